@@ -17,6 +17,7 @@ import (
 	"github.com/amannvl/freefileconverterz/pkg/config"
 	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
 	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 	"github.com/amannvl/freefileconverterz/pkg/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -142,7 +143,7 @@ func NewConverterAdapter(factory *factory.ConverterFactory, logger utils.Logger)
 }
 
 // Convert implements the iface.Converter interface
-func (c *converterAdapter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *converterAdapter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Get the appropriate converter
 	sourceExt := strings.TrimPrefix(filepath.Ext(inputPath), ".")
 	targetExt := strings.TrimPrefix(filepath.Ext(outputPath), ".")
@@ -151,13 +152,13 @@ func (c *converterAdapter) Convert(ctx context.Context, inputPath, outputPath st
 	}
 
 	// Get the converter for the source and target formats
-	conv, err := c.factory.GetConverter(sourceExt, targetExt)
+	conv, err := c.factory.GetConverter(sourceExt, targetExt, opts)
 	if err != nil {
 		return fmt.Errorf("failed to get converter: %w", err)
 	}
 
 	// Perform the conversion
-	return conv.Convert(ctx, inputPath, outputPath)
+	return conv.Convert(ctx, inputPath, outputPath, opts)
 }
 
 // Cleanup implements the iface.Converter interface
@@ -173,28 +174,25 @@ func (c *converterAdapter) Cleanup(files ...string) error {
 // SupportsConversion implements the iface.Converter interface
 func (c *converterAdapter) SupportsConversion(sourceFormat, targetFormat string) bool {
 	// Get the converter for the source and target formats
-	_, err := c.factory.GetConverter(sourceFormat, targetFormat)
+	_, err := c.factory.GetConverter(sourceFormat, targetFormat, iface.Options{})
 	return err == nil
 }
 
 // SupportedFormats returns a map of supported source formats to target formats
 func (c *converterAdapter) SupportedFormats() map[string][]string {
-	// TODO: Implement this by aggregating formats from all available converters
-	return map[string][]string{
-		"jpg":  {"png", "webp"},
-		"jpeg": {"png", "webp"},
-		"png":  {"jpg", "webp"},
-		"webp": {"jpg", "png"},
-	}
+	return c.factory.SupportedFormats()
 }
 
-// ValidateOptions validates the conversion options
-func (c *converterAdapter) ValidateOptions(options map[string]interface{}) error {
-	// TODO: Implement proper validation based on the converter type
-	if format, ok := options["format"]; !ok || format == "" {
-		return fmt.Errorf("output format is required")
-	}
-	return nil
+// Catalog describes every supported format grouped by category
+func (c *converterAdapter) Catalog() map[string]registry.CategoryInfo {
+	return c.factory.Catalog()
+}
+
+// ValidateOptions implements the iface.Converter interface. The formats are
+// not known yet, so only the option values are checked here; the per-converter
+// schema is enforced when Convert resolves the converter.
+func (c *converterAdapter) ValidateOptions(opts iface.Options) error {
+	return opts.Validate()
 }
 
 // setupRouter configures the HTTP routes
@@ -255,6 +253,7 @@ func setupRouter(conv iface.Converter, storage *storage.FileStorage, logger util
 	{
 		// File conversion
 		v1.POST("/convert", handler.ConvertFile)
+		v1.GET("/formats", handler.GetSupportedFormats)
 
 		// TODO: Add other endpoints as they are implemented
 	}
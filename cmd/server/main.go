@@ -12,12 +12,20 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/amannvl/freefileconverterz/internal/cache"
 	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/fetch"
 	"github.com/amannvl/freefileconverterz/internal/handlers"
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/internal/queue"
 	"github.com/amannvl/freefileconverterz/internal/service"
 	"github.com/amannvl/freefileconverterz/internal/storage"
 	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/internal/uploads"
+	"github.com/amannvl/freefileconverterz/internal/webhooks"
+	"github.com/amannvl/freefileconverterz/pkg/converter/archive"
 	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
+	"github.com/amannvl/freefileconverterz/pkg/converter/image"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -150,8 +158,10 @@ func main() {
 			fiber.MethodPut,
 			fiber.MethodDelete,
 			fiber.MethodPatch,
+			fiber.MethodOptions,
 		}, ","),
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, X-Archive-Password",
+		ExposeHeaders:    "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Upload-Key",
 	}
 
 	// Only set AllowCredentials to true if we have specific origins
@@ -204,8 +214,69 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Archive entries are checked before they are written, archives exceeding these limits are rejected
+	converterFactory.SetArchiveLimits(archive.Limits{
+		MaxEntries: cfg.Archive.MaxEntries,
+		MaxSize:    cfg.Archive.MaxSize,
+		MaxRatio:   cfg.Archive.MaxRatio,
+		MaxDepth:   cfg.Archive.MaxDepth,
+	})
+
+	// Images are converted natively when ImageMagick is missing, or for small inputs
+	if err := converterFactory.SetImageBackend(image.Backend{
+		Name:          cfg.Image.Backend,
+		NativeMaxSize: cfg.Image.NativeMaxSize,
+	}); err != nil {
+		slog.Error("Invalid image backend", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize the job store so conversion state survives restarts
+	jobStore, err := jobs.NewJobStore(cfg.JobStore)
+	if err != nil {
+		slog.Error("Failed to open job store", "error", err)
+		os.Exit(1)
+	}
+	defer jobStore.Close()
+
+	// Conversions a previous run left unfinished cannot be resumed
+	if failed, err := jobs.FailInterrupted(context.Background(), jobStore, time.Now()); err != nil {
+		slog.Error("Failed to mark interrupted conversions", "error", err)
+	} else if failed > 0 {
+		slog.Warn("Marked interrupted conversions as failed", "count", failed)
+	}
+
+	// Background conversions run on bounded per-category worker pools
+	jobQueue := queue.New(cfg.Queue, log)
+
+	// Callbacks are signed and delivered in the background, attempts are
+	// recorded on the conversion
+	webhookDispatcher, err := webhooks.NewDispatcher(cfg.Webhooks, webhooks.NewJobLog(jobStore), log)
+	if err != nil {
+		slog.Error("Failed to configure webhook callbacks", "error", err)
+		os.Exit(1)
+	}
+
+	// Resumable uploads are kept in storage, expired ones are removed hourly
+	uploadManager := uploads.NewManager(storageImpl, cfg.Storage, log)
+	uploadManager.Start(1 * time.Hour)
+	defer uploadManager.Stop()
+
+	// Remote sources (source_url) are downloaded without access to private networks
+	sourceFetcher, err := fetch.NewFetcher(cfg.Fetch)
+	if err != nil {
+		slog.Error("Failed to configure source URL downloads", "error", err)
+		os.Exit(1)
+	}
+
+	// Outputs are shared by identical conversions, unreferenced ones are
+	// removed hourly once unused for RESULT_CACHE_TTL
+	resultCache := cache.NewCache(storageImpl, cfg.Cache, log)
+	resultCache.Start(1 * time.Hour)
+	defer resultCache.Stop()
+
 	// Setup API routes
-	handlers.SetupRoutes(app, cfg, storageImpl, converterFactory, log)
+	handlers.SetupRoutes(app, cfg, storageImpl, converterFactory, jobStore, jobQueue, webhookDispatcher, uploadManager, sourceFetcher, resultCache, log)
 
 	// Setup static files after API routes
 	app.Static("/", "./static")
@@ -248,14 +319,23 @@ func main() {
 		slog.Error("Server forced to shutdown:", "error", err)
 	}
 
-	// Clean up temp files on shutdown
-	slog.Info("Cleaning up temporary files...")
-	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cleanupCancel()
-	
-	if err := storageImpl.Cleanup(cleanupCtx, 0); err != nil { // Clean up all temporary files
-		slog.Error("Failed to clean up temp files", "error", err)
+	// Let queued and running conversions finish before the job store closes
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer drainCancel()
+	if err := jobQueue.Shutdown(drainCtx); err != nil {
+		slog.Error("Conversion queue did not drain in time", "error", err)
 	}
 
+	// Deliver the callbacks of the last conversions
+	webhookCtx, webhookCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer webhookCancel()
+	if err := webhookDispatcher.Shutdown(webhookCtx); err != nil {
+		slog.Error("Webhook deliveries did not finish in time", "error", err)
+	}
+
+	// Stored files outlive the process: outputs are shared through the result
+	// cache and removed once unreferenced, resumable uploads once expired.
+	// Working directories of conversions are removed as their jobs end.
+
 	slog.Info("Server gracefully stopped")
 }
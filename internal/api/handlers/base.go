@@ -74,3 +74,19 @@ func (h *BaseHandler) getOutputFormat(c *gin.Context) (string, error) {
 
 	return format, nil
 }
+
+// getOptions parses the optional JSON conversion options from the request
+func (h *BaseHandler) getOptions(c *gin.Context) (iface.Options, error) {
+	var opts iface.Options
+	rawOptions := c.PostForm("options")
+	if rawOptions == "" {
+		return opts, nil
+	}
+
+	opts, err := iface.ParseOptions([]byte(rawOptions))
+	if err != nil {
+		return opts, err
+	}
+
+	return opts, h.converter.ValidateOptions(opts)
+}
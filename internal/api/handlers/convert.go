@@ -10,6 +10,7 @@ import (
 
 	"github.com/amannvl/freefileconverterz/internal/storage"
 	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 	"github.com/amannvl/freefileconverterz/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -49,6 +50,16 @@ func (h *ConvertHandler) ConvertFile(c *gin.Context) {
 
 	h.logger.Info("Requested output format", "format", outputFormat)
 
+	// Get and validate the conversion options
+	opts, err := h.getOptions(c)
+	if err != nil {
+		h.logger.Error("Invalid conversion options", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// Save the uploaded file
 	inputFilename, err := h.storage.SaveFile(file)
 	if err != nil {
@@ -137,7 +148,7 @@ func (h *ConvertHandler) ConvertFile(c *gin.Context) {
 	// Perform the conversion
 	h.logger.Info("Calling converter.Convert")
 	conversionStart := time.Now()
-	err = h.converter.Convert(ctx, inputPath, outputPath)
+	err = h.converter.Convert(ctx, inputPath, outputPath, opts)
 	conversionDuration := time.Since(conversionStart)
 
 	h.logger.Info("Converter.Convert completed", 
@@ -219,27 +230,22 @@ func (h *ConvertHandler) ConvertFile(c *gin.Context) {
 	}()
 }
 
+// FormatCatalog is implemented by converters that can describe their supported formats
+type FormatCatalog interface {
+	Catalog() map[string]registry.CategoryInfo
+}
+
 // GetSupportedFormats returns the list of supported conversion formats
 func (h *ConvertHandler) GetSupportedFormats(c *gin.Context) {
-	// This would be populated from the converter package
-	formats := map[string]map[string][]string{
-		"documents": {
-			"input":  {"pdf", "docx", "doc", "odt", "txt", "rtf"},
-			"output": {"pdf", "docx", "odt", "txt", "rtf"},
-		},
-		"images": {
-			"input":  {"jpg", "jpeg", "png", "gif", "webp", "bmp"},
-			"output": {"jpg", "jpeg", "png", "gif", "webp", "bmp"},
-		},
-		"archives": {
-			"input":  {"zip", "tar", "gz", "7z", "rar"},
-			"output": {"zip", "tar", "gz", "7z"},
-		},
+	catalog, ok := h.converter.(FormatCatalog)
+	if !ok {
+		h.handleError(c, fmt.Errorf("converter does not provide a format catalog"))
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    formats,
+		"data":    catalog.Catalog(),
 	})
 }
 
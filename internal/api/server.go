@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,7 +12,8 @@ import (
 	"time"
 
 	"github.com/amannvl/freefileconverterz/internal/storage"
-	"github.com/amannvl/freefileconverterz/pkg/converter"
+	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -22,7 +24,7 @@ type Config struct {
 	Port         string
 	Environment  string
 	FileStorage  *storage.FileStorage
-	Converter    *converter.ConverterFactory
+	Converter    *factory.ConverterFactory
 	JWTSecret    string
 	RateLimit    int
 	RateBurst    int
@@ -204,9 +206,32 @@ func (s *Server) handleConvert(c *gin.Context) {
 	// Remove the leading dot from the extension
 	ext = strings.TrimPrefix(ext, ".")
 
+	// Parse the optional conversion options
+	var opts iface.Options
+	if rawOptions := c.PostForm("options"); rawOptions != "" {
+		var err error
+		if opts, err = iface.ParseOptions([]byte(rawOptions)); err != nil {
+			var convErr *iface.ConversionError
+			errors.As(err, &convErr)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": convErr.Message,
+				"code":  convErr.Code,
+			})
+			return
+		}
+	}
+
 	// Get the appropriate converter
-	converter, err := s.config.Converter.GetConverter(ext, targetFormat)
+	converter, err := s.config.Converter.GetConverter(ext, targetFormat, opts)
 	if err != nil {
+		var convErr *iface.ConversionError
+		if errors.As(err, &convErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": convErr.Message,
+				"code":  convErr.Code,
+			})
+			return
+		}
 		s.logger.Error().Err(err).Str("source", ext).Str("target", targetFormat).Msg("Failed to get converter")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("Conversion from %s to %s is not supported", ext, targetFormat),
@@ -255,7 +280,7 @@ func (s *Server) handleConvert(c *gin.Context) {
 	defer cancel()
 
 	// Perform the conversion
-	err = converter.Convert(ctx, srcPath, dstPath)
+	err = converter.Convert(ctx, srcPath, dstPath, opts)
 	if err != nil {
 		s.logger.Error().Err(err).Str("source", ext).Str("target", targetFormat).Msg("Conversion failed")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -285,28 +310,10 @@ func (s *Server) handleConvert(c *gin.Context) {
 	c.Data(http.StatusOK, http.DetectContentType(result), result)
 }
 
-// handleGetFormats returns the supported file formats
+// handleGetFormats returns the supported file formats from the converter registry
 func (s *Server) handleGetFormats(c *gin.Context) {
-	// TODO: Return supported formats from converter factory
 	c.JSON(http.StatusOK, gin.H{
-		"data": map[string]interface{}{
-			"document": map[string][]string{
-				"input":  {"pdf", "docx", "doc", "odt"},
-				"output": {"pdf", "docx", "odt", "txt"},
-			},
-			"image": map[string][]string{
-				"input":  {"jpg", "jpeg", "png", "webp", "gif", "bmp"},
-				"output": {"jpg", "png", "webp", "gif"},
-			},
-			"audio": map[string][]string{
-				"input":  {"mp3", "wav", "ogg", "flac", "aac"},
-				"output": {"mp3", "wav", "ogg", "flac"},
-			},
-			"video": map[string][]string{
-				"input":  {"mp4", "webm", "mov", "avi", "mkv"},
-				"output": {"mp4", "webm", "mov"},
-			},
-		},
+		"data": s.config.Converter.Catalog(),
 	})
 }
 
@@ -9,7 +9,7 @@ import (
 	"github.com/amannvl/freefileconverterz/internal/api"
 	"github.com/amannvl/freefileconverterz/internal/config"
 	"github.com/amannvl/freefileconverterz/internal/storage"
-	"github.com/amannvl/freefileconverterz/pkg/converter"
+	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
 	"github.com/amannvl/freefileconverterz/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
@@ -40,7 +40,7 @@ func New(cfg *config.Config) (*App, error) {
 	}
 
 	// Initialize converter factory
-	converterFactory, err := converter.NewConverterFactory(cfg.Storage.TempDir, nil)
+	converterFactory, err := factory.NewConverterFactory(cfg.Storage.TempDir, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize converter factory: %w", err)
 	}
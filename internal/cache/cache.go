@@ -0,0 +1,410 @@
+// Package cache reuses conversion results. Outputs are stored under a key
+// derived from the SHA-256 of the input, the target format, the options and
+// the converter and tool versions, together with the number of conversions
+// referencing them. An output is only removed once no conversion references
+// it and it has not been used for the configured TTL.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// prefix is the storage prefix of cached results
+const prefix = "results"
+
+// entrySuffix is the suffix of the stored entries next to the outputs
+const entrySuffix = ".entry"
+
+var (
+	// ErrMiss is returned when no result is cached for a key
+	ErrMiss = errors.New("no cached result")
+	// ErrNotCached is returned when releasing a storage key that is not a
+	// cached output, e.g. an output stored before the cache existed
+	ErrNotCached = errors.New("not a cached output")
+)
+
+// Entry is a cached output and the number of conversions referencing it
+type Entry struct {
+	Key        string    `json:"key"`
+	OutputKey  string    `json:"output_key"`
+	Size       int64     `json:"size"`
+	RefCount   int       `json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+
+	// Result is what the converter reported about the output
+	Result iface.Result `json:"result"`
+}
+
+// Stats are the lookups since the server started
+type Stats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Cache stores conversion outputs for reuse
+type Cache struct {
+	storage storage.Storage
+	ttl     time.Duration
+	logger  *slog.Logger
+	now     func() time.Time
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	mu    sync.Mutex
+	locks map[string]*entryLock
+
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// NewCache creates a Cache storing results in store
+func NewCache(store storage.Storage, cfg config.CacheConfig, logger *slog.Logger) *Cache {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Cache{
+		storage: store,
+		ttl:     cfg.TTL,
+		logger:  logger,
+		now:     time.Now,
+		locks:   make(map[string]*entryLock),
+	}
+}
+
+// Key derives the cache key of a conversion from the SHA-256 of its input,
+// the target format, the options and the converter fingerprint
+func Key(inputDigest, targetFormat string, opts iface.Options, fingerprint string) (string, error) {
+	// Options marshal with their fields in a fixed order and unset fields
+	// omitted, so equal options always give the same key. The password is
+	// part of them, so an output is only reused with the same password.
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode options: %w", err)
+	}
+
+	h := sha256.New()
+	for _, part := range []string{inputDigest, strings.ToLower(targetFormat), string(options), fingerprint} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashFile returns the hex encoded SHA-256 of a file
+func HashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Acquire returns the cached result of key and adds a reference to it. It
+// returns ErrMiss if there is none.
+func (c *Cache) Acquire(ctx context.Context, key string) (*Entry, error) {
+	unlock := c.lock(key)
+	defer unlock()
+
+	entry, err := c.load(ctx, key)
+	if errors.Is(err, ErrMiss) {
+		c.misses.Add(1)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The entry may outlive its output if storage was cleaned up directly
+	if exists, err := c.storage.Exists(ctx, entry.OutputKey); err != nil {
+		return nil, err
+	} else if !exists {
+		c.remove(ctx, entry)
+		c.misses.Add(1)
+		return nil, ErrMiss
+	}
+
+	entry.RefCount++
+	entry.LastUsedAt = c.now()
+	if err := c.save(ctx, entry); err != nil {
+		return nil, err
+	}
+	c.hits.Add(1)
+	return entry, nil
+}
+
+// Put stores the output of key, read from r, with one reference. If an
+// identical conversion stored its output in the meantime, that output is
+// referenced instead. ext is the extension of the output, including the dot,
+// and result what the converter reported about it.
+func (c *Cache) Put(ctx context.Context, key string, r io.Reader, ext string, result iface.Result) (*Entry, error) {
+	unlock := c.lock(key)
+	defer unlock()
+
+	now := c.now()
+	refs := 0
+	entry, err := c.load(ctx, key)
+	switch {
+	case err == nil:
+		exists, err := c.storage.Exists(ctx, entry.OutputKey)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			entry.RefCount++
+			entry.LastUsedAt = now
+			return entry, c.save(ctx, entry)
+		}
+		// The output was removed from storage, store it again
+		refs = entry.RefCount
+	case !errors.Is(err, ErrMiss):
+		return nil, err
+	}
+
+	entry = &Entry{
+		Key:        key,
+		OutputKey:  prefix + "/" + key + ext,
+		Result:     result,
+		RefCount:   refs + 1,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+	counter := &countingReader{r: r}
+	if _, err := c.storage.Save(ctx, entry.OutputKey, counter); err != nil {
+		c.storage.Delete(context.Background(), entry.OutputKey)
+		return nil, fmt.Errorf("failed to store output: %w", err)
+	}
+	entry.Size = counter.n
+
+	if err := c.save(ctx, entry); err != nil {
+		c.storage.Delete(context.Background(), entry.OutputKey)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Release removes a reference to a cached output. The output is kept for
+// reuse until RemoveUnused finds it unreferenced and unused for the TTL.
+func (c *Cache) Release(ctx context.Context, outputKey string) error {
+	key, ok := keyOf(outputKey)
+	if !ok {
+		return ErrNotCached
+	}
+
+	unlock := c.lock(key)
+	defer unlock()
+
+	entry, err := c.load(ctx, key)
+	if errors.Is(err, ErrMiss) {
+		return ErrNotCached
+	}
+	if err != nil {
+		return err
+	}
+	if entry.OutputKey != outputKey {
+		return ErrNotCached
+	}
+
+	entry.RefCount = max(entry.RefCount-1, 0)
+	entry.LastUsedAt = c.now()
+	return c.save(ctx, entry)
+}
+
+// Stats returns the hits and misses since the cache was created
+func (c *Cache) Stats() Stats {
+	stats := Stats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// RemoveUnused removes the outputs no conversion references that have not
+// been used for the TTL and returns how many were removed
+func (c *Cache) RemoveUnused(ctx context.Context) (int, error) {
+	files, err := c.storage.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := c.now().Add(-c.ttl)
+	for _, file := range files {
+		name := path.Base(filepath.ToSlash(file.Name))
+		if !strings.HasSuffix(name, entrySuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(name, entrySuffix)
+
+		unlock := c.lock(key)
+		entry, err := c.load(ctx, key)
+		if err == nil && entry.RefCount == 0 && entry.LastUsedAt.Before(cutoff) {
+			c.remove(ctx, entry)
+			removed++
+		}
+		unlock()
+	}
+	return removed, nil
+}
+
+// Start removes unused outputs in the background every interval
+func (c *Cache) Start(interval time.Duration) {
+	c.ticker = time.NewTicker(interval)
+	c.done = make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-c.ticker.C:
+				removed, err := c.RemoveUnused(context.Background())
+				if err != nil {
+					c.logger.Error("Failed to remove unused cached results", "error", err)
+				} else if removed > 0 {
+					c.logger.Info("Removed unused cached results", "count", removed)
+				}
+			case <-c.done:
+				c.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background removal of unused outputs
+func (c *Cache) Stop() {
+	if c.done != nil {
+		close(c.done)
+	}
+}
+
+// remove deletes an entry and its output
+func (c *Cache) remove(ctx context.Context, entry *Entry) {
+	if err := c.storage.Delete(ctx, entry.OutputKey); err != nil {
+		c.logger.Warn("Failed to remove cached output", "error", err, "key", entry.Key)
+	}
+	if err := c.storage.Delete(ctx, entryKey(entry.Key)); err != nil {
+		c.logger.Warn("Failed to remove cache entry", "error", err, "key", entry.Key)
+	}
+}
+
+func (c *Cache) load(ctx context.Context, key string) (*Entry, error) {
+	exists, err := c.storage.Exists(ctx, entryKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMiss
+	}
+
+	data, err := c.storage.Read(ctx, entryKey(key))
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cache entry %s: %w", key, err)
+	}
+	return &entry, nil
+}
+
+func (c *Cache) save(ctx context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry %s: %w", entry.Key, err)
+	}
+	// A reader, S3 storage does not save byte slices
+	if _, err := c.storage.Save(ctx, entryKey(entry.Key), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to store cache entry %s: %w", entry.Key, err)
+	}
+	return nil
+}
+
+// entryLock is the lock of one key and the number of callers holding or
+// waiting for it
+type entryLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock serializes the operations on one key
+func (c *Cache) lock(key string) func() {
+	c.mu.Lock()
+	l, ok := c.locks[key]
+	if !ok {
+		l = &entryLock{}
+		c.locks[key] = l
+	}
+	l.users++
+	c.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mu.Lock()
+		// Keep the lock while others wait for it
+		if l.users--; l.users == 0 {
+			delete(c.locks, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func entryKey(key string) string {
+	return prefix + "/" + key + entrySuffix
+}
+
+// keyOf returns the cache key of a cached output's storage key
+func keyOf(outputKey string) (string, bool) {
+	name, ok := strings.CutPrefix(outputKey, prefix+"/")
+	if !ok || strings.Contains(name, "/") {
+		return "", false
+	}
+	// The extension may have several parts, e.g. .tar.gz
+	key, _, _ := strings.Cut(name, ".")
+	if len(key) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
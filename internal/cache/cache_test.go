@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) (*Cache, storage.Storage) {
+	store, err := storage.NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir()})
+	require.NoError(t, err)
+	return NewCache(store, config.CacheConfig{TTL: time.Hour}, nil), store
+}
+
+// readerStorage saves readers only, like S3 storage
+type readerStorage struct {
+	storage.Storage
+}
+
+func (s readerStorage) Save(ctx context.Context, path string, file interface{}) (string, error) {
+	if _, ok := file.(io.Reader); !ok {
+		return "", errors.New("unsupported file type")
+	}
+	return s.Storage.Save(ctx, path, file)
+}
+
+func TestKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("%PDF-1.4"), 0644))
+	digest, err := HashFile(path)
+	require.NoError(t, err)
+	assert.Len(t, digest, 64)
+
+	key, err := Key(digest, "docx", iface.Options{Quality: 80}, "document:pdf>docx:libreoffice:7.6")
+	require.NoError(t, err)
+
+	same, err := Key(digest, "DOCX", iface.Options{Quality: 80}, "document:pdf>docx:libreoffice:7.6")
+	require.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	for _, other := range []struct {
+		target      string
+		opts        iface.Options
+		fingerprint string
+	}{
+		{"odt", iface.Options{Quality: 80}, "document:pdf>docx:libreoffice:7.6"},
+		{"docx", iface.Options{Quality: 90}, "document:pdf>docx:libreoffice:7.6"},
+		{"docx", iface.Options{Quality: 80}, "document:pdf>docx:libreoffice:24.2"},
+	} {
+		differs, err := Key(digest, other.target, other.opts, other.fingerprint)
+		require.NoError(t, err)
+		assert.NotEqual(t, key, differs)
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	c, store := newTestCache(t)
+	key := strings.Repeat("ab", 32)
+
+	_, err := c.Acquire(ctx, key)
+	assert.ErrorIs(t, err, ErrMiss)
+
+	entry, err := c.Put(ctx, key, strings.NewReader("converted"), ".tar.gz", iface.Result{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.RefCount)
+	assert.EqualValues(t, 9, entry.Size)
+
+	hit, err := c.Acquire(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, entry.OutputKey, hit.OutputKey)
+	assert.Equal(t, 2, hit.RefCount)
+
+	// A concurrent identical conversion references the existing output
+	again, err := c.Put(ctx, key, strings.NewReader("other"), ".tar.gz", iface.Result{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, again.RefCount)
+	data, err := store.Read(ctx, entry.OutputKey)
+	require.NoError(t, err)
+	assert.Equal(t, "converted", string(data))
+
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, HitRate: 0.5}, c.Stats())
+
+	// Referenced outputs are kept however old they are
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	removed, err := c.RemoveUnused(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Release(ctx, entry.OutputKey))
+	}
+	assert.ErrorIs(t, c.Release(ctx, "0123abcd.pdf"), ErrNotCached)
+
+	// Unreferenced outputs are kept for the TTL after their last use
+	removed, err = c.RemoveUnused(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	c.now = func() time.Time { return time.Now().Add(4 * time.Hour) }
+	removed, err = c.RemoveUnused(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	exists, err := store.Exists(ctx, entry.OutputKey)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = c.Acquire(ctx, key)
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestCacheMissingOutput(t *testing.T) {
+	ctx := context.Background()
+	c, store := newTestCache(t)
+	key := strings.Repeat("cd", 32)
+
+	entry, err := c.Put(ctx, key, strings.NewReader("converted"), ".zip", iface.Result{Format: "zip", Pages: 3})
+	require.NoError(t, err)
+	assert.Equal(t, iface.Result{Format: "zip", Pages: 3}, entry.Result)
+	require.NoError(t, store.Delete(ctx, entry.OutputKey))
+
+	_, err = c.Acquire(ctx, key)
+	assert.ErrorIs(t, err, ErrMiss)
+
+	entry, err = c.Put(ctx, key, strings.NewReader("again"), ".zip", iface.Result{Format: "zip", Pages: 3})
+	require.NoError(t, err)
+	r, err := store.Get(ctx, entry.OutputKey)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "again", string(data))
+}
+
+func TestCacheReaderStorage(t *testing.T) {
+	ctx := context.Background()
+	local, err := storage.NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir()})
+	require.NoError(t, err)
+	c := NewCache(readerStorage{local}, config.CacheConfig{TTL: time.Hour}, nil)
+	key := strings.Repeat("ef", 32)
+
+	entry, err := c.Put(ctx, key, strings.NewReader("converted"), ".pdf", iface.Result{})
+	require.NoError(t, err)
+	hit, err := c.Acquire(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, hit.RefCount)
+	assert.NoError(t, c.Release(ctx, entry.OutputKey))
+}
@@ -19,6 +19,13 @@ type Config struct {
 	Redis    RedisConfig
 	JWT      JWTConfig
 	Storage  StorageConfig
+	JobStore JobStoreConfig
+	Queue    QueueConfig
+	Webhooks WebhookConfig
+	Fetch    FetchConfig
+	Cache    CacheConfig
+	Archive  ArchiveConfig
+	Image    ImageConfig
 	Security SecurityConfig
 	Logging  LoggingConfig
 }
@@ -82,6 +89,61 @@ type StorageConfig struct {
 	S3SecretAccessKey string        `mapstructure:"S3_SECRET_ACCESS_KEY"`
 	S3Endpoint        string        `mapstructure:"S3_ENDPOINT"`
 	S3UseSSL          bool          `mapstructure:"S3_USE_SSL"`
+	ResumableMaxSize    int64         `mapstructure:"RESUMABLE_UPLOAD_MAX_SIZE"`   // Largest resumable upload
+	ResumableExpiration time.Duration `mapstructure:"RESUMABLE_UPLOAD_EXPIRATION"` // Idle time before an incomplete upload is removed
+	SignedURLSecret     string        `mapstructure:"SIGNED_URL_SECRET"`           // HMAC key of local download links, random per process if empty
+	SignedURLTTL        time.Duration `mapstructure:"SIGNED_URL_TTL"`              // Validity of download links in status responses
+}
+
+// JobStoreConfig holds conversion job store configuration
+type JobStoreConfig struct {
+	Driver string // "bolt" or "memory"
+	Path   string // Database file for the bolt driver
+}
+
+// QueueConfig holds background conversion queue configuration
+type QueueConfig struct {
+	Workers        map[string]int // Workers per converter category
+	DefaultWorkers int            // Workers for categories without an explicit count
+	MaxDepth       int            // Waiting jobs per category before new jobs are rejected
+	MaxBatchSize   int            // Files accepted by a single batch request
+}
+
+// WebhookConfig holds conversion callback configuration
+type WebhookConfig struct {
+	Secrets     map[string]string // Signing secret per API key
+	MaxAttempts int               // Delivery attempts before a callback is given up
+	Backoff     time.Duration     // Delay before the first retry, doubled for each further retry
+	MaxBackoff  time.Duration     // Upper bound for the retry delay
+	Timeout     time.Duration     // Timeout of a single delivery attempt
+	Allowlist   []string          // CIDR ranges, addresses and host names exempt from the private address block
+}
+
+// FetchConfig holds configuration for conversions of remote source URLs
+type FetchConfig struct {
+	MaxSize      int64         // Largest source that is downloaded
+	Timeout      time.Duration // Timeout of a whole download
+	MaxRedirects int           // Redirects followed per request
+	Allowlist    []string      // CIDR ranges, addresses and host names exempt from the private address block
+}
+
+// CacheConfig holds configuration of the conversion result cache
+type CacheConfig struct {
+	TTL time.Duration // Time an output no conversion references is kept for reuse
+}
+
+// ArchiveConfig holds the limits archives are checked against before they are extracted
+type ArchiveConfig struct {
+	MaxEntries int   // Files, directories and links in an archive
+	MaxSize    int64 // Total uncompressed size
+	MaxRatio   int   // Uncompressed bytes per archive byte
+	MaxDepth   int   // Directory levels of an entry path
+}
+
+// ImageConfig holds how image conversions choose their backend
+type ImageConfig struct {
+	Backend       string // auto, imagemagick or native
+	NativeMaxSize int64  // With auto, inputs up to this size skip ImageMagick, 0 disables it
 }
 
 // SecurityConfig holds security-related configuration
@@ -173,6 +235,54 @@ func Load() (*Config, error) {
 			S3SecretAccessKey: getEnv("S3_SECRET_KEY", ""),
 			S3Endpoint:        getEnv("S3_ENDPOINT", ""),
 			S3UseSSL:          getEnvAsBool("S3_USE_SSL", true),
+			ResumableMaxSize:    getEnvAsInt64("RESUMABLE_UPLOAD_MAX_SIZE", 10<<30), // 10GB
+			ResumableExpiration: getEnvAsDuration("RESUMABLE_UPLOAD_EXPIRATION", 24*time.Hour),
+			SignedURLSecret:     getEnv("SIGNED_URL_SECRET", ""),
+			SignedURLTTL:        getEnvAsDuration("SIGNED_URL_TTL", time.Hour),
+		},
+		JobStore: JobStoreConfig{
+			Driver: getEnv("JOB_STORE_DRIVER", "bolt"),
+			Path:   getEnv("JOB_STORE_PATH", "/tmp/freefileconverterz/jobs.db"),
+		},
+		Queue: QueueConfig{
+			Workers: map[string]int{
+				// LibreOffice cannot run concurrent conversions with one user profile
+				"document": getEnvAsInt("QUEUE_WORKERS_DOCUMENT", 1),
+				"video":    getEnvAsInt("QUEUE_WORKERS_VIDEO", 2),
+				"audio":    getEnvAsInt("QUEUE_WORKERS_AUDIO", 2),
+				"image":    getEnvAsInt("QUEUE_WORKERS_IMAGE", 4),
+				"archive":  getEnvAsInt("QUEUE_WORKERS_ARCHIVE", 2),
+			},
+			DefaultWorkers: getEnvAsInt("QUEUE_WORKERS_DEFAULT", 2),
+			MaxDepth:       getEnvAsInt("QUEUE_MAX_DEPTH", 50),
+			MaxBatchSize:   getEnvAsInt("QUEUE_MAX_BATCH_SIZE", 20),
+		},
+		Webhooks: WebhookConfig{
+			Secrets:     getEnvAsMap("WEBHOOK_SECRETS", ",", "="),
+			MaxAttempts: getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 5),
+			Backoff:     getEnvAsDuration("WEBHOOK_BACKOFF", 5*time.Second),
+			MaxBackoff:  getEnvAsDuration("WEBHOOK_MAX_BACKOFF", 5*time.Minute),
+			Timeout:     getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			Allowlist:   getEnvAsSlice("WEBHOOK_ALLOWLIST", ",", nil),
+		},
+		Fetch: FetchConfig{
+			MaxSize:      getEnvAsInt64("SOURCE_URL_MAX_SIZE", 1<<30), // 1GB
+			Timeout:      getEnvAsDuration("SOURCE_URL_TIMEOUT", 10*time.Minute),
+			MaxRedirects: getEnvAsInt("SOURCE_URL_MAX_REDIRECTS", 5),
+			Allowlist:    getEnvAsSlice("SOURCE_URL_ALLOWLIST", ",", nil),
+		},
+		Cache: CacheConfig{
+			TTL: getEnvAsDuration("RESULT_CACHE_TTL", 24*time.Hour),
+		},
+		Archive: ArchiveConfig{
+			MaxEntries: getEnvAsInt("ARCHIVE_MAX_ENTRIES", 10000),
+			MaxSize:    getEnvAsInt64("ARCHIVE_MAX_SIZE", 2<<30), // 2GB
+			MaxRatio:   getEnvAsInt("ARCHIVE_MAX_RATIO", 100),
+			MaxDepth:   getEnvAsInt("ARCHIVE_MAX_DEPTH", 32),
+		},
+		Image: ImageConfig{
+			Backend:       getEnv("IMAGE_BACKEND", "auto"),
+			NativeMaxSize: getEnvAsInt64("IMAGE_NATIVE_MAX_SIZE", 0),
 		},
 		Security: SecurityConfig{
 			RateLimit:          getEnvAsInt("RATE_LIMIT", 100),
@@ -263,6 +373,20 @@ func getEnvAsSlice(name string, separator string, defaultVal []string) []string
 	return values
 }
 
+// Helper function to read an environment variable as key/value pairs,
+// e.g. "key1=value1,key2=value2"
+func getEnvAsMap(name, separator, kvSeparator string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvAsSlice(name, separator, nil) {
+		key, value, ok := strings.Cut(pair, kvSeparator)
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
 // GetDSN returns the database connection string
 func (c *DatabaseConfig) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -0,0 +1,195 @@
+// Package events fans conversion progress out to the clients watching a job
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+)
+
+// Event types
+const (
+	TypeStatus   = "status"
+	TypeProgress = "progress"
+	TypeResult   = "result"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber. Progress
+// events are dropped for subscribers that fall further behind.
+const subscriberBuffer = 32
+
+// Event is a conversion update pushed to clients
+type Event struct {
+	Type   string                  `json:"type"`
+	Status models.ConversionStatus `json:"status"`
+	iface.Progress
+	// ETASeconds estimates the remaining time from the progress made so far
+	ETASeconds *int `json:"eta_seconds,omitempty"`
+	// Conversion is the final conversion record, sent with the result event
+	Conversion *models.Conversion `json:"conversion,omitempty"`
+}
+
+// Broker delivers the events of each conversion to its subscribers
+type Broker struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+	now     func() time.Time
+}
+
+// stream holds the subscribers of one conversion
+type stream struct {
+	subscribers map[chan Event]struct{}
+	started     time.Time
+	latest      iface.Progress
+}
+
+// NewBroker creates a new Broker
+func NewBroker() *Broker {
+	return &Broker{
+		streams: make(map[string]*stream),
+		now:     time.Now,
+	}
+}
+
+// Subscribe returns a channel receiving the events of a conversion and a
+// function that unsubscribes. The channel is closed after the result event.
+func (b *Broker) Subscribe(id string) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	b.stream(id).subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if s, ok := b.streams[id]; ok {
+			if _, ok := s.subscribers[ch]; ok {
+				delete(s.subscribers, ch)
+				close(ch)
+			}
+			// Keep the stream of a running conversion for its ETA
+			if len(s.subscribers) == 0 && s.started.IsZero() {
+				delete(b.streams, id)
+			}
+		}
+	}
+}
+
+// Status publishes a status change
+func (b *Broker) Status(id string, status models.ConversionStatus) {
+	b.publish(id, Event{Type: TypeStatus, Status: status})
+}
+
+// Progress publishes converter progress, adding an ETA once the conversion
+// has measurably advanced
+func (b *Broker) Progress(id string, progress iface.Progress) {
+	b.mu.Lock()
+	s := b.stream(id)
+	if s.started.IsZero() {
+		s.started = b.now()
+	}
+	s.latest = progress
+	started := s.started
+	b.mu.Unlock()
+
+	event := Event{Type: TypeProgress, Status: models.StatusProcessing, Progress: progress}
+	if progress.Percent > 0 && progress.Percent < 100 {
+		elapsed := b.now().Sub(started)
+		eta := int((elapsed.Seconds() * (100 - progress.Percent) / progress.Percent) + 0.5)
+		event.ETASeconds = &eta
+	}
+	b.publish(id, event)
+}
+
+// Latest returns the last progress reported for a running conversion
+func (b *Broker) Latest(id string) (iface.Progress, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[id]
+	if !ok || s.started.IsZero() {
+		return iface.Progress{}, false
+	}
+	return s.latest, true
+}
+
+// Finish publishes the final conversion record and closes the subscriber channels
+func (b *Broker) Finish(conv *models.Conversion) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[conv.ID]
+	if !ok {
+		return
+	}
+	delete(b.streams, conv.ID)
+
+	event := ResultEvent(conv)
+	for ch := range s.subscribers {
+		// The channel is closed right after; a subscriber that missed the
+		// result reads the final state from the job store instead
+		select {
+		case ch <- event:
+		default:
+		}
+		close(ch)
+	}
+}
+
+// Done removes the stream of a conversion whose job has ended and closes the
+// subscriber channels. It is a no-op after Finish, and releases the stream
+// of a conversion that never finished, e.g. one deleted while it ran.
+func (b *Broker) Done(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[id]
+	if !ok {
+		return
+	}
+	delete(b.streams, id)
+	for ch := range s.subscribers {
+		close(ch)
+	}
+}
+
+// ResultEvent builds the result event of a finished conversion
+func ResultEvent(conv *models.Conversion) Event {
+	event := Event{Type: TypeResult, Status: conv.Status, Conversion: conv}
+	if conv.Status == models.StatusCompleted {
+		event.Percent = 100
+		event.Stage = iface.StageFinished
+	}
+	return event
+}
+
+// publish sends an event to the current subscribers without blocking
+func (b *Broker) publish(id string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[id]
+	if !ok {
+		return
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// stream returns the stream of a conversion, creating it if needed. The
+// caller must hold b.mu.
+func (b *Broker) stream(id string) *stream {
+	s, ok := b.streams[id]
+	if !ok {
+		s = &stream{subscribers: make(map[chan Event]struct{})}
+		b.streams[id] = s
+	}
+	return s
+}
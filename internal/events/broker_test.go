@@ -0,0 +1,86 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	t.Run("delivers progress with an ETA and closes after the result", func(t *testing.T) {
+		b := NewBroker()
+		now := time.Unix(0, 0)
+		b.now = func() time.Time { return now }
+
+		events, unsubscribe := b.Subscribe("conv")
+		defer unsubscribe()
+
+		b.Status("conv", models.StatusProcessing)
+		b.Progress("conv", iface.Progress{Percent: 0, Stage: iface.StageConverting})
+		now = now.Add(10 * time.Second)
+		b.Progress("conv", iface.Progress{Percent: 25, Stage: iface.StageConverting})
+		b.Finish(&models.Conversion{ID: "conv", Status: models.StatusCompleted})
+
+		status := <-events
+		assert.Equal(t, TypeStatus, status.Type)
+		assert.Equal(t, models.StatusProcessing, status.Status)
+
+		first := <-events
+		assert.Equal(t, TypeProgress, first.Type)
+		assert.Nil(t, first.ETASeconds)
+
+		second := <-events
+		require.NotNil(t, second.ETASeconds)
+		assert.Equal(t, 30, *second.ETASeconds)
+
+		result := <-events
+		assert.Equal(t, TypeResult, result.Type)
+		assert.Equal(t, float64(100), result.Percent)
+		require.NotNil(t, result.Conversion)
+
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+
+	t.Run("drops events for slow subscribers", func(t *testing.T) {
+		b := NewBroker()
+		events, unsubscribe := b.Subscribe("conv")
+
+		for i := 0; i < subscriberBuffer*2; i++ {
+			b.Progress("conv", iface.Progress{Percent: float64(i)})
+		}
+		assert.Len(t, events, subscriberBuffer)
+
+		unsubscribe()
+		b.Finish(&models.Conversion{ID: "conv", Status: models.StatusFailed})
+	})
+
+	t.Run("removes the stream of a job that never finished", func(t *testing.T) {
+		b := NewBroker()
+		b.Progress("conv", iface.Progress{Percent: 50})
+		_, ok := b.Latest("conv")
+		assert.True(t, ok)
+
+		events, unsubscribe := b.Subscribe("conv")
+		defer unsubscribe()
+		b.Done("conv")
+		assert.Empty(t, b.streams)
+		_, ok = <-events
+		assert.False(t, ok)
+
+		// Done after Finish has nothing left to remove
+		b.Finish(&models.Conversion{ID: "conv", Status: models.StatusCompleted})
+		b.Done("conv")
+	})
+
+	t.Run("ignores events without subscribers", func(t *testing.T) {
+		b := NewBroker()
+		b.Status("conv", models.StatusPending)
+		b.Finish(&models.Conversion{ID: "conv", Status: models.StatusCancelled})
+		assert.Empty(t, b.streams)
+	})
+}
@@ -0,0 +1,324 @@
+// Package fetch downloads conversion sources from remote URLs. Connections
+// to private, loopback and link-local addresses are refused unless the
+// address or host name is allowlisted, and the check runs on the address
+// actually dialed, so redirects and DNS rebinding cannot bypass it.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+)
+
+var (
+	// ErrInvalidURL is returned for URLs that are not absolute http or https URLs
+	ErrInvalidURL = errors.New("source URL must be an absolute http or https URL")
+	// ErrBlockedAddress is returned when a URL resolves to a blocked address
+	ErrBlockedAddress = errors.New("URL resolves to a blocked address")
+	// ErrTooManyRedirects is returned when a URL redirects too often
+	ErrTooManyRedirects = errors.New("source URL redirects too often")
+	// ErrTooLarge is returned when a source exceeds the maximum size
+	ErrTooLarge = errors.New("source exceeds the maximum size")
+)
+
+// StatusError is returned when the remote server responds with an error status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("source URL responded with status %d", e.StatusCode)
+}
+
+// Info describes a remote source
+type Info struct {
+	URL         string // Final URL after redirects
+	ContentType string // Media type without parameters
+	Size        int64  // -1 if unknown
+	Filename    string
+}
+
+// Format returns the source format from the file name, falling back to the
+// content type
+func (i Info) Format() string {
+	if ext := path.Ext(i.Filename); len(ext) > 1 {
+		return strings.ToLower(ext[1:])
+	}
+	if i.ContentType != "" {
+		if exts, err := mime.ExtensionsByType(i.ContentType); err == nil && len(exts) > 0 {
+			return strings.TrimPrefix(exts[0], ".")
+		}
+	}
+	return ""
+}
+
+// Fetcher downloads remote sources
+type Fetcher struct {
+	client  *http.Client
+	maxSize int64
+}
+
+// NewFetcher creates a Fetcher from the configuration
+func NewFetcher(cfg config.FetchConfig) (*Fetcher, error) {
+	transport, err := NewTransport(cfg.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRedirects := cfg.MaxRedirects
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return ErrTooManyRedirects
+				}
+				if err := validateURL(req.URL); err != nil {
+					return err
+				}
+				return nil
+			},
+		},
+		maxSize: cfg.MaxSize,
+	}, nil
+}
+
+// NewTransport returns an HTTP transport that refuses to connect to
+// private, loopback and link-local addresses unless they are covered by the
+// allowlist of CIDR ranges, addresses and host names. Other clients sending
+// requests to user supplied URLs, like webhook callbacks, use it too.
+func NewTransport(allowlist []string) (*http.Transport, error) {
+	guard, err := newGuard(allowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := &net.Dialer{Timeout: dialer.Timeout, KeepAlive: dialer.KeepAlive, Control: guard.control}
+
+	return &http.Transport{
+		// Dial directly, a proxy would hide the dialed address from the guard
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err == nil && guard.allowsHost(host) {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return guarded.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+	}, nil
+}
+
+// Head checks that a URL is reachable and returns what the server reports
+// about it. Servers that do not support HEAD yield an Info with the size
+// unknown, the download enforces the limits in that case.
+func (f *Fetcher) Head(ctx context.Context, rawURL string) (Info, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return Info{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return Info{}, ErrInvalidURL
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Info{}, unwrapError(err)
+	}
+	resp.Body.Close()
+
+	info := info(resp)
+	switch {
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		info.ContentType = ""
+		info.Size = -1
+		return info, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return Info{}, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if f.maxSize > 0 && info.Size > f.maxSize {
+		return Info{}, ErrTooLarge
+	}
+	return info, nil
+}
+
+// Open starts downloading a URL. Reading the body fails with ErrTooLarge once
+// more than the maximum size has been read. Cancelling ctx aborts the download.
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (io.ReadCloser, Info, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, Info{}, ErrInvalidURL
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, Info{}, unwrapError(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, Info{}, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	info := info(resp)
+	if f.maxSize > 0 && info.Size > f.maxSize {
+		resp.Body.Close()
+		return nil, Info{}, ErrTooLarge
+	}
+
+	body := resp.Body
+	if f.maxSize > 0 {
+		body = &limitedBody{ReadCloser: resp.Body, remaining: f.maxSize}
+	}
+	return body, info, nil
+}
+
+// info collects what a response reports about the source
+func info(resp *http.Response) Info {
+	info := Info{
+		URL:      resp.Request.URL.String(),
+		Size:     resp.ContentLength,
+		Filename: path.Base(resp.Request.URL.Path),
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		info.ContentType = mediaType
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(params["filename"]); params["filename"] != "" && name != "/" && name != "." {
+			info.Filename = name
+		}
+	}
+	if info.Filename == "/" || info.Filename == "." {
+		info.Filename = ""
+	}
+	return info
+}
+
+// limitedBody fails reads past the maximum size instead of truncating the file
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := validateURL(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func validateURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// unwrapError returns the sentinel errors raised by the guard and the
+// redirect policy instead of the *url.Error wrapping them
+func unwrapError(err error) error {
+	for _, target := range []error{ErrBlockedAddress, ErrTooManyRedirects, ErrInvalidURL} {
+		if errors.Is(err, target) {
+			return target
+		}
+	}
+	return err
+}
+
+// guard decides which addresses may be dialed
+type guard struct {
+	prefixes []netip.Prefix
+	hosts    map[string]bool
+}
+
+// newGuard parses an allowlist of CIDR ranges, IP addresses and host names
+func newGuard(allowlist []string) (*guard, error) {
+	g := &guard{hosts: make(map[string]bool)}
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			g.prefixes = append(g.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			g.prefixes = append(g.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		if strings.ContainsAny(entry, "/:") {
+			return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		g.hosts[strings.ToLower(strings.TrimSuffix(entry, "."))] = true
+	}
+	return g, nil
+}
+
+func (g *guard) allowsHost(host string) bool {
+	return g.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+// allowsAddr reports whether addr is public or allowlisted
+func (g *guard) allowsAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsUnspecified())
+}
+
+// control runs before every connection with the resolved address
+func (g *guard) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+	if !g.allowsAddr(addrPort.Addr()) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
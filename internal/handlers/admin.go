@@ -23,6 +23,7 @@ func (h *Handler) GetStats(c *fiber.Ctx) error {
 		"totalConversions": 0,
 		"storageUsed":     "0 MB",
 		"uptime":          "0h 0m 0s",
+		"resultCache":     h.cache.Stats(),
 	})
 }
 
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/internal/queue"
+	"github.com/amannvl/freefileconverterz/pkg/converter/archive"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// extractPrefix is the storage prefix of files extracted from archives
+const extractPrefix = "extracts"
+
+// extractOwnerSuffix is the suffix of the record of who extracted the
+// outputs of an extraction, stored next to their directory
+const extractOwnerSuffix = ".owner"
+
+// archivePasswordHeader carries the password of an archive being listed
+const archivePasswordHeader = "X-Archive-Password"
+
+// Errors of archive requests
+var (
+	errInvalidKey     = errors.New("invalid storage key")
+	errStoredNotFound = errors.New("stored file not found")
+	errArchiveJob     = errors.New("archive job failed")
+)
+
+// unsupportedArchiveError is returned for stored files that are not an
+// archive, or for target formats entries cannot be packed into
+type unsupportedArchiveError struct {
+	format string
+	target string
+}
+
+func (e *unsupportedArchiveError) Error() string {
+	if e.target != "" {
+		return fmt.Sprintf("cannot pack %s entries into %s", e.format, e.target)
+	}
+	return fmt.Sprintf("%s is not a supported archive format", e.format)
+}
+
+// extractOwner records the user an extraction belongs to and its outputs
+type extractOwner struct {
+	UserID string   `json:"user_id"`
+	Keys   []string `json:"keys"`
+}
+
+// storedArchive is a stored archive copied into a working directory
+type storedArchive struct {
+	key     string
+	format  string
+	workDir string
+	path    string
+}
+
+// ListArchiveEntries lists the entries of a stored archive
+// @Summary List archive entries
+// @Description Lists the files, directories and links of a stored archive in any format the archive converter reads (zip, tar, tar.gz, tar.bz2, tar.xz, tar.zst, tar.lz4, zst, 7z, rar) with their size, compressed size, modification time, CRC-32 and whether they are encrypted. Compressed sizes are 0 and CRCs omitted for tar archives, which are compressed as a whole.
+// @Tags archives
+// @Produce json
+// @Param key path string true "URL-encoded storage key of the archive, the Upload-Key of a completed resumable upload or the key of an output of the caller"
+// @Param X-Archive-Password header string false "Password of an archive whose names are encrypted"
+// @Success 200 {object} models.ArchiveEntriesResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/archives/{key}/entries [get]
+func (h *Handler) ListArchiveEntries(c *fiber.Ctx) error {
+	// The password is taken from a header, query strings end up in logs
+	password := c.Get(archivePasswordHeader)
+	if err := (iface.Options{Password: password}).Validate(); err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+
+	stored, err := h.loadArchive(c.Context(), currentUserID(c), c.Params("key"), "")
+	if err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+	defer os.RemoveAll(stored.workDir)
+
+	var entries []archive.Entry
+	err = h.runArchiveJob(func(ctx context.Context) error {
+		var err error
+		entries, err = h.converterFactory.Archives().Entries(ctx, stored.path, password)
+		return err
+	})
+	if err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+
+	if entries == nil {
+		entries = []archive.Entry{}
+	}
+	return c.JSON(models.ArchiveEntriesResponse{
+		Key:     stored.key,
+		Format:  stored.format,
+		Entries: entries,
+	})
+}
+
+// ExtractArchive extracts entries of a stored archive into storage
+// @Summary Extract archive entries
+// @Description Extracts the named entries of a stored archive, every entry if "entries" is empty; a directory name picks everything below it. With a "format" the entries are packed into a new archive of that format, otherwise each file is stored on its own. A "password" decrypts an encrypted archive and encrypts a new ZIP or 7z archive, a "compression_level" from 1 to 9 trades speed for size and a "volume_size" splits a new ZIP or 7z archive into volumes named like those of 7-Zip (.001, .002, ...). The returned keys can be passed to the conversion endpoints as "key". Entries are checked like those of an archive conversion.
+// @Tags archives
+// @Accept json
+// @Produce json
+// @Param key path string true "URL-encoded storage key of the archive, the Upload-Key of a completed resumable upload or the key of an output of the caller"
+// @Param request body models.ArchiveExtractRequest true "Entries to extract and the archive format to pack them into"
+// @Success 200 {object} models.ArchiveExtractResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/archives/{key}/extract [post]
+func (h *Handler) ExtractArchive(c *fiber.Ctx) error {
+	// Misspelled fields are rejected rather than extracting with defaults
+	var req models.ArchiveExtractRequest
+	if len(c.Body()) > 0 {
+		if err := iface.DecodeStrict(c.Body(), &req); err != nil {
+			var convErr *iface.ConversionError
+			if errors.As(err, &convErr) {
+				return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, convErr.Message, err)
+			}
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_request", "Request body must be a valid JSON object", err)
+		}
+	}
+	req.Format = strings.ToLower(strings.TrimPrefix(req.Format, "."))
+	if err := req.Options().Validate(); err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+	if req.Format == "" && (req.CompressionLevel != 0 || req.VolumeSize != 0) {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_option", "Set a format to use compression_level or volume_size", nil)
+	}
+
+	userID := currentUserID(c)
+	stored, err := h.loadArchive(c.Context(), userID, c.Params("key"), req.Format)
+	if err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+	defer os.RemoveAll(stored.workDir)
+
+	id := utils.UUIDv4()
+	var outputs []models.ArchiveOutput
+	err = h.runArchiveJob(func(ctx context.Context) error {
+		var err error
+		if req.Format != "" {
+			outputs, err = h.extractToArchive(ctx, id, stored, req)
+		} else {
+			outputs, err = h.extractToFiles(ctx, id, stored, req)
+		}
+		return err
+	})
+	if err == nil {
+		err = h.saveExtractOwner(c.Context(), id, userID, outputs)
+	}
+	if err != nil {
+		return h.archiveErrorResponse(c, err)
+	}
+
+	h.logger.Info("Archive entries extracted", "key", stored.key, "extractID", id, "outputs", len(outputs))
+
+	for i := range outputs {
+		url, err := h.storage.SignedURL(c.Context(), outputs[i].Key, h.config.Storage.SignedURLTTL)
+		if err != nil {
+			h.logger.Warn("Failed to sign download URL", "error", err, "key", outputs[i].Key)
+			continue
+		}
+		outputs[i].DownloadURL = url
+	}
+	return c.JSON(models.ArchiveExtractResponse{ID: id, Outputs: outputs})
+}
+
+// loadArchive copies the stored archive with the URL-encoded key, a file of
+// the user, into a new working directory and identifies its format. A
+// non-empty target is the archive format entries are packed into.
+func (h *Handler) loadArchive(ctx context.Context, userID, rawKey, target string) (*storedArchive, error) {
+	key, err := url.PathUnescape(rawKey)
+	if err != nil || !filepath.IsLocal(key) {
+		return nil, errInvalidKey
+	}
+	if err := h.checkStoredKey(ctx, userID, key); err != nil {
+		return nil, err
+	}
+
+	workDir, srcPath, _, err := h.saveStored(ctx, key, extension(filetype.FromName(key)))
+	if err != nil {
+		return nil, err
+	}
+	format, srcPath, err := detectFormat(srcPath, filetype.FromName(key))
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, err
+	}
+
+	if archives := h.converterFactory.Archives(); archives == nil || !archives.SupportsExtraction(format, target) {
+		os.RemoveAll(workDir)
+		if archives != nil && archives.SupportsExtraction(format, "") {
+			return nil, &unsupportedArchiveError{format: format, target: target}
+		}
+		return nil, &unsupportedArchiveError{format: format}
+	}
+	return &storedArchive{key: key, format: format, workDir: workDir, path: srcPath}, nil
+}
+
+// extractToArchive packs the picked entries into a new archive and stores
+// it, or each of its volumes
+func (h *Handler) extractToArchive(ctx context.Context, id string, stored *storedArchive, req models.ArchiveExtractRequest) ([]models.ArchiveOutput, error) {
+	name := archiveBaseName(stored.key) + extension(req.Format)
+	dest := filepath.Join(stored.workDir, "output"+extension(req.Format))
+	files, err := h.converterFactory.Archives().ExtractArchive(ctx, stored.path, dest, req.Entries, req.Options())
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]models.ArchiveOutput, 0, len(files))
+	for _, file := range files {
+		// Volumes keep their number after the archive name
+		output, err := h.storeExtracted(ctx, id, name+strings.TrimPrefix(file, dest), file)
+		if err != nil {
+			for _, output := range outputs {
+				h.storage.Delete(context.Background(), output.Key)
+			}
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// extractToFiles extracts the picked entries and stores every file on its
+// own, under its path in the archive. Links are not stored.
+func (h *Handler) extractToFiles(ctx context.Context, id string, stored *storedArchive, req models.ArchiveExtractRequest) ([]models.ArchiveOutput, error) {
+	dir := filepath.Join(stored.workDir, "extracted")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := h.converterFactory.Archives().ExtractFiles(ctx, stored.path, dir, req.Entries, req.Password); err != nil {
+		return nil, err
+	}
+
+	outputs := []models.ArchiveOutput{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		output, err := h.storeExtracted(ctx, id, filepath.ToSlash(rel), p)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, output)
+		return nil
+	})
+	if err != nil {
+		// Keep nothing of a partial extraction
+		for _, output := range outputs {
+			h.storage.Delete(context.Background(), output.Key)
+		}
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// archiveBaseName returns the file name of an archive key without its
+// extension, including the .tar of compressed tar archives
+func archiveBaseName(key string) string {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if strings.EqualFold(path.Ext(name), ".tar") {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	if name == "" {
+		return "archive"
+	}
+	return name
+}
+
+// storeExtracted saves an extracted file under the prefix of the extraction
+func (h *Handler) storeExtracted(ctx context.Context, id, name, filePath string) (models.ArchiveOutput, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return models.ArchiveOutput{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return models.ArchiveOutput{}, err
+	}
+
+	key, err := h.storage.Save(ctx, extractPrefix+"/"+id+"/"+name, f)
+	if err != nil {
+		return models.ArchiveOutput{}, fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return models.ArchiveOutput{Name: name, Key: key, Size: info.Size()}, nil
+}
+
+// saveExtractOwner records that the outputs of an extraction belong to the
+// user. The outputs are removed if it cannot be stored.
+func (h *Handler) saveExtractOwner(ctx context.Context, id, userID string, outputs []models.ArchiveOutput) error {
+	owner := extractOwner{UserID: userID, Keys: make([]string, 0, len(outputs))}
+	for _, output := range outputs {
+		owner.Keys = append(owner.Keys, output.Key)
+	}
+	data, err := json.Marshal(owner)
+	if err == nil {
+		// A reader, S3 storage does not save byte slices
+		_, err = h.storage.Save(ctx, extractPrefix+"/"+id+extractOwnerSuffix, bytes.NewReader(data))
+	}
+	if err != nil {
+		for _, output := range outputs {
+			h.storage.Delete(context.Background(), output.Key)
+		}
+		return fmt.Errorf("failed to store owner of extraction %s: %w", id, err)
+	}
+	return nil
+}
+
+// ownsExtracted reports whether key is an output of an extraction of the user
+func (h *Handler) ownsExtracted(ctx context.Context, userID, key string) bool {
+	rest, ok := strings.CutPrefix(key, extractPrefix+"/")
+	if !ok {
+		return false
+	}
+	id, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return false
+	}
+	data, err := h.storage.Read(ctx, extractPrefix+"/"+id+extractOwnerSuffix)
+	if err != nil {
+		return false
+	}
+	var owner extractOwner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return false
+	}
+	return owner.UserID == userID && slices.Contains(owner.Keys, key)
+}
+
+// runArchiveJob runs fn on an archive worker and waits for it, so archive
+// requests share the worker limit of archive conversions
+func (h *Handler) runArchiveJob(fn func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	err := h.queue.Submit(queue.Job{
+		ID:       utils.UUIDv4(),
+		Category: "archive",
+		Run: func(ctx context.Context) {
+			// A panicking job still answers the request
+			err := errArchiveJob
+			defer func() { done <- err }()
+			err = fn(ctx)
+		},
+		Discard: func() {
+			done <- queue.ErrCancelled
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return <-done
+}
+
+// archiveErrorResponse writes the response of a failed archive request
+func (h *Handler) archiveErrorResponse(c *fiber.Ctx, err error) error {
+	var unsupported *unsupportedArchiveError
+	var convErr *iface.ConversionError
+	var mismatch *filetype.MismatchError
+	switch {
+	case errors.Is(err, errInvalidKey):
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_key", "Invalid storage key", err)
+	case errors.Is(err, errStoredNotFound):
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Stored file not found", err)
+	case errors.As(err, &mismatch), errors.Is(err, filetype.ErrUnrecognized):
+		status, code, message := formatError(err)
+		return h.errorResponse(c, status, code, message, err)
+	case errors.As(err, &unsupported) && unsupported.target != "":
+		return h.errorResponse(c, fiber.StatusBadRequest, "unsupported_conversion",
+			fmt.Sprintf("%s entries cannot be packed into %s", strings.ToUpper(unsupported.format), strings.ToUpper(unsupported.target)), err)
+	case errors.As(err, &unsupported):
+		return h.errorResponse(c, fiber.StatusUnsupportedMediaType, "unsupported_archive",
+			fmt.Sprintf("%s files are not a supported archive format", strings.ToUpper(unsupported.format)), err)
+	case errors.As(err, &convErr) && convErr.Code == archive.CodeEntryNotFound:
+		return h.errorResponse(c, fiber.StatusNotFound, convErr.Code, convErr.Message, err)
+	case errors.As(err, &convErr) && convErr.Code == "invalid_option":
+		return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, convErr.Message, err)
+	case errors.As(err, &convErr):
+		h.logger.Warn("Archive rejected", "error", err)
+		return h.errorResponse(c, fiber.StatusUnprocessableEntity, convErr.Code, convErr.Message, err)
+	case errors.Is(err, queue.ErrQueueFull), errors.Is(err, queue.ErrQueueClosed):
+		return h.enqueueError(c, err, "", "archive")
+	}
+	h.logger.Error("Archive request failed", "error", err)
+	return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to read archive", err)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractArchiveUnknownField(t *testing.T) {
+	h := &Handler{config: &config.Config{}, logger: slog.Default()}
+	app := fiber.New()
+	app.Post("/archives/:key/extract", h.ExtractArchive)
+
+	for _, tc := range []struct {
+		body string
+		code string
+	}{
+		{`{"entries": ["a.txt"], "pasword": "s3cret"}`, "unsupported_option"},
+		{`{"entries": "a.txt"}`, "invalid_request"},
+	} {
+		req := httptest.NewRequest("POST", "/archives/uploads%2Fid%2Ffiles.zip/extract", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, tc.code, body["error"], tc.body)
+	}
+}
@@ -1,13 +1,24 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log/slog"
-	"sync"
 	"time"
 
+	"github.com/amannvl/freefileconverterz/internal/cache"
 	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/events"
+	"github.com/amannvl/freefileconverterz/internal/fetch"
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/internal/queue"
 	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/amannvl/freefileconverterz/internal/uploads"
+	"github.com/amannvl/freefileconverterz/internal/webhooks"
 	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -17,23 +28,37 @@ type Handler struct {
 	storage          storage.Storage
 	converterFactory *factory.ConverterFactory
 	logger           *slog.Logger
-	mu              sync.RWMutex
-	conversions     map[string]*Conversion
+	jobs             jobs.JobStore
+	queue            *queue.Queue
+	events           *events.Broker
+	webhooks         *webhooks.Dispatcher
+	uploads          *uploads.Manager
+	fetcher          *fetch.Fetcher
+	cache            *cache.Cache
+	eventsSocket     fiber.Handler
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(cfg *config.Config, store storage.Storage, factory *factory.ConverterFactory, log *slog.Logger) *Handler {
+func NewHandler(cfg *config.Config, store storage.Storage, factory *factory.ConverterFactory, jobStore jobs.JobStore, jobQueue *queue.Queue, dispatcher *webhooks.Dispatcher, uploadManager *uploads.Manager, fetcher *fetch.Fetcher, resultCache *cache.Cache, log *slog.Logger) *Handler {
 	if log == nil {
 		log = slog.Default()
 	}
 
-	return &Handler{
+	h := &Handler{
 		config:           cfg,
 		storage:          store,
 		converterFactory: factory,
 		logger:           log,
-		conversions:      make(map[string]*Conversion),
+		jobs:             jobStore,
+		queue:            jobQueue,
+		events:           events.NewBroker(),
+		webhooks:         dispatcher,
+		uploads:          uploadManager,
+		fetcher:          fetcher,
+		cache:            resultCache,
 	}
+	h.eventsSocket = websocket.New(h.streamEventsSocket)
+	return h
 }
 
 // HealthCheck handles health check requests
@@ -60,39 +85,73 @@ func (h *Handler) errorResponse(c *fiber.Ctx, status int, code, message string,
 	return c.Status(status).JSON(response)
 }
 
-// updateConversionStatus updates the status of a conversion
-func (h *Handler) updateConversionStatus(conversionID, status string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if conv, ok := h.conversions[conversionID]; ok {
-		conv.Status = status
+// updateConversion applies fn to a stored conversion, logging store failures,
+// and publishes the new status to the event stream. Conversions in a final
+// status, e.g. cancelled ones, are left untouched. It reports whether the
+// conversion was updated.
+func (h *Handler) updateConversion(conversionID string, fn func(conv *models.Conversion)) bool {
+	skipped := false
+	conv, err := h.jobs.Update(context.Background(), conversionID, func(conv *models.Conversion) error {
+		if conv.Status.IsFinal() {
+			skipped = true
+			return nil
+		}
+		fn(conv)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("Failed to update conversion", "error", err, "conversionID", conversionID)
+		return false
 	}
+	if !skipped {
+		h.publishStatus(conv)
+	}
+	return !skipped
+}
+
+// publishStatus pushes a conversion's status to its event stream, ending the
+// stream and sending the callback once the conversion is final
+func (h *Handler) publishStatus(conv *models.Conversion) {
+	if conv.Status.IsFinal() {
+		h.withDownloadURL(context.Background(), conv)
+		h.events.Finish(conv)
+		h.webhooks.Notify(conv)
+		return
+	}
+	h.events.Status(conv.ID, conv.Status)
+}
+
+// updateConversionStatus updates the status of a conversion
+func (h *Handler) updateConversionStatus(conversionID string, status models.ConversionStatus) {
+	h.updateConversion(conversionID, func(conv *models.Conversion) {
+		conv.SetStatus(status, time.Now())
+	})
 }
 
 // updateConversionError updates a conversion with an error status
 func (h *Handler) updateConversionError(conversionID string, err error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if conv, ok := h.conversions[conversionID]; ok {
-		now := time.Now()
-		conv.Status = "error"
+	var convErr *iface.ConversionError
+	h.updateConversion(conversionID, func(conv *models.Conversion) {
 		conv.Error = err.Error()
-		conv.CompletedAt = now
-	}
+		if errors.As(err, &convErr) {
+			conv.ErrorCode = convErr.Code
+		}
+		conv.SetStatus(models.StatusFailed, time.Now())
+	})
 }
 
-// updateConversionSuccess updates a conversion with success status and file info
-func (h *Handler) updateConversionSuccess(conversionID, convertedName string, fileSize int64) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if conv, ok := h.conversions[conversionID]; ok {
-		now := time.Now()
-		conv.Status = "completed"
-		conv.ConvertedName = convertedName
-		conv.FileSize = fileSize
-		conv.CompletedAt = now
-		conv.DownloadURL = "/download/" + convertedName
-	}
+// updateConversionSuccess updates a conversion with success status and the
+// stored output, cached tells whether the output was reused from an
+// identical conversion
+func (h *Handler) updateConversionSuccess(conversionID string, entry *cache.Entry, cached bool) bool {
+	return h.updateConversion(conversionID, func(conv *models.Conversion) {
+		conv.OutputKey = entry.OutputKey
+		conv.FileSize = entry.Size
+		conv.OutputFormat = entry.Result.Format
+		conv.Pages = entry.Result.Pages
+		conv.Cached = cached
+		conv.SetStatus(models.StatusCompleted, time.Now())
+	})
 }
 
 // successResponse is a helper for success responses
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// batchManifestName is the name of the manifest in batch downloads
+const batchManifestName = "manifest.json"
+
+// batchEntry is a validated batch item
+type batchEntry struct {
+	name         string
+	sourceFormat string
+	upload       *multipart.FileHeader // Set for uploaded files
+	key          string                // Set for stored files
+	sourceURL    string                // Set for remote files
+	req          models.ConversionRequest
+	converter    iface.Converter
+	category     string
+
+	workDir string
+	srcPath string
+	size    int64
+}
+
+// batchManifest lists the contents of a batch download
+type batchManifest struct {
+	BatchID   string               `json:"batch_id"`
+	CreatedAt time.Time            `json:"created_at"`
+	Files     []batchManifestEntry `json:"files"`
+	Failures  []batchManifestEntry `json:"failures"`
+}
+
+// batchManifestEntry describes one conversion of a batch download
+type batchManifestEntry struct {
+	ConversionID string                  `json:"conversion_id"`
+	OriginalName string                  `json:"original_name"`
+	TargetFormat string                  `json:"target_format"`
+	Status       models.ConversionStatus `json:"status"`
+	File         string                  `json:"file,omitempty"`
+	Error        string                  `json:"error,omitempty"`
+}
+
+// CreateBatch handles batch conversion requests
+// @Summary Convert several files
+// @Description Converts several files, each with its own target format and options. Send the files as repeated "file" fields with either a "format" (and "options") for all of them or an "items" JSON array with one {"format","options"} object per file. Items with a "key" convert a completed resumable upload of the caller and items with a "source_url" a file downloaded from that URL instead of an upload; a JSON body {"items":[...]} can be used when no files are uploaded.
+// @Tags conversion
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Param file formData file false "Files to convert"
+// @Param format formData string false "Target format for all files"
+// @Param options formData string false "Conversion options for all files as JSON"
+// @Param items formData string false "Per file items as JSON, e.g. [{\"format\":\"pdf\"},{\"key\":\"abc.png\",\"format\":\"jpg\"}]"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/v1/batches [post]
+func (h *Handler) CreateBatch(c *fiber.Ctx) error {
+	items, uploads, err := parseBatchRequest(c)
+	if err != nil {
+		var convErr *iface.ConversionError
+		if errors.As(err, &convErr) {
+			return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, convErr.Message, err)
+		}
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", err.Error(), err)
+	}
+
+	if len(items) == 0 {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", "A batch needs at least one file", nil)
+	}
+	if maxSize := h.config.Queue.MaxBatchSize; maxSize > 0 && len(items) > maxSize {
+		return h.errorResponse(c, fiber.StatusBadRequest, "batch_too_large",
+			fmt.Sprintf("A batch can contain at most %d files", maxSize), nil)
+	}
+
+	// Validate every item before any work is queued
+	entries := make([]*batchEntry, len(items))
+	next := 0
+	for i, item := range items {
+		entry := &batchEntry{
+			key:       item.Key,
+			sourceURL: item.SourceURL,
+			req:       models.ConversionRequest{TargetFormat: strings.ToLower(item.Format), Options: item.Options},
+		}
+		switch {
+		case item.SourceURL != "" && item.Key != "":
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", fmt.Sprintf("Item %d: use either key or source_url", i), nil)
+		case item.SourceURL != "":
+			source, name, err := h.checkSourceURL(c.Context(), item.SourceURL)
+			if err != nil {
+				status, code, message := sourceURLError(err)
+				return h.errorResponse(c, status, code, fmt.Sprintf("Item %d: %s", i, message), err)
+			}
+			entry.name = name
+			entry.size = max(source.Size, 0)
+		case item.Key != "":
+			if err := h.checkStoredKey(c.Context(), currentUserID(c), item.Key); err != nil {
+				return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", fmt.Sprintf("Item %d: stored file not found", i), err)
+			}
+			entry.name = filepath.Base(item.Key)
+		default:
+			if next >= len(uploads) {
+				return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", fmt.Sprintf("Item %d: no file uploaded for this item", i), nil)
+			}
+			entry.upload = uploads[next]
+			entry.name = entry.upload.Filename
+			entry.size = entry.upload.Size
+			next++
+		}
+
+		if entry.req.TargetFormat == "" {
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", fmt.Sprintf("Item %d: target format is required", i), nil)
+		}
+		// Remote sources are converted from the format their name claims,
+		// the others from their content once saved
+		entry.sourceFormat = filetype.FromName(entry.name)
+		if entry.sourceFormat == "" && entry.sourceURL != "" {
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch", fmt.Sprintf("Item %d: file has no extension", i), nil)
+		}
+		entries[i] = entry
+	}
+	if next < len(uploads) {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_batch",
+			fmt.Sprintf("%d uploaded files have no item", len(uploads)-next), nil)
+	}
+
+	// Copy the inputs into working directories before the request ends,
+	// remote sources are downloaded by the workers
+	for i, entry := range entries {
+		ext := extension(entry.sourceFormat)
+		switch {
+		case entry.upload != nil:
+			entry.workDir, entry.srcPath, err = saveUpload(entry.upload, ext)
+		case entry.sourceURL != "":
+			entry.workDir, entry.srcPath, err = newWorkDir(ext)
+		default:
+			entry.workDir, entry.srcPath, entry.size, err = h.saveStored(c.Context(), entry.key, ext)
+		}
+		if err != nil {
+			removeBatchWorkDirs(entries)
+			h.logger.Error("Failed to save batch file", "error", err, "filename", entry.name)
+			return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to save uploaded file", err)
+		}
+
+		if entry.sourceURL == "" {
+			if entry.sourceFormat, entry.srcPath, err = detectFormat(entry.srcPath, entry.sourceFormat); err != nil {
+				removeBatchWorkDirs(entries)
+				h.logger.Warn("Batch file rejected", "error", err, "filename", entry.name)
+				status, code, message := formatError(err)
+				return h.errorResponse(c, status, code, fmt.Sprintf("Item %d: %s", i, message), err)
+			}
+		}
+	}
+
+	// Resolve the converters and validate the options before any work is queued
+	for i, entry := range entries {
+		entry.converter, err = h.converterFactory.GetConverter(entry.sourceFormat, entry.req.TargetFormat, entry.req.Options)
+		if err == nil {
+			entry.category, err = h.converterFactory.Category(entry.sourceFormat, entry.req.TargetFormat)
+		}
+		if err != nil {
+			removeBatchWorkDirs(entries)
+			var convErr *iface.ConversionError
+			if errors.As(err, &convErr) {
+				return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, fmt.Sprintf("Item %d: %s", i, convErr.Message), err)
+			}
+			return h.errorResponse(c, fiber.StatusBadRequest, "unsupported_conversion",
+				fmt.Sprintf("Item %d: conversion from %s to %s is not supported", i, entry.sourceFormat, entry.req.TargetFormat), err)
+		}
+	}
+
+	userID := currentUserID(c)
+	batch := &models.Batch{
+		ID:        utils.UUIDv4(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	conversions := make([]*models.Conversion, len(entries))
+	for i, entry := range entries {
+		conversions[i] = newConversion(userID, entry.name, entry.size, entry.sourceFormat, entry.req, entry.converter)
+		conversions[i].BatchID = batch.ID
+		conversions[i].SourceURL = entry.sourceURL
+		batch.ConversionIDs = append(batch.ConversionIDs, conversions[i].ID)
+	}
+
+	if err := h.jobs.CreateBatch(c.Context(), batch); err != nil {
+		removeBatchWorkDirs(entries)
+		h.logger.Error("Failed to store batch", "error", err, "batchID", batch.ID)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to create batch", err)
+	}
+
+	// Queue the conversions; a batch is accepted completely or not at all
+	for i, entry := range entries {
+		var download func(ctx context.Context) error
+		if entry.sourceURL != "" {
+			download = h.downloadSource(conversions[i].ID, entry.sourceURL, entry.srcPath)
+		}
+		err := h.enqueueConversion(c.Context(), conversions[i], entry.category, entry.workDir, entry.srcPath, entry.converter, entry.req, download)
+		if err != nil {
+			removeBatchWorkDirs(entries[i+1:])
+			h.rollbackBatch(batch, conversions[:i])
+			return h.enqueueError(c, err, conversions[i].ID, entry.category)
+		}
+	}
+
+	h.logger.Info("Batch queued", "batchID", batch.ID, "conversions", len(conversions))
+
+	response, err := h.batchResponse(c.Context(), batch)
+	if err != nil {
+		return h.batchLookupError(c, err)
+	}
+	return c.JSON(response)
+}
+
+// GetBatch gets a batch with the state of its conversions
+// @Summary Get batch
+// @Description Gets a batch by ID with its aggregate progress and the state of each conversion
+// @Tags conversion
+// @Produce json
+// @Param id path string true "Batch ID"
+// @Success 200 {object} models.BatchResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/batches/{id} [get]
+func (h *Handler) GetBatch(c *fiber.Ctx) error {
+	batch, err := h.jobs.GetBatch(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.batchLookupError(c, err)
+	}
+
+	response, err := h.batchResponse(c.Context(), batch)
+	if err != nil {
+		return h.batchLookupError(c, err)
+	}
+	return c.JSON(response)
+}
+
+// DownloadBatch downloads the outputs of a batch as a ZIP archive
+// @Summary Download batch results
+// @Description Streams a ZIP archive with the outputs of all successful conversions of a finished batch and a manifest.json listing the files and the failed conversions
+// @Tags conversion
+// @Produce application/zip
+// @Param id path string true "Batch ID"
+// @Success 200
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/batches/{id}/download [get]
+func (h *Handler) DownloadBatch(c *fiber.Ctx) error {
+	batch, err := h.jobs.GetBatch(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.batchLookupError(c, err)
+	}
+
+	response, err := h.batchResponse(c.Context(), batch)
+	if err != nil {
+		return h.batchLookupError(c, err)
+	}
+	if !response.Progress.Finished() {
+		return h.errorResponse(c, fiber.StatusConflict, "batch_in_progress", "The batch has conversions that have not finished yet", nil)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=batch-%s.zip", batch.ID))
+
+	// The archive is written after the handler returns, so only captured values are used
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.writeBatchArchive(context.Background(), w, response); err != nil {
+			h.logger.Error("Failed to stream batch archive", "error", err, "batchID", batch.ID)
+		}
+	})
+	return nil
+}
+
+// writeBatchArchive writes the successful outputs of a batch and its manifest as a ZIP archive
+func (h *Handler) writeBatchArchive(ctx context.Context, w *bufio.Writer, batch *models.BatchResponse) error {
+	archive := zip.NewWriter(w)
+	manifest := batchManifest{
+		BatchID:   batch.ID,
+		CreatedAt: batch.CreatedAt,
+		Files:     []batchManifestEntry{},
+		Failures:  []batchManifestEntry{},
+	}
+	used := map[string]bool{batchManifestName: true}
+
+	for _, conv := range batch.Conversions {
+		entry := batchManifestEntry{
+			ConversionID: conv.ID,
+			OriginalName: conv.OriginalName,
+			TargetFormat: conv.TargetFormat,
+			Status:       conv.Status,
+			Error:        conv.Error,
+		}
+		if conv.Status != models.StatusCompleted {
+			manifest.Failures = append(manifest.Failures, entry)
+			continue
+		}
+
+		name := uniqueArchiveName(used, conv.OriginalName, conv.ResultFormat())
+		if err := h.addStoredFile(ctx, archive, name, conv.OutputKey); err != nil {
+			h.logger.Error("Failed to add converted file to batch archive", "error", err, "conversionID", conv.ID)
+			entry.Error = "converted file is no longer available"
+			manifest.Failures = append(manifest.Failures, entry)
+			continue
+		}
+		entry.File = name
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	mw, err := archive.Create(batchManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(data); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// addStoredFile copies a file from storage into the archive
+func (h *Handler) addStoredFile(ctx context.Context, archive *zip.Writer, name, key string) error {
+	src, err := h.storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// batchResponse loads the conversions of a batch and aggregates their progress
+func (h *Handler) batchResponse(ctx context.Context, batch *models.Batch) (*models.BatchResponse, error) {
+	response := &models.BatchResponse{
+		Batch:       *batch,
+		Conversions: make([]*models.Conversion, 0, len(batch.ConversionIDs)),
+	}
+
+	for _, id := range batch.ConversionIDs {
+		conv, err := h.jobs.Get(ctx, id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			continue // Deleted by the user
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var percent float64
+		if progress, ok := h.events.Latest(id); ok {
+			percent = progress.Percent
+		}
+		response.Progress.Add(conv.Status, percent)
+		h.withDownloadURL(ctx, conv)
+		response.Conversions = append(response.Conversions, conv)
+	}
+	response.Status = response.Progress.Status()
+	return response, nil
+}
+
+// rollbackBatch removes a batch whose conversions could not all be queued
+func (h *Handler) rollbackBatch(batch *models.Batch, queued []*models.Conversion) {
+	ctx := context.Background()
+	for _, conv := range queued {
+		h.queue.Cancel(conv.ID)
+		// Conversions served from the result cache already reference an output
+		if stored, err := h.jobs.Get(ctx, conv.ID); err == nil && stored.OutputKey != "" {
+			h.releaseOutput(ctx, conv.ID, stored.OutputKey)
+		}
+		if err := h.jobs.Delete(ctx, conv.ID); err != nil {
+			h.logger.Error("Failed to remove conversion of rejected batch", "error", err, "conversionID", conv.ID)
+		}
+	}
+	if err := h.jobs.DeleteBatch(ctx, batch.ID); err != nil {
+		h.logger.Error("Failed to remove rejected batch", "error", err, "batchID", batch.ID)
+	}
+}
+
+// batchLookupError writes the response for a failed batch lookup
+func (h *Handler) batchLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, jobs.ErrBatchNotFound) {
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Batch not found", nil)
+	}
+	h.logger.Error("Failed to load batch", "error", err, "batchID", c.Params("id"))
+	return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to load batch", err)
+}
+
+// saveStored copies a stored file into a new working directory and returns
+// the directory, the path of the copy and its size
+func (h *Handler) saveStored(ctx context.Context, key, ext string) (string, string, int64, error) {
+	workDir, srcPath, err := newWorkDir(ext)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	size, err := h.copyStored(ctx, key, srcPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return "", "", 0, err
+	}
+	return workDir, srcPath, size, nil
+}
+
+// parseBatchRequest reads the batch items and uploaded files of a request
+func parseBatchRequest(c *fiber.Ctx) ([]models.BatchItem, []*multipart.FileHeader, error) {
+	if c.Is("json") {
+		var req models.BatchRequest
+		if err := iface.DecodeStrict(c.Body(), &req); err != nil {
+			return nil, nil, batchDecodeError("request body must be a valid JSON object", err)
+		}
+		for i, item := range req.Items {
+			if item.Key == "" && item.SourceURL == "" {
+				return nil, nil, fmt.Errorf("item %d: JSON requests can only convert stored or remote files", i)
+			}
+		}
+		return req.Items, nil, nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse form: %w", err)
+	}
+	uploads := form.File["file"]
+
+	var items []models.BatchItem
+	if raw := c.FormValue("items"); raw != "" {
+		if err := iface.DecodeStrict([]byte(raw), &items); err != nil {
+			return nil, nil, batchDecodeError("items must be a valid JSON array", err)
+		}
+		return items, uploads, nil
+	}
+
+	// Without items every upload is converted to the same format
+	item := models.BatchItem{Format: c.FormValue("format")}
+	if raw := c.FormValue("options"); raw != "" {
+		var err error
+		if item.Options, err = iface.ParseOptions([]byte(raw)); err != nil {
+			return nil, nil, err
+		}
+	}
+	for range uploads {
+		items = append(items, item)
+	}
+	return items, uploads, nil
+}
+
+// batchDecodeError describes invalid JSON of a batch request. Unknown
+// options keep their unsupported_option error.
+func batchDecodeError(message string, err error) error {
+	var convErr *iface.ConversionError
+	if errors.As(err, &convErr) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// removeBatchWorkDirs removes the working directories of batch entries that were not queued
+func removeBatchWorkDirs(entries []*batchEntry) {
+	for _, entry := range entries {
+		if entry != nil && entry.workDir != "" {
+			os.RemoveAll(entry.workDir)
+		}
+	}
+}
+
+// uniqueArchiveName names a converted file after its original, adding a
+// counter when the name is already taken
+func uniqueArchiveName(used map[string]bool, originalName, targetFormat string) string {
+	base := outputBaseName(originalName)
+	name := base + "." + targetFormat
+	for n := 2; used[name]; n++ {
+		name = base + " (" + strconv.Itoa(n) + ")." + targetFormat
+	}
+	used[name] = true
+	return name
+}
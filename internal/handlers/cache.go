@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/amannvl/freefileconverterz/internal/cache"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+)
+
+// resultKey returns the result cache key of converting the file at srcPath
+func (h *Handler) resultKey(srcPath, sourceFormat string, req models.ConversionRequest) (string, error) {
+	digest, err := cache.HashFile(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash input: %w", err)
+	}
+	fingerprint, err := h.converterFactory.Fingerprint(sourceFormat, req.TargetFormat)
+	if err != nil {
+		return "", err
+	}
+	// The application version covers the converters that need no external tool
+	return cache.Key(digest, req.TargetFormat, req.Options, h.config.App.Version+"|"+fingerprint)
+}
+
+// useCachedResult completes a conversion with the output of an identical
+// earlier conversion and reports whether there was one
+func (h *Handler) useCachedResult(ctx context.Context, conversionID, key string) bool {
+	entry, err := h.cache.Acquire(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			h.logger.Warn("Result cache lookup failed", "error", err, "conversionID", conversionID)
+		}
+		return false
+	}
+
+	h.logger.Info("Conversion served from result cache", "conversionID", conversionID, "outputKey", entry.OutputKey)
+	if !h.updateConversionSuccess(conversionID, entry, true) {
+		// Cancelled in the meantime
+		h.releaseOutput(context.Background(), conversionID, entry.OutputKey)
+	}
+	return true
+}
+
+// releaseOutput drops a conversion's reference to its output. Cached outputs
+// stay available for identical conversions until the cache removes them,
+// outputs stored before the cache existed are deleted.
+func (h *Handler) releaseOutput(ctx context.Context, conversionID, outputKey string) {
+	err := h.cache.Release(ctx, outputKey)
+	if errors.Is(err, cache.ErrNotCached) {
+		err = h.storage.Delete(ctx, outputKey)
+	}
+	if err != nil {
+		h.logger.Warn("Failed to release conversion output", "error", err, "conversionID", conversionID)
+	}
+}
@@ -1,71 +1,52 @@
 package handlers
 
 import (
-	"fmt"
-	"strconv"
-	"strings"
+	"context"
+	"errors"
 	"time"
 
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/pkg/models"
 	"github.com/gofiber/fiber/v2"
 )
 
+// GetFormats lists the supported formats
+// @Summary List supported formats
+// @Description Lists every supported format grouped by category, with its MIME type, conversion targets and tool availability
+// @Tags conversion
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/formats [get]
+func (h *Handler) GetFormats(c *fiber.Ctx) error {
+	return h.successResponse(c, fiber.StatusOK, h.converterFactory.Catalog())
+}
+
 // GetConversionStatus gets the status of a conversion
 // @Summary Get conversion status
-// @Description Gets the status of a file conversion by ID
+// @Description Gets the status of a file conversion by ID, including its queue position while it waits for a worker
 // @Tags conversion
 // @Produce json
 // @Param id path string true "Conversion ID"
-// @Success 200 {object} Conversion
+// @Success 200 {object} models.Conversion
 // @Failure 404 {object} map[string]interface{}
 // @Router /api/v1/convert/{id}/status [get]
 func (h *Handler) GetConversionStatus(c *fiber.Ctx) error {
-	id := c.Params("id")
-	h.mu.RLock()
-	conversion, exists := h.conversions[id]
-	h.mu.RUnlock()
-
-	// If conversion is not found in memory, check if the file exists in storage
-	if !exists {
-		// Try to find the file in storage
-		files, err := h.storage.List(c.Context(), "")
-		if err != nil {
-			h.logger.Error("Failed to list files in storage", "error", err)
-			return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to check conversion status", err)
-		}
-
-		// Look for a file with the conversion ID in its name
-		for _, file := range files {
-			if file.ID == id || strings.HasPrefix(file.Name, id) {
-				h.mu.Lock()
-				// Create a new conversion entry
-				conversion = &Conversion{
-					ID:             id,
-					Status:         "completed",
-					ConvertedName:  file.Name,
-					OriginalName:   file.Name,
-					FileSize:       file.Size,
-					CreatedAt:      file.CreatedAt,
-					CompletedAt:    file.UpdatedAt,
-				}
-				h.conversions[id] = conversion
-				h.mu.Unlock()
-				exists = true
-				break
-			}
-		}
+	conversion, err := h.jobs.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.conversionLookupError(c, err)
+	}
 
-		if !exists {
-			return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Conversion not found", nil)
+	// Report how many jobs are ahead of a waiting conversion
+	if conversion.Status == models.StatusPending {
+		if position, ok := h.queue.Position(conversion.ID); ok {
+			conversion.QueuePosition = position
 		}
 	}
 
-	// If conversion is complete, update the download URL
-	if conversion.Status == "completed" && conversion.DownloadURL == "" {
-		downloadURL, err := h.generateDownloadURL(conversion.ConvertedName)
-		if err != nil {
-			return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate download URL", err)
-		}
-		conversion.DownloadURL = downloadURL
+	// If conversion is complete, add a fresh download link
+	if err := h.setDownloadURL(c.Context(), conversion); err != nil {
+		h.logger.Error("Failed to sign download URL", "error", err, "conversionID", conversion.ID)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate download URL", err)
 	}
 
 	return c.JSON(conversion)
@@ -73,114 +54,49 @@ func (h *Handler) GetConversionStatus(c *fiber.Ctx) error {
 
 // DownloadFile downloads a converted file
 // @Summary Download converted file
-// @Description Downloads a converted file by ID
+// @Description Downloads a converted file by ID. Supports single byte ranges (Range, If-Range) for resuming and seeking, and conditional requests (If-None-Match, If-Modified-Since).
 // @Tags conversion
 // @Produce octet-stream
 // @Param id path string true "Conversion ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
 // @Success 200
+// @Success 206
+// @Success 304
 // @Failure 404 {object} map[string]interface{}
+// @Failure 416 {object} map[string]interface{}
 // @Router /api/v1/convert/{id}/download [get]
 func (h *Handler) DownloadFile(c *fiber.Ctx) error {
-	id := c.Params("id")
-	h.mu.RLock()
-	conversion, exists := h.conversions[id]
-	h.mu.RUnlock()
-
-	var convertedFileName string
-
-	// If conversion is not found in memory or not completed, try to find the file in storage
-	if !exists || conversion.Status != "completed" {
-		h.logger.Info("Conversion not found in memory, checking storage", "conversionID", id)
-		
-		// List all files in storage to find one that matches the conversion ID
-		files, err := h.storage.List(c.Context(), "")
-		if err != nil {
-			h.logger.Error("Failed to list files in storage", "error", err)
-			return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to check storage", err)
-		}
-
-		// Look for a file with the conversion ID in its name
-		found := false
-		for _, file := range files {
-			if strings.HasPrefix(file.Name, id) {
-				convertedFileName = file.Name
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found or conversion not complete", nil)
-		}
-
-		// If we found the file but not in memory, create a conversion entry
-		h.mu.Lock()
-		conversion = &Conversion{
-			ID:             id,
-			Status:         "completed",
-			ConvertedName:  convertedFileName,
-			OriginalName:   convertedFileName,
-			FileSize:       0, // We don't know the size yet
-			CompletedAt:    time.Now(),
-		}
-		h.conversions[id] = conversion
-		h.mu.Unlock()
-	} else {
-		convertedFileName = conversion.ConvertedName
-	}
-
-	// Get the file from storage
-	file, err := h.storage.Get(c.Context(), convertedFileName)
-	if err != nil {
-		h.logger.Error("Failed to get file from storage", "error", err, "filename", convertedFileName)
-		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found in storage", err)
-	}
-	defer file.Close()
-
-	// Get file info from storage
-	files, err := h.storage.List(c.Context(), "")
+	conversion, err := h.jobs.Get(c.Context(), c.Params("id"))
 	if err != nil {
-		h.logger.Error("Failed to list files in storage", "error", err)
-		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to get file info", err)
+		return h.conversionLookupError(c, err)
 	}
 
-	// Find the file in the storage to get its size
-	var fileSize int64
-	for _, f := range files {
-		if f.Name == convertedFileName {
-			fileSize = f.Size
-			break
-		}
+	if conversion.Status != models.StatusCompleted || conversion.OutputKey == "" {
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found or conversion not complete", nil)
 	}
 
-	// Set appropriate headers for download
-	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%s", convertedFileName))
-	if fileSize > 0 {
-		c.Set(fiber.HeaderContentLength, strconv.FormatInt(fileSize, 10))
-	}
-	c.Set(fiber.HeaderContentType, "application/octet-stream")
-	
-	// Stream the file from storage
-	return c.Status(fiber.StatusOK).SendStream(file)
+	// Outputs are stored under content-addressed keys, the download is named
+	// after the uploaded file
+	return h.serveStored(c, conversion.OutputKey, outputBaseName(conversion.OriginalName)+"."+conversion.ResultFormat())
 }
 
-// ListConversions lists all conversions
+// ListConversions lists the conversions of the authenticated user
 // @Summary List conversions
-// @Description Lists all file conversions
+// @Description Lists the file conversions of the authenticated user
 // @Tags conversion
 // @Produce json
-// @Success 200 {array} Conversion
-// @Router /api/v1/convert [get]
+// @Success 200 {array} models.Conversion
+// @Router /api/v1/conversions [get]
 func (h *Handler) ListConversions(c *fiber.Ctx) error {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	// Convert map to slice
-	conversionList := make([]*Conversion, 0, len(h.conversions))
-	for _, conv := range h.conversions {
-		conversionList = append(conversionList, conv)
+	conversionList, err := h.jobs.ListByUser(c.Context(), currentUserID(c))
+	if err != nil {
+		h.logger.Error("Failed to list conversions", "error", err)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to list conversions", err)
 	}
 
+	for _, conversion := range conversionList {
+		h.withDownloadURL(c.Context(), conversion)
+	}
 	return c.JSON(conversionList)
 }
 
@@ -190,19 +106,16 @@ func (h *Handler) ListConversions(c *fiber.Ctx) error {
 // @Tags conversion
 // @Produce json
 // @Param id path string true "Conversion ID"
-// @Success 200 {object} Conversion
+// @Success 200 {object} models.Conversion
 // @Failure 404 {object} map[string]interface{}
-// @Router /api/v1/convert/{id} [get]
+// @Router /api/v1/conversions/{id} [get]
 func (h *Handler) GetConversion(c *fiber.Ctx) error {
-	id := c.Params("id")
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	conversion, exists := h.conversions[id]
-	if !exists {
-		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Conversion not found", nil)
+	conversion, err := h.jobs.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.conversionLookupError(c, err)
 	}
 
+	h.withDownloadURL(c.Context(), conversion)
 	return c.JSON(conversion)
 }
 
@@ -213,40 +126,95 @@ func (h *Handler) GetConversion(c *fiber.Ctx) error {
 // @Param id path string true "Conversion ID"
 // @Success 204
 // @Failure 404 {object} map[string]interface{}
-// @Router /api/v1/convert/{id} [delete]
+// @Router /api/v1/conversions/{id} [delete]
 func (h *Handler) DeleteConversion(c *fiber.Ctx) error {
-	id := c.Params("id")
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	conversion, exists := h.conversions[id]
-	if !exists {
-		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Conversion not found", nil)
+	conversion, err := h.jobs.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.conversionLookupError(c, err)
 	}
 
-	// Delete the file from storage
-	if conversion.ConvertedName != "" {
-		_ = h.storage.Delete(c.Context(), conversion.ConvertedName) // Best effort delete
+	// Stop the conversion if it is still waiting or running
+	h.queue.Cancel(conversion.ID)
+
+	// Release the output, identical conversions may still use it
+	if conversion.OutputKey != "" {
+		h.releaseOutput(c.Context(), conversion.ID, conversion.OutputKey) // Best effort
 	}
 
-	// Remove from map
-	delete(h.conversions, id)
+	if err := h.jobs.Delete(c.Context(), conversion.ID); err != nil && !errors.Is(err, jobs.ErrNotFound) {
+		h.logger.Error("Failed to delete conversion", "error", err, "conversionID", conversion.ID)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete conversion", err)
+	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// generateDownloadURL creates a download URL for a converted file
-func (h *Handler) generateDownloadURL(filename string) (string, error) {
-	if h.storage == nil {
-		return "", fmt.Errorf("storage not initialized")
+// CancelConversion cancels a waiting or running conversion
+// @Summary Cancel conversion
+// @Description Cancels a waiting or running file conversion. The converter process is killed and its temporary files are removed.
+// @Tags conversion
+// @Produce json
+// @Param id path string true "Conversion ID"
+// @Success 200 {object} models.Conversion
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/convert/{id} [delete]
+func (h *Handler) CancelConversion(c *fiber.Ctx) error {
+	conversion, err := h.jobs.Update(c.Context(), c.Params("id"), func(conv *models.Conversion) error {
+		if conv.Status.IsFinal() {
+			return errConversionFinished
+		}
+		conv.SetStatus(models.StatusCancelled, time.Now())
+		return nil
+	})
+	if errors.Is(err, errConversionFinished) {
+		return h.errorResponse(c, fiber.StatusConflict, "conversion_finished", "The conversion has already finished", nil)
+	}
+	if err != nil {
+		return h.conversionLookupError(c, err)
 	}
 
-	// Use the storage's URL method to generate the download URL
-	// The storage implementation (S3 or local) will handle the URL generation appropriately
-	url := h.storage.URL(filename)
-	if url == "" {
-		return "", fmt.Errorf("failed to generate download URL")
+	// Kill the converter, or drop the job if no worker has picked it up yet
+	h.queue.Cancel(conversion.ID)
+	h.publishStatus(conversion)
+	h.logger.Info("Conversion cancelled by request", "conversionID", conversion.ID)
+
+	return c.JSON(conversion)
+}
+
+// errConversionFinished is returned when cancelling a conversion in a final status
+var errConversionFinished = errors.New("conversion already finished")
+
+// conversionLookupError writes the response for a failed job store lookup
+func (h *Handler) conversionLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, jobs.ErrNotFound) {
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Conversion not found", nil)
+	}
+	h.logger.Error("Failed to load conversion", "error", err, "conversionID", c.Params("id"))
+	return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to load conversion", err)
+}
+
+// setDownloadURL sets an expiring download link on a completed conversion.
+// Links are signed for each response rather than stored, so stored
+// conversions never carry an expired or raw storage path.
+func (h *Handler) setDownloadURL(ctx context.Context, conv *models.Conversion) error {
+	conv.DownloadURL = ""
+	if conv.Status != models.StatusCompleted || conv.OutputKey == "" {
+		return nil
 	}
 
-	return url, nil
+	url, err := h.storage.SignedURL(ctx, conv.OutputKey, h.config.Storage.SignedURLTTL)
+	if err != nil {
+		return err
+	}
+	conv.DownloadURL = url
+	return nil
+}
+
+// withDownloadURL sets the download link of a conversion, logging failures
+// where a missing link should not fail the response
+func (h *Handler) withDownloadURL(ctx context.Context, conv *models.Conversion) {
+	if err := h.setDownloadURL(ctx, conv); err != nil {
+		h.logger.Warn("Failed to sign download URL", "error", err, "conversionID", conv.ID)
+	}
 }
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errRangeNotSatisfiable is returned for ranges outside of the file
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is a single range of a Range header
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// DownloadSigned downloads a file through a signed link
+// @Summary Download through signed link
+// @Description Serves a stored file for the expiring links returned as download_url when files are kept in local storage. Supports the same range and conditional requests as the conversion download.
+// @Tags conversion
+// @Produce octet-stream
+// @Param path path string true "Storage key"
+// @Param expires query int true "Expiry as Unix time"
+// @Param signature query string true "Link signature"
+// @Success 200
+// @Success 206
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /api/v1/files/{path} [get]
+func (h *Handler) DownloadSigned(c *fiber.Ctx) error {
+	verifier, ok := h.storage.(storage.URLVerifier)
+	if !ok {
+		// Signed links of other storages point to the storage itself
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found", nil)
+	}
+
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil || !filepath.IsLocal(key) {
+		return h.errorResponse(c, fiber.StatusForbidden, "invalid_signature", "Download link is invalid", err)
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return h.errorResponse(c, fiber.StatusForbidden, "invalid_signature", "Download link is invalid", err)
+	}
+
+	switch err := verifier.VerifySignedURL(key, expires, c.Query("signature")); {
+	case errors.Is(err, storage.ErrLinkExpired):
+		return h.errorResponse(c, fiber.StatusGone, "link_expired", "Download link has expired", err)
+	case err != nil:
+		return h.errorResponse(c, fiber.StatusForbidden, "invalid_signature", "Download link is invalid", err)
+	}
+
+	return h.serveStored(c, key, path.Base(key))
+}
+
+// serveStored sends a stored file as an attachment. It answers conditional
+// requests (If-None-Match, If-Modified-Since) with 304 and single byte
+// ranges with 206, honouring If-Range, so downloads can be resumed and
+// media can be played with seeking.
+func (h *Handler) serveStored(c *fiber.Ctx, key, filename string) error {
+	info, err := h.storage.Stat(c.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found in storage", err)
+		}
+		h.logger.Error("Failed to stat file in storage", "error", err, "filename", key)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to read file", err)
+	}
+
+	modified := info.UpdatedAt.UTC().Truncate(time.Second)
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if info.ETag != "" {
+		c.Set(fiber.HeaderETag, info.ETag)
+	}
+	if !modified.IsZero() {
+		c.Set(fiber.HeaderLastModified, modified.Format(http.TimeFormat))
+	}
+
+	if notModified(c, info.ETag, modified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// Serve the whole file unless a satisfiable range of the current version is requested
+	var r *byteRange
+	if header := c.Get(fiber.HeaderRange); header != "" && rangeApplies(c.Get(fiber.HeaderIfRange), info.ETag, modified) {
+		r, err = parseRange(header, info.Size)
+		if errors.Is(err, errRangeNotSatisfiable) {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", info.Size))
+			return h.errorResponse(c, fiber.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable",
+				"Requested range is outside of the file", nil)
+		}
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	status, length := fiber.StatusOK, info.Size
+	if r != nil {
+		status, length = fiber.StatusPartialContent, r.length
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, info.Size))
+	}
+	c.Status(status)
+
+	if c.Method() == fiber.MethodHead {
+		c.Response().Header.SetContentLength(int(length))
+		return nil
+	}
+
+	var file io.ReadCloser
+	if r != nil {
+		file, err = h.storage.GetRange(c.Context(), key, r.start, r.length)
+	} else {
+		file, err = h.storage.Get(c.Context(), key)
+	}
+	if err != nil {
+		h.logger.Error("Failed to get file from storage", "error", err, "filename", key)
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "File not found in storage", err)
+	}
+
+	// The body stream is closed by fasthttp once it has been sent
+	c.Context().SetBodyStream(file, int(length))
+	return nil
+}
+
+// notModified evaluates If-None-Match and, without it, If-Modified-Since
+func notModified(c *fiber.Ctx, etag string, modified time.Time) bool {
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		return etag != "" && etagListMatches(header, etag, true)
+	}
+	if header := c.Get(fiber.HeaderIfModifiedSince); header != "" && !modified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !modified.After(since)
+	}
+	return false
+}
+
+// rangeApplies evaluates If-Range: a range only applies to the version of
+// the file the client already has part of
+func rangeApplies(ifRange, etag string, modified time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && etagListMatches(ifRange, etag, false)
+	}
+	date, err := http.ParseTime(ifRange)
+	return err == nil && !modified.IsZero() && modified.Equal(date)
+}
+
+// etagListMatches reports whether a comma separated list of entity tags, or
+// "*", matches etag. Weak comparison ignores the W/ prefix, strong
+// comparison never matches weak tags.
+func etagListMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a Range header for a file of size bytes. It returns nil
+// for headers that are ignored, i.e. other units, several ranges or invalid
+// syntax, and errRangeNotSatisfiable for ranges outside of the file.
+func parseRange(header string, size int64) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	// Suffix range, the last bytes of the file
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return &byteRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
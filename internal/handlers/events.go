@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/events"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// eventsKeepAlive is how often an idle event stream is pinged, which also
+// detects clients that went away
+const eventsKeepAlive = 15 * time.Second
+
+// ConversionEvents streams the progress of a conversion
+// @Summary Stream conversion progress
+// @Description Streams status, progress (percentage, stage, ETA) and the final result of a conversion as Server-Sent Events. Send a WebSocket upgrade request to receive the same events as JSON WebSocket messages. The stream ends after the result event.
+// @Tags conversion
+// @Produce text/event-stream
+// @Param id path string true "Conversion ID"
+// @Success 200 {object} events.Event
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/convert/{id}/events [get]
+func (h *Handler) ConversionEvents(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := h.jobs.Get(c.Context(), id); err != nil {
+		return h.conversionLookupError(c, err)
+	}
+
+	if websocket.IsWebSocketUpgrade(c) {
+		return h.eventsSocket(c)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		send := func(event events.Event) error {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			return w.Flush()
+		}
+		ping := func() error {
+			fmt.Fprint(w, ": ping\n\n")
+			return w.Flush()
+		}
+
+		if err := h.streamEvents(id, send, ping, nil); err != nil {
+			h.logger.Debug("Event stream closed", "conversionID", id, "error", err)
+		}
+	})
+	return nil
+}
+
+// streamEventsSocket streams the events of a conversion over a WebSocket
+func (h *Handler) streamEventsSocket(conn *websocket.Conn) {
+	id := conn.Params("id")
+
+	// Read until the client closes the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event events.Event) error {
+		return conn.WriteJSON(event)
+	}
+	ping := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsKeepAlive))
+	}
+
+	if err := h.streamEvents(id, send, ping, closed); err != nil {
+		h.logger.Debug("Event socket closed", "conversionID", id, "error", err)
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// streamEvents sends the current status of a conversion followed by its live
+// events until the result has been sent, sending fails or done is closed
+func (h *Handler) streamEvents(id string, send func(events.Event) error, ping func() error, done <-chan struct{}) error {
+	// Subscribe before reading the status so no transition is missed in between
+	updates, unsubscribe := h.events.Subscribe(id)
+	defer unsubscribe()
+
+	conv, err := h.jobs.Get(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if conv.Status.IsFinal() {
+		h.withDownloadURL(context.Background(), conv)
+		return send(events.ResultEvent(conv))
+	}
+	if err := send(events.Event{Type: events.TypeStatus, Status: conv.Status}); err != nil {
+		return err
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-updates:
+			if !ok {
+				// The stream ended; the job store has the final state even
+				// if the result event was dropped
+				conv, err := h.jobs.Get(context.Background(), id)
+				if err != nil {
+					return err
+				}
+				h.withDownloadURL(context.Background(), conv)
+				return send(events.ResultEvent(conv))
+			}
+			if event.Type == events.TypeResult {
+				return send(event)
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-keepAlive.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
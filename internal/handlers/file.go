@@ -2,50 +2,91 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/amannvl/freefileconverterz/internal/fetch"
+	"github.com/amannvl/freefileconverterz/internal/queue"
+	"github.com/amannvl/freefileconverterz/internal/webhooks"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/converter/pipeline"
+	"github.com/amannvl/freefileconverterz/pkg/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/utils"
 )
 
 // ConvertFile handles file conversion requests
 // @Summary Convert a file to another format
-// @Description Converts an uploaded file to the specified target format
+// @Description Converts an uploaded file, a stored file such as a completed resumable upload, or a file downloaded from a URL to the specified target format. Files are identified by their content, so files without extension can be converted and files whose content does not match their extension are rejected.
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
-// @Param file formData file true "File to convert"
+// @Param file formData file false "File to convert, required without key or source_url"
+// @Param key formData string false "Storage key of the file to convert, the Upload-Key of a completed resumable upload, the key of an extracted file or of a conversion output of the caller"
+// @Param source_url formData string false "http or https URL the file to convert is downloaded from"
 // @Param format formData string true "Target format to convert to"
+// @Param options formData string false "Conversion options as JSON, e.g. {\"quality\":80}"
+// @Param callback_url formData string false "URL that receives a signed POST when the conversion completes, fails or is cancelled"
+// @Param X-API-Key header string false "API key whose webhook secret signs the callback, required with callback_url"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
 // @Router /api/v1/convert [post]
 func (h *Handler) ConvertFile(c *fiber.Ctx) error {
-	// Parse the multipart form
-	form, err := c.MultipartForm()
-	if err != nil {
-		h.logger.Error("Failed to parse form", "error", err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse form: " + err.Error(),
-		})
-	}
-
-	// Get the file from the form
-	files := form.File["file"]
-	if len(files) == 0 {
-		h.logger.Error("No file uploaded")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No file uploaded",
-		})
+	// The file is uploaded with the request, stored under "key", e.g. by a
+	// resumable upload, or downloaded from "source_url" by the worker
+	var fileHeader *multipart.FileHeader
+	var source fetch.Info
+	key := c.FormValue("key")
+	sourceURL := c.FormValue("source_url")
+	filename := filepath.Base(key)
+	switch {
+	case sourceURL != "" && key != "":
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_source_url", "Use either key or source_url", nil)
+	case sourceURL != "":
+		var err error
+		if source, filename, err = h.checkSourceURL(c.Context(), sourceURL); err != nil {
+			h.logger.Warn("Source URL rejected", "error", err, "url", sourceURL)
+			status, code, message := sourceURLError(err)
+			return h.errorResponse(c, status, code, message, err)
+		}
+	case key == "":
+		form, err := c.MultipartForm()
+		if err != nil {
+			h.logger.Error("Failed to parse form", "error", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to parse form: " + err.Error(),
+			})
+		}
+
+		files := form.File["file"]
+		if len(files) == 0 {
+			h.logger.Error("No file uploaded")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "No file uploaded",
+			})
+		}
+		fileHeader = files[0]
+		filename = fileHeader.Filename
+	default:
+		if err := h.checkStoredKey(c.Context(), currentUserID(c), key); err != nil {
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_key", "Stored file not found", err)
+		}
 	}
 
-	fileHeader := files[0]
-
 	// Get target format from form
 	targetFormat := c.FormValue("format")
 	if targetFormat == "" {
@@ -55,183 +96,342 @@ func (h *Handler) ConvertFile(c *fiber.Ctx) error {
 		})
 	}
 
+	// Build the conversion request from the form
+	req := models.ConversionRequest{TargetFormat: targetFormat}
+	if rawOptions := c.FormValue("options"); rawOptions != "" {
+		var err error
+		if req.Options, err = iface.ParseOptions([]byte(rawOptions)); err != nil {
+			var convErr *iface.ConversionError
+			errors.As(err, &convErr)
+			return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, convErr.Message, err)
+		}
+	}
+
+	// Callbacks are signed with the secret of the caller's API key
+	callbackURL := c.FormValue("callback_url")
+	var apiKeyID string
+	if callbackURL != "" {
+		if err := webhooks.ValidateCallbackURL(callbackURL); err != nil {
+			return h.errorResponse(c, fiber.StatusBadRequest, "invalid_callback_url", err.Error(), err)
+		}
+		var ok bool
+		if apiKeyID, ok = h.webhooks.SigningKey(c.Get("X-API-Key")); !ok {
+			return h.errorResponse(c, fiber.StatusUnauthorized, "invalid_api_key",
+				"callback_url requires an X-API-Key with a configured webhook secret", nil)
+		}
+	}
+
+	// Get the source format from the file name. Remote sources need one to
+	// pick the converter before they are downloaded, uploaded and stored
+	// files are identified by their content.
+	sourceFormat := filetype.FromName(filename)
+	if sourceFormat == "" && sourceURL != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "File has no extension",
+		})
+	}
+	ext := extension(sourceFormat)
+
+	// Save the input now, the multipart form is released once the request
+	// ends. Remote sources are downloaded by the worker.
+	var workDir, srcPath string
+	var size int64
+	var err error
+	switch {
+	case fileHeader != nil:
+		workDir, srcPath, err = saveUpload(fileHeader, ext)
+		size = fileHeader.Size
+	case sourceURL != "":
+		workDir, srcPath, err = newWorkDir(ext)
+		size = max(source.Size, 0)
+	default:
+		workDir, srcPath, size, err = h.saveStored(c.Context(), key, ext)
+	}
+	if err != nil {
+		h.logger.Error("Failed to save uploaded file", "error", err, "filename", filename)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to save uploaded file", err)
+	}
+
+	// Reject inputs whose content does not match their name
+	if sourceURL == "" {
+		if sourceFormat, srcPath, err = detectFormat(srcPath, sourceFormat); err != nil {
+			os.RemoveAll(workDir)
+			h.logger.Warn("File rejected", "error", err, "filename", filename)
+			status, code, message := formatError(err)
+			return h.errorResponse(c, status, code, message, err)
+		}
+	}
+
+	// Resolve the converter and validate the options before the job starts
+	converter, err := h.converterFactory.GetConverter(sourceFormat, req.TargetFormat, req.Options)
+	if err != nil {
+		os.RemoveAll(workDir)
+		var convErr *iface.ConversionError
+		if errors.As(err, &convErr) {
+			return h.errorResponse(c, fiber.StatusBadRequest, convErr.Code, convErr.Message, err)
+		}
+		return h.errorResponse(c, fiber.StatusBadRequest, "unsupported_conversion",
+			fmt.Sprintf("Conversion from %s to %s is not supported", sourceFormat, req.TargetFormat), err)
+	}
+
+	// Determine the worker pool the conversion runs on
+	category, err := h.converterFactory.Category(sourceFormat, req.TargetFormat)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return h.errorResponse(c, fiber.StatusBadRequest, "unsupported_conversion",
+			fmt.Sprintf("Conversion from %s to %s is not supported", sourceFormat, req.TargetFormat), err)
+	}
+
 	h.logger.Info("Starting file conversion", 
-		"filename", fileHeader.Filename, 
-		"size", fileHeader.Size,
+		"filename", filename, 
+		"size", size,
 		"targetFormat", targetFormat,
 	)
 
 	// Create a new conversion
-	conversionID := utils.UUIDv4()
-	now := time.Now()
-	conversion := &Conversion{
-		ID:           conversionID,
-		Status:       "pending",
-		CreatedAt:    now,
-		TargetFormat: targetFormat,
-		OriginalName: fileHeader.Filename,
-		FileSize:     fileHeader.Size,
+	conversion := newConversion(currentUserID(c), filename, size, sourceFormat, req, converter)
+	conversion.CallbackURL = callbackURL
+	conversion.APIKeyID = apiKeyID
+	conversion.SourceURL = sourceURL
+	conversionID := conversion.ID
+
+	var download func(ctx context.Context) error
+	if sourceURL != "" {
+		download = h.downloadSource(conversionID, sourceURL, srcPath)
 	}
 
-	// Store the conversion
-	h.mu.Lock()
-	h.conversions[conversionID] = conversion
-	h.mu.Unlock()
-
-	// Process the conversion in the background
-	go h.processConversion(conversionID, &FileHeader{fileHeader}, targetFormat)
+	// Store the conversion and queue it for a background worker
+	if err := h.enqueueConversion(c.Context(), conversion, category, workDir, srcPath, converter, req, download); err != nil {
+		return h.enqueueError(c, err, conversionID, category)
+	}
 
-	h.logger.Info("Conversion started", "conversionID", conversionID)
+	if conversion.Status == models.StatusPending {
+		h.logger.Info("Conversion queued", "conversionID", conversionID, "category", category)
+	}
 
-	// Return the conversion ID to track progress
+	// Return the conversion ID to track progress; a cached result is
+	// completed right away
 	return c.JSON(fiber.Map{
 		"id":     conversionID,
-		"status": "pending",
+		"status": conversion.Status,
 	})
 }
 
+// newConversion builds the record of a pending conversion
+func newConversion(userID, originalName string, size int64, sourceFormat string, req models.ConversionRequest, converter iface.Converter) *models.Conversion {
+	now := time.Now()
+	conversion := &models.Conversion{
+		ID:           utils.UUIDv4(),
+		UserID:       userID,
+		CreatedAt:    now,
+		SourceFormat: sourceFormat,
+		TargetFormat: req.TargetFormat,
+		OriginalName: originalName,
+		FileSize:     size,
+		Options:      req.Options.Redacted(),
+		Path:         []string{sourceFormat, req.TargetFormat},
+	}
+	conversion.SetStatus(models.StatusPending, now)
 
-
-// FileHeader wraps multipart.FileHeader to implement our interface
-type FileHeader struct {
-	*multipart.FileHeader
-}
-
-// Filename returns the name of the file
-func (f *FileHeader) Filename() string {
-	return f.FileHeader.Filename
-}
-
-// Size returns the size of the file in bytes
-func (f *FileHeader) Size() int64 {
-	return f.FileHeader.Size
-}
-
-// Open returns a ReadCloser for the file
-func (f *FileHeader) Open() (multipart.File, error) {
-	return f.FileHeader.Open()
+	// Report the intermediate formats of a multi-hop conversion
+	if p, ok := converter.(*pipeline.Pipeline); ok {
+		conversion.Path = p.Path()
+	}
+	return conversion
 }
 
-// processConversion handles the actual file conversion in a separate goroutine
-func (h *Handler) processConversion(conversionID string, fileHeader *FileHeader, targetFormat string) {
-	// Update status to processing
-	h.updateConversionStatus(conversionID, "processing")
-
-	// Log the start of conversion
-	h.logger.Info("Starting conversion",
-		"conversionID", conversionID,
-		"filename", fileHeader.Filename(),
-		"targetFormat", targetFormat,
-	)
+// enqueueConversion stores a conversion and queues it for a background
+// worker. The worker runs download, if set, to write the input to srcPath
+// first. A conversion whose result is cached completes without being queued.
+// The working directory is removed once the job ends, or right away if the
+// conversion is not queued.
+func (h *Handler) enqueueConversion(ctx context.Context, conversion *models.Conversion, category, workDir, srcPath string, converter iface.Converter, req models.ConversionRequest, download func(ctx context.Context) error) error {
+	conversionID := conversion.ID
+
+	// The input of remote sources is only known once the worker downloaded it
+	var cacheKey string
+	if download == nil {
+		var err error
+		if cacheKey, err = h.resultKey(srcPath, conversion.SourceFormat, req); err != nil {
+			os.RemoveAll(workDir)
+			return err
+		}
+	}
 
-	// Get the appropriate converter
-	ext := filepath.Ext(fileHeader.Filename())
-	if ext == "" {
-		err := fmt.Errorf("file has no extension")
-		h.logger.Error("File extension error", "error", err, "filename", fileHeader.Filename())
-		h.updateConversionError(conversionID, err)
-		return
+	if err := h.jobs.Create(ctx, conversion); err != nil {
+		os.RemoveAll(workDir)
+		return fmt.Errorf("failed to store conversion: %w", err)
 	}
 
-	sourceFormat := ext[1:] // Remove the dot
-	h.logger.Info("Getting converter", 
-		"sourceFormat", sourceFormat, 
-		"targetFormat", targetFormat,
-		"conversionID", conversionID,
-	)
+	if cacheKey != "" && h.useCachedResult(ctx, conversionID, cacheKey) {
+		os.RemoveAll(workDir)
+		conversion.Status = models.StatusCompleted
+		return nil
+	}
 
-	converter, err := h.converterFactory.GetConverter(sourceFormat, targetFormat)
+	err := h.queue.Submit(queue.Job{
+		ID:       conversionID,
+		Category: category,
+		Run: func(ctx context.Context) {
+			defer os.RemoveAll(workDir)
+			// The stream outlives the job if it was not finished, e.g.
+			// because the conversion was deleted while it ran
+			defer h.events.Done(conversionID)
+			h.updateConversionStatus(conversionID, models.StatusProcessing)
+			key := cacheKey
+			if download != nil {
+				if err := download(ctx); err != nil {
+					h.failConversion(ctx, conversionID, err)
+					return
+				}
+				var err error
+				if key, err = h.resultKey(srcPath, conversion.SourceFormat, req); err != nil {
+					h.failConversion(ctx, conversionID, err)
+					return
+				}
+				if h.useCachedResult(ctx, conversionID, key) {
+					return
+				}
+			}
+			h.processConversion(ctx, conversionID, srcPath, converter, req, key)
+		},
+		Discard: func() {
+			os.RemoveAll(workDir)
+		},
+	})
 	if err != nil {
-		err = fmt.Errorf("unsupported conversion from %s to %s: %w", sourceFormat, targetFormat, err)
-		h.logger.Error("Converter error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
-		return
+		os.RemoveAll(workDir)
+		if delErr := h.jobs.Delete(context.Background(), conversionID); delErr != nil {
+			h.logger.Error("Failed to remove rejected conversion", "error", delErr, "conversionID", conversionID)
+		}
+		return err
 	}
+	return nil
+}
 
-	h.logger.Info("Converter found", 
-		"converter", fmt.Sprintf("%T", converter),
-		"conversionID", conversionID,
-	)
+// enqueueError writes the response for a conversion that could not be queued
+func (h *Handler) enqueueError(c *fiber.Ctx, err error, conversionID, category string) error {
+	switch {
+	case errors.Is(err, queue.ErrQueueFull):
+		h.logger.Warn("Conversion rejected", "error", err, "conversionID", conversionID, "category", category)
+		c.Set(fiber.HeaderRetryAfter, "30")
+		return h.errorResponse(c, fiber.StatusTooManyRequests, "queue_full",
+			fmt.Sprintf("Too many %s conversions are waiting, please retry later", category), err)
+	case errors.Is(err, queue.ErrQueueClosed):
+		h.logger.Warn("Conversion rejected", "error", err, "conversionID", conversionID, "category", category)
+		return h.errorResponse(c, fiber.StatusServiceUnavailable, "shutting_down", "The server is shutting down, please retry later", err)
+	default:
+		h.logger.Error("Failed to store conversion", "error", err, "conversionID", conversionID)
+		return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to create conversion", err)
+	}
+}
 
-	// Create temporary directory for conversion
-	tempDir, err := os.MkdirTemp("", "conversion_*")
+// saveUpload copies an uploaded file into a new working directory and returns
+// the directory and the path of the copy
+func saveUpload(fileHeader *multipart.FileHeader, ext string) (string, string, error) {
+	workDir, err := os.MkdirTemp("", "conversion_*")
 	if err != nil {
-		err = fmt.Errorf("failed to create temp directory: %w", err)
-		h.logger.Error("Temp dir error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
-		return
+		return "", "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Save uploaded file to temp location
-	srcPath := filepath.Join(tempDir, "input"+ext)
-	dstFile, err := os.Create(srcPath)
+	srcPath := filepath.Join(workDir, "input"+ext)
+	if err := copyUpload(fileHeader, srcPath); err != nil {
+		os.RemoveAll(workDir)
+		return "", "", err
+	}
+	return workDir, srcPath, nil
+}
+
+// copyUpload writes the contents of an uploaded file to path
+func copyUpload(fileHeader *multipart.FileHeader, path string) error {
+	dstFile, err := os.Create(path)
 	if err != nil {
-		err = fmt.Errorf("failed to create temp file: %w", err)
-		h.logger.Error("Temp file create error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
-		return
+		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer dstFile.Close()
 
 	srcFile, err := fileHeader.Open()
 	if err != nil {
-		err = fmt.Errorf("failed to open uploaded file: %w", err)
-		h.logger.Error("File open error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
-		return
+		return fmt.Errorf("failed to open uploaded file: %w", err)
 	}
 	defer srcFile.Close()
 
 	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		err = fmt.Errorf("failed to save uploaded file: %w", err)
-		h.logger.Error("File save error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
+		return fmt.Errorf("failed to save uploaded file: %w", err)
+	}
+	return nil
+}
+
+// failConversion records the error of a conversion that did not finish,
+// unless the conversion was cancelled
+func (h *Handler) failConversion(ctx context.Context, conversionID string, err error) {
+	// The cancellation request has already marked the conversion as cancelled
+	if errors.Is(context.Cause(ctx), queue.ErrCancelled) {
+		h.logger.Info("Conversion cancelled", "conversionID", conversionID)
 		return
 	}
 
-	// Create output path
-	outputPath := filepath.Join(tempDir, "output."+targetFormat)
+	h.logger.Error("Conversion error", "error", err, "conversionID", conversionID)
+	h.updateConversionError(conversionID, err)
+}
+
+// processConversion converts a saved upload and stores the output in the
+// result cache under cacheKey; it runs on a queue worker
+func (h *Handler) processConversion(ctx context.Context, conversionID, srcPath string, converter iface.Converter, req models.ConversionRequest, cacheKey string) {
+	targetFormat := req.TargetFormat
 
-	// Convert the file
-	h.logger.Info("Starting file conversion", 
+	// Create output path next to the saved upload
+	outputPath := filepath.Join(filepath.Dir(srcPath), "output."+targetFormat)
+
+	// Log the start of conversion
+	h.logger.Info("Starting file conversion",
 		"conversionID", conversionID,
-		"sourceFormat", sourceFormat,
+		"converter", fmt.Sprintf("%T", converter),
+		"sourceFormat", strings.TrimPrefix(filepath.Ext(srcPath), "."),
 		"targetFormat", targetFormat,
 		"sourcePath", srcPath,
 		"outputPath", outputPath,
 	)
 
+	// Forward the converter's progress to the event stream
+	ctx = iface.WithProgress(ctx, func(progress iface.Progress) {
+		h.events.Progress(conversionID, progress)
+	})
+
+	// Converters report outputs packaged in another format, e.g. several
+	// pages of a document as ZIP, and their page count
+	var result iface.Result
+	ctx = iface.WithResult(ctx, func(r iface.Result) {
+		result = r
+	})
+
 	// Call the converter with file paths
-	err = converter.Convert(context.Background(), srcPath, outputPath)
-	if err != nil {
-		err = fmt.Errorf("conversion failed: %w", err)
-		h.logger.Error("Conversion error", "error", err, "conversionID", conversionID)
-		h.updateConversionError(conversionID, err)
+	if err := converter.Convert(ctx, srcPath, outputPath, req.Options); err != nil {
+		h.failConversion(ctx, conversionID, fmt.Errorf("conversion failed: %w", err))
 		return
 	}
 
-	// Read the converted file
+	// Open the converted file
 	h.logger.Info("Reading converted file", "conversionID", conversionID, "path", outputPath)
-	convertedData, err := os.ReadFile(outputPath)
+	converted, err := os.Open(outputPath)
 	if err != nil {
 		err = fmt.Errorf("failed to read converted file: %w", err)
 		h.logger.Error("Read converted file error", "error", err, "conversionID", conversionID)
 		h.updateConversionError(conversionID, err)
 		return
 	}
+	defer converted.Close()
 
-	// Generate a unique filename for the converted file
-	convertedName := fmt.Sprintf("%s.%s", utils.UUIDv4(), targetFormat)
+	h.logger.Info("Saving converted file", "conversionID", conversionID, "cacheKey", cacheKey)
 
-	h.logger.Info("Saving converted file", 
-		"conversionID", conversionID,
-		"convertedName", convertedName,
-		"size", len(convertedData),
-	)
-
-	// Save the converted file to storage
-	if _, err := h.storage.Save(context.Background(), convertedName, convertedData); err != nil {
+	// Save the converted file to storage through the result cache, so
+	// identical conversions reuse it
+	outputFormat := targetFormat
+	if result.Format != "" {
+		outputFormat = result.Format
+	}
+	entry, err := h.cache.Put(context.Background(), cacheKey, converted, "."+outputFormat, result)
+	if err != nil {
 		err = fmt.Errorf("failed to save converted file: %w", err)
 		h.logger.Error("Save converted file error", "error", err, "conversionID", conversionID)
 		h.updateConversionError(conversionID, err)
@@ -239,8 +439,11 @@ func (h *Handler) processConversion(conversionID string, fileHeader *FileHeader,
 	}
 
 	// Update conversion with success status
-	h.logger.Info("Conversion completed successfully", "conversionID", conversionID)
-	h.updateConversionSuccess(conversionID, convertedName, int64(len(convertedData)))
+	h.logger.Info("Conversion completed successfully", "conversionID", conversionID, "size", entry.Size, "pages", entry.Result.Pages)
+	if !h.updateConversionSuccess(conversionID, entry, false) {
+		// Cancelled while the output was saved
+		h.releaseOutput(context.Background(), conversionID, entry.OutputKey)
+	}
 }
 
 
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/gofiber/fiber/v2"
+)
+
+// extension returns the file extension of a format, including the dot
+func extension(format string) string {
+	if format == "" {
+		return ""
+	}
+	return "." + format
+}
+
+// detectFormat checks the content of a saved input against the format its
+// name claims and returns the format it is converted from together with its
+// path. An input without extension is renamed after the detected format.
+func detectFormat(srcPath, claimed string) (string, string, error) {
+	detected, err := filetype.DetectFile(srcPath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read input: %w", err)
+	}
+	format, err := filetype.Resolve(claimed, detected)
+	if err != nil {
+		return "", "", err
+	}
+
+	if format != claimed {
+		renamed := filepath.Join(filepath.Dir(srcPath), "input"+extension(format))
+		if err := os.Rename(srcPath, renamed); err != nil {
+			return "", "", fmt.Errorf("failed to rename input: %w", err)
+		}
+		srcPath = renamed
+	}
+	return format, srcPath, nil
+}
+
+// formatError returns the status, error code and message for an input whose
+// format could not be determined or does not match its content
+func formatError(err error) (int, string, string) {
+	var mismatch *filetype.MismatchError
+	switch {
+	case errors.As(err, &mismatch) && mismatch.Detected == "":
+		return fiber.StatusUnsupportedMediaType, "format_mismatch",
+			fmt.Sprintf("The file content is not a valid %s file", strings.ToUpper(mismatch.Claimed))
+	case errors.As(err, &mismatch):
+		return fiber.StatusUnsupportedMediaType, "format_mismatch",
+			fmt.Sprintf("The file content is %s, not %s as its name says", strings.ToUpper(mismatch.Detected), strings.ToUpper(mismatch.Claimed))
+	case errors.Is(err, filetype.ErrUnrecognized):
+		return fiber.StatusUnsupportedMediaType, "unrecognized_format", "The file has no extension and its format could not be recognized"
+	}
+	return fiber.StatusInternalServerError, "internal_error", "Failed to read uploaded file"
+}
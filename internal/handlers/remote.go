@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/amannvl/freefileconverterz/internal/fetch"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errUnexpectedContent is returned for source URLs serving an HTML page
+// instead of the file, e.g. a login or error page
+var errUnexpectedContent = errors.New("source URL serves an HTML page")
+
+// checkSourceURL checks the size and content type a source URL reports and
+// returns the file name it is converted under
+func (h *Handler) checkSourceURL(ctx context.Context, sourceURL string) (fetch.Info, string, error) {
+	info, err := h.fetcher.Head(ctx, sourceURL)
+	if err != nil {
+		return info, "", err
+	}
+
+	format := info.Format()
+	if info.ContentType == "text/html" && format != "html" && format != "htm" {
+		return info, "", errUnexpectedContent
+	}
+
+	name := info.Filename
+	if name == "" {
+		name = "download"
+	}
+	if filepath.Ext(name) == "" && format != "" {
+		name += "." + format
+	}
+	return info, name, nil
+}
+
+// sourceURLError returns the status, error code and message for a source URL
+// that cannot be converted
+func sourceURLError(err error) (int, string, string) {
+	var statusErr *fetch.StatusError
+	switch {
+	case errors.Is(err, fetch.ErrInvalidURL), errors.Is(err, fetch.ErrTooManyRedirects), errors.Is(err, errUnexpectedContent):
+		return fiber.StatusBadRequest, "invalid_source_url", err.Error()
+	case errors.Is(err, fetch.ErrBlockedAddress):
+		return fiber.StatusBadRequest, "blocked_source_url", "Source URL resolves to a private, loopback or link-local address"
+	case errors.Is(err, fetch.ErrTooLarge):
+		return fiber.StatusRequestEntityTooLarge, "source_too_large", err.Error()
+	case errors.As(err, &statusErr):
+		return fiber.StatusBadGateway, "source_unavailable", statusErr.Error()
+	}
+	return fiber.StatusBadGateway, "source_unavailable", "Source URL could not be fetched"
+}
+
+// newWorkDir creates the working directory of a conversion whose input is
+// written later and returns the directory and the input path
+func newWorkDir(ext string) (string, string, error) {
+	workDir, err := os.MkdirTemp("", "conversion_*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	return workDir, filepath.Join(workDir, "input"+ext), nil
+}
+
+// downloadSource returns the step that downloads a source URL into storage
+// and from there to srcPath. It runs on the queue worker, so cancelling the
+// conversion aborts the download.
+func (h *Handler) downloadSource(conversionID, sourceURL, srcPath string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		body, info, err := h.fetcher.Open(ctx, sourceURL)
+		if err != nil {
+			return fmt.Errorf("failed to download source: %w", err)
+		}
+		defer body.Close()
+
+		h.logger.Info("Downloading source", "conversionID", conversionID, "url", info.URL, "size", info.Size)
+
+		reader := &downloadReader{r: body, total: info.Size, report: func(percent float64) {
+			h.events.Progress(conversionID, iface.Progress{Percent: percent, Stage: "downloading"})
+		}}
+		key := path.Join("remote", conversionID, "source"+filepath.Ext(srcPath))
+		if _, err := h.storage.Save(ctx, key, reader); err != nil {
+			h.storage.Delete(context.Background(), key)
+			return fmt.Errorf("failed to download source: %w", err)
+		}
+		defer func() {
+			if err := h.storage.Delete(context.Background(), key); err != nil {
+				h.logger.Warn("Failed to remove downloaded source", "error", err, "conversionID", conversionID)
+			}
+		}()
+
+		size, err := h.copyStored(ctx, key, srcPath)
+		if err != nil {
+			return err
+		}
+		h.updateConversion(conversionID, func(conv *models.Conversion) {
+			conv.FileSize = size
+		})
+
+		// The converter was chosen by the format the source claimed
+		if _, err := filetype.Check(srcPath); err != nil {
+			return fmt.Errorf("downloaded source rejected: %w", err)
+		}
+		return nil
+	}
+}
+
+// copyStored writes the contents of a stored file to path and returns its size
+func (h *Handler) copyStored(ctx context.Context, key, path string) (int64, error) {
+	src, err := h.storage.Get(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open stored file: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer dst.Close()
+
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy stored file: %w", err)
+	}
+	return size, nil
+}
+
+// downloadReader reports the download progress of a source with a known size
+type downloadReader struct {
+	r        io.Reader
+	total    int64
+	read     int64
+	reported int
+	report   func(percent float64)
+}
+
+func (d *downloadReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.read += int64(n)
+	if d.total > 0 {
+		// Report whole percents only
+		if percent := int(d.read * 100 / d.total); percent > d.reported {
+			d.reported = percent
+			d.report(float64(percent))
+		}
+	}
+	return n, err
+}
@@ -3,20 +3,26 @@ package handlers
 import (
 	"log/slog"
 
+	"github.com/amannvl/freefileconverterz/internal/cache"
 	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/fetch"
+	"github.com/amannvl/freefileconverterz/internal/jobs"
 	"github.com/amannvl/freefileconverterz/internal/middleware"
+	"github.com/amannvl/freefileconverterz/internal/queue"
 	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/amannvl/freefileconverterz/internal/uploads"
+	"github.com/amannvl/freefileconverterz/internal/webhooks"
 	"github.com/amannvl/freefileconverterz/pkg/converter/factory"
 	"github.com/gofiber/fiber/v2"
 )
 
 // SetupRoutes configures all the routes for the application
-func SetupRoutes(app *fiber.App, cfg *config.Config, store storage.Storage, conv *factory.ConverterFactory, logger *slog.Logger) {
+func SetupRoutes(app *fiber.App, cfg *config.Config, store storage.Storage, conv *factory.ConverterFactory, jobStore jobs.JobStore, jobQueue *queue.Queue, dispatcher *webhooks.Dispatcher, uploadManager *uploads.Manager, fetcher *fetch.Fetcher, resultCache *cache.Cache, logger *slog.Logger) {
 	// Initialize handler with dependencies
-	handler := NewHandler(cfg, store, conv, logger)
+	handler := NewHandler(cfg, store, conv, jobStore, jobQueue, dispatcher, uploadManager, fetcher, resultCache, logger)
 
-	// Serve static files
-	app.Static("/downloads", "./uploads")
+	// Serve static files. Converted files are only served through the
+	// download endpoints and expiring signed links.
 	app.Static("/", "./static")
 
 	// Public routes
@@ -55,9 +61,32 @@ func setupAPIRoutes(api fiber.Router, h *Handler) {
 	api.Get("/health", h.HealthCheck)
 
 	// File conversion
-	api.Post("/convert", h.ConvertFile)
+	api.Get("/formats", h.GetFormats)
+	// Conversions, batches and uploads belong to the user of a bearer
+	// token, if any; stored files are only converted for their owner
+	api.Post("/convert", middleware.Identify(), h.ConvertFile)
 	api.Get("/convert/:id/status", h.GetConversionStatus)
 	api.Get("/convert/:id/download", h.DownloadFile)
+	api.Get("/files/*", h.DownloadSigned)
+	api.Get("/convert/:id/events", h.ConversionEvents)
+	api.Delete("/convert/:id", h.CancelConversion)
+
+	// Batch conversion
+	api.Post("/batches", middleware.Identify(), h.CreateBatch)
+	api.Get("/batches/:id", h.GetBatch)
+	api.Get("/batches/:id/download", h.DownloadBatch)
+
+	// Resumable uploads (tus 1.0)
+	api.Options("/uploads", h.UploadOptions)
+	api.Post("/uploads", middleware.Identify(), h.CreateUpload)
+	api.Head("/uploads/:id", h.GetUploadOffset)
+	api.Patch("/uploads/:id", h.AppendUpload)
+	api.Delete("/uploads/:id", h.DeleteUpload)
+
+	// Archive inspection, keys are URL-encoded and name stored files of
+	// the user
+	api.Get("/archives/:key/entries", middleware.Protected(), h.ListArchiveEntries)
+	api.Post("/archives/:key/extract", middleware.Protected(), h.ExtractArchive)
 
 	// User management (public)
 	api.Post("/register", h.Register)
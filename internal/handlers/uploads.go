@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/internal/uploads"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// tus protocol headers
+const (
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation,expiration,termination"
+	tusContentType     = "application/offset+octet-stream"
+	headerTusResumable = "Tus-Resumable"
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+	headerUploadExpire = "Upload-Expires"
+	headerUploadMeta   = "Upload-Metadata"
+	// headerUploadKey carries the storage key of a completed upload, which
+	// can be passed to the conversion endpoints as "key"
+	headerUploadKey = "Upload-Key"
+)
+
+// UploadOptions describes the resumable upload server
+// @Summary Resumable upload capabilities
+// @Description Returns the supported tus version, extensions and maximum upload size in the Tus-* headers
+// @Tags uploads
+// @Success 204
+// @Router /api/v1/uploads [options]
+func (h *Handler) UploadOptions(c *fiber.Ctx) error {
+	c.Set(headerTusResumable, tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	if max := h.uploads.MaxSize(); max > 0 {
+		c.Set("Tus-Max-Size", strconv.FormatInt(max, 10))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload
+// @Summary Create resumable upload
+// @Description Creates a tus upload of Upload-Length bytes. Pass the file name as "filename" in Upload-Metadata, its extension is the source format of later conversions.
+// @Tags uploads
+// @Param Upload-Length header int true "Size of the file in bytes"
+// @Param Upload-Metadata header string false "Comma separated key and base64 value pairs"
+// @Success 201
+// @Failure 400 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Router /api/v1/uploads [post]
+func (h *Handler) CreateUpload(c *fiber.Ctx) error {
+	if c.Get(headerTusResumable) != tusVersion {
+		return h.tusVersionError(c)
+	}
+
+	length, err := strconv.ParseInt(c.Get(headerUploadLength), 10, 64)
+	if err != nil || length < 0 {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_upload", "Upload-Length must be a non-negative integer", err)
+	}
+	metadata, err := parseUploadMetadata(c.Get(headerUploadMeta))
+	if err != nil {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_upload", err.Error(), err)
+	}
+
+	upload, err := h.uploads.Create(c.Context(), currentUserID(c), length, metadata)
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	h.logger.Info("Resumable upload created", "uploadID", upload.ID, "length", length)
+
+	c.Location(strings.TrimSuffix(c.BaseURL()+c.Path(), "/") + "/" + upload.ID)
+	setUploadHeaders(c, upload)
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// GetUploadOffset returns the offset of a resumable upload
+// @Summary Get resumable upload offset
+// @Description Returns the number of bytes received in Upload-Offset, and the storage key of a completed upload in Upload-Key
+// @Tags uploads
+// @Param id path string true "Upload ID"
+// @Success 200
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /api/v1/uploads/{id} [head]
+func (h *Handler) GetUploadOffset(c *fiber.Ctx) error {
+	if c.Get(headerTusResumable) != tusVersion {
+		return h.tusVersionError(c)
+	}
+
+	upload, err := h.uploads.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	setUploadHeaders(c, upload)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// AppendUpload appends a chunk to a resumable upload
+// @Summary Append to resumable upload
+// @Description Appends the request body at Upload-Offset. The response carries the new offset, and the storage key in Upload-Key once the upload is complete.
+// @Tags uploads
+// @Accept application/offset+octet-stream
+// @Param id path string true "Upload ID"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Router /api/v1/uploads/{id} [patch]
+func (h *Handler) AppendUpload(c *fiber.Ctx) error {
+	if c.Get(headerTusResumable) != tusVersion {
+		return h.tusVersionError(c)
+	}
+	if c.Get(fiber.HeaderContentType) != tusContentType {
+		return h.errorResponse(c, fiber.StatusUnsupportedMediaType, "invalid_upload", "Content-Type must be "+tusContentType, nil)
+	}
+
+	offset, err := strconv.ParseInt(c.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return h.errorResponse(c, fiber.StatusBadRequest, "invalid_upload", "Upload-Offset must be a non-negative integer", err)
+	}
+
+	upload, err := h.uploads.Append(c.Context(), c.Params("id"), offset, bytes.NewReader(c.Body()))
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	if upload.Completed() {
+		h.logger.Info("Resumable upload completed", "uploadID", upload.ID, "key", upload.Key)
+	}
+
+	setUploadHeaders(c, upload)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DeleteUpload terminates a resumable upload
+// @Summary Delete resumable upload
+// @Description Removes an upload and its stored data
+// @Tags uploads
+// @Param id path string true "Upload ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/uploads/{id} [delete]
+func (h *Handler) DeleteUpload(c *fiber.Ctx) error {
+	if c.Get(headerTusResumable) != tusVersion {
+		return h.tusVersionError(c)
+	}
+
+	if err := h.uploads.Terminate(c.Context(), c.Params("id")); err != nil {
+		return h.uploadError(c, err)
+	}
+
+	c.Set(headerTusResumable, tusVersion)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// checkStoredKey checks that key names a stored file of the user: a
+// completed resumable upload, a file extracted from an archive or the
+// output of a completed conversion
+func (h *Handler) checkStoredKey(ctx context.Context, userID, key string) error {
+	if upload, err := h.uploads.Stored(ctx, key); err == nil {
+		if upload.UserID != userID {
+			return errStoredNotFound
+		}
+		return nil
+	}
+	if h.ownsExtracted(ctx, userID, key) {
+		return nil
+	}
+	// Conversions without a user cannot be told apart
+	if userID == "" {
+		return errStoredNotFound
+	}
+	conversions, err := h.jobs.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, conv := range conversions {
+		if conv.Status == models.StatusCompleted && conv.OutputKey == key {
+			return nil
+		}
+	}
+	return errStoredNotFound
+}
+
+// tusVersionError rejects requests for another protocol version
+func (h *Handler) tusVersionError(c *fiber.Ctx) error {
+	c.Set("Tus-Version", tusVersion)
+	return h.errorResponse(c, fiber.StatusPreconditionFailed, "unsupported_version",
+		"Tus-Resumable must be "+tusVersion, nil)
+}
+
+// uploadError maps upload errors to responses
+func (h *Handler) uploadError(c *fiber.Ctx, err error) error {
+	c.Set(headerTusResumable, tusVersion)
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		return h.errorResponse(c, fiber.StatusNotFound, "not_found", "Upload not found", err)
+	case errors.Is(err, uploads.ErrExpired):
+		return h.errorResponse(c, fiber.StatusGone, "upload_expired", "Upload has expired", err)
+	case errors.Is(err, uploads.ErrOffsetMismatch):
+		return h.errorResponse(c, fiber.StatusConflict, "offset_mismatch", "Upload-Offset does not match the upload's offset", err)
+	case errors.Is(err, uploads.ErrCompleted):
+		return h.errorResponse(c, fiber.StatusConflict, "offset_mismatch", "Upload is already complete", err)
+	case errors.Is(err, uploads.ErrTooLarge):
+		return h.errorResponse(c, fiber.StatusRequestEntityTooLarge, "upload_too_large", "Upload exceeds its length or the maximum upload size", err)
+	}
+	h.logger.Error("Resumable upload failed", "error", err, "uploadID", c.Params("id"))
+	return h.errorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to process upload", err)
+}
+
+// setUploadHeaders sets the tus headers describing an upload
+func setUploadHeaders(c *fiber.Ctx, upload *uploads.Upload) {
+	c.Set(headerTusResumable, tusVersion)
+	c.Set(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	c.Set(headerUploadLength, strconv.FormatInt(upload.Length, 10))
+	if !upload.ExpiresAt.IsZero() {
+		c.Set(headerUploadExpire, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if upload.Completed() {
+		c.Set(headerUploadKey, upload.Key)
+	}
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header, comma separated
+// pairs of a key and an optional base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata value of %q is not valid base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
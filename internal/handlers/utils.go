@@ -3,8 +3,12 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 // generateID creates a new unique ID
@@ -22,3 +26,24 @@ func getFileExtension(filename string) string {
 	}
 	return strings.TrimPrefix(ext, ".")
 }
+
+// outputBaseName returns the name of an uploaded file without directories
+// and extension, the name converted files are given
+func outputBaseName(originalName string) string {
+	// Names from Windows clients separate directories with backslashes,
+	// which extractors on Windows would restore as paths
+	base := path.Base(strings.ReplaceAll(originalName, `\`, "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if base == "" || base == "." || base == ".." || base == "/" {
+		return "file"
+	}
+	return base
+}
+
+// currentUserID returns the ID of the authenticated user, or "" for anonymous requests
+func currentUserID(c *fiber.Ctx) string {
+	if id := c.Locals("userID"); id != nil {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// conversionsBucket maps conversion IDs to JSON encoded conversions
+	conversionsBucket = []byte("conversions")
+	// userIndexBucket holds a "<user ID>\x00<conversion ID>" key per user owned conversion
+	userIndexBucket = []byte("conversions_by_user")
+	// batchesBucket maps batch IDs to JSON encoded batches
+	batchesBucket = []byte("batches")
+)
+
+// BoltStore implements JobStore on an embedded BoltDB database file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the BoltDB database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{conversionsBucket, userIndexBucket, batchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job store: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Create stores a new conversion
+func (s *BoltStore) Create(ctx context.Context, conv *models.Conversion) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(conversionsBucket).Get([]byte(conv.ID)) != nil {
+			return fmt.Errorf("conversion %s already exists", conv.ID)
+		}
+		return put(tx, conv)
+	})
+}
+
+// Get retrieves a conversion by ID
+func (s *BoltStore) Get(ctx context.Context, id string) (*models.Conversion, error) {
+	var conv *models.Conversion
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		conv, err = get(tx, id)
+		return err
+	})
+	return conv, err
+}
+
+// Update applies fn to the stored conversion and saves the result in a single transaction
+func (s *BoltStore) Update(ctx context.Context, id string, fn func(conv *models.Conversion) error) (*models.Conversion, error) {
+	var conv *models.Conversion
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		existing, err := get(tx, id)
+		if err != nil {
+			return err
+		}
+		previousUser := existing.UserID
+
+		if err := fn(existing); err != nil {
+			return err
+		}
+		existing.ID = id
+
+		if previousUser != existing.UserID && previousUser != "" {
+			if err := tx.Bucket(userIndexBucket).Delete(userIndexKey(previousUser, id)); err != nil {
+				return err
+			}
+		}
+		conv = existing
+		return put(tx, existing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// Delete removes a conversion
+func (s *BoltStore) Delete(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		conv, err := get(tx, id)
+		if err != nil {
+			return err
+		}
+		if conv.UserID != "" {
+			if err := tx.Bucket(userIndexBucket).Delete(userIndexKey(conv.UserID, id)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(conversionsBucket).Delete([]byte(id))
+	})
+}
+
+// List returns all conversions, oldest first
+func (s *BoltStore) List(ctx context.Context) ([]*models.Conversion, error) {
+	var convs []*models.Conversion
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(conversionsBucket).ForEach(func(_, data []byte) error {
+			var conv models.Conversion
+			if err := json.Unmarshal(data, &conv); err != nil {
+				return fmt.Errorf("failed to decode conversion: %w", err)
+			}
+			convs = append(convs, &conv)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortByCreated(convs)
+	return convs, nil
+}
+
+// ListByUser returns the conversions of a user, oldest first, using the user index
+func (s *BoltStore) ListByUser(ctx context.Context, userID string) ([]*models.Conversion, error) {
+	var convs []*models.Conversion
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := userIndexKey(userID, "")
+		c := tx.Bucket(userIndexBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			conv, err := get(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			convs = append(convs, conv)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortByCreated(convs)
+	return convs, nil
+}
+
+// CreateBatch stores a new batch
+func (s *BoltStore) CreateBatch(ctx context.Context, batch *models.Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch %s: %w", batch.ID, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(batchesBucket)
+		if b.Get([]byte(batch.ID)) != nil {
+			return fmt.Errorf("batch %s already exists", batch.ID)
+		}
+		return b.Put([]byte(batch.ID), data)
+	})
+}
+
+// GetBatch retrieves a batch by ID
+func (s *BoltStore) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	var batch models.Batch
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(batchesBucket).Get([]byte(id))
+		if data == nil {
+			return ErrBatchNotFound
+		}
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return fmt.Errorf("failed to decode batch %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// DeleteBatch removes a batch
+func (s *BoltStore) DeleteBatch(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(batchesBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrBatchNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// Close closes the database file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// get reads and decodes a conversion within a transaction
+func get(tx *bolt.Tx, id string) (*models.Conversion, error) {
+	data := tx.Bucket(conversionsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var conv models.Conversion
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return nil, fmt.Errorf("failed to decode conversion %s: %w", id, err)
+	}
+	return &conv, nil
+}
+
+// put encodes and writes a conversion and its user index entry within a transaction
+func put(tx *bolt.Tx, conv *models.Conversion) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("failed to encode conversion %s: %w", conv.ID, err)
+	}
+	if err := tx.Bucket(conversionsBucket).Put([]byte(conv.ID), data); err != nil {
+		return err
+	}
+	if conv.UserID != "" {
+		return tx.Bucket(userIndexBucket).Put(userIndexKey(conv.UserID, conv.ID), []byte{})
+	}
+	return nil
+}
+
+// userIndexKey builds the user index key of a conversion
+func userIndexKey(userID, id string) []byte {
+	return []byte(userID + "\x00" + id)
+}
@@ -0,0 +1,205 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/amannvl/freefileconverterz/pkg/models"
+)
+
+// MemoryStore implements JobStore in memory. State is lost on restart, so it
+// is meant for tests and single-process development setups.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	conversions map[string]*models.Conversion
+	byUser      map[string]map[string]struct{}
+	batches     map[string]*models.Batch
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		conversions: make(map[string]*models.Conversion),
+		byUser:      make(map[string]map[string]struct{}),
+		batches:     make(map[string]*models.Batch),
+	}
+}
+
+// Create stores a new conversion
+func (s *MemoryStore) Create(ctx context.Context, conv *models.Conversion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.conversions[conv.ID]; exists {
+		return fmt.Errorf("conversion %s already exists", conv.ID)
+	}
+	s.conversions[conv.ID] = clone(conv)
+	s.index(conv)
+	return nil
+}
+
+// Get retrieves a conversion by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (*models.Conversion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv, ok := s.conversions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(conv), nil
+}
+
+// Update applies fn to the stored conversion and saves the result
+func (s *MemoryStore) Update(ctx context.Context, id string, fn func(conv *models.Conversion) error) (*models.Conversion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.conversions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	updated := clone(existing)
+	if err := fn(updated); err != nil {
+		return nil, err
+	}
+	updated.ID = id
+
+	s.unindex(existing)
+	s.conversions[id] = updated
+	s.index(updated)
+	return clone(updated), nil
+}
+
+// Delete removes a conversion
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.unindex(conv)
+	delete(s.conversions, id)
+	return nil
+}
+
+// List returns all conversions, oldest first
+func (s *MemoryStore) List(ctx context.Context) ([]*models.Conversion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	convs := make([]*models.Conversion, 0, len(s.conversions))
+	for _, conv := range s.conversions {
+		convs = append(convs, clone(conv))
+	}
+	sortByCreated(convs)
+	return convs, nil
+}
+
+// ListByUser returns the conversions of a user, oldest first
+func (s *MemoryStore) ListByUser(ctx context.Context, userID string) ([]*models.Conversion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.byUser[userID]
+	convs := make([]*models.Conversion, 0, len(ids))
+	for id := range ids {
+		convs = append(convs, clone(s.conversions[id]))
+	}
+	sortByCreated(convs)
+	return convs, nil
+}
+
+// CreateBatch stores a new batch
+func (s *MemoryStore) CreateBatch(ctx context.Context, batch *models.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.batches[batch.ID]; exists {
+		return fmt.Errorf("batch %s already exists", batch.ID)
+	}
+	s.batches[batch.ID] = cloneBatch(batch)
+	return nil
+}
+
+// GetBatch retrieves a batch by ID
+func (s *MemoryStore) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, ok := s.batches[id]
+	if !ok {
+		return nil, ErrBatchNotFound
+	}
+	return cloneBatch(batch), nil
+}
+
+// DeleteBatch removes a batch
+func (s *MemoryStore) DeleteBatch(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.batches[id]; !ok {
+		return ErrBatchNotFound
+	}
+	delete(s.batches, id)
+	return nil
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// index adds a conversion to the user index
+func (s *MemoryStore) index(conv *models.Conversion) {
+	if conv.UserID == "" {
+		return
+	}
+	if s.byUser[conv.UserID] == nil {
+		s.byUser[conv.UserID] = make(map[string]struct{})
+	}
+	s.byUser[conv.UserID][conv.ID] = struct{}{}
+}
+
+// unindex removes a conversion from the user index
+func (s *MemoryStore) unindex(conv *models.Conversion) {
+	if ids, ok := s.byUser[conv.UserID]; ok {
+		delete(ids, conv.ID)
+		if len(ids) == 0 {
+			delete(s.byUser, conv.UserID)
+		}
+	}
+}
+
+// clone returns a copy of a conversion that shares no mutable state with the original
+func clone(conv *models.Conversion) *models.Conversion {
+	c := *conv
+	c.Path = append([]string(nil), conv.Path...)
+	c.Transitions = append([]models.StatusTransition(nil), conv.Transitions...)
+	c.Deliveries = append([]models.WebhookDelivery(nil), conv.Deliveries...)
+	if conv.StartedAt != nil {
+		t := *conv.StartedAt
+		c.StartedAt = &t
+	}
+	if conv.CompletedAt != nil {
+		t := *conv.CompletedAt
+		c.CompletedAt = &t
+	}
+	if conv.Options.CRF != nil {
+		crf := *conv.Options.CRF
+		c.Options.CRF = &crf
+	}
+	return &c
+}
+
+// cloneBatch returns a copy of a batch
+func cloneBatch(batch *models.Batch) *models.Batch {
+	b := *batch
+	b.ConversionIDs = append([]string(nil), batch.ConversionIDs...)
+	return &b
+}
@@ -0,0 +1,105 @@
+// Package jobs persists conversion jobs so their state survives restarts
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+)
+
+var (
+	// ErrNotFound is returned when a conversion does not exist in the store
+	ErrNotFound = errors.New("conversion not found")
+	// ErrBatchNotFound is returned when a batch does not exist in the store
+	ErrBatchNotFound = errors.New("batch not found")
+)
+
+// JobStore defines the interface for conversion job persistence.
+// Implementations return copies, so callers may modify the records they get
+// back without affecting the store.
+type JobStore interface {
+	// Create stores a new conversion
+	Create(ctx context.Context, conv *models.Conversion) error
+	// Get retrieves a conversion by ID
+	Get(ctx context.Context, id string) (*models.Conversion, error)
+	// Update applies fn to the stored conversion and saves the result atomically
+	Update(ctx context.Context, id string, fn func(conv *models.Conversion) error) (*models.Conversion, error)
+	// Delete removes a conversion
+	Delete(ctx context.Context, id string) error
+	// List returns all conversions, oldest first
+	List(ctx context.Context) ([]*models.Conversion, error)
+	// ListByUser returns the conversions of a user, oldest first
+	ListByUser(ctx context.Context, userID string) ([]*models.Conversion, error)
+	// CreateBatch stores a new batch
+	CreateBatch(ctx context.Context, batch *models.Batch) error
+	// GetBatch retrieves a batch by ID
+	GetBatch(ctx context.Context, id string) (*models.Batch, error)
+	// DeleteBatch removes a batch, leaving its conversions in place
+	DeleteBatch(ctx context.Context, id string) error
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// NewJobStore creates a new job store based on the configuration
+func NewJobStore(cfg config.JobStoreConfig) (JobStore, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt", "":
+		return NewBoltStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown job store driver %q", cfg.Driver)
+	}
+}
+
+// ErrorInterrupted is the error code of conversions that were still pending
+// or processing when the server stopped
+const ErrorInterrupted = "interrupted"
+
+// FailInterrupted marks the conversions a previous run left pending or
+// processing as failed. Their inputs were in working directories of that
+// run, so they cannot be resumed. It returns the number of conversions
+// marked.
+func FailInterrupted(ctx context.Context, store JobStore, now time.Time) (int, error) {
+	convs, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, conv := range convs {
+		if conv.Status.IsFinal() {
+			continue
+		}
+		_, err := store.Update(ctx, conv.ID, func(conv *models.Conversion) error {
+			if conv.Status.IsFinal() {
+				return nil
+			}
+			conv.Error = "conversion was interrupted by a server restart"
+			conv.ErrorCode = ErrorInterrupted
+			conv.SetStatus(models.StatusFailed, now)
+			failed++
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// sortByCreated orders conversions by creation time, then ID
+func sortByCreated(convs []*models.Conversion) {
+	sort.Slice(convs, func(i, j int) bool {
+		if !convs[i].CreatedAt.Equal(convs[j].CreatedAt) {
+			return convs[i].CreatedAt.Before(convs[j].CreatedAt)
+		}
+		return convs[i].ID < convs[j].ID
+	})
+}
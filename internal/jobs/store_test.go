@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) JobStore{
+		"memory": func(t *testing.T) JobStore {
+			return NewMemoryStore()
+		},
+		"bolt": func(t *testing.T) JobStore {
+			store, err := NewBoltStore(filepath.Join(t.TempDir(), "jobs.db"))
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+			testJobStore(t, store)
+		})
+	}
+}
+
+func testJobStore(t *testing.T, store JobStore) {
+	ctx := context.Background()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"job-b", "job-a", "job-c"} {
+		conv := &models.Conversion{
+			ID:           id,
+			UserID:       "alice",
+			SourceFormat: "png",
+			TargetFormat: "jpg",
+			CreatedAt:    created.Add(time.Duration(i) * time.Minute),
+		}
+		if id == "job-c" {
+			conv.UserID = "bob"
+		}
+		conv.SetStatus(models.StatusPending, conv.CreatedAt)
+		require.NoError(t, store.Create(ctx, conv))
+	}
+
+	t.Run("Create rejects duplicates", func(t *testing.T) {
+		assert.Error(t, store.Create(ctx, &models.Conversion{ID: "job-a"}))
+	})
+
+	t.Run("Update records status transitions", func(t *testing.T) {
+		started := created.Add(time.Hour)
+		_, err := store.Update(ctx, "job-a", func(conv *models.Conversion) error {
+			conv.SetStatus(models.StatusProcessing, started)
+			return nil
+		})
+		require.NoError(t, err)
+
+		completed := started.Add(time.Minute)
+		_, err = store.Update(ctx, "job-a", func(conv *models.Conversion) error {
+			conv.SetStatus(models.StatusCompleted, completed)
+			conv.OutputKey = "result.jpg"
+			return nil
+		})
+		require.NoError(t, err)
+
+		conv, err := store.Get(ctx, "job-a")
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusCompleted, conv.Status)
+		assert.Equal(t, "result.jpg", conv.OutputKey)
+		require.NotNil(t, conv.StartedAt)
+		assert.True(t, started.Equal(*conv.StartedAt))
+		require.NotNil(t, conv.CompletedAt)
+		assert.True(t, completed.Equal(*conv.CompletedAt))
+
+		statuses := make([]models.ConversionStatus, 0, len(conv.Transitions))
+		for _, transition := range conv.Transitions {
+			statuses = append(statuses, transition.Status)
+		}
+		assert.Equal(t, []models.ConversionStatus{models.StatusPending, models.StatusProcessing, models.StatusCompleted}, statuses)
+	})
+
+	t.Run("Update keeps the record when fn fails", func(t *testing.T) {
+		_, err := store.Update(ctx, "job-b", func(conv *models.Conversion) error {
+			conv.Error = "changed"
+			return errors.New("abort")
+		})
+		assert.Error(t, err)
+
+		conv, err := store.Get(ctx, "job-b")
+		require.NoError(t, err)
+		assert.Empty(t, conv.Error)
+	})
+
+	t.Run("returned records are copies", func(t *testing.T) {
+		conv, err := store.Get(ctx, "job-b")
+		require.NoError(t, err)
+		conv.Status = models.StatusFailed
+
+		conv, err = store.Get(ctx, "job-b")
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPending, conv.Status)
+	})
+
+	t.Run("List and ListByUser", func(t *testing.T) {
+		all, err := store.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-b", "job-a", "job-c"}, ids(all))
+
+		alice, err := store.ListByUser(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-b", "job-a"}, ids(alice))
+
+		_, err = store.Update(ctx, "job-b", func(conv *models.Conversion) error {
+			conv.UserID = "bob"
+			return nil
+		})
+		require.NoError(t, err)
+
+		alice, err = store.ListByUser(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-a"}, ids(alice))
+
+		bob, err := store.ListByUser(ctx, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-b", "job-c"}, ids(bob))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, store.Delete(ctx, "job-c"))
+
+		_, err := store.Get(ctx, "job-c")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Delete(ctx, "job-c"), ErrNotFound)
+
+		bob, err := store.ListByUser(ctx, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-b"}, ids(bob))
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		batch := &models.Batch{ID: "batch", UserID: "alice", ConversionIDs: []string{"job-a", "job-b"}, CreatedAt: created}
+		require.NoError(t, store.CreateBatch(ctx, batch))
+		assert.Error(t, store.CreateBatch(ctx, batch))
+
+		got, err := store.GetBatch(ctx, "batch")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"job-a", "job-b"}, got.ConversionIDs)
+
+		require.NoError(t, store.DeleteBatch(ctx, "batch"))
+		_, err = store.GetBatch(ctx, "batch")
+		assert.ErrorIs(t, err, ErrBatchNotFound)
+		assert.ErrorIs(t, store.DeleteBatch(ctx, "batch"), ErrBatchNotFound)
+	})
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	ctx := context.Background()
+
+	store, err := NewBoltStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, &models.Conversion{ID: "job", UserID: "alice", Status: models.StatusCompleted}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	conv, err := store.Get(ctx, "job")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, conv.Status)
+
+	convs, err := store.ListByUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Len(t, convs, 1)
+}
+
+func TestNewJobStoreRejectsUnknownDriver(t *testing.T) {
+	_, err := NewJobStore(config.JobStoreConfig{Driver: "redis"})
+	assert.ErrorContains(t, err, "unknown job store driver")
+
+	store, err := NewJobStore(config.JobStoreConfig{Driver: "Memory"})
+	require.NoError(t, err)
+	assert.NoError(t, store.Close())
+}
+
+func TestFailInterrupted(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, status := range []models.ConversionStatus{models.StatusPending, models.StatusProcessing, models.StatusCompleted} {
+		conv := &models.Conversion{ID: string(status), CreatedAt: created}
+		conv.SetStatus(status, created)
+		require.NoError(t, store.Create(ctx, conv))
+	}
+
+	restarted := created.Add(time.Hour)
+	failed, err := FailInterrupted(ctx, store, restarted)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failed)
+
+	for _, id := range []string{"pending", "processing"} {
+		conv, err := store.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusFailed, conv.Status)
+		assert.Equal(t, ErrorInterrupted, conv.ErrorCode)
+		assert.Equal(t, restarted, *conv.CompletedAt)
+	}
+	conv, err := store.Get(ctx, "completed")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, conv.Status)
+}
+
+func ids(convs []*models.Conversion) []string {
+	result := make([]string, 0, len(convs))
+	for _, conv := range convs {
+		result = append(result, conv.ID)
+	}
+	return result
+}
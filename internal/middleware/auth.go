@@ -10,37 +10,53 @@ import (
 // Protected protects routes with JWT authentication
 func Protected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		tokenString := c.Get("Authorization")
-		if tokenString == "" {
+		if c.Get("Authorization") == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Unauthorized",
 			})
 		}
+		return authenticate(c)
+	}
+}
 
-		// Remove "Bearer " prefix if present
-		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
+// Identify authenticates requests that carry a JWT and lets anonymous
+// requests through, so public routes can record who made a request
+func Identify() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
 		}
+		return authenticate(c)
+	}
+}
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// TODO: Replace with your actual secret key from config
-			return []byte("your-secret-key"), nil
-		})
+// authenticate validates the JWT of a request and adds the user to the context
+func authenticate(c *fiber.Ctx) error {
+	tokenString := c.Get("Authorization")
 
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
-		}
+	// Remove "Bearer " prefix if present
+	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
+		tokenString = tokenString[7:]
+	}
 
-		// Add user info to context
-		claims := token.Claims.(jwt.MapClaims)
-		c.Locals("userID", claims["user_id"])
-		c.Locals("userRole", claims["role"])
+	// Parse and validate token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// TODO: Replace with your actual secret key from config
+		return []byte("your-secret-key"), nil
+	})
 
-		return c.Next()
+	if err != nil || !token.Valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
 	}
+
+	// Add user info to context
+	claims := token.Claims.(jwt.MapClaims)
+	c.Locals("userID", claims["user_id"])
+	c.Locals("userRole", claims["role"])
+
+	return c.Next()
 }
 
 // RequireRole requires the user to have a specific role
@@ -0,0 +1,244 @@
+// Package queue runs background conversions on bounded worker pools
+package queue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+)
+
+var (
+	// ErrQueueFull is returned when a category already has the maximum number of waiting jobs
+	ErrQueueFull = errors.New("conversion queue is full")
+	// ErrQueueClosed is returned when the queue is shutting down
+	ErrQueueClosed = errors.New("conversion queue is shutting down")
+	// ErrCancelled is the cause of a job context cancelled through Cancel
+	ErrCancelled = errors.New("conversion cancelled")
+)
+
+// Job is a unit of background work
+type Job struct {
+	ID       string
+	Category string
+	// Run performs the work. The context is cancelled by Cancel, with
+	// ErrCancelled as its cause, or when a shutdown deadline expires.
+	Run func(ctx context.Context)
+	// Discard, if set, releases the job's resources when it is cancelled
+	// before a worker picked it up. Run is not called in that case.
+	Discard func()
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// Queue dispatches jobs to a fixed number of workers per converter category,
+// so slow tools such as LibreOffice or FFmpeg cannot exhaust the host.
+type Queue struct {
+	mu             sync.Mutex
+	pools          map[string]*pool
+	running        map[string]*Job
+	workers        map[string]int
+	defaultWorkers int
+	maxDepth       int
+	closed         bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger *slog.Logger
+}
+
+// pool holds the waiting jobs of one category
+type pool struct {
+	waiting []*Job
+	running int
+	ready   *sync.Cond
+}
+
+// New creates a Queue from the configuration. Worker pools are started lazily
+// the first time a job of their category is submitted.
+func New(cfg config.QueueConfig, logger *slog.Logger) *Queue {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.DefaultWorkers < 1 {
+		cfg.DefaultWorkers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		pools:          make(map[string]*pool),
+		running:        make(map[string]*Job),
+		workers:        cfg.Workers,
+		defaultWorkers: cfg.DefaultWorkers,
+		maxDepth:       cfg.MaxDepth,
+		ctx:            ctx,
+		cancel:         cancel,
+		logger:         logger,
+	}
+}
+
+// Submit queues a job. It returns ErrQueueFull when the job's category has
+// reached the queue depth limit and ErrQueueClosed after Shutdown was called.
+func (q *Queue) Submit(job Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	p := q.pool(job.Category)
+	if q.maxDepth > 0 && len(p.waiting) >= q.maxDepth {
+		return ErrQueueFull
+	}
+
+	job.ctx, job.cancel = context.WithCancelCause(q.ctx)
+	p.waiting = append(p.waiting, &job)
+	p.ready.Signal()
+	return nil
+}
+
+// Cancel cancels a job. A waiting job is removed from the queue and discarded;
+// a running job has its context cancelled. It returns false if the job is
+// neither waiting nor running.
+func (q *Queue) Cancel(id string) bool {
+	q.mu.Lock()
+	if job, ok := q.running[id]; ok {
+		q.mu.Unlock()
+		job.cancel(ErrCancelled)
+		return true
+	}
+
+	for _, p := range q.pools {
+		for i, job := range p.waiting {
+			if job.ID != id {
+				continue
+			}
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			q.mu.Unlock()
+
+			job.cancel(ErrCancelled)
+			if job.Discard != nil {
+				job.Discard()
+			}
+			return true
+		}
+	}
+	q.mu.Unlock()
+	return false
+}
+
+// Position returns the 1-based position of a waiting job within its category.
+// It returns false once the job has been picked up by a worker or is unknown.
+func (q *Queue) Position(id string) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range q.pools {
+		for i, job := range p.waiting {
+			if job.ID == id {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running jobs to
+// finish. When ctx expires first, the context passed to the jobs is cancelled,
+// the remaining jobs are still run so they can record their failure, and the
+// context error is returned.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	pending := 0
+	for _, p := range q.pools {
+		pending += len(p.waiting) + p.running
+		p.ready.Broadcast()
+	}
+	q.mu.Unlock()
+
+	q.logger.Info("Draining conversion queue", "jobs", pending)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.logger.Warn("Conversion queue drain timed out, cancelling remaining jobs")
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// pool returns the pool of a category, starting its workers on first use.
+// The caller must hold q.mu.
+func (q *Queue) pool(category string) *pool {
+	if p, ok := q.pools[category]; ok {
+		return p
+	}
+
+	workers := q.defaultWorkers
+	if n, ok := q.workers[category]; ok && n > 0 {
+		workers = n
+	}
+
+	p := &pool{ready: sync.NewCond(&q.mu)}
+	q.pools[category] = p
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work(p)
+	}
+	return p
+}
+
+// work runs jobs from a pool until the queue is closed and the pool is empty
+func (q *Queue) work(p *pool) {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for len(p.waiting) == 0 && !q.closed {
+			p.ready.Wait()
+		}
+		if len(p.waiting) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		job := p.waiting[0]
+		p.waiting[0] = nil
+		p.waiting = p.waiting[1:]
+		p.running++
+		q.running[job.ID] = job
+		q.mu.Unlock()
+
+		q.run(job)
+
+		q.mu.Lock()
+		p.running--
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}
+}
+
+// run executes a job, recovering from panics so a worker is never lost
+func (q *Queue) run(job *Job) {
+	defer job.cancel(nil)
+	defer func() {
+		if r := recover(); r != nil {
+			q.logger.Error("Conversion job panicked", "jobID", job.ID, "category", job.Category, "panic", r)
+		}
+	}()
+	job.Run(job.ctx)
+}
@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("limits workers per category", func(t *testing.T) {
+		q := New(config.QueueConfig{Workers: map[string]int{"video": 2}, DefaultWorkers: 1}, nil)
+
+		var running, peak int32
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			require.NoError(t, q.Submit(Job{ID: "job", Category: "video", Run: func(ctx context.Context) {
+				defer wg.Done()
+				n := atomic.AddInt32(&running, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}}))
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+		require.NoError(t, q.Shutdown(context.Background()))
+	})
+
+	t.Run("reports positions and rejects jobs over the depth limit", func(t *testing.T) {
+		q := New(config.QueueConfig{DefaultWorkers: 1, MaxDepth: 2}, nil)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		require.NoError(t, q.Submit(Job{ID: "running", Category: "document", Run: func(ctx context.Context) {
+			close(started)
+			<-release
+		}}))
+		<-started
+
+		noop := func(ctx context.Context) {}
+		require.NoError(t, q.Submit(Job{ID: "first", Category: "document", Run: noop}))
+		require.NoError(t, q.Submit(Job{ID: "second", Category: "document", Run: noop}))
+		assert.ErrorIs(t, q.Submit(Job{ID: "third", Category: "document", Run: noop}), ErrQueueFull)
+
+		// Other categories have their own limit
+		assert.NoError(t, q.Submit(Job{ID: "image", Category: "image", Run: noop}))
+
+		_, ok := q.Position("running")
+		assert.False(t, ok)
+		pos, ok := q.Position("second")
+		assert.True(t, ok)
+		assert.Equal(t, 2, pos)
+
+		close(release)
+		require.NoError(t, q.Shutdown(context.Background()))
+		assert.ErrorIs(t, q.Submit(Job{ID: "late", Category: "document", Run: noop}), ErrQueueClosed)
+	})
+
+	t.Run("drains queued jobs on shutdown", func(t *testing.T) {
+		q := New(config.QueueConfig{DefaultWorkers: 1}, nil)
+
+		var done int32
+		for i := 0; i < 5; i++ {
+			require.NoError(t, q.Submit(Job{ID: "job", Category: "audio", Run: func(ctx context.Context) {
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&done, 1)
+			}}))
+		}
+
+		require.NoError(t, q.Shutdown(context.Background()))
+		assert.Equal(t, int32(5), atomic.LoadInt32(&done))
+	})
+
+	t.Run("cancels jobs when the drain deadline expires", func(t *testing.T) {
+		q := New(config.QueueConfig{DefaultWorkers: 1}, nil)
+
+		started := make(chan struct{})
+		var cancelled int32
+		require.NoError(t, q.Submit(Job{ID: "slow", Category: "video", Run: func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			atomic.AddInt32(&cancelled, 1)
+		}}))
+		require.NoError(t, q.Submit(Job{ID: "queued", Category: "video", Run: func(ctx context.Context) {
+			if ctx.Err() != nil {
+				atomic.AddInt32(&cancelled, 1)
+			}
+		}}))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, q.Shutdown(ctx), context.DeadlineExceeded)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&cancelled))
+	})
+
+	t.Run("cancels waiting and running jobs", func(t *testing.T) {
+		q := New(config.QueueConfig{DefaultWorkers: 1}, nil)
+
+		started := make(chan struct{})
+		cause := make(chan error, 1)
+		require.NoError(t, q.Submit(Job{ID: "running", Category: "video", Run: func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			cause <- context.Cause(ctx)
+		}}))
+		<-started
+
+		var ran, discarded int32
+		require.NoError(t, q.Submit(Job{ID: "waiting", Category: "video",
+			Run:     func(ctx context.Context) { atomic.AddInt32(&ran, 1) },
+			Discard: func() { atomic.AddInt32(&discarded, 1) },
+		}))
+
+		assert.True(t, q.Cancel("waiting"))
+		_, ok := q.Position("waiting")
+		assert.False(t, ok)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&discarded))
+
+		assert.True(t, q.Cancel("running"))
+		assert.ErrorIs(t, <-cause, ErrCancelled)
+		assert.False(t, q.Cancel("unknown"))
+
+		require.NoError(t, q.Shutdown(context.Background()))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+	})
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/amannvl/freefileconverterz/internal/config"
 	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 )
 
 // FileService handles file operations
@@ -35,11 +37,6 @@ func (s *FileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 		return "", errors.New("file size exceeds maximum allowed size")
 	}
 
-	// Validate file type
-	if !s.isFileTypeAllowed(fileHeader.Filename) {
-		return "", errors.New("file type not allowed")
-	}
-
 	// Open the uploaded file
 	file, err := fileHeader.Open()
 	if err != nil {
@@ -47,9 +44,23 @@ func (s *FileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 	}
 	defer file.Close()
 
+	// Identify the file by its content, a name that does not match it is rejected
+	detected, err := filetype.Detect(file, fileHeader.Size)
+	if err != nil {
+		return "", err
+	}
+	format, err := filetype.Resolve(filetype.FromName(fileHeader.Filename), detected)
+	if err != nil {
+		return "", err
+	}
+
+	// Validate file type
+	if !s.isFileTypeAllowed(format) {
+		return "", errors.New("file type not allowed")
+	}
+
 	// Generate a unique filename
-	ext := filepath.Ext(fileHeader.Filename)
-	filename := generateUniqueFilename(userID, ext)
+	filename := generateUniqueFilename(userID, "."+format)
 
 	// Save the file
 	path, err := s.storage.Save(ctx, filename, file)
@@ -60,31 +71,27 @@ func (s *FileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 	return path, nil
 }
 
-// isFileTypeAllowed checks if the file type is allowed
-func (s *FileService) isFileTypeAllowed(filename string) bool {	ext := strings.ToLower(filepath.Ext(filename))
-	if len(ext) == 0 {
-		return false
-	}
-
-	// Remove the leading dot
-	ext = ext[1:]
+// isFileTypeAllowed checks if a detected format is allowed by its MIME type
+// or extension
+func (s *FileService) isFileTypeAllowed(format string) bool {
+	mimeType := registry.MIMEType(format)
 
 	for _, allowedType := range s.config.AllowedFileTypes {
 		// Handle wildcard patterns like "image/*"
 		if strings.Contains(allowedType, "/*") {
-			prefix := strings.TrimSuffix(allowedType, "/*")
-			if strings.HasPrefix(ext, prefix) {
+			prefix := strings.TrimSuffix(allowedType, "*")
+			if strings.HasPrefix(mimeType, prefix) {
 				return true
 			}
 		}
 
-		// Handle exact matches
-		if strings.EqualFold(ext, allowedType) {
+		// Handle exact MIME types
+		if strings.Contains(allowedType, "/") && strings.EqualFold(mimeType, allowedType) {
 			return true
 		}
 
-		// Handle extensions with leading dot
-		if strings.HasPrefix(allowedType, ".") && strings.EqualFold(ext, allowedType[1:]) {
+		// Handle extensions with or without leading dot
+		if strings.EqualFold(format, strings.TrimPrefix(allowedType, ".")) {
 			return true
 		}
 	}
@@ -15,6 +15,8 @@ import (
 	"time"
 
 	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 	"github.com/amannvl/freefileconverterz/pkg/utils"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -165,41 +167,17 @@ func (s *FileStorage) GetFileSize(filename string) (int64, error) {
 	return info.Size(), nil
 }
 
-// GetMimeType returns the MIME type of a file
+// GetMimeType returns the MIME type of a file judged by its content, or by
+// its extension if the content is not recognized
 func (s *FileStorage) GetMimeType(filename string) (string, error) {
-	filePath := filepath.Join(s.basePath, filename)
-	file, err := os.Open(filePath)
+	format, err := filetype.DetectFile(filepath.Join(s.basePath, filename))
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-
-	// Read the first 512 bytes to detect the content type
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return "", err
-	}
-
-	// Reset the read pointer
-	file.Seek(0, 0)
-
-	// Simple content type detection based on file extension
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg", nil
-	case ".png":
-		return "image/png", nil
-	case ".gif":
-		return "image/gif", nil
-	case ".pdf":
-		return "application/pdf", nil
-	case ".txt":
-		return "text/plain", nil
-	default:
-		return "application/octet-stream", nil
+	if format == "" {
+		format = filetype.FromName(filename)
 	}
+	return registry.MIMEType(format), nil
 }
 
 // MoveFile moves a file within the storage
@@ -220,10 +198,14 @@ type FileInfo struct {
 	ID        string
 	Name      string
 	Size      int64
+	ETag      string // Quoted entity tag, set by Stat
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// ErrNotFound is returned by Stat for files that do not exist
+var ErrNotFound = errors.New("file not found")
+
 // Storage defines the interface for storage operations
 type Storage interface {
 	// Save saves a file to the storage
@@ -234,12 +216,18 @@ type Storage interface {
 	Delete(ctx context.Context, path string) error
 	// URL returns the public URL for a file
 	URL(path string) string
+	// SignedURL returns a download link for a file that expires after ttl
+	SignedURL(ctx context.Context, path string, ttl time.Duration) (string, error)
 	// Read reads the entire file into memory
 	Read(ctx context.Context, path string) ([]byte, error)
 	// ReadStream returns a reader for the file
 	ReadStream(ctx context.Context, path string) (io.ReadCloser, error)
 	// Exists checks if a file exists
 	Exists(ctx context.Context, path string) (bool, error)
+	// Stat returns the size, modification time and ETag of a file
+	Stat(ctx context.Context, path string) (*FileInfo, error)
+	// GetRange retrieves length bytes of a file starting at offset
+	GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
 	// List lists all files in the storage with the given prefix
 	List(ctx context.Context, prefix string) ([]FileInfo, error)
 	// GetFullPath returns the full filesystem path for a given relative path
@@ -264,6 +252,7 @@ func NewStorage(cfg config.StorageConfig) (Storage, error) {
 type localStorage struct {
 	basePath string
 	baseURL  string
+	signer   *urlSigner
 }
 
 func newLocalStorage(cfg config.StorageConfig) (Storage, error) {
@@ -272,9 +261,15 @@ func newLocalStorage(cfg config.StorageConfig) (Storage, error) {
 		return nil, err
 	}
 
+	signer, err := newURLSigner(cfg.SignedURLSecret)
+	if err != nil {
+		return nil, err
+	}
+
 	return &localStorage{
 		basePath: cfg.UploadDir,
 		baseURL:  "", // Use relative URLs for local storage
+		signer:   signer,
 	}, nil
 }
 
@@ -366,6 +361,49 @@ func (s *localStorage) Exists(ctx context.Context, path string) (bool, error) {
 	return false, err
 }
 
+// Stat returns the size, modification time and ETag of a file. The ETag is
+// derived from the modification time and size.
+func (s *localStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	info, err := os.Stat(filepath.Join(s.basePath, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	return &FileInfo{
+		ID:        path,
+		Name:      path,
+		Size:      info.Size(),
+		ETag:      fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		CreatedAt: info.ModTime(),
+		UpdatedAt: info.ModTime(),
+	}, nil
+}
+
+// GetRange retrieves length bytes of a file starting at offset
+func (s *localStorage) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(s.basePath, path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rangeReader{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// rangeReader reads part of a file and closes the file
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
 // GetFullPath returns the full filesystem path for a given relative path
 func (s *localStorage) GetFullPath(path string) string {
 	return filepath.Join(s.basePath, path)
@@ -583,6 +621,44 @@ func (s *s3Storage) Exists(ctx context.Context, path string) (bool, error) {
 	return true, nil
 }
 
+// Stat returns the size, modification time and ETag of an object
+func (s *s3Storage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+		return nil, err
+	}
+
+	return &FileInfo{
+		ID:        path,
+		Name:      path,
+		Size:      aws.ToInt64(result.ContentLength),
+		ETag:      aws.ToString(result.ETag),
+		CreatedAt: aws.ToTime(result.LastModified),
+		UpdatedAt: aws.ToTime(result.LastModified),
+	}, nil
+}
+
+// GetRange retrieves length bytes of an object starting at offset
+func (s *s3Storage) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
 // GetFullPath returns the full S3 path for a given key
 func (s *s3Storage) GetFullPath(path string) string {
 	return fmt.Sprintf("s3://%s/%s", s.bucket, strings.TrimPrefix(path, "/"))
@@ -1,11 +1,17 @@
 package storage
 
 import (
+	"context"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/amannvl/freefileconverterz/internal/config"
 	"github.com/amannvl/freefileconverterz/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,6 +78,66 @@ func TestFileStorage(t *testing.T) {
 	})
 }
 
+func TestLocalStorageStatAndRange(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = store.Save(ctx, "out/video.mp4", []byte("0123456789"))
+	require.NoError(t, err)
+
+	info, err := store.Stat(ctx, "out/video.mp4")
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, info.Size)
+	assert.NotEmpty(t, info.ETag)
+	assert.False(t, info.UpdatedAt.IsZero())
+
+	part, err := store.GetRange(ctx, "out/video.mp4", 3, 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(part)
+	part.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "3456", string(data))
+
+	_, err = store.Stat(ctx, "out/missing.mp4")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Stat(ctx, "out")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStorageSignedURL(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir(), SignedURLSecret: "secret"})
+	require.NoError(t, err)
+	verifier := store.(URLVerifier)
+
+	link, err := store.SignedURL(ctx, "out/my file.pdf", time.Hour)
+	require.NoError(t, err)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, SignedURLPrefix+"out/my file.pdf", u.Path)
+
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	signature := u.Query().Get("signature")
+	assert.NoError(t, verifier.VerifySignedURL("out/my file.pdf", expires, signature))
+	assert.ErrorIs(t, verifier.VerifySignedURL("out/other.pdf", expires, signature), ErrInvalidSignature)
+	assert.ErrorIs(t, verifier.VerifySignedURL("out/my file.pdf", expires+3600, signature), ErrInvalidSignature)
+
+	// Links of another secret are rejected
+	other, err := NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir(), SignedURLSecret: "other"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.(URLVerifier).VerifySignedURL("out/my file.pdf", expires, signature), ErrInvalidSignature)
+
+	link, err = store.SignedURL(ctx, "out/my file.pdf", -time.Minute)
+	require.NoError(t, err)
+	u, err = url.Parse(link)
+	require.NoError(t, err)
+	expires, err = strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	assert.ErrorIs(t, verifier.VerifySignedURL("out/my file.pdf", expires, u.Query().Get("signature")), ErrLinkExpired)
+}
+
 // Test helper functions
 func createTestFile(path string, size int) error {
 	file, err := os.Create(path)
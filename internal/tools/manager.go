@@ -8,6 +8,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/amannvl/freefileconverterz/internal/utils"
 )
@@ -15,6 +18,9 @@ import (
 type ToolManager struct {
 	binManager *utils.BinaryManager
 	tempDir    string
+
+	versionsMu sync.Mutex
+	versions   map[string]string
 }
 
 // BinaryManager handles downloading and managing binary dependencies
@@ -69,13 +75,11 @@ func (tm *ToolManager) EnsureTools() error {
 		missingTools = append(missingTools, "LibreOffice (not executable)")
 	}
 
-	// Check ImageMagick
+	// Check ImageMagick (optional, common raster formats are converted natively without it)
 	if path, err := tm.GetImageMagickPath(); err != nil {
-		log.Printf("ImageMagick not found: %v", err)
-		missingTools = append(missingTools, "ImageMagick (for image conversions)")
+		log.Printf("Warning: ImageMagick not found. Images are converted natively, WebP output, HEIC and PDF are disabled: %v", err)
 	} else if !isExecutable(path) {
-		log.Printf("ImageMagick convert is not executable at %s", path)
-		missingTools = append(missingTools, "ImageMagick (not executable)")
+		log.Printf("Warning: ImageMagick is not executable at %s. Images are converted natively, WebP output, HEIC and PDF are disabled", path)
 	}
 
 	// Check FFmpeg
@@ -273,31 +277,24 @@ func (tm *ToolManager) GetUnrarPath() (string, error) {
 	return "", fmt.Errorf("unrar not found. Please install unrar or provide the path to the unrar binary")
 }
 
+// CommandContext is like exec.CommandContext, but cancelling the context kills
+// the command's whole process group rather than just the direct child
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	// Don't block on pipes held open by orphaned grandchildren
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
 // Command creates a new command with the tool
 func (tm *ToolManager) Command(ctx context.Context, tool string, args ...string) (*exec.Cmd, error) {
-	var path string
-	var err error
-
-	switch tool {
-	case "libreoffice":
-		path, err = tm.GetLibreOfficePath()
-	case "imagemagick":
-		path, err = tm.GetImageMagickPath()
-	case "ffmpeg":
-		path, err = tm.GetFFmpegPath()
-	case "7z":
-		path, err = tm.Get7zPath()
-	case "unrar":
-		path, err = tm.GetUnrarPath()
-	default:
-		return nil, fmt.Errorf("unknown tool: %s", tool)
-	}
-
+	path, err := tm.toolPath(tool)
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := exec.CommandContext(ctx, path, args...)
+	cmd := CommandContext(ctx, path, args...)
 	// Set the PATH to include our bin directory
 	cmd.Env = append(os.Environ(), 
 		fmt.Sprintf("PATH=%s:%s", filepath.Dir(path), os.Getenv("PATH")),
@@ -306,6 +303,90 @@ func (tm *ToolManager) Command(ctx context.Context, tool string, args ...string)
 	return cmd, nil
 }
 
+// IsAvailable reports whether the tool is currently installed. Besides the
+// tools known to Command, any binary on the PATH (tar, zip, unzip) can be checked.
+func (tm *ToolManager) IsAvailable(tool string) bool {
+	path, err := tm.toolPath(tool)
+	if err != nil {
+		path, err = exec.LookPath(tool)
+		if err != nil {
+			return false
+		}
+	}
+	return isExecutable(path)
+}
+
+// versionArgs are the arguments that make a tool print its version. Tools
+// not listed print it with --version, 7z and unrar print it in their banner.
+var versionArgs = map[string][]string{
+	"imagemagick": {"-version"},
+	"ffmpeg":      {"-version"},
+	"7z":          nil,
+	"unrar":       nil,
+	"unzip":       {"-v"},
+}
+
+// Version returns the first line a tool prints about its version, or "" if
+// the tool is not installed. Versions are resolved once, so a tool upgraded
+// while the server runs is only noticed after a restart.
+func (tm *ToolManager) Version(tool string) string {
+	tm.versionsMu.Lock()
+	defer tm.versionsMu.Unlock()
+
+	if version, ok := tm.versions[tool]; ok {
+		return version
+	}
+	if tm.versions == nil {
+		tm.versions = make(map[string]string)
+	}
+	version := tm.queryVersion(tool)
+	tm.versions[tool] = version
+	return version
+}
+
+func (tm *ToolManager) queryVersion(tool string) string {
+	path, err := tm.toolPath(tool)
+	if err != nil {
+		if path, err = exec.LookPath(tool); err != nil {
+			return ""
+		}
+	}
+
+	args, ok := versionArgs[tool]
+	if !ok {
+		args = []string{"--version"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Some tools exit with an error after printing their banner
+	output, _ := CommandContext(ctx, path, args...).CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// toolPath resolves the path of a known tool
+func (tm *ToolManager) toolPath(tool string) (string, error) {
+	switch tool {
+	case "libreoffice":
+		return tm.GetLibreOfficePath()
+	case "imagemagick":
+		return tm.GetImageMagickPath()
+	case "ffmpeg":
+		return tm.GetFFmpegPath()
+	case "7z":
+		return tm.Get7zPath()
+	case "unrar":
+		return tm.GetUnrarPath()
+	default:
+		return "", fmt.Errorf("unknown tool: %s", tool)
+	}
+}
+
 // Cleanup removes temporary files
 func (tm *ToolManager) Cleanup() error {
 	// Remove all files in temp directory
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not available; the
+// context still kills the direct child
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// DetachTerminal is a no-op where sessions are not available
+func DetachTerminal(cmd *exec.Cmd) {}
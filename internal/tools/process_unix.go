@@ -0,0 +1,27 @@
+//go:build unix
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group and makes
+// context cancellation kill the whole group, so helpers the tool spawns
+// (soffice.bin, ffmpeg filters) do not outlive it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// DetachTerminal starts the command of CommandContext in a session of its
+// own, without a controlling terminal, so a tool asking for a password
+// reads it from its standard input rather than the server's terminal. The
+// session is the command's process group as well.
+func DetachTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+}
@@ -0,0 +1,427 @@
+// Package uploads implements resumable uploads on top of storage.Storage.
+// Every appended chunk is stored as its own object, so uploads work with any
+// storage backend, and the chunks are joined into a single storage key once
+// the upload is complete. Uploads, complete or not, are removed once they
+// have not been written to for the configured expiration.
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/google/uuid"
+)
+
+// prefix is the storage prefix of resumable uploads
+const prefix = "uploads"
+
+var (
+	// ErrNotFound is returned for unknown uploads
+	ErrNotFound = errors.New("upload not found")
+	// ErrExpired is returned for uploads that were not completed in time
+	ErrExpired = errors.New("upload expired")
+	// ErrOffsetMismatch is returned when a chunk does not start at the current offset
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrTooLarge is returned when an upload exceeds its declared or the maximum length
+	ErrTooLarge = errors.New("upload too large")
+	// ErrCompleted is returned when appending to a completed upload
+	ErrCompleted = errors.New("upload already completed")
+)
+
+// Upload is the state of a resumable upload
+type Upload struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id,omitempty"` // Owner, empty for anonymous uploads
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Parts     []Part            `json:"parts,omitempty"`
+	Key       string            `json:"key,omitempty"` // Storage key of the completed file
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Part is a chunk stored as its own object until the upload completes
+type Part struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// Completed reports whether all bytes have been received
+func (u *Upload) Completed() bool {
+	return u.Key != ""
+}
+
+// Manager creates and appends to resumable uploads
+type Manager struct {
+	storage    storage.Storage
+	maxSize    int64
+	expiration time.Duration
+	logger     *slog.Logger
+	now        func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// NewManager creates a Manager storing uploads in store
+func NewManager(store storage.Storage, cfg config.StorageConfig, logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Manager{
+		storage:    store,
+		maxSize:    cfg.ResumableMaxSize,
+		expiration: cfg.ResumableExpiration,
+		logger:     logger,
+		now:        time.Now,
+		locks:      make(map[string]*uploadLock),
+	}
+}
+
+// MaxSize returns the maximum upload length, 0 if unlimited
+func (m *Manager) MaxSize() int64 {
+	return m.maxSize
+}
+
+// Create starts an upload of length bytes owned by userID
+func (m *Manager) Create(ctx context.Context, userID string, length int64, metadata map[string]string) (*Upload, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("invalid upload length %d", length)
+	}
+	if m.maxSize > 0 && length > m.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	now := m.now()
+	upload := &Upload{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.expiration),
+	}
+
+	// An empty upload is complete right away
+	if length == 0 {
+		if err := m.complete(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get returns the state of an upload
+func (m *Manager) Get(ctx context.Context, id string) (*Upload, error) {
+	upload, err := m.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if m.expired(upload) {
+		return nil, ErrExpired
+	}
+	return upload, nil
+}
+
+// Stored returns the completed upload whose file is stored under key. Other
+// keys, including those of the chunks and state of uploads, yield
+// ErrNotFound.
+func (m *Manager) Stored(ctx context.Context, key string) (*Upload, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(key, prefix+"/"), "/")
+	if !ok || !strings.HasPrefix(key, prefix+"/") {
+		return nil, ErrNotFound
+	}
+	upload, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Key != key {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
+
+// Append stores the data of a chunk starting at offset. Once the last byte
+// has been received the chunks are joined into the upload's storage key.
+func (m *Manager) Append(ctx context.Context, id string, offset int64, data io.Reader) (*Upload, error) {
+	unlock := m.lock(id)
+	defer unlock()
+
+	upload, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Completed() {
+		return nil, ErrCompleted
+	}
+	if offset != upload.Offset {
+		return nil, ErrOffsetMismatch
+	}
+
+	// Read one byte past the declared length to detect oversized chunks
+	remaining := upload.Length - upload.Offset
+	counter := &countingReader{r: io.LimitReader(data, remaining+1)}
+	partKey := partKey(id, offset)
+	if _, err := m.storage.Save(ctx, partKey, counter); err != nil {
+		return nil, fmt.Errorf("failed to store upload chunk: %w", err)
+	}
+	if counter.n > remaining {
+		m.storage.Delete(ctx, partKey)
+		return nil, ErrTooLarge
+	}
+	if counter.n == 0 {
+		m.storage.Delete(ctx, partKey)
+		return upload, nil
+	}
+
+	upload.Parts = append(upload.Parts, Part{Offset: offset, Size: counter.n})
+	upload.Offset += counter.n
+	upload.ExpiresAt = m.now().Add(m.expiration)
+
+	if upload.Offset == upload.Length {
+		if err := m.complete(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Terminate removes an upload and its stored data
+func (m *Manager) Terminate(ctx context.Context, id string) error {
+	unlock := m.lock(id)
+	defer unlock()
+
+	upload, err := m.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	m.remove(ctx, upload)
+	return nil
+}
+
+// RemoveExpired removes uploads past their expiration and returns how many
+// were removed
+func (m *Manager) RemoveExpired(ctx context.Context) (int, error) {
+	files, err := m.storage.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, file := range files {
+		name := path.Base(filepath.ToSlash(file.Name))
+		if !strings.HasSuffix(name, ".info") {
+			continue
+		}
+		id := strings.TrimSuffix(name, ".info")
+
+		unlock := m.lock(id)
+		upload, err := m.load(ctx, id)
+		if err == nil && m.expired(upload) {
+			m.remove(ctx, upload)
+			removed++
+		}
+		unlock()
+	}
+	return removed, nil
+}
+
+// Start removes expired uploads in the background every interval
+func (m *Manager) Start(interval time.Duration) {
+	m.ticker = time.NewTicker(interval)
+	m.done = make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-m.ticker.C:
+				removed, err := m.RemoveExpired(context.Background())
+				if err != nil {
+					m.logger.Error("Failed to remove expired uploads", "error", err)
+				} else if removed > 0 {
+					m.logger.Info("Removed expired uploads", "count", removed)
+				}
+			case <-m.done:
+				m.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background removal of expired uploads
+func (m *Manager) Stop() {
+	if m.done != nil {
+		close(m.done)
+	}
+}
+
+// complete joins the chunks of a fully received upload into its storage key
+func (m *Manager) complete(ctx context.Context, upload *Upload) error {
+	key := fileKey(upload)
+
+	readers := make([]io.Reader, 0, len(upload.Parts))
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	sort.Slice(upload.Parts, func(i, j int) bool { return upload.Parts[i].Offset < upload.Parts[j].Offset })
+	for _, part := range upload.Parts {
+		r, err := m.storage.Get(ctx, partKey(upload.ID, part.Offset))
+		if err != nil {
+			return fmt.Errorf("failed to open upload chunk: %w", err)
+		}
+		readers = append(readers, r)
+		closers = append(closers, r)
+	}
+
+	if _, err := m.storage.Save(ctx, key, io.MultiReader(readers...)); err != nil {
+		return fmt.Errorf("failed to join upload chunks: %w", err)
+	}
+
+	for _, part := range upload.Parts {
+		if err := m.storage.Delete(ctx, partKey(upload.ID, part.Offset)); err != nil {
+			m.logger.Warn("Failed to remove upload chunk", "error", err, "uploadID", upload.ID)
+		}
+	}
+	upload.Parts = nil
+	upload.Key = key
+	return nil
+}
+
+// remove deletes the stored data of an upload
+func (m *Manager) remove(ctx context.Context, upload *Upload) {
+	for _, part := range upload.Parts {
+		m.storage.Delete(ctx, partKey(upload.ID, part.Offset))
+	}
+	if upload.Key != "" {
+		m.storage.Delete(ctx, upload.Key)
+	}
+	if err := m.storage.Delete(ctx, infoKey(upload.ID)); err != nil {
+		m.logger.Warn("Failed to remove upload info", "error", err, "uploadID", upload.ID)
+	}
+}
+
+func (m *Manager) expired(upload *Upload) bool {
+	return m.expiration > 0 && m.now().After(upload.ExpiresAt)
+}
+
+func (m *Manager) load(ctx context.Context, id string) (*Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	exists, err := m.storage.Exists(ctx, infoKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	data, err := m.storage.Read(ctx, infoKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload %s: %w", id, err)
+	}
+	return &upload, nil
+}
+
+func (m *Manager) save(ctx context.Context, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload %s: %w", upload.ID, err)
+	}
+	// A reader, S3 storage does not save byte slices
+	if _, err := m.storage.Save(ctx, infoKey(upload.ID), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to store upload %s: %w", upload.ID, err)
+	}
+	return nil
+}
+
+// uploadLock is the lock of one upload and the number of callers holding or
+// waiting for it
+type uploadLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock serializes the operations on one upload
+func (m *Manager) lock(id string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		m.locks[id] = l
+	}
+	l.users++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		// Keep the lock while others wait for it
+		if l.users--; l.users == 0 {
+			delete(m.locks, id)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func infoKey(id string) string {
+	return prefix + "/" + id + ".info"
+}
+
+func partKey(id string, offset int64) string {
+	return fmt.Sprintf("%s/%s/part-%020d", prefix, id, offset)
+}
+
+// fileKey names the completed file after the uploaded file name, so its
+// extension tells the converters the source format
+func fileKey(upload *Upload) string {
+	name := path.Base(filepath.ToSlash(upload.Metadata["filename"]))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "upload"
+	}
+	return prefix + "/" + upload.ID + "/" + name
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(t *testing.T) (*Manager, storage.Storage) {
+	store, err := storage.NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir()})
+	require.NoError(t, err)
+	return NewManager(store, config.StorageConfig{ResumableMaxSize: 1 << 20, ResumableExpiration: time.Hour}, nil), store
+}
+
+// readerStorage saves readers only, like S3 storage
+type readerStorage struct {
+	storage.Storage
+}
+
+func (s readerStorage) Save(ctx context.Context, path string, file interface{}) (string, error) {
+	if _, ok := file.(io.Reader); !ok {
+		return "", errors.New("unsupported file type")
+	}
+	return s.Storage.Save(ctx, path, file)
+}
+
+func TestUploads(t *testing.T) {
+	ctx := context.Background()
+	m, store := newTestManager(t)
+
+	upload, err := m.Create(ctx, "alice", 11, map[string]string{"filename": "../clip.mp4"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, upload.Offset)
+	assert.False(t, upload.Completed())
+
+	upload, err = m.Append(ctx, upload.ID, 0, strings.NewReader("hello "))
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, upload.Offset)
+
+	// A retried chunk must resume at the stored offset
+	_, err = m.Append(ctx, upload.ID, 0, strings.NewReader("hello "))
+	assert.ErrorIs(t, err, ErrOffsetMismatch)
+
+	// Chunks may not exceed the declared length
+	_, err = m.Append(ctx, upload.ID, 6, strings.NewReader("world and more"))
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	upload, err = m.Append(ctx, upload.ID, 6, strings.NewReader("world"))
+	require.NoError(t, err)
+	require.True(t, upload.Completed())
+	assert.Equal(t, "uploads/"+upload.ID+"/clip.mp4", upload.Key)
+
+	data, err := store.Read(ctx, upload.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	got, err := m.Get(ctx, upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, upload.Key, got.Key)
+	assert.Empty(t, got.Parts)
+
+	// Only the file of a completed upload is looked up by its key
+	got, err = m.Stored(ctx, upload.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.UserID)
+	for _, key := range []string{infoKey(upload.ID), "uploads/" + upload.ID + "/other.mp4", "results/clip.mp4", "uploads/../clip.mp4"} {
+		_, err = m.Stored(ctx, key)
+		assert.ErrorIs(t, err, ErrNotFound, key)
+	}
+
+	_, err = m.Append(ctx, upload.ID, 11, strings.NewReader("!"))
+	assert.ErrorIs(t, err, ErrCompleted)
+
+	require.NoError(t, m.Terminate(ctx, upload.ID))
+	_, err = m.Get(ctx, upload.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	exists, err := store.Exists(ctx, upload.Key)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = m.Create(ctx, "", 2<<20, nil)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = m.Get(ctx, "../jobs")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUploadExpiration(t *testing.T) {
+	ctx := context.Background()
+	m, store := newTestManager(t)
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	stale, err := m.Create(ctx, "", 10, nil)
+	require.NoError(t, err)
+	_, err = m.Append(ctx, stale.ID, 0, strings.NewReader("abc"))
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	active, err := m.Create(ctx, "", 10, nil)
+	require.NoError(t, err)
+
+	now = now.Add(45 * time.Minute)
+	_, err = m.Get(ctx, stale.ID)
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = m.Append(ctx, stale.ID, 3, strings.NewReader("def"))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	removed, err := m.RemoveExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = m.Get(ctx, stale.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	exists, err := store.Exists(ctx, partKey(stale.ID, 0))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = m.Get(ctx, active.ID)
+	assert.NoError(t, err)
+}
+
+func TestUploadsReaderStorage(t *testing.T) {
+	ctx := context.Background()
+	local, err := storage.NewStorage(config.StorageConfig{Provider: "local", UploadDir: t.TempDir()})
+	require.NoError(t, err)
+	m := NewManager(readerStorage{local}, config.StorageConfig{ResumableMaxSize: 1 << 20, ResumableExpiration: time.Hour}, nil)
+
+	upload, err := m.Create(ctx, "", 5, map[string]string{"filename": "a.txt"})
+	require.NoError(t, err)
+	upload, err = m.Append(ctx, upload.ID, 0, strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.True(t, upload.Completed())
+}
@@ -0,0 +1,329 @@
+// Package webhooks delivers signed callbacks when conversions finish
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/fetch"
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	EventConversionCompleted = "conversion.completed"
+	EventConversionFailed    = "conversion.failed"
+	EventConversionCancelled = "conversion.cancelled"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderAttempt   = "X-Webhook-Attempt"
+)
+
+// ErrInvalidCallbackURL is returned for callback URLs that cannot be delivered to
+var ErrInvalidCallbackURL = errors.New("callback URL must be an absolute http or https URL")
+
+// Event is the JSON payload posted to a callback URL. Retries of a delivery
+// carry the same ID so receivers can drop duplicates.
+type Event struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	CreatedAt time.Time          `json:"created_at"`
+	Data      *models.Conversion `json:"data"`
+}
+
+// DeliveryLog records delivery attempts
+type DeliveryLog interface {
+	RecordDelivery(ctx context.Context, conversionID string, delivery models.WebhookDelivery) error
+}
+
+// Dispatcher posts conversion events to their callback URLs in the
+// background, retrying failed deliveries with exponential backoff. Pending
+// retries do not survive a restart.
+type Dispatcher struct {
+	secrets     map[string]string // Signing secret per API key ID
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	client      *http.Client
+	log         DeliveryLog
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu     sync.Mutex
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a Dispatcher from the configuration. Callbacks to
+// private, loopback and link-local addresses fail unless allowlisted.
+func NewDispatcher(cfg config.WebhookConfig, log DeliveryLog, logger *slog.Logger) (*Dispatcher, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	secrets := make(map[string]string, len(cfg.Secrets))
+	for apiKey, secret := range cfg.Secrets {
+		if secret != "" {
+			secrets[KeyID(apiKey)] = secret
+		}
+	}
+
+	transport, err := fetch.NewTransport(cfg.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook allowlist: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		secrets:     secrets,
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+		maxBackoff:  cfg.MaxBackoff,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// Report redirects as failed deliveries instead of following them
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		log:    log,
+		logger: logger,
+		now:    time.Now,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// SigningKey returns the ID of an API key if a webhook secret is configured for it
+func (d *Dispatcher) SigningKey(apiKey string) (string, bool) {
+	if apiKey == "" {
+		return "", false
+	}
+	id := KeyID(apiKey)
+	_, ok := d.secrets[id]
+	return id, ok
+}
+
+// ValidateCallbackURL checks that a callback URL can be delivered to
+func ValidateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidCallbackURL
+	}
+	return nil
+}
+
+// Notify queues the delivery of the event for a finished conversion. It does
+// nothing for conversions without a callback URL.
+func (d *Dispatcher) Notify(conv *models.Conversion) {
+	if conv.CallbackURL == "" {
+		return
+	}
+
+	eventType, ok := eventType(conv.Status)
+	if !ok {
+		return
+	}
+	secret, ok := d.secrets[conv.APIKeyID]
+	if !ok {
+		d.logger.Warn("No webhook secret for API key, dropping callback", "conversionID", conv.ID, "apiKeyID", conv.APIKeyID)
+		return
+	}
+
+	event := Event{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: d.now().UTC(),
+		Data:      conv,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		d.logger.Warn("Webhook dispatcher is shutting down, dropping callback", "conversionID", conv.ID, "event", eventType)
+		return
+	}
+	d.wg.Add(1)
+	go d.deliver(event, conv.CallbackURL, secret)
+}
+
+// Shutdown stops accepting events and waits for pending deliveries,
+// including their retries. When ctx expires first, the remaining deliveries
+// are abandoned.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// deliver posts an event until it is accepted or the attempts are used up
+func (d *Dispatcher) deliver(event Event, callbackURL, secret string) {
+	defer d.wg.Done()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		d.logger.Error("Failed to encode webhook event", "error", err, "conversionID", event.Data.ID)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		delivery := models.WebhookDelivery{
+			EventID: event.ID,
+			Event:   event.Type,
+			Attempt: attempt,
+			At:      d.now().UTC(),
+		}
+
+		status, err := d.send(callbackURL, secret, event, payload, attempt)
+		delivery.StatusCode = status
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Delivered = true
+		}
+		d.record(event.Data.ID, delivery)
+
+		if delivery.Delivered {
+			d.logger.Info("Webhook delivered", "conversionID", event.Data.ID, "event", event.Type, "attempt", attempt)
+			return
+		}
+		if attempt >= d.maxAttempts {
+			d.logger.Warn("Webhook delivery failed, giving up", "error", err, "conversionID", event.Data.ID, "event", event.Type, "attempts", attempt)
+			return
+		}
+
+		delay := d.retryDelay(attempt)
+		d.logger.Warn("Webhook delivery failed, retrying", "error", err, "conversionID", event.Data.ID, "attempt", attempt, "retryIn", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			d.logger.Warn("Webhook delivery abandoned on shutdown", "conversionID", event.Data.ID, "event", event.Type)
+			return
+		}
+	}
+}
+
+// send performs one delivery attempt. Any response other than 2xx is a failure.
+func (d *Dispatcher) send(callbackURL, secret string, event Event, payload []byte, attempt int) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FreeFileConverterZ-Webhooks/1.0")
+	req.Header.Set(HeaderID, event.ID)
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(attempt))
+	req.Header.Set(HeaderSignature, Sign(secret, d.now(), payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay returns the delay before the retry following attempt
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempt && (d.maxBackoff <= 0 || delay < d.maxBackoff); i++ {
+		delay *= 2
+	}
+	if d.maxBackoff > 0 && delay > d.maxBackoff {
+		return d.maxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) record(conversionID string, delivery models.WebhookDelivery) {
+	if d.log == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.log.RecordDelivery(ctx, conversionID, delivery); err != nil {
+		d.logger.Error("Failed to record webhook delivery", "error", err, "conversionID", conversionID)
+	}
+}
+
+// eventType maps a final conversion status to its event type
+func eventType(status models.ConversionStatus) (string, bool) {
+	switch status {
+	case models.StatusCompleted:
+		return EventConversionCompleted, true
+	case models.StatusFailed:
+		return EventConversionFailed, true
+	case models.StatusCancelled:
+		return EventConversionCancelled, true
+	}
+	return "", false
+}
+
+// JobLog records deliveries on the conversion in the job store, where they
+// are returned with the conversion
+type JobLog struct {
+	store jobs.JobStore
+}
+
+// NewJobLog creates a DeliveryLog backed by the job store
+func NewJobLog(store jobs.JobStore) *JobLog {
+	return &JobLog{store: store}
+}
+
+// RecordDelivery appends a delivery attempt to the conversion
+func (l *JobLog) RecordDelivery(ctx context.Context, conversionID string, delivery models.WebhookDelivery) error {
+	_, err := l.store.Update(ctx, conversionID, func(conv *models.Conversion) error {
+		conv.Deliveries = append(conv.Deliveries, delivery)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,158 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/config"
+	"github.com/amannvl/freefileconverterz/internal/jobs"
+	"github.com/amannvl/freefileconverterz/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher(t *testing.T) {
+	const apiKey, secret = "test-key", "test-secret"
+	cfg := config.WebhookConfig{
+		Secrets:     map[string]string{apiKey: secret},
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Timeout:     time.Second,
+		// The test receivers listen on loopback
+		Allowlist: []string{"127.0.0.1"},
+	}
+
+	newDispatcher := func(t *testing.T, cfg config.WebhookConfig, log DeliveryLog) *Dispatcher {
+		d, err := NewDispatcher(cfg, log, nil)
+		require.NoError(t, err)
+		return d
+	}
+
+	newConversion := func(t *testing.T, store jobs.JobStore, callbackURL string) *models.Conversion {
+		keyID, ok := newDispatcher(t, cfg, nil).SigningKey(apiKey)
+		require.True(t, ok)
+
+		conv := &models.Conversion{ID: "conv", CallbackURL: callbackURL, APIKeyID: keyID}
+		conv.SetStatus(models.StatusCompleted, time.Now())
+		require.NoError(t, store.Create(context.Background(), conv))
+		return conv
+	}
+
+	t.Run("retries until the receiver accepts a signed event", func(t *testing.T) {
+		var calls int32
+		received := make(chan Event, 1)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if !assert.NoError(t, Verify(secret, r.Header.Get(HeaderSignature), body, time.Minute, time.Now())) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			var event Event
+			require.NoError(t, json.Unmarshal(body, &event))
+			assert.Equal(t, event.ID, r.Header.Get(HeaderID))
+			assert.Equal(t, "3", r.Header.Get(HeaderAttempt))
+			received <- event
+		}))
+		defer receiver.Close()
+
+		store := jobs.NewMemoryStore()
+		d := newDispatcher(t, cfg, NewJobLog(store))
+		d.Notify(newConversion(t, store, receiver.URL))
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		event := <-received
+		assert.Equal(t, EventConversionCompleted, event.Type)
+		assert.Equal(t, "conv", event.Data.ID)
+
+		conv, err := store.Get(context.Background(), "conv")
+		require.NoError(t, err)
+		require.Len(t, conv.Deliveries, 3)
+		assert.Equal(t, http.StatusServiceUnavailable, conv.Deliveries[0].StatusCode)
+		assert.False(t, conv.Deliveries[0].Delivered)
+		assert.True(t, conv.Deliveries[2].Delivered)
+		assert.Equal(t, event.ID, conv.Deliveries[2].EventID)
+	})
+
+	t.Run("gives up after the maximum attempts", func(t *testing.T) {
+		var calls int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer receiver.Close()
+
+		store := jobs.NewMemoryStore()
+		d := newDispatcher(t, cfg, NewJobLog(store))
+		d.Notify(newConversion(t, store, receiver.URL))
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		conv, err := store.Get(context.Background(), "conv")
+		require.NoError(t, err)
+		assert.Len(t, conv.Deliveries, 3)
+	})
+
+	t.Run("refuses private addresses that are not allowlisted", func(t *testing.T) {
+		var calls int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+		}))
+		defer receiver.Close()
+
+		blocked := cfg
+		blocked.Allowlist = nil
+		blocked.MaxAttempts = 1
+		store := jobs.NewMemoryStore()
+		d := newDispatcher(t, blocked, NewJobLog(store))
+		d.Notify(newConversion(t, store, receiver.URL))
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		assert.Zero(t, atomic.LoadInt32(&calls))
+		conv, err := store.Get(context.Background(), "conv")
+		require.NoError(t, err)
+		require.Len(t, conv.Deliveries, 1)
+		assert.False(t, conv.Deliveries[0].Delivered)
+		assert.Contains(t, conv.Deliveries[0].Error, "blocked address")
+
+		_, err = NewDispatcher(config.WebhookConfig{Allowlist: []string{"10.0.0.0/8:80"}}, nil, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("skips conversions without a known key", func(t *testing.T) {
+		d := newDispatcher(t, cfg, nil)
+		_, ok := d.SigningKey("other-key")
+		assert.False(t, ok)
+
+		d.Notify(&models.Conversion{ID: "conv", Status: models.StatusFailed, CallbackURL: "http://127.0.0.1:1", APIKeyID: KeyID("other-key")})
+		require.NoError(t, d.Shutdown(context.Background()))
+	})
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{"id":"evt"}`)
+	header := Sign("secret", now, payload)
+
+	assert.NoError(t, Verify("secret", header, payload, time.Minute, now))
+	assert.ErrorIs(t, Verify("other", header, payload, time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":"evx"}`), time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, payload, time.Minute, now.Add(time.Hour)), ErrExpiredSignature)
+	assert.ErrorIs(t, Verify("secret", "garbage", payload, 0, now), ErrInvalidSignature)
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	assert.NoError(t, ValidateCallbackURL("https://example.com/hooks"))
+	assert.ErrorIs(t, ValidateCallbackURL("ftp://example.com"), ErrInvalidCallbackURL)
+	assert.ErrorIs(t, ValidateCallbackURL("/relative"), ErrInvalidCallbackURL)
+}
@@ -1,16 +1,21 @@
 package archive
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/amannvl/freefileconverterz/internal/tools"
 	"github.com/amannvl/freefileconverterz/pkg/converter/base"
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
 	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
 )
 
@@ -18,6 +23,7 @@ import (
 type ArchiveConverter struct {
 	*base.BaseConverter
 	toolManager *tools.ToolManager
+	limits      Limits
 }
 
 // NewArchiveConverter creates a new ArchiveConverter
@@ -25,68 +31,281 @@ func NewArchiveConverter(toolManager *tools.ToolManager, tempDir string) iface.C
 	converter := &ArchiveConverter{
 		BaseConverter: base.NewBaseConverter(toolManager, tempDir),
 		toolManager:   toolManager,
+		limits:        DefaultLimits,
 	}
 
-	// Register supported archive formats
-	converter.AddSupportedConversion("zip", "tar", "tar.gz", "tar.bz2", "tar.xz", "7z", "rar")
-	converter.AddSupportedConversion("tar", "zip", "tar.gz", "tar.bz2", "tar.xz", "7z")
-	converter.AddSupportedConversion("tar.gz", "zip", "tar", "tar.bz2", "tar.xz", "7z")
-	converter.AddSupportedConversion("tar.bz2", "zip", "tar", "tar.gz", "tar.xz", "7z")
-	converter.AddSupportedConversion("tar.xz", "zip", "tar", "tar.gz", "tar.bz2", "7z")
-	converter.AddSupportedConversion("7z", "zip", "tar", "tar.gz", "tar.bz2", "tar.xz")
-	converter.AddSupportedConversion("rar", "zip", "tar", "tar.gz", "tar.bz2", "tar.xz", "7z")
+	// Register supported archive formats, recording the tool each conversion
+	// needs. ZIP and tar archives are read and written natively, except that
+	// tar.bz2 and tar.lz4 archives are compressed by bzip2 and lz4. A zst
+	// file holds a single file rather than entries. Natively written
+	// formats convert to themselves too, to decrypt, encrypt or recompress
+	// an archive.
+	converter.SetCategory("archive", "")
+	native := []string{"zip", "tar", "tar.gz", "tar.xz", "tar.zst", "zst"}
+	for _, source := range append(native, "tar.bz2") {
+		converter.AddSupportedConversion(source, native...)
+	}
+	converter.SetTool("bzip2")
+	for _, source := range native {
+		converter.AddSupportedConversion(source, "tar.bz2")
+	}
+	converter.SetTool("lz4")
+	for _, source := range append(native, "tar.bz2") {
+		converter.AddSupportedConversion(source, "tar.lz4")
+		converter.AddSupportedConversion("tar.lz4", source)
+	}
+	converter.SetTool("7z")
+	for _, source := range append(native, "tar.bz2", "tar.lz4") {
+		converter.AddSupportedConversion(source, "7z")
+		converter.AddSupportedConversion("7z", source)
+	}
+	converter.SetTool("unrar")
+	converter.AddSupportedConversion("rar", append(native, "tar.bz2", "tar.lz4", "7z")...)
+
+	// The password decrypts encrypted inputs and encrypts ZIP and 7z
+	// outputs, the compression level applies to every compressed output and
+	// the volume size splits ZIP and 7z outputs
+	converter.SetOptionSchema(iface.OptionPassword, iface.OptionCompression, iface.OptionVolumeSize)
 
 	return converter
 }
 
-// Convert converts an archive from one format to another
-func (c *ArchiveConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+// SetLimits sets the limits archive entries are checked against before they are written
+func (c *ArchiveConverter) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
+// Convert converts an archive from one format to another. The password
+// option decrypts an encrypted archive and encrypts the new one if it is a
+// ZIP or 7z archive; wrong passwords fail with CodeInvalidPassword. The
+// volume_size option splits a new ZIP or 7z archive into volumes, which are
+// packed into a ZIP if there are several. Callers that do not receive the
+// result always get the archive whole.
+func (c *ArchiveConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
+	if opts.VolumeSize > 0 && !splittable(filetype.FromName(outputPath)) {
+		return iface.NewConversionError("invalid_option", "volume_size is only supported for zip and 7z archives", nil)
+	}
+	if opts.VolumeSize == 0 || !iface.ReceivesResult(ctx) {
+		return c.convert(ctx, inputPath, outputPath, opts, nil)
+	}
+
+	dir, err := os.MkdirTemp("", "volumes-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Volumes are named after the archive, e.g. archive.zip.001
+	volumes, err := c.ExtractArchive(ctx, inputPath, filepath.Join(dir, "archive."+filetype.FromName(outputPath)), nil, opts)
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 1 {
+		return copyVolume(volumes[0], outputPath)
+	}
+	if err := zipVolumes(outputPath, volumes); err != nil {
+		return err
+	}
+	iface.ReportResult(ctx, iface.Result{Format: "zip"})
+	return nil
+}
+
+// convert writes the entries of an archive picked by sel, or all entries if
+// sel is nil, to a new archive
+func (c *ArchiveConverter) convert(ctx context.Context, inputPath, outputPath string, opts iface.Options, sel *selection) error {
 	// Extract source and target formats from file extensions
-	sourceFormat := strings.TrimPrefix(filepath.Ext(inputPath), ".")
+	sourceFormat := filetype.FromName(inputPath)
 	if sourceFormat == "" {
 		return fmt.Errorf("could not determine source format from file extension")
 	}
 
-	targetFormat := strings.TrimPrefix(filepath.Ext(outputPath), ".")
+	targetFormat := filetype.FromName(outputPath)
 	if targetFormat == "" {
 		return fmt.Errorf("could not determine target format from file extension")
 	}
 
-	// Create a temporary directory for extraction
-	extractDir, err := os.MkdirTemp("", "extract-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
-	defer os.RemoveAll(extractDir)
 
-	// Extract the source archive
 	log.Debug().
 		Str("source", inputPath).
 		Str("target", outputPath).
 		Str("source_format", sourceFormat).
 		Str("target_format", targetFormat).
-		Msg("Extracting source archive")
+		Bool("password", opts.Password != "").
+		Int("compression_level", opts.CompressionLevel).
+		Msg("Converting archive")
+
+	// Entries go straight from one archive to the other when both formats
+	// are handled natively
+	if nativeReadable(sourceFormat) && targetFormat != "7z" {
+		return c.repack(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts, sel)
+	}
+
+	// 7z and RAR archives are extracted and created by their tools, zst
+	// files are decompressed first
+	extractDir, err := os.MkdirTemp("", "extract-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageExtracting})
+	if err := c.extractTo(ctx, inputPath, sourceFormat, extractDir, opts.Password, sel); err != nil {
+		return err
+	}
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 50, Stage: iface.StagePacking})
+	if targetFormat == "7z" {
+		if err := c.create7z(ctx, extractDir, outputPath, opts); err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+	} else if err := c.packDir(ctx, extractDir, outputPath, targetFormat, opts); err != nil {
+		return err
+	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StagePacking})
+
+	return nil
+}
+
+// repack copies the entries of a source archive into the target archive
+// one at a time, checking each before it is written
+func (c *ArchiveConverter) repack(ctx context.Context, src, dest, sourceFormat, targetFormat string, opts iface.Options, sel *selection) error {
+	f, err := openSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := newReader(f, sourceFormat, opts.Password)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StagePacking})
+	err = c.writeArchive(ctx, dest, targetFormat, opts, func(w archiveWriter) error {
+		return copyMembers(sel.filter(r), w, newInspector(c.limits, f.size), func() {
+			iface.ReportProgress(ctx, iface.Progress{Percent: f.percent(), Stage: iface.StagePacking})
+		})
+	})
+	if err != nil {
+		return err
+	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StagePacking})
+	return nil
+}
+
+// extractTo extracts the entries of an archive picked by sel, or all
+// entries if sel is nil, into dir
+func (c *ArchiveConverter) extractTo(ctx context.Context, src, format, dir, password string, sel *selection) error {
+	if nativeReadable(format) {
+		return c.extractNative(ctx, src, dir, format, password, sel)
+	}
+	if singleFile(format) {
+		return c.extractSingle(ctx, src, dir, sel)
+	}
+
+	// 7z and RAR archives are extracted whole by their tools, the picked
+	// entries are copied from there
+	extractDir := dir
+	if sel != nil {
+		var err error
+		if extractDir, err = os.MkdirTemp("", "extract-*"); err != nil {
+			return fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		defer os.RemoveAll(extractDir)
+	}
 
-	if err := c.extractArchive(inputPath, extractDir, sourceFormat); err != nil {
+	// Reject archives that would write outside the extraction directory or
+	// fill the disk before anything is written
+	if err := c.inspect(ctx, src, format, password); err != nil {
+		return err
+	}
+	if err := c.extractArchive(ctx, src, extractDir, format, password); err != nil {
 		return fmt.Errorf("failed to extract archive: %w", err)
 	}
+	if err := c.verifyExtracted(src, extractDir); err != nil {
+		return err
+	}
+	if sel == nil {
+		return nil
+	}
 
-	// Create output directory if it doesn't exist
-	outputDir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	r, err := newDirReader(extractDir)
+	if err != nil {
+		return err
 	}
+	defer r.Close()
+	return copyMembers(sel.filter(r), &dirWriter{dir: dir}, newInspector(Limits{}, 0), nil)
+}
 
-	// Create the target archive
-	log.Debug().
-		Str("path", outputPath).
-		Str("format", targetFormat).
-		Msg("Creating target archive")
+// extractNative extracts an archive read natively, checking each entry
+// before it is written
+func (c *ArchiveConverter) extractNative(ctx context.Context, src, dest, format, password string, sel *selection) error {
+	f, err := openSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := newReader(f, format, password)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return copyMembers(sel.filter(r), &dirWriter{dir: dest}, newInspector(c.limits, f.size), nil)
+}
 
-	if err := c.createArchive(extractDir, outputPath, targetFormat, nil); err != nil {
+// packDir creates an archive in a native format from an extracted directory
+func (c *ArchiveConverter) packDir(ctx context.Context, dir, dest, format string, opts iface.Options) error {
+	r, err := newDirReader(dir)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return c.writeArchive(ctx, dest, format, opts, func(w archiveWriter) error {
+		// The directory has been verified already, limits were checked then
+		return copyMembers(r, w, newInspector(Limits{}, 0), nil)
+	})
+}
+
+// writeArchive creates the archive dest, encrypted with the password and
+// compressed at the level of the options, and lets fill add its entries.
+// The archive is removed again if anything fails.
+func (c *ArchiveConverter) writeArchive(ctx context.Context, dest, format string, opts iface.Options, fill func(w archiveWriter) error) (err error) {
+	out, err := os.Create(dest)
+	if err != nil {
 		return fmt.Errorf("failed to create archive: %w", err)
 	}
+	defer func() {
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to create archive: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
 
+	buf := bufio.NewWriter(out)
+	w, err := newWriter(ctx, buf, format, opts)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := fill(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
 	return nil
 }
 
@@ -105,117 +324,83 @@ func (c *ArchiveConverter) SupportsConversion(sourceFormat, targetFormat string)
 	return c.BaseConverter.SupportsConversion(sourceFormat, targetFormat)
 }
 
-// extractArchive extracts an archive to the specified directory
-func (c *ArchiveConverter) extractArchive(src, dest, format string) error {
-	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(dest, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
-	}
-
+// extractArchive extracts an archive read by an external tool to the
+// specified directory
+func (c *ArchiveConverter) extractArchive(ctx context.Context, src, dest, format, password string) error {
 	switch format {
-	case "zip":
-		return c.extractZip(src, dest)
-	case "tar":
-		return c.extractTar(src, dest, false)
-	case "tar.gz", "tgz":
-		return c.extractTar(src, dest, true)
-	case "tar.bz2", "tbz2":
-		return c.extractTarBz2(src, dest)
-	case "tar.xz", "txz":
-		return c.extractTarXz(src, dest)
 	case "rar":
-		return c.extractRar(src, dest)
+		return runTool(ctx, password, "unrar", "x", "-o+", src, dest+string(filepath.Separator))
 	case "7z":
-		return c.extract7z(src, dest)
+		return runTool(ctx, password, "7z", "x", "-o"+dest, src)
 	default:
 		return fmt.Errorf("unsupported archive format: %s", format)
 	}
 }
 
-// createArchive creates an archive from the specified directory
-func (c *ArchiveConverter) createArchive(src, dest, format string, options map[string]interface{}) error {
-	// Create parent directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
-		return fmt.Errorf("failed to create parent directory: %w", err)
+// create7z creates a 7-Zip archive of the contents of a directory, encrypted
+// with AES-256 if a password is set
+func (c *ArchiveConverter) create7z(ctx context.Context, src, dest string, opts iface.Options) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
 	}
-
-	switch format {
-	case "zip":
-		return c.createZip(src, dest, options)
-	case "tar":
-		return c.createTar(src, dest, false, options)
-	case "tar.gz", "tgz":
-		return c.createTar(src, dest, true, options)
-	case "tar.bz2", "tbz2":
-		return c.createTarBz2(src, dest, options)
-	case "tar.xz", "txz":
-		return c.createTarXz(src, dest, options)
-	case "7z":
-		return c.create7z(src, dest, options)
-	default:
-		return fmt.Errorf("unsupported archive format: %s", format)
+	args := []string{"a", dest, "."}
+	if opts.CompressionLevel != 0 {
+		args = append(args, "-mx="+strconv.Itoa(opts.CompressionLevel))
 	}
+	// Entries are named relative to the directory
+	cmd := toolCommand(ctx, opts.Password, "7z", args...)
+	cmd.Dir = src
+	return cmd.Run()
 }
 
-// extractZip extracts a ZIP archive
-func (c *ArchiveConverter) extractZip(src, dest string) error {
-	return exec.Command("unzip", "-o", src, "-d", dest).Run()
-}
-
-// extractTar extracts a TAR archive, optionally with gzip compression
-func (c *ArchiveConverter) extractTar(src, dest string, gzipped bool) error {
-	args := []string{"-xf", src, "-C", dest}
-	if gzipped {
-		args = append([]string{"-z"}, args...)
+// toolCommand creates the command of an archive tool, args starting with
+// the tool's command. The password is never put on the command line, which
+// other local users can read: a bare -p switch makes the tool ask for it and
+// it is written to the tool's standard input, twice for tools that ask to
+// verify a new password. Without a password unrar is told not to ask.
+func toolCommand(ctx context.Context, password, name string, args ...string) *exec.Cmd {
+	var passwordSwitch string
+	switch {
+	case password != "":
+		passwordSwitch = "-p"
+	case name == "unrar":
+		passwordSwitch = "-p-"
 	}
-	return exec.Command("tar", args...).Run()
-}
-
-// extractTarBz2 extracts a BZIP2 compressed TAR archive
-func (c *ArchiveConverter) extractTarBz2(src, dest string) error {
-	return exec.Command("tar", "-xjf", src, "-C", dest).Run()
-}
-
-// extractTarXz extracts a XZ compressed TAR archive
-func (c *ArchiveConverter) extractTarXz(src, dest string) error {
-	return exec.Command("tar", "-xJf", src, "-C", dest).Run()
-}
-
-// extract7z extracts a 7-Zip archive
-func (c *ArchiveConverter) extract7z(src, dest string) error {
-	return exec.Command("7z", "x", "-o"+dest, src).Run()
-}
-
-// extractRar extracts a RAR archive
-func (c *ArchiveConverter) extractRar(src, dest string) error {
-	return exec.Command("unrar", "x", "-o+", src, dest).Run()
-}
-
-// createZip creates a ZIP archive
-func (c *ArchiveConverter) createZip(src, dest string, options map[string]interface{}) error {
-	return exec.Command("zip", "-r", dest, ".").Run()
-}
-
-// createTar creates a TAR archive, optionally with gzip compression
-func (c *ArchiveConverter) createTar(src, dest string, gzipped bool, options map[string]interface{}) error {
-	args := []string{"-cf", dest, "-C", filepath.Dir(src), filepath.Base(src)}
-	if gzipped {
-		args = append([]string{"-z"}, args...)
+	if passwordSwitch != "" && len(args) > 0 {
+		args = append([]string{args[0], passwordSwitch}, args[1:]...)
 	}
-	return exec.Command("tar", args...).Run()
-}
 
-// createTarBz2 creates a BZIP2 compressed TAR archive
-func (c *ArchiveConverter) createTarBz2(src, dest string, options map[string]interface{}) error {
-	return exec.Command("tar", "-cjf", dest, "-C", filepath.Dir(src), filepath.Base(src)).Run()
+	cmd := tools.CommandContext(ctx, name, args...)
+	if password != "" {
+		cmd.Stdin = strings.NewReader(password + "\n" + password + "\n")
+	}
+	// Without a terminal the tools read the password from standard input
+	tools.DetachTerminal(cmd)
+	return cmd
 }
 
-// createTarXz creates a XZ compressed TAR archive
-func (c *ArchiveConverter) createTarXz(src, dest string, options map[string]interface{}) error {
-	return exec.Command("tar", "-cJf", dest, "-C", filepath.Dir(src), filepath.Base(src)).Run()
+// runTool runs an archive tool given the password, if any. Wrong passwords
+// fail with CodeInvalidPassword.
+func runTool(ctx context.Context, password, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := toolCommand(ctx, password, name, args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil && wrongPassword(name, err, stderr.String()) {
+		return rejected(CodeInvalidPassword, "wrong or missing password for the archive")
+	}
+	return err
 }
 
-// create7z creates a 7-Zip archive
-func (c *ArchiveConverter) create7z(src, dest string, options map[string]interface{}) error {
-	return exec.Command("7z", "a", dest, src).Run()
+// wrongPassword reports whether a failed archive tool ran into an encrypted
+// archive it could not decrypt
+func wrongPassword(name string, err error, stderr string) bool {
+	var exitErr *exec.ExitError
+	if name == "unrar" && errors.As(err, &exitErr) && exitErr.ExitCode() == 11 {
+		return true
+	}
+	stderr = strings.ToLower(stderr)
+	return strings.Contains(stderr, "wrong password") || strings.Contains(stderr, "incorrect password") ||
+		strings.Contains(stderr, "password is incorrect")
 }
@@ -0,0 +1,429 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// CodeInvalidPassword is the error code of an encrypted archive read
+// without its password or with a wrong one
+const CodeInvalidPassword = "invalid_password"
+
+// WinZip AES encryption (https://www.winzip.com/en/support/aes-encryption/).
+// Entries encrypted with it have method 99, the real method is stored in an
+// extra field. Their content is a salt, a password verifier, the encrypted
+// compressed data and an authentication code.
+const (
+	methodAES        = 99
+	aesExtraID       = 0x9901
+	aesStrength256   = 3
+	aesVerifierSize  = 2
+	aesAuthSize      = 10
+	aesIterations    = 1000
+	zipCryptoHdrSize = 12 // Encryption header of traditional PKWARE encryption
+)
+
+// invalidPassword creates the error of an entry that cannot be decrypted
+func invalidPassword(name, password string) error {
+	if password == "" {
+		return rejected(CodeInvalidPassword, "archive entry %q is encrypted, a password is required", name)
+	}
+	return rejected(CodeInvalidPassword, "wrong password for archive entry %q", name)
+}
+
+// aesKeySize returns the key size of an AES strength, 1 to 3 for AES-128 to
+// AES-256
+func aesKeySize(strength byte) int {
+	switch strength {
+	case 1:
+		return 16
+	case 2:
+		return 24
+	case 3:
+		return 32
+	}
+	return 0
+}
+
+// aesExtra is the extra field of a ZIP entry encrypted with AES-256 whose
+// data is compressed with method. Entries are written as AE-1, which keeps
+// their CRC-32.
+func aesExtra(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 7)
+	binary.LittleEndian.PutUint16(b[4:], 1)
+	copy(b[6:], "AE")
+	b[8] = aesStrength256
+	binary.LittleEndian.PutUint16(b[9:], method)
+	return b
+}
+
+// aesInfo is the content of the AES extra field of a ZIP entry
+type aesInfo struct {
+	version  uint16 // 1 for AE-1, 2 for AE-2 which stores no CRC-32
+	strength byte
+	method   uint16
+}
+
+// parseAESExtra finds the AES extra field among the extra fields of an entry
+func parseAESExtra(extra []byte) (aesInfo, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == aesExtraID && size >= 7 {
+			return aesInfo{
+				version:  binary.LittleEndian.Uint16(extra[0:]),
+				strength: extra[4],
+				method:   binary.LittleEndian.Uint16(extra[5:]),
+			}, nil
+		}
+		extra = extra[size:]
+	}
+	return aesInfo{}, errors.New("zip: missing AES encryption field")
+}
+
+// aesKeys derives the encryption key, the authentication key and the
+// password verifier of an entry from the password and its salt
+func aesKeys(password string, salt []byte, keySize int) (encKey, authKey, verifier []byte) {
+	key := pbkdf2.Key([]byte(password), salt, aesIterations, 2*keySize+aesVerifierSize, sha1.New)
+	return key[:keySize], key[keySize : 2*keySize], key[2*keySize:]
+}
+
+// aesCTR is AES in counter mode with the little endian counter WinZip uses,
+// starting at 1
+type aesCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newAESCTR(key []byte) (*aesCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesCTR{block: block, used: aes.BlockSize}, nil
+}
+
+func (c *aesCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// aesCompressor returns a ZIP compressor that deflates entries at the
+// compression level and encrypts them with AES-256, for entries with method
+// 99 and the extra field of aesExtra
+func aesCompressor(password string, level int) zip.Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		salt := make([]byte, aesKeySize(aesStrength256)/2)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		encKey, authKey, verifier := aesKeys(password, salt, aesKeySize(aesStrength256))
+		ctr, err := newAESCTR(encKey)
+		if err != nil {
+			return nil, err
+		}
+		enc := &aesWriter{w: w, header: append(salt, verifier...), ctr: ctr, mac: hmac.New(sha1.New, authKey)}
+		fw, err := flate.NewWriter(enc, flateLevel(level))
+		if err != nil {
+			return nil, err
+		}
+		return &aesEntryWriter{Writer: fw, enc: enc}, nil
+	}
+}
+
+// aesWriter encrypts what is written to it and authenticates the result
+type aesWriter struct {
+	w      io.Writer
+	header []byte // Salt and password verifier, written before the data
+	ctr    *aesCTR
+	mac    hash.Hash
+	buf    []byte
+}
+
+// writeHeader writes the salt and password verifier. The compressor is
+// created before the entry header is written, so they are written with the
+// first data.
+func (w *aesWriter) writeHeader() error {
+	if w.header == nil {
+		return nil
+	}
+	_, err := w.w.Write(w.header)
+	w.header = nil
+	return err
+}
+
+func (w *aesWriter) Write(p []byte) (int, error) {
+	if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], p...)
+	w.ctr.XORKeyStream(w.buf, w.buf)
+	w.mac.Write(w.buf)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// aesEntryWriter compresses the content of an entry before it is encrypted
+// and appends the authentication code when it is closed
+type aesEntryWriter struct {
+	*flate.Writer
+	enc *aesWriter
+}
+
+func (w *aesEntryWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	if err := w.enc.writeHeader(); err != nil {
+		return err
+	}
+	_, err := w.enc.w.Write(w.enc.mac.Sum(nil)[:aesAuthSize])
+	return err
+}
+
+// openEncrypted opens the content of an encrypted ZIP entry, encrypted with
+// AES or with the traditional PKWARE encryption. A wrong password is
+// reported when the entry is opened or, failing that, once its content
+// does not match its checksum.
+func openEncrypted(f *zip.File, password string) (io.ReadCloser, error) {
+	if password == "" {
+		return nil, invalidPassword(f.Name, password)
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var data io.Reader
+	method, checkCRC := f.Method, true
+	if f.Method == methodAES {
+		info, err := parseAESExtra(f.Extra)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = newAESReader(raw, int64(f.CompressedSize64), info.strength, f.Name, password); err != nil {
+			return nil, err
+		}
+		method, checkCRC = info.method, info.version != 2
+	} else {
+		if data, err = newZipCryptoReader(raw, f, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var content io.ReadCloser
+	switch method {
+	case zip.Store:
+		content = io.NopCloser(data)
+	case zip.Deflate:
+		content = flate.NewReader(data)
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	return &decryptedReader{
+		ReadCloser: content,
+		data:       data,
+		file:       f,
+		password:   password,
+		crc:        crc32.NewIEEE(),
+		checkCRC:   checkCRC,
+	}, nil
+}
+
+// decryptedReader reads the decompressed content of an encrypted entry and
+// checks its size and checksum at the end
+type decryptedReader struct {
+	io.ReadCloser
+	data     io.Reader // Decrypted data, read to its end to authenticate it
+	file     *zip.File
+	password string
+	crc      hash.Hash32
+	checkCRC bool
+	read     uint64
+}
+
+func (r *decryptedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.crc.Write(p[:n])
+	r.read += uint64(n)
+	var corrupt flate.CorruptInputError
+	switch {
+	case r.read > r.file.UncompressedSize64:
+		return n, zip.ErrFormat
+	case errors.Is(err, io.EOF):
+		return n, r.finish()
+	case errors.As(err, &corrupt):
+		// Data decrypted with a wrong password does not decompress
+		return n, invalidPassword(r.file.Name, r.password)
+	}
+	return n, err
+}
+
+// finish authenticates the rest of the data and checks the content read
+func (r *decryptedReader) finish() error {
+	if _, err := io.Copy(io.Discard, r.data); err != nil {
+		return err
+	}
+	if r.read != r.file.UncompressedSize64 {
+		return io.ErrUnexpectedEOF
+	}
+	if r.checkCRC && r.crc.Sum32() != r.file.CRC32 {
+		return invalidPassword(r.file.Name, r.password)
+	}
+	return io.EOF
+}
+
+// newAESReader decrypts AES encrypted entry data of size bytes, checking
+// the password verifier first and the authentication code at the end
+func newAESReader(raw io.Reader, size int64, strength byte, name, password string) (io.Reader, error) {
+	keySize := aesKeySize(strength)
+	if keySize == 0 {
+		return nil, fmt.Errorf("zip: unknown AES strength %d", strength)
+	}
+	saltSize := keySize / 2
+	if size < int64(saltSize+aesVerifierSize+aesAuthSize) {
+		return nil, zip.ErrFormat
+	}
+
+	header := make([]byte, saltSize+aesVerifierSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	encKey, authKey, verifier := aesKeys(password, header[:saltSize], keySize)
+	if !bytes.Equal(verifier, header[saltSize:]) {
+		return nil, invalidPassword(name, password)
+	}
+	ctr, err := newAESCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+	dataSize := size - int64(len(header)) - aesAuthSize
+	return &aesReader{
+		data: io.LimitReader(raw, dataSize),
+		raw:  raw,
+		ctr:  ctr,
+		mac:  hmac.New(sha1.New, authKey),
+		name: name,
+		pass: password,
+	}, nil
+}
+
+// aesReader decrypts the data of an AES encrypted entry
+type aesReader struct {
+	data io.Reader
+	raw  io.Reader // Followed by the authentication code
+	ctr  *aesCTR
+	mac  hash.Hash
+	name string
+	pass string
+	done error // Result of the authentication, once the data is read
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	if r.done != nil {
+		return 0, r.done
+	}
+	n, err := r.data.Read(p)
+	r.mac.Write(p[:n])
+	r.ctr.XORKeyStream(p[:n], p[:n])
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	r.done = io.EOF
+	code := make([]byte, aesAuthSize)
+	if _, err := io.ReadFull(r.raw, code); err != nil {
+		r.done = err
+	} else if !hmac.Equal(code, r.mac.Sum(nil)[:aesAuthSize]) {
+		r.done = invalidPassword(r.name, r.pass)
+	}
+	return n, r.done
+}
+
+// newZipCryptoReader decrypts entry data encrypted with the traditional
+// PKWARE encryption, checking the last byte of its encryption header first
+func newZipCryptoReader(raw io.Reader, f *zip.File, password string) (io.Reader, error) {
+	r := &zipCryptoReader{r: raw, keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, b := range []byte(password) {
+		r.update(b)
+	}
+
+	header := make([]byte, zipCryptoHdrSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	// Entries followed by a data descriptor are checked against their
+	// modification time, their CRC-32 is not known before they are written
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHdrSize-1] != check {
+		return nil, invalidPassword(f.Name, password)
+	}
+	return r, nil
+}
+
+// zipCryptoReader decrypts data encrypted with the traditional PKWARE
+// encryption
+type zipCryptoReader struct {
+	r    io.Reader
+	keys [3]uint32
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i := range p[:n] {
+		t := r.keys[2] | 2
+		p[i] ^= byte((t * (t ^ 1)) >> 8)
+		r.update(p[i])
+	}
+	return n, err
+}
+
+func (r *zipCryptoReader) update(b byte) {
+	r.keys[0] = crc32Update(r.keys[0], b)
+	r.keys[1] = (r.keys[1]+r.keys[0]&0xff)*134775813 + 1
+	r.keys[2] = crc32Update(r.keys[2], byte(r.keys[1]>>24))
+}
+
+// crc32Update adds a byte to a CRC-32 without its pre- and post-conditioning
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedZip(t *testing.T) {
+	c := newTestConverter(t)
+	ctx := context.Background()
+	src := writeTarGz(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "dir/file.txt", Typeflag: tar.TypeReg, Size: 5},
+		&tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file.txt"},
+	)
+	want := map[string]string{
+		"dir":          "<dir>",
+		"dir/file.txt": "aaaaa",
+		"dir/link":     "-> file.txt",
+	}
+
+	dest := filepath.Join(t.TempDir(), "secret.zip")
+	require.NoError(t, c.Convert(ctx, src, dest, iface.Options{Password: "s3cret"}))
+	assert.Equal(t, want, readEncrypted(t, dest, "zip", "s3cret"))
+
+	entries, err := c.Entries(ctx, dest, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.True(t, entries[1].Encrypted, "files are encrypted")
+	assert.NotEmpty(t, entries[1].CRC32)
+	assert.False(t, entries[2].Encrypted, "links are not")
+
+	// The encrypted archive converts back with its password only
+	out := filepath.Join(t.TempDir(), "out.tar")
+	require.NoError(t, c.Convert(ctx, dest, out, iface.Options{Password: "s3cret"}))
+	assert.Equal(t, want, readArchive(t, out, "tar"))
+
+	// Archives convert to their own format directly, e.g. to recompress
+	require.True(t, c.SupportsConversion("zip", "zip"))
+	again := filepath.Join(t.TempDir(), "again.zip")
+	require.NoError(t, c.Convert(ctx, dest, again, iface.Options{Password: "s3cret", CompressionLevel: 9}))
+	assert.Equal(t, want, readEncrypted(t, again, "zip", "s3cret"))
+
+	for _, password := range []string{"wrong", ""} {
+		out := filepath.Join(t.TempDir(), "out.tar")
+		assertCode(t, c.Convert(ctx, dest, out, iface.Options{Password: password}), CodeInvalidPassword)
+		_, err := os.Stat(out)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	}
+}
+
+func TestEncryptedTarIgnoresPassword(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeZip(t, zipEntry{name: "file.txt", content: "plain"})
+	dest := filepath.Join(t.TempDir(), "out.tar.gz")
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{Password: "unused"}))
+	assert.Equal(t, map[string]string{"file.txt": "plain"}, readArchive(t, dest, "tar.gz"))
+}
+
+func TestZipCrypto(t *testing.T) {
+	if _, err := exec.LookPath("zip"); err != nil {
+		t.Skip("zip is not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("traditional encryption"), 0644))
+	src := filepath.Join(dir, "legacy.zip")
+	cmd := exec.Command("zip", "-q", "-P", "s3cret", src, "file.txt")
+	cmd.Dir = dir
+	require.NoError(t, cmd.Run())
+
+	assert.Equal(t, map[string]string{"file.txt": "traditional encryption"}, readEncrypted(t, src, "zip", "s3cret"))
+
+	c := newTestConverter(t)
+	err := c.ExtractFiles(context.Background(), src, t.TempDir(), nil, "wrong")
+	assertCode(t, err, CodeInvalidPassword)
+}
+
+func TestWrongPassword(t *testing.T) {
+	exit11 := exec.Command("sh", "-c", "exit 11").Run()
+	other := errors.New("exit status 2")
+
+	assert.True(t, wrongPassword("7z", other, "ERROR: Wrong password : file.txt"))
+	assert.True(t, wrongPassword("7z", other, "Can not open encrypted archive. Wrong password?"))
+	assert.True(t, wrongPassword("unrar", exit11, ""))
+	assert.True(t, wrongPassword("unrar", other, "The specified password is incorrect."))
+	assert.False(t, wrongPassword("7z", exit11, "ERROR: Data Error : file.txt"))
+	assert.False(t, wrongPassword("unrar", other, "CRC failed in file.txt"))
+}
+
+func TestToolCommandPassword(t *testing.T) {
+	ctx := context.Background()
+	cmd := toolCommand(ctx, "s3cret", "7z", "x", "-o/tmp/out", "archive.7z")
+	assert.Equal(t, []string{"7z", "x", "-p", "-o/tmp/out", "archive.7z"}, cmd.Args)
+	require.NotNil(t, cmd.Stdin)
+	input, err := io.ReadAll(cmd.Stdin)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret\ns3cret\n", string(input))
+
+	// Without a password 7z gets no switch, unrar is told not to ask
+	cmd = toolCommand(ctx, "", "7z", "l", "-slt", "archive.7z")
+	assert.Equal(t, []string{"7z", "l", "-slt", "archive.7z"}, cmd.Args)
+	assert.Nil(t, cmd.Stdin)
+	cmd = toolCommand(ctx, "", "unrar", "lt", "archive.rar")
+	assert.Equal(t, []string{"unrar", "lt", "-p-", "archive.rar"}, cmd.Args)
+}
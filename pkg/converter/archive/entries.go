@@ -0,0 +1,253 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/filetype"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// CodeEntryNotFound is the error code of extracting an entry an archive
+// does not have
+const CodeEntryNotFound = "archive_entry_not_found"
+
+// entryTypes names the entry kinds in listings
+var entryTypes = map[entryKind]string{
+	kindFile:     "file",
+	kindDir:      "dir",
+	kindSymlink:  "symlink",
+	kindHardlink: "hardlink",
+	kindSpecial:  "special",
+}
+
+// Entry describes a member of an archive
+type Entry struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type"` // file, dir, symlink, hardlink or special
+	Size           int64      `json:"size"`
+	CompressedSize int64      `json:"compressed_size"` // Zero for tar archives, which are compressed as a whole
+	Modified       *time.Time `json:"modified,omitempty"`
+	CRC32          string     `json:"crc32,omitempty"` // Hex, ZIP, 7z and RAR archives only
+	Encrypted      bool       `json:"encrypted"`
+	Link           string     `json:"link,omitempty"` // Target of links
+}
+
+// Entries lists the members of an archive in the order they are stored. The
+// format is taken from the extension of src. The password is only needed
+// for archives whose names are encrypted.
+func (c *ArchiveConverter) Entries(ctx context.Context, src, password string) ([]Entry, error) {
+	format := filetype.FromName(src)
+	if !c.isSource(format) {
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+
+	var entries []Entry
+	err := c.listMembers(ctx, src, format, password, func(e entry) error {
+		if c.limits.MaxEntries > 0 && len(entries) >= c.limits.MaxEntries {
+			return rejected(CodeTooManyEntries, "archive has more than %d entries", c.limits.MaxEntries)
+		}
+		listed := Entry{
+			Name:           e.name,
+			Type:           entryTypes[e.kind],
+			Size:           e.size,
+			CompressedSize: e.compressed,
+			CRC32:          e.crc,
+			Encrypted:      e.encrypted,
+			Link:           e.link,
+		}
+		if e.kind == kindDir {
+			listed.CRC32 = ""
+		}
+		if !e.modTime.IsZero() {
+			modified := e.modTime.UTC()
+			listed.Modified = &modified
+		}
+		entries = append(entries, listed)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SupportsExtraction reports whether entries of sourceFormat archives can be
+// extracted, into a new archive of targetFormat or, if it is empty, into
+// individual files
+func (c *ArchiveConverter) SupportsExtraction(sourceFormat, targetFormat string) bool {
+	if !c.isSource(sourceFormat) {
+		return false
+	}
+	// An archive can be written in its own format whenever another archive
+	// can be converted into it
+	return targetFormat == "" || c.SupportsConversion(sourceFormat, targetFormat) ||
+		targetFormat == sourceFormat && c.isTarget(targetFormat)
+}
+
+// ExtractArchive writes the named entries of the archive src into a new
+// archive dest, in the format of its extension, and returns the paths of
+// the files written. A directory name picks everything below it. The
+// entries are checked and the options are used like those of a conversion;
+// with a volume size the archive is split into volumes dest.001, dest.002
+// and so on.
+func (c *ArchiveConverter) ExtractArchive(ctx context.Context, src, dest string, names []string, opts iface.Options) ([]string, error) {
+	sel, err := newSelection(names)
+	if err != nil {
+		return nil, err
+	}
+	if opts.VolumeSize > 0 && !splittable(filetype.FromName(dest)) {
+		return nil, iface.NewConversionError("invalid_option", "volume_size is only supported for zip and 7z archives", nil)
+	}
+	if err := c.convert(ctx, src, dest, opts, sel); err != nil {
+		return nil, err
+	}
+	if opts.VolumeSize > 0 {
+		return splitVolumes(dest, opts.VolumeSize)
+	}
+	return []string{dest}, nil
+}
+
+// ExtractFiles extracts the named entries of the archive src into dir,
+// decrypting them with the password. A directory name picks everything
+// below it.
+func (c *ArchiveConverter) ExtractFiles(ctx context.Context, src, dir string, names []string, password string) error {
+	sel, err := newSelection(names)
+	if err != nil {
+		return err
+	}
+	format := filetype.FromName(src)
+	if !c.isSource(format) {
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+	return c.extractTo(ctx, src, format, dir, password, sel)
+}
+
+// isSource reports whether archives of the format can be read
+func (c *ArchiveConverter) isSource(format string) bool {
+	return format == "7z" || format == "rar" || nativeReadable(format) || singleFile(format)
+}
+
+// isTarget reports whether archives of the format can be written
+func (c *ArchiveConverter) isTarget(format string) bool {
+	for _, source := range []string{"zip", "tar"} {
+		if c.SupportsConversion(source, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// selection picks archive entries by name; a directory picks everything
+// below it
+type selection struct {
+	names   map[string]bool // Cleaned names asked for
+	found   map[string]bool // Names asked for that matched an entry
+	written map[string]bool // Entries picked so far, targets of hard links
+}
+
+// newSelection picks the named entries, or every entry if there are no names
+func newSelection(names []string) (*selection, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	s := &selection{names: make(map[string]bool), found: make(map[string]bool), written: make(map[string]bool)}
+	for _, name := range names {
+		clean, err := cleanEntryPath(name)
+		if err != nil {
+			return nil, err
+		}
+		s.names[clean] = true
+	}
+	return s, nil
+}
+
+// picks reports whether an entry is picked, its name must be cleaned
+func (s *selection) picks(m member) bool {
+	for name := m.name; ; name = path.Dir(name) {
+		if s.names[name] {
+			s.found[name] = true
+			break
+		}
+		if name == "." || name == "/" {
+			return false
+		}
+	}
+	// A hard link needs its target next to it
+	if m.kind == kindHardlink && !s.written[m.link] {
+		return false
+	}
+	s.written[m.name] = true
+	return true
+}
+
+// missing returns the names that matched no entry, sorted
+func (s *selection) missing() []string {
+	var missing []string
+	for name := range s.names {
+		if !s.found[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// filter returns a reader of the picked members of r, r itself if s is nil
+func (s *selection) filter(r archiveReader) archiveReader {
+	if s == nil {
+		return r
+	}
+	return &selectedReader{archiveReader: r, sel: s}
+}
+
+// selectedReader skips the members a selection does not pick and fails at
+// the end if a name matched nothing
+type selectedReader struct {
+	archiveReader
+	sel *selection
+}
+
+func (r *selectedReader) next() (member, error) {
+	for {
+		m, err := r.archiveReader.next()
+		if errors.Is(err, io.EOF) {
+			if missing := r.sel.missing(); len(missing) > 0 {
+				return member{}, rejected(CodeEntryNotFound, "archive has no entry %s", strings.Join(quoted(missing), ", "))
+			}
+		}
+		if err != nil {
+			return member{}, err
+		}
+
+		// Names are matched cleaned. Entries with invalid names are passed
+		// on, so the inspector rejects the archive as it would on conversion.
+		picked := m
+		if picked.name, err = cleanEntryPath(m.name); err != nil {
+			return m, nil
+		}
+		if m.kind == kindHardlink {
+			if picked.link, err = cleanEntryPath(m.link); err != nil {
+				return m, nil
+			}
+		}
+		if r.sel.picks(picked) {
+			return m, nil
+		}
+	}
+}
+
+// quoted quotes each of names
+func quoted(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = fmt.Sprintf("%q", name)
+	}
+	return out
+}
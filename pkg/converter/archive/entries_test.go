@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConverter(t *testing.T) *ArchiveConverter {
+	return NewArchiveConverter(nil, t.TempDir()).(*ArchiveConverter)
+}
+
+func TestEntries(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeZip(t,
+		zipEntry{name: "docs/", mode: fs.ModeDir},
+		zipEntry{name: "docs/readme.txt", content: "hello hello hello"},
+		zipEntry{name: "docs/link", content: "readme.txt", mode: fs.ModeSymlink},
+	)
+
+	entries, err := c.Entries(context.Background(), src, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "docs/", entries[0].Name)
+	assert.Equal(t, "dir", entries[0].Type)
+	assert.Empty(t, entries[0].CRC32)
+
+	file := entries[1]
+	assert.Equal(t, "file", file.Type)
+	assert.Equal(t, int64(17), file.Size)
+	assert.Positive(t, file.CompressedSize)
+	assert.Equal(t, fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte("hello hello hello"))), file.CRC32)
+	assert.False(t, file.Encrypted)
+
+	assert.Equal(t, "symlink", entries[2].Type)
+	assert.Equal(t, "readme.txt", entries[2].Link)
+}
+
+func TestEntriesTooMany(t *testing.T) {
+	c := newTestConverter(t)
+	c.SetLimits(Limits{MaxEntries: 1})
+	src := writeZip(t, zipEntry{name: "a.txt"}, zipEntry{name: "b.txt"})
+
+	_, err := c.Entries(context.Background(), src, "")
+	assertCode(t, err, CodeTooManyEntries)
+}
+
+func TestExtractArchive(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeTarGz(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "dir/file.txt", Typeflag: tar.TypeReg, Size: 2},
+		&tar.Header{Name: "dir/copy.txt", Typeflag: tar.TypeLink, Linkname: "dir/file.txt"},
+		&tar.Header{Name: "other.txt", Typeflag: tar.TypeReg, Size: 1},
+	)
+
+	dest := filepath.Join(t.TempDir(), "subset.zip")
+	_, err := c.ExtractArchive(context.Background(), src, dest, []string{"./dir/"}, iface.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"dir":          "<dir>",
+		"dir/file.txt": "aa",
+		"dir/copy.txt": "-> file.txt",
+	}, readArchive(t, dest, "zip"))
+
+	// A hard link is dropped without its target
+	dest = filepath.Join(t.TempDir(), "subset.tar.gz")
+	_, err = c.ExtractArchive(context.Background(), src, dest, []string{"dir/copy.txt", "other.txt"}, iface.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"other.txt": "a"}, readArchive(t, dest, "tar.gz"))
+}
+
+func TestExtractVolumes(t *testing.T) {
+	c := newTestConverter(t)
+	content := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	src := writeZip(t, zipEntry{name: "random.bin", content: string(content)})
+
+	dest := filepath.Join(t.TempDir(), "backup.zip")
+	volumes, err := c.ExtractArchive(context.Background(), src, dest, nil, iface.Options{VolumeSize: 64 << 10})
+	require.NoError(t, err)
+	require.Len(t, volumes, 4)
+	assert.Equal(t, dest+".001", volumes[0])
+	assert.Equal(t, dest+".004", volumes[3])
+	_, err = os.Stat(dest)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// The volumes joined are the archive
+	joined := filepath.Join(t.TempDir(), "joined.zip")
+	var data []byte
+	for _, volume := range volumes {
+		part, err := os.ReadFile(volume)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(part), 64<<10)
+		data = append(data, part...)
+	}
+	require.NoError(t, os.WriteFile(joined, data, 0644))
+	assert.Equal(t, map[string]string{"random.bin": string(content)}, readArchive(t, joined, "zip"))
+
+	_, err = c.ExtractArchive(context.Background(), src, filepath.Join(t.TempDir(), "backup.tar.gz"), nil, iface.Options{VolumeSize: 64 << 10})
+	assertCode(t, err, "invalid_option")
+}
+
+func TestConvertVolumes(t *testing.T) {
+	c := newTestConverter(t)
+	content := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	src := writeZip(t, zipEntry{name: "random.bin", content: string(content)})
+	opts := iface.Options{VolumeSize: 64 << 10}
+	require.NoError(t, c.ValidateOptions(opts))
+
+	var result iface.Result
+	ctx := iface.WithResult(context.Background(), func(r iface.Result) { result = r })
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	require.NoError(t, c.Convert(ctx, src, dest, opts))
+	assert.Equal(t, "zip", result.Format)
+
+	// The volumes are packed in order, joined they are the archive
+	volumes := readArchive(t, dest, "zip")
+	require.Len(t, volumes, 4)
+	var joined string
+	for i := 1; i <= 4; i++ {
+		joined += volumes[fmt.Sprintf("archive.zip.%03d", i)]
+	}
+	whole := filepath.Join(t.TempDir(), "joined.zip")
+	require.NoError(t, os.WriteFile(whole, []byte(joined), 0644))
+	assert.Equal(t, map[string]string{"random.bin": string(content)}, readArchive(t, whole, "zip"))
+
+	// Callers without a result get the archive whole
+	require.NoError(t, c.Convert(context.Background(), src, dest, opts))
+	assert.Equal(t, map[string]string{"random.bin": string(content)}, readArchive(t, dest, "zip"))
+
+	err := c.Convert(ctx, src, filepath.Join(t.TempDir(), "out.tar.gz"), opts)
+	assertCode(t, err, "invalid_option")
+}
+
+func TestExtractFiles(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeZip(t,
+		zipEntry{name: "a/one.txt", content: "1"},
+		zipEntry{name: "b/two.txt", content: "2"},
+	)
+
+	dir := t.TempDir()
+	require.NoError(t, c.ExtractFiles(context.Background(), src, dir, []string{"b/two.txt"}, ""))
+	data, err := os.ReadFile(filepath.Join(dir, "b", "two.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(data))
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestExtractMissingEntry(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeZip(t, zipEntry{name: "a.txt", content: "1"})
+
+	err := c.ExtractFiles(context.Background(), src, t.TempDir(), []string{"a.txt", "b.txt"}, "")
+	assertCode(t, err, CodeEntryNotFound)
+	assert.Contains(t, err.Error(), `"b.txt"`)
+
+	dest := filepath.Join(t.TempDir(), "out.tar")
+	_, err = c.ExtractArchive(context.Background(), src, dest, []string{"b.txt"}, iface.Options{})
+	assertCode(t, err, CodeEntryNotFound)
+	_, err = os.Stat(dest)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = newSelection([]string{"../a.txt"})
+	assertCode(t, err, CodePathTraversal)
+}
+
+func TestSupportsExtraction(t *testing.T) {
+	c := newTestConverter(t)
+	assert.True(t, c.SupportsExtraction("zip", ""))
+	assert.True(t, c.SupportsExtraction("zip", "zip"))
+	assert.True(t, c.SupportsExtraction("tar.gz", "tar.gz"))
+	assert.True(t, c.SupportsExtraction("rar", "zip"))
+	assert.False(t, c.SupportsExtraction("rar", "rar"))
+	assert.False(t, c.SupportsExtraction("zip", "mp4"))
+	assert.False(t, c.SupportsExtraction("png", ""))
+}
@@ -0,0 +1,421 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// Error codes of archives rejected by the inspection
+const (
+	CodePathTraversal  = "archive_path_traversal"
+	CodeAbsolutePath   = "archive_absolute_path"
+	CodeLinkEscape     = "archive_link_escape"
+	CodeSpecialFile    = "archive_special_file"
+	CodeTooManyEntries = "archive_too_many_entries"
+	CodeTooLarge       = "archive_too_large"
+	CodeRatioExceeded  = "archive_ratio_exceeded"
+	CodeTooDeep        = "archive_too_deep"
+)
+
+// Limits bound what an archive may expand to, zero disables a limit
+type Limits struct {
+	MaxEntries int   // Files, directories and links in an archive
+	MaxSize    int64 // Total uncompressed size
+	MaxRatio   int   // Uncompressed bytes per archive byte
+	MaxDepth   int   // Directory levels of an entry path
+}
+
+// DefaultLimits are the limits of converters not configured otherwise
+var DefaultLimits = Limits{
+	MaxEntries: 10000,
+	MaxSize:    2 << 30, // 2GB
+	MaxRatio:   100,
+	MaxDepth:   32,
+}
+
+// ratioThreshold is the uncompressed size up to which the compression ratio
+// is not checked, small files of repeated content compress very well
+const ratioThreshold = 10 << 20
+
+// maxLinkTarget bounds the link targets read from ZIP entries
+const maxLinkTarget = 4096
+
+// entryKind is the type of an archive entry
+type entryKind int
+
+const (
+	kindFile entryKind = iota
+	kindDir
+	kindSymlink
+	kindHardlink
+	kindSpecial
+)
+
+// entry is an archive member as listed before extraction
+type entry struct {
+	name       string
+	kind       entryKind
+	size       int64
+	link       string // Target of links, empty if the listing does not show it
+	compressed int64  // Stored size, zero for formats that compress the whole archive
+	modTime    time.Time
+	crc        string // CRC-32 in hex, empty if the format has none
+	encrypted  bool
+}
+
+// inspector checks the entries of an archive one at a time, so a listing
+// stops at the first violation
+type inspector struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	total       int64
+	links       map[string]bool // Cleaned names of symbolic links
+}
+
+func newInspector(limits Limits, archiveSize int64) *inspector {
+	return &inspector{limits: limits, archiveSize: archiveSize, links: make(map[string]bool)}
+}
+
+// rejected creates the error of an archive that violates a rule or limit
+func rejected(code, format string, args ...interface{}) error {
+	return iface.NewConversionError(code, fmt.Sprintf(format, args...), nil)
+}
+
+// cleanEntryPath checks that an entry path stays inside the extraction
+// directory and returns it cleaned
+func cleanEntryPath(name string) (string, error) {
+	// Archives made on Windows may use backslashes
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.VolumeName(name) != "" || len(slashed) > 1 && slashed[1] == ':' {
+		return "", rejected(CodeAbsolutePath, "archive entry %q has an absolute path", name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", rejected(CodePathTraversal, "archive entry %q points outside the archive", name)
+		}
+	}
+	return path.Clean(slashed), nil
+}
+
+// check checks an entry against the rules and limits
+func (i *inspector) check(e entry) error {
+	name, err := cleanEntryPath(e.name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+
+	i.entries++
+	if i.limits.MaxEntries > 0 && i.entries > i.limits.MaxEntries {
+		return rejected(CodeTooManyEntries, "archive has more than %d entries", i.limits.MaxEntries)
+	}
+	if depth := strings.Count(name, "/") + 1; i.limits.MaxDepth > 0 && depth > i.limits.MaxDepth {
+		return rejected(CodeTooDeep, "archive entry %q is nested deeper than %d levels", e.name, i.limits.MaxDepth)
+	}
+
+	if e.size > 0 {
+		i.total += e.size
+	}
+	if i.limits.MaxSize > 0 && i.total > i.limits.MaxSize {
+		return rejected(CodeTooLarge, "archive expands to more than %d bytes", i.limits.MaxSize)
+	}
+	if i.limits.MaxRatio > 0 && i.archiveSize > 0 && i.total > ratioThreshold && i.total/i.archiveSize > int64(i.limits.MaxRatio) {
+		return rejected(CodeRatioExceeded, "archive expands to more than %d times its size", i.limits.MaxRatio)
+	}
+
+	// An entry below a symbolic link would be written wherever the link points
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if i.links[dir] {
+			return rejected(CodeLinkEscape, "archive entry %q is written through the link %q", e.name, dir)
+		}
+	}
+
+	switch e.kind {
+	case kindSymlink:
+		i.links[name] = true
+		if e.link == "" {
+			return nil
+		}
+		target := strings.ReplaceAll(e.link, `\`, "/")
+		if strings.HasPrefix(target, "/") || filepath.VolumeName(e.link) != "" {
+			return rejected(CodeLinkEscape, "archive link %q points to the absolute path %q", e.name, e.link)
+		}
+		if resolved := path.Join(path.Dir(name), target); resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return rejected(CodeLinkEscape, "archive link %q points outside the archive", e.name)
+		}
+	case kindHardlink:
+		// Hard link targets are relative to the archive root
+		target, err := cleanEntryPath(e.link)
+		if err != nil {
+			return rejected(CodeLinkEscape, "archive link %q points outside the archive", e.name)
+		}
+		// A hard link to a symbolic link is a second symbolic link whose
+		// target was never checked against the link's new place
+		for dir := target; dir != "."; dir = path.Dir(dir) {
+			if i.links[dir] {
+				return rejected(CodeLinkEscape, "archive link %q points to the link %q", e.name, dir)
+			}
+		}
+	case kindSpecial:
+		return rejected(CodeSpecialFile, "archive entry %q is a device or named pipe", e.name)
+	}
+	return nil
+}
+
+// inspect lists an archive and checks its entries before it is extracted
+func (c *ArchiveConverter) inspect(ctx context.Context, src, format, password string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return c.listMembers(ctx, src, format, password, newInspector(c.limits, info.Size()).check)
+}
+
+// listMembers passes the entries of an archive to visit in the order they
+// are stored, stopping at the first error. The password is needed for
+// archives whose names are encrypted too.
+func (c *ArchiveConverter) listMembers(ctx context.Context, src, format, password string, visit func(e entry) error) error {
+	switch {
+	case nativeReadable(format):
+		return listNative(ctx, src, format, password, visit)
+	case format == "7z":
+		return list7z(ctx, src, password, visit)
+	case format == "rar":
+		return listRar(ctx, src, password, visit)
+	case singleFile(format):
+		return listSingle(ctx, src, c.limits.MaxSize, visit)
+	}
+	return fmt.Errorf("unsupported archive format: %s", format)
+}
+
+// verifyExtracted checks the extracted files against the same rules and
+// limits, in case an extraction tool read an archive differently than its
+// listing showed
+func (c *ArchiveConverter) verifyExtracted(src, dir string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	r, err := newDirReader(dir)
+	if err != nil {
+		return err
+	}
+	return visitMembers(r, newInspector(c.limits, info.Size()).check)
+}
+
+// listNative lists the members of an archive read natively, without reading
+// their content
+func listNative(ctx context.Context, src, format, password string, visit func(e entry) error) error {
+	f, err := openSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := newReader(f, format, password)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return visitMembers(r, visit)
+}
+
+// visitMembers passes the members of r to visit without reading their content
+func visitMembers(r archiveReader, visit func(e entry) error) error {
+	for {
+		m, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if err := visit(m.entry); err != nil {
+			return err
+		}
+	}
+}
+
+// listTool runs a listing command given the password, if any, and passes
+// its output lines to visit
+func listTool(ctx context.Context, visit func(line string) error, password, name string, args ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := toolCommand(ctx, password, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		if err := visit(scanner.Text()); err != nil {
+			cancel()
+			cmd.Wait()
+			return err
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if wrongPassword(name, err, stderr.String()) {
+			return rejected(CodeInvalidPassword, "wrong or missing password for the archive")
+		}
+		return fmt.Errorf("failed to list archive: %w", err)
+	}
+	return scanner.Err()
+}
+
+// technicalListing collects the "key = value" or "key: value" blocks of a
+// technical archive listing and passes each as an entry to visit
+type technicalListing struct {
+	visit    func(e entry) error
+	sep      string
+	first    string // Key starting the block of an entry
+	startKey string // Line after which entries are listed
+	started  bool   // The lines before startKey describe the archive itself
+	fields   map[string]string
+	toEntry  func(fields map[string]string) entry
+}
+
+func (l *technicalListing) line(line string) error {
+	if !l.started {
+		l.started = strings.TrimSpace(line) == l.startKey
+		return nil
+	}
+
+	key, value, ok := strings.Cut(strings.TrimSpace(line), l.sep)
+	if !ok {
+		return nil
+	}
+	key = strings.TrimSpace(key)
+	if key == l.first {
+		if err := l.flush(); err != nil {
+			return err
+		}
+		l.fields = make(map[string]string)
+	}
+	if l.fields != nil {
+		l.fields[key] = strings.TrimSpace(value)
+	}
+	return nil
+}
+
+// flush visits the entry of the current block
+func (l *technicalListing) flush() error {
+	if l.fields == nil {
+		return nil
+	}
+	e := l.toEntry(l.fields)
+	l.fields = nil
+	return l.visit(e)
+}
+
+func list7z(ctx context.Context, src, password string, visit func(e entry) error) error {
+	listing := &technicalListing{
+		visit:    visit,
+		sep:      " = ",
+		first:    "Path",
+		startKey: "----------",
+		toEntry:  sevenZipEntry,
+	}
+	if err := listTool(ctx, listing.line, password, "7z", "l", "-slt", src); err != nil {
+		return err
+	}
+	return listing.flush()
+}
+
+// sevenZipEntry reads an entry of a 7z technical listing. Unix modes are
+// listed after the attribute letters, e.g. "A_ lrwxrwxrwx".
+func sevenZipEntry(fields map[string]string) entry {
+	e := entry{
+		name:      fields["Path"],
+		modTime:   parseListingTime(fields["Modified"]),
+		crc:       strings.ToLower(fields["CRC"]),
+		encrypted: fields["Encrypted"] == "+",
+	}
+	e.size, _ = strconv.ParseInt(fields["Size"], 10, 64)
+	e.compressed, _ = strconv.ParseInt(fields["Packed Size"], 10, 64)
+	attributes := strings.Fields(fields["Attributes"])
+	mode := ""
+	if len(attributes) > 1 {
+		mode = attributes[len(attributes)-1]
+	}
+	switch {
+	case fields["Folder"] == "+", strings.HasPrefix(mode, "d"):
+		e.kind = kindDir
+	case strings.HasPrefix(mode, "l"):
+		e.kind = kindSymlink
+		e.link = fields["Symbolic Link"]
+	case strings.HasPrefix(mode, "c"), strings.HasPrefix(mode, "b"), strings.HasPrefix(mode, "p"), strings.HasPrefix(mode, "s"):
+		e.kind = kindSpecial
+	}
+	return e
+}
+
+func listRar(ctx context.Context, src, password string, visit func(e entry) error) error {
+	listing := &technicalListing{
+		visit:   visit,
+		sep:     ": ",
+		first:   "Name",
+		started: true,
+		toEntry: rarEntry,
+	}
+	if err := listTool(ctx, listing.line, password, "unrar", "lt", src); err != nil {
+		return err
+	}
+	return listing.flush()
+}
+
+// rarEntry reads an entry of an unrar technical listing
+func rarEntry(fields map[string]string) entry {
+	e := entry{
+		name:      fields["Name"],
+		link:      fields["Target"],
+		modTime:   parseListingTime(fields["mtime"]),
+		crc:       strings.ToLower(fields["CRC32"]),
+		encrypted: strings.Contains(fields["Flags"], "encrypted"),
+	}
+	e.size, _ = strconv.ParseInt(fields["Size"], 10, 64)
+	e.compressed, _ = strconv.ParseInt(fields["Packed size"], 10, 64)
+	kind := strings.ToLower(fields["Type"])
+	switch {
+	case strings.Contains(kind, "directory"):
+		e.kind = kindDir
+	case strings.Contains(kind, "hard link"):
+		e.kind = kindHardlink
+	case strings.Contains(kind, "link"), strings.Contains(kind, "junction"):
+		e.kind = kindSymlink
+	}
+	return e
+}
+
+// parseListingTime parses the modification times of 7z and unrar listings,
+// e.g. "2024-03-01 14:05:09.1234567" or "2024-03-01 14:05:09,123456789".
+// Listings show local time.
+func parseListingTime(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", strings.Replace(value, ",", ".", 1), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipEntry is an entry of a test ZIP archive
+type zipEntry struct {
+	name    string
+	content string
+	mode    fs.FileMode
+}
+
+func writeZip(t *testing.T, entries ...zipEntry) string {
+	path := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		hdr.SetMode(e.mode | 0644)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return path
+}
+
+func writeTarGz(t *testing.T, headers ...*tar.Header) string {
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range headers {
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write(bytes.Repeat([]byte{'a'}, int(hdr.Size)))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func assertCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var convErr *iface.ConversionError
+	require.True(t, errors.As(err, &convErr), "expected a conversion error, got %v", err)
+	assert.Equal(t, code, convErr.Code)
+}
+
+func TestInspectZip(t *testing.T) {
+	c := &ArchiveConverter{limits: Limits{MaxEntries: 3, MaxSize: 1 << 20, MaxRatio: 100, MaxDepth: 4}}
+	ctx := context.Background()
+
+	valid := writeZip(t,
+		zipEntry{name: "docs/"},
+		zipEntry{name: "docs/readme.txt", content: "hello"},
+		zipEntry{name: "docs/link", content: "readme.txt", mode: fs.ModeSymlink},
+	)
+	assert.NoError(t, c.inspect(ctx, valid, "zip", ""))
+
+	for _, tc := range []struct {
+		name    string
+		entries []zipEntry
+		code    string
+	}{
+		{"traversal", []zipEntry{{name: "../../etc/passwd", content: "x"}}, CodePathTraversal},
+		{"windows traversal", []zipEntry{{name: `docs\..\..\evil.txt`, content: "x"}}, CodePathTraversal},
+		{"absolute", []zipEntry{{name: "/etc/passwd", content: "x"}}, CodeAbsolutePath},
+		{"drive letter", []zipEntry{{name: `C:\Windows\evil.dll`, content: "x"}}, CodeAbsolutePath},
+		{"absolute link", []zipEntry{{name: "link", content: "/etc", mode: fs.ModeSymlink}}, CodeLinkEscape},
+		{"escaping link", []zipEntry{{name: "a/link", content: "../../outside", mode: fs.ModeSymlink}}, CodeLinkEscape},
+		{"write through link", []zipEntry{
+			{name: "dir", content: "sub", mode: fs.ModeSymlink},
+			{name: "dir/file.txt", content: "x"},
+		}, CodeLinkEscape},
+		{"too many entries", []zipEntry{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}}, CodeTooManyEntries},
+		{"too deep", []zipEntry{{name: "a/b/c/d/e.txt", content: "x"}}, CodeTooDeep},
+		{"too large", []zipEntry{{name: "big.bin", content: strings.Repeat("0", 2<<20)}}, CodeTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertCode(t, c.inspect(ctx, writeZip(t, tc.entries...), "zip", ""), tc.code)
+		})
+	}
+}
+
+func TestInspectRatio(t *testing.T) {
+	c := &ArchiveConverter{limits: Limits{MaxRatio: 100}}
+	bomb := writeZip(t, zipEntry{name: "zeros.bin", content: strings.Repeat("\x00", 20<<20)})
+	assertCode(t, c.inspect(context.Background(), bomb, "zip", ""), CodeRatioExceeded)
+
+	// Small files of repeated content are not bombs
+	small := writeZip(t, zipEntry{name: "zeros.bin", content: strings.Repeat("\x00", 1<<20)})
+	assert.NoError(t, c.inspect(context.Background(), small, "zip", ""))
+}
+
+func TestInspectTar(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	ctx := context.Background()
+
+	valid := writeTarGz(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "dir/file.txt", Typeflag: tar.TypeReg, Size: 5},
+		&tar.Header{Name: "dir/copy.txt", Typeflag: tar.TypeLink, Linkname: "dir/file.txt"},
+		&tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file.txt"},
+	)
+	assert.NoError(t, c.inspect(ctx, valid, "tar.gz", ""))
+
+	for _, tc := range []struct {
+		name   string
+		header *tar.Header
+		code   string
+	}{
+		{"traversal", &tar.Header{Name: "a/../../evil", Typeflag: tar.TypeReg, Size: 1}, CodePathTraversal},
+		{"absolute", &tar.Header{Name: "/tmp/evil", Typeflag: tar.TypeReg, Size: 1}, CodeAbsolutePath},
+		{"symlink", &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"}, CodeLinkEscape},
+		{"hard link", &tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "/etc/shadow"}, CodeLinkEscape},
+		{"device", &tar.Header{Name: "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}, CodeSpecialFile},
+		{"fifo", &tar.Header{Name: "pipe", Typeflag: tar.TypeFifo}, CodeSpecialFile},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertCode(t, c.inspect(ctx, writeTarGz(t, tc.header), "tar.gz", ""), tc.code)
+		})
+	}
+}
+
+func TestInspectHardlinkToLink(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	ctx := context.Background()
+
+	// The hard link would be a copy of the link in a place where it points
+	// outside the archive, and the last entry would be written through it
+	src := writeTarGz(t,
+		&tar.Header{Name: "x/y/a", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "x/y/a"},
+		&tar.Header{Name: "h/pwned", Typeflag: tar.TypeReg, Size: 1},
+	)
+	assertCode(t, c.inspect(ctx, src, "tar.gz", ""), CodeLinkEscape)
+
+	below := writeTarGz(t,
+		&tar.Header{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+		&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "dir/file.txt"},
+	)
+	assertCode(t, c.inspect(ctx, below, "tar.gz", ""), CodeLinkEscape)
+}
+
+func TestVerifyExtracted(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	src := writeZip(t, zipEntry{name: "file.txt", content: "x"})
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("x"), 0644))
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(dir, "inside")))
+	assert.NoError(t, c.verifyExtracted(src, dir))
+
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(dir, "outside")))
+	assertCode(t, c.verifyExtracted(src, dir), CodeLinkEscape)
+}
+
+func TestTechnicalListings(t *testing.T) {
+	sevenZip := `
+7-Zip [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21
+
+Listing archive: test.7z
+
+--
+Path = test.7z
+Type = 7z
+Physical Size = 230
+
+----------
+Path = docs
+Size = 0
+Folder = +
+Attributes = D_ drwxr-xr-x
+
+Path = docs/readme.txt
+Size = 5
+Folder = -
+Attributes = A_ -rw-r--r--
+
+Path = docs/link
+Size = 10
+Folder = -
+Attributes = A_ lrwxrwxrwx
+
+Path = docs/link/evil.txt
+Size = 1
+Folder = -
+Attributes = A_ -rw-r--r--
+`
+	in := newInspector(DefaultLimits, 230)
+	listing := &technicalListing{visit: in.check, sep: " = ", first: "Path", startKey: "----------", toEntry: sevenZipEntry}
+	var err error
+	for _, line := range strings.Split(sevenZip, "\n") {
+		if err = listing.line(line); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = listing.flush()
+	}
+	assertCode(t, err, CodeLinkEscape)
+	assert.Equal(t, 4, in.entries)
+
+	rar := `
+UNRAR 6.11 freeware      Copyright (c) 1993-2022 Alexander Roshal
+
+Archive: test.rar
+Details: RAR 5
+
+        Name: notes.txt
+        Type: File
+        Size: 12
+ Packed size: 12
+
+        Name: link
+        Type: Unix symbolic link
+      Target: /etc/passwd
+        Size: 11
+`
+	in = newInspector(DefaultLimits, 100)
+	listing = &technicalListing{visit: in.check, sep: ": ", first: "Name", started: true, toEntry: rarEntry}
+	for _, line := range strings.Split(rar, "\n") {
+		require.NoError(t, listing.line(line))
+	}
+	assertCode(t, listing.flush(), CodeLinkEscape)
+}
@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CodeNotSingleFile is the error code of packing anything but exactly one
+// file into a format that compresses a single file
+const CodeNotSingleFile = "archive_not_single_file"
+
+// singleFile reports whether files of the format hold one compressed file
+// rather than archive entries
+func singleFile(format string) bool {
+	return format == "zst"
+}
+
+// singleName returns the name of the file compressed into src, the name of
+// src without its extension
+func singleName(src string) string {
+	name := filepath.Base(src)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if name == "" || name == "." {
+		return "file"
+	}
+	return name
+}
+
+// listSingle passes the file compressed into src to visit. Frames need not
+// record the size of their content, so it is counted by decompressing them,
+// stopping at maxSize.
+func listSingle(ctx context.Context, src string, maxSize int64, visit func(e entry) error) error {
+	f, err := openSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer zr.Close()
+
+	size, err := io.Copy(io.Discard, &boundedReader{r: zr, max: maxSize})
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return visit(entry{name: singleName(src), kind: kindFile, size: size, compressed: f.size, modTime: info.ModTime()})
+}
+
+// extractSingle decompresses the file compressed into src into dir if sel
+// picks it. Its size is only known once it is written, so decompression
+// stops at the size limit.
+func (c *ArchiveConverter) extractSingle(ctx context.Context, src, dir string, sel *selection) error {
+	f, err := openSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer zr.Close()
+
+	r := &singleReader{
+		m:    member{entry: entry{name: singleName(src), kind: kindFile}, mode: 0644},
+		data: &boundedReader{r: zr, max: c.limits.MaxSize},
+	}
+	if err := copyMembers(sel.filter(r), &dirWriter{dir: dir}, newInspector(c.limits, f.size), nil); err != nil {
+		return err
+	}
+	// The size and ratio limits are checked against what was written
+	return c.verifyExtracted(src, dir)
+}
+
+// singleReader reads the one file of a single-file format as a member
+type singleReader struct {
+	m    member
+	data io.Reader
+	read bool
+}
+
+func (r *singleReader) next() (member, error) {
+	if r.read {
+		return member{}, io.EOF
+	}
+	r.read = true
+	return r.m, nil
+}
+
+func (r *singleReader) content() (io.Reader, error) {
+	return r.data, nil
+}
+
+func (r *singleReader) Close() error {
+	return nil
+}
+
+// boundedReader fails once more than max bytes were read, zero reads all
+type boundedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (r *boundedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.max > 0 && r.read > r.max {
+		return n, rejected(CodeTooLarge, "archive expands to more than %d bytes", r.max)
+	}
+	return n, err
+}
+
+// singleWriter compresses the one file of a single-file format. Directories
+// are skipped, anything else fails.
+type singleWriter struct {
+	w       io.WriteCloser
+	format  string
+	written bool
+}
+
+func (w *singleWriter) add(m member, content io.Reader) error {
+	switch {
+	case m.kind == kindDir:
+		return nil
+	case m.kind != kindFile || w.written:
+		return rejected(CodeNotSingleFile, "%s files hold a single file, the archive has more entries", w.format)
+	}
+	w.written = true
+	_, err := io.Copy(w.w, content)
+	return err
+}
+
+func (w *singleWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		return err
+	}
+	if !w.written {
+		return rejected(CodeNotSingleFile, "%s files hold a single file, the archive has none", w.format)
+	}
+	return nil
+}
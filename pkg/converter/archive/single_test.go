@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleFile(t *testing.T) {
+	c := newTestConverter(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := writeZip(t, zipEntry{name: "docs/", mode: os.ModeDir}, zipEntry{name: "docs/report.txt", content: "report"})
+
+	zst := filepath.Join(dir, "report.zst")
+	require.NoError(t, c.Convert(ctx, src, zst, iface.Options{CompressionLevel: 3}))
+
+	entries, err := c.Entries(ctx, zst, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "report", entries[0].Name)
+	assert.Equal(t, int64(6), entries[0].Size)
+
+	dest := filepath.Join(dir, "report.tar.zst")
+	require.NoError(t, c.Convert(ctx, zst, dest, iface.Options{}))
+	assert.Equal(t, map[string]string{"report": "report"}, readArchive(t, dest, "tar.zst"))
+}
+
+func TestSingleFileRejected(t *testing.T) {
+	c := newTestConverter(t)
+	ctx := context.Background()
+
+	src := writeZip(t, zipEntry{name: "a.txt", content: "a"}, zipEntry{name: "b.txt", content: "b"})
+	dest := filepath.Join(t.TempDir(), "out.zst")
+	assertCode(t, c.Convert(ctx, src, dest, iface.Options{}), CodeNotSingleFile)
+	_, err := os.Stat(dest)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	src = writeZip(t, zipEntry{name: "empty/", mode: os.ModeDir})
+	assertCode(t, c.Convert(ctx, src, dest, iface.Options{}), CodeNotSingleFile)
+}
+
+func TestSingleFileTooLarge(t *testing.T) {
+	c := newTestConverter(t)
+	ctx := context.Background()
+	zst := filepath.Join(t.TempDir(), "big.zst")
+	require.NoError(t, c.Convert(ctx, writeZip(t, zipEntry{name: "big.txt", content: strings.Repeat("a", 4096)}), zst, iface.Options{}))
+
+	c.SetLimits(Limits{MaxSize: 1024})
+	err := c.Convert(ctx, zst, filepath.Join(t.TempDir(), "out.zip"), iface.Options{})
+	assertCode(t, err, CodeTooLarge)
+
+	// Listing stops decompressing at the limit too
+	_, err = c.Entries(ctx, zst, "")
+	assertCode(t, err, CodeTooLarge)
+}
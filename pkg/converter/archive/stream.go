@@ -0,0 +1,778 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// nativeReadable reports whether the entries of archives of the format are
+// read one at a time, without extracting the archive first. Only tar.lz4
+// archives need a tool, lz4 decompresses them.
+func nativeReadable(format string) bool {
+	switch format {
+	case "zip", "tar", "tar.gz", "tgz", "tar.bz2", "tbz2", "tar.xz", "txz", "tar.zst", "tzst", "tar.lz4":
+		return true
+	}
+	return false
+}
+
+// member is an archive entry together with what is kept when it is re-packed
+type member struct {
+	entry
+	mode fs.FileMode // Permission bits
+}
+
+// archiveReader reads the members of an archive in order
+type archiveReader interface {
+	// next returns the next member, io.EOF after the last one
+	next() (member, error)
+	// content returns the content of the current file member
+	content() (io.Reader, error)
+	Close() error
+}
+
+// archiveWriter adds members to an archive or directory
+type archiveWriter interface {
+	// add adds a member, content is nil for anything but files
+	add(m member, content io.Reader) error
+	Close() error
+}
+
+// sourceFile is an archive being read that counts the bytes read from it
+// and stops reading once the conversion is cancelled
+type sourceFile struct {
+	*os.File
+	ctx  context.Context
+	size int64
+	read int64
+}
+
+func openSource(ctx context.Context, name string) (*sourceFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &sourceFile{File: f, ctx: ctx, size: info.Size()}, nil
+}
+
+func (f *sourceFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *sourceFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := f.File.ReadAt(p, off)
+	f.read += int64(n)
+	return n, err
+}
+
+// percent returns how much of the archive has been read
+func (f *sourceFile) percent() float64 {
+	if f.size == 0 {
+		return 100
+	}
+	return min(float64(f.read)/float64(f.size)*100, 100)
+}
+
+// newReader reads the members of an archive in one of the native formats.
+// The password decrypts encrypted ZIP entries.
+func newReader(f *sourceFile, format, password string) (archiveReader, error) {
+	switch format {
+	case "zip":
+		zr, err := zip.NewReader(f, f.size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return &zipReader{files: zr.File, password: password}, nil
+	case "tar":
+		return &tarReader{tr: tar.NewReader(bufio.NewReader(f))}, nil
+	case "tar.gz", "tgz":
+		gr, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return &tarReader{tr: tar.NewReader(gr), closer: gr}, nil
+	case "tar.bz2", "tbz2":
+		return &tarReader{tr: tar.NewReader(bzip2.NewReader(bufio.NewReader(f)))}, nil
+	case "tar.xz", "txz":
+		xr, err := xz.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return &tarReader{tr: tar.NewReader(xr)}, nil
+	case "tar.zst", "tzst":
+		zr, err := zstd.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return &tarReader{tr: tar.NewReader(zr), closer: zr.IOReadCloser()}, nil
+	case "tar.lz4":
+		lr, err := newCommandReader(f.ctx, f, "lz4", "-dc")
+		if err != nil {
+			return nil, err
+		}
+		return &tarReader{tr: tar.NewReader(lr), closer: lr}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", format)
+}
+
+// zipReader reads the members of a ZIP archive
+type zipReader struct {
+	files    []*zip.File
+	password string
+	i        int
+	open     io.ReadCloser
+}
+
+func (r *zipReader) next() (member, error) {
+	r.closeOpen()
+	if r.i >= len(r.files) {
+		return member{}, io.EOF
+	}
+	f := r.files[r.i]
+	r.i++
+
+	crc := fmt.Sprintf("%08x", f.CRC32)
+	if f.Method == methodAES && f.CRC32 == 0 {
+		// AES encrypted entries may leave out their CRC-32
+		crc = ""
+	}
+	mode := f.Mode()
+	m := member{
+		entry: entry{
+			name:       f.Name,
+			size:       int64(f.UncompressedSize64),
+			compressed: int64(f.CompressedSize64),
+			modTime:    f.Modified,
+			crc:        crc,
+			encrypted:  f.Flags&0x1 != 0,
+		},
+		mode: mode.Perm(),
+	}
+	switch {
+	case mode.IsDir():
+		m.kind = kindDir
+	case mode&fs.ModeSymlink != 0:
+		// The link target is the content of the entry
+		m.kind = kindSymlink
+		rc, err := r.openFile(f)
+		if err != nil {
+			return member{}, err
+		}
+		target, err := io.ReadAll(io.LimitReader(rc, maxLinkTarget))
+		rc.Close()
+		if err != nil {
+			return member{}, err
+		}
+		m.link = string(target)
+	case !mode.IsRegular():
+		m.kind = kindSpecial
+	}
+	return m, nil
+}
+
+func (r *zipReader) content() (io.Reader, error) {
+	r.closeOpen()
+	rc, err := r.openFile(r.files[r.i-1])
+	if err != nil {
+		return nil, err
+	}
+	r.open = rc
+	return rc, nil
+}
+
+// openFile opens the content of an entry, decrypting it if it is encrypted
+func (r *zipReader) openFile(f *zip.File) (io.ReadCloser, error) {
+	if f.Flags&0x1 != 0 {
+		return openEncrypted(f, r.password)
+	}
+	return f.Open()
+}
+
+func (r *zipReader) closeOpen() {
+	if r.open != nil {
+		r.open.Close()
+		r.open = nil
+	}
+}
+
+func (r *zipReader) Close() error {
+	r.closeOpen()
+	return nil
+}
+
+// tarReader reads the members of a tar archive from a decompressed stream
+type tarReader struct {
+	tr     *tar.Reader
+	closer io.Closer
+}
+
+func (r *tarReader) next() (member, error) {
+	for {
+		hdr, err := r.tr.Next()
+		if err != nil {
+			return member{}, err
+		}
+
+		m := member{
+			entry: entry{name: hdr.Name, size: hdr.Size, link: hdr.Linkname, modTime: hdr.ModTime},
+			mode:  fs.FileMode(hdr.Mode).Perm(),
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			// Global PAX headers describe the archive, not a member
+			continue
+		case tar.TypeDir:
+			m.kind = kindDir
+		case tar.TypeSymlink:
+			m.kind = kindSymlink
+		case tar.TypeLink:
+			m.kind = kindHardlink
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			m.kind = kindSpecial
+		}
+		return m, nil
+	}
+}
+
+func (r *tarReader) content() (io.Reader, error) {
+	return r.tr, nil
+}
+
+func (r *tarReader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// dirReader reads the files below a directory as archive members
+type dirReader struct {
+	dir     string
+	members []member
+	i       int
+	open    *os.File
+}
+
+func newDirReader(dir string) (*dirReader, error) {
+	r := &dirReader{dir: dir}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		m := member{
+			entry: entry{name: filepath.ToSlash(rel), modTime: info.ModTime()},
+			mode:  info.Mode().Perm(),
+		}
+		switch t := info.Mode().Type(); {
+		case t.IsDir():
+			m.kind = kindDir
+		case t&fs.ModeSymlink != 0:
+			m.kind = kindSymlink
+			if m.link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case t.IsRegular():
+			m.size = info.Size()
+		default:
+			m.kind = kindSpecial
+		}
+		r.members = append(r.members, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *dirReader) next() (member, error) {
+	r.closeOpen()
+	if r.i >= len(r.members) {
+		return member{}, io.EOF
+	}
+	r.i++
+	return r.members[r.i-1], nil
+}
+
+func (r *dirReader) content() (io.Reader, error) {
+	r.closeOpen()
+	f, err := os.Open(filepath.Join(r.dir, filepath.FromSlash(r.members[r.i-1].name)))
+	if err != nil {
+		return nil, err
+	}
+	r.open = f
+	return f, nil
+}
+
+func (r *dirReader) closeOpen() {
+	if r.open != nil {
+		r.open.Close()
+		r.open = nil
+	}
+}
+
+func (r *dirReader) Close() error {
+	r.closeOpen()
+	return nil
+}
+
+// newWriter writes an archive in one of the native formats to w. Go has no
+// bzip2 or lz4 compressor, so tar.bz2 and tar.lz4 archives are compressed by
+// their tools. With a password, the files of ZIP archives are encrypted with
+// AES-256; tar archives cannot be encrypted. The compression level of the
+// options maps to the closest setting of each format.
+func newWriter(ctx context.Context, w io.Writer, format string, opts iface.Options) (archiveWriter, error) {
+	level := opts.CompressionLevel
+	switch format {
+	case "zip":
+		zw := zip.NewWriter(w)
+		if level != 0 {
+			zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, level)
+			})
+		}
+		if opts.Password != "" {
+			zw.RegisterCompressor(methodAES, aesCompressor(opts.Password, level))
+		}
+		return &zipWriter{zw: zw, encrypt: opts.Password != ""}, nil
+	case "tar":
+		return &tarWriter{tw: tar.NewWriter(w)}, nil
+	case "tar.gz", "tgz":
+		gw, err := gzip.NewWriterLevel(w, flateLevel(level))
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(gw), closer: gw}, nil
+	case "tar.bz2", "tbz2":
+		bw, err := newCommandWriter(ctx, w, "bzip2", levelArgs(level, "-c")...)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(bw), closer: bw}, nil
+	case "tar.xz", "txz":
+		xw, err := xz.WriterConfig{DictCap: xzDictCap(level)}.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(xw), closer: xw}, nil
+	case "tar.zst", "tzst":
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel(level)))
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), closer: zw}, nil
+	case "tar.lz4":
+		lw, err := newCommandWriter(ctx, w, "lz4", levelArgs(level, "-c")...)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(lw), closer: lw}, nil
+	case "zst":
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel(level)))
+		if err != nil {
+			return nil, err
+		}
+		return &singleWriter{w: zw, format: format}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", format)
+}
+
+// flateLevel returns the deflate level of a compression level
+func flateLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// levelArgs appends the compression level switch of bzip2 and lz4 to args
+func levelArgs(level int, args ...string) []string {
+	if level == 0 {
+		return args
+	}
+	return append(args, "-"+strconv.Itoa(level))
+}
+
+// xzDictCaps are the dictionary sizes of the xz presets 1 to 9
+var xzDictCaps = [...]int{1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// xzDictCap returns the dictionary size of a compression level, the xz
+// default for 0
+func xzDictCap(level int) int {
+	if level == 0 {
+		return 8 << 20
+	}
+	return xzDictCaps[level-1]
+}
+
+// zstdLevel maps a compression level to one of the four zstd encoder levels
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == 0:
+		return zstd.SpeedDefault
+	case level <= 2:
+		return zstd.SpeedFastest
+	case level <= 5:
+		return zstd.SpeedDefault
+	case level <= 8:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// zipWriter adds members to a ZIP archive. ZIP has no hard links, they are
+// stored as symbolic links to their target.
+type zipWriter struct {
+	zw      *zip.Writer
+	encrypt bool // Encrypt the content of files, names and links stay readable
+}
+
+func (w *zipWriter) add(m member, content io.Reader) error {
+	hdr := &zip.FileHeader{Name: m.name, Method: zip.Deflate, Modified: m.modTime}
+	switch m.kind {
+	case kindDir:
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+		hdr.SetMode(fs.ModeDir | m.mode)
+	case kindSymlink, kindHardlink:
+		target := m.link
+		if m.kind == kindHardlink {
+			rel, err := filepath.Rel(path.Dir(m.name), m.link)
+			if err != nil {
+				return err
+			}
+			target = filepath.ToSlash(rel)
+		}
+		hdr.Method = zip.Store
+		hdr.SetMode(fs.ModeSymlink | 0777)
+		content = bytes.NewReader([]byte(target))
+	default:
+		hdr.SetMode(m.mode)
+		if w.encrypt {
+			hdr.Method = methodAES
+			hdr.Flags |= 0x1
+			hdr.Extra = aesExtra(zip.Deflate)
+		}
+	}
+
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		if _, err := io.Copy(fw, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// tarWriter adds members to a tar archive, optionally through a compressor
+type tarWriter struct {
+	tw     *tar.Writer
+	closer io.Closer
+}
+
+func (w *tarWriter) add(m member, content io.Reader) error {
+	hdr := &tar.Header{
+		Name:     m.name,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(m.mode),
+		ModTime:  m.modTime,
+		Size:     m.size,
+	}
+	switch m.kind {
+	case kindDir:
+		hdr.Name += "/"
+		hdr.Typeflag = tar.TypeDir
+		hdr.Size = 0
+	case kindSymlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = m.link
+		hdr.Size = 0
+	case kindHardlink:
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = m.link
+		hdr.Size = 0
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if content != nil {
+		if _, err := io.Copy(w.tw, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *tarWriter) Close() error {
+	err := w.tw.Close()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// dirWriter extracts members into a directory
+type dirWriter struct {
+	dir string
+}
+
+func (w *dirWriter) add(m member, content io.Reader) error {
+	p := filepath.Join(w.dir, filepath.FromSlash(m.name))
+	if m.kind == kindDir {
+		return w.mkdirs(m.name)
+	}
+	if err := w.mkdirs(path.Dir(m.name)); err != nil {
+		return err
+	}
+	// A later member replaces an earlier one of the same name
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	switch m.kind {
+	case kindSymlink:
+		return os.Symlink(m.link, p)
+	case kindHardlink:
+		// The target must be a file reached without following links,
+		// a hard link to a symbolic link would be a link of its own
+		if err := w.checkDirs(path.Dir(m.link)); err != nil {
+			return err
+		}
+		target := filepath.Join(w.dir, filepath.FromSlash(m.link))
+		info, err := os.Lstat(target)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return rejected(CodeLinkEscape, "archive link %q points to %q, which is not a file", m.name, m.link)
+		}
+		return os.Link(target, p)
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, m.mode|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mkdirs creates the directories of a slash-separated path below the
+// directory. Unlike os.MkdirAll it never follows symbolic links, which
+// would let an archive write outside the directory.
+func (w *dirWriter) mkdirs(name string) error {
+	return w.walkDirs(name, true)
+}
+
+// checkDirs checks that the directories of a slash-separated path below
+// the directory exist and are not symbolic links
+func (w *dirWriter) checkDirs(name string) error {
+	return w.walkDirs(name, false)
+}
+
+func (w *dirWriter) walkDirs(name string, create bool) error {
+	if name == "." {
+		return nil
+	}
+	p := w.dir
+	for _, part := range strings.Split(name, "/") {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		switch {
+		case create && errors.Is(err, fs.ErrNotExist):
+			if err := os.Mkdir(p, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&fs.ModeSymlink != 0:
+			return rejected(CodeLinkEscape, "archive entry %q is written through a link", name)
+		case !info.IsDir():
+			return fmt.Errorf("%q is not a directory", part)
+		}
+	}
+	return nil
+}
+
+func (w *dirWriter) Close() error {
+	return nil
+}
+
+// commandWriter pipes what is written to it through a command
+type commandWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func newCommandWriter(ctx context.Context, w io.Writer, name string, args ...string) (*commandWriter, error) {
+	cmd := tools.CommandContext(ctx, name, args...)
+	cmd.Stdout = w
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	return &commandWriter{cmd: cmd, stdin: stdin}, nil
+}
+
+func (w *commandWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+func (w *commandWriter) Close() error {
+	w.stdin.Close()
+	return w.cmd.Wait()
+}
+
+// commandReader reads the output of a command run on an input
+type commandReader struct {
+	cmd    *exec.Cmd
+	name   string
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	waited bool
+	err    error
+}
+
+func newCommandReader(ctx context.Context, r io.Reader, name string, args ...string) (*commandReader, error) {
+	cmd := tools.CommandContext(ctx, name, args...)
+	cmd.Stdin = r
+	cr := &commandReader{cmd: cmd, name: name}
+	cmd.Stderr = &cr.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	cr.stdout = stdout
+	return cr, nil
+}
+
+// Read reads the output, failing at its end if the command failed
+func (r *commandReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *commandReader) wait() error {
+	if !r.waited {
+		r.waited = true
+		if err := r.cmd.Wait(); err != nil {
+			r.err = fmt.Errorf("%s failed: %w: %s", r.name, err, strings.TrimSpace(r.stderr.String()))
+		}
+	}
+	return r.err
+}
+
+// Close stops the command. Failures were reported by Read, a command that
+// is stopped before its output was read fails too.
+func (r *commandReader) Close() error {
+	r.stdout.Close()
+	r.wait()
+	return nil
+}
+
+// copyMembers copies the members of r to w. Each member is checked against
+// the rules and limits before any of it is written; Go's readers fail
+// members whose content is longer than their header says, so the sizes
+// checked are the sizes written.
+func copyMembers(r archiveReader, w archiveWriter, in *inspector, progress func()) error {
+	for {
+		m, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if err := in.check(m.entry); err != nil {
+			return err
+		}
+
+		// Names are written cleaned, the checks above ensure they are valid
+		m.name, _ = cleanEntryPath(m.name)
+		if m.name == "." {
+			continue
+		}
+		if m.kind == kindHardlink {
+			m.link, _ = cleanEntryPath(m.link)
+		}
+
+		var content io.Reader
+		if m.kind == kindFile {
+			if content, err = r.content(); err != nil {
+				return fmt.Errorf("failed to read archive: %w", err)
+			}
+		}
+		if err := w.add(m, content); err != nil {
+			return fmt.Errorf("failed to copy %q: %w", m.name, err)
+		}
+		if progress != nil {
+			progress()
+		}
+	}
+}
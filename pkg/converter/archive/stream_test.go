@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive returns the members of an archive by name, with the content
+// of files and the target of links
+func readArchive(t *testing.T, src, format string) map[string]string {
+	return readEncrypted(t, src, format, "")
+}
+
+// readEncrypted is readArchive for archives encrypted with a password
+func readEncrypted(t *testing.T, src, format, password string) map[string]string {
+	f, err := openSource(context.Background(), src)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := newReader(f, format, password)
+	require.NoError(t, err)
+	defer r.Close()
+
+	members := make(map[string]string)
+	for {
+		m, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return members
+		}
+		require.NoError(t, err)
+		switch m.kind {
+		case kindFile:
+			content, err := r.content()
+			require.NoError(t, err)
+			data, err := io.ReadAll(content)
+			require.NoError(t, err)
+			members[m.name] = string(data)
+		case kindDir:
+			members[strings.TrimSuffix(m.name, "/")] = "<dir>"
+		default:
+			members[m.name] = "-> " + m.link
+		}
+	}
+}
+
+func TestRepack(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	src := writeZip(t,
+		zipEntry{name: "docs/", mode: fs.ModeDir},
+		zipEntry{name: "docs/readme.txt", content: "hello"},
+		zipEntry{name: "docs/link", content: "readme.txt", mode: fs.ModeSymlink},
+		zipEntry{name: "./empty.txt"},
+	)
+	want := map[string]string{
+		"docs":            "<dir>",
+		"docs/readme.txt": "hello",
+		"docs/link":       "-> readme.txt",
+		"empty.txt":       "",
+	}
+
+	formats := []string{"tar.gz", "tar.xz", "tar.zst", "tar", "zip"}
+	if _, err := exec.LookPath("bzip2"); err == nil {
+		formats = append([]string{"tar.bz2"}, formats...)
+	}
+	if _, err := exec.LookPath("lz4"); err == nil {
+		formats = append([]string{"tar.lz4"}, formats...)
+	}
+	for _, format := range formats {
+		dest := filepath.Join(dir, "out."+format)
+		require.NoError(t, c.Convert(ctx, src, dest, iface.Options{}), format)
+
+		got := readArchive(t, dest, format)
+		assert.Equal(t, want, got, format)
+		src = dest
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	content := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20000)
+	src := writeZip(t, zipEntry{name: "fox.txt", content: content})
+
+	for _, format := range []string{"zip", "tar.gz", "tar.xz", "tar.zst"} {
+		sizes := make(map[int]int64)
+		for _, level := range []int{1, 9} {
+			dest := filepath.Join(t.TempDir(), "out."+format)
+			require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{CompressionLevel: level}), format)
+			assert.Equal(t, map[string]string{"fox.txt": content}, readArchive(t, dest, format), format)
+
+			info, err := os.Stat(dest)
+			require.NoError(t, err)
+			sizes[level] = info.Size()
+		}
+		assert.LessOrEqual(t, sizes[9], sizes[1], format)
+	}
+}
+
+func TestRepackHardLinkToZip(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	src := writeTarGz(t,
+		&tar.Header{Name: "dir/file.txt", Typeflag: tar.TypeReg, Size: 3},
+		&tar.Header{Name: "dir/sub/copy.txt", Typeflag: tar.TypeLink, Linkname: "./dir/file.txt"},
+	)
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{}))
+
+	assert.Equal(t, map[string]string{
+		"dir/file.txt":     "aaa",
+		"dir/sub/copy.txt": "-> ../file.txt",
+	}, readArchive(t, dest, "zip"))
+}
+
+func TestRepackRejected(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	src := writeTarGz(t,
+		&tar.Header{Name: "ok.txt", Typeflag: tar.TypeReg, Size: 1},
+		&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Size: 1},
+	)
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	assertCode(t, c.Convert(context.Background(), src, dest, iface.Options{}), CodePathTraversal)
+
+	_, err := os.Stat(dest)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "a partial archive is removed")
+}
+
+func TestExtractNative(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	src := writeTarGz(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "dir/file.txt", Typeflag: tar.TypeReg, Size: 2},
+		&tar.Header{Name: "dir/copy.txt", Typeflag: tar.TypeLink, Linkname: "dir/file.txt"},
+		&tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file.txt"},
+	)
+	dir := t.TempDir()
+	require.NoError(t, c.extractNative(context.Background(), src, dir, "tar.gz", "", nil))
+
+	data, err := os.ReadFile(filepath.Join(dir, "dir", "copy.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "aa", string(data))
+	target, err := os.Readlink(filepath.Join(dir, "dir", "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "file.txt", target)
+	assert.NoError(t, c.verifyExtracted(src, dir))
+}
+
+func TestDirWriterNoFollow(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+	w := &dirWriter{dir: dir}
+
+	err := w.add(member{entry: entry{name: "link/pwned"}, mode: 0644}, strings.NewReader("x"))
+	assertCode(t, err, CodeLinkEscape)
+	err = w.add(member{entry: entry{name: "link/sub", kind: kindDir}, mode: 0755}, nil)
+	assertCode(t, err, CodeLinkEscape)
+	err = w.add(member{entry: entry{name: "copy", kind: kindHardlink, link: "link/secret"}}, nil)
+	assertCode(t, err, CodeLinkEscape)
+	err = w.add(member{entry: entry{name: "copy", kind: kindHardlink, link: "link"}}, nil)
+	assertCode(t, err, CodeLinkEscape)
+
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "nothing is written outside the directory")
+}
+
+func TestRepackCancelled(t *testing.T) {
+	c := &ArchiveConverter{limits: DefaultLimits}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := writeZip(t, zipEntry{name: "file.txt", content: "x"})
+	err := c.Convert(ctx, src, filepath.Join(t.TempDir(), "out.tar"), iface.Options{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
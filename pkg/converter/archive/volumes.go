@@ -0,0 +1,123 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// splittable reports whether archives of the format can be split into
+// volumes that 7-Zip joins again
+func splittable(format string) bool {
+	return format == "zip" || format == "7z"
+}
+
+// splitVolumes splits the archive at path into volumes of size bytes, named
+// like 7-Zip names them: path.001, path.002 and so on. The archive is
+// replaced by its volumes, which concatenated give the archive again.
+func splitVolumes(path string, size int64) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []string
+	for written := int64(0); written < info.Size() || len(volumes) == 0; written += size {
+		volume := fmt.Sprintf("%s.%03d", path, len(volumes)+1)
+		volumes = append(volumes, volume)
+		if err := writeVolume(volume, io.LimitReader(f, size)); err != nil {
+			removeAll(volumes)
+			return nil, fmt.Errorf("failed to split archive: %w", err)
+		}
+	}
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		removeAll(volumes)
+		return nil, err
+	}
+	return volumes, nil
+}
+
+func writeVolume(path string, r io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyVolume copies the only volume of an archive to dest, the volume
+// being the archive itself
+func copyVolume(volume, dest string) error {
+	f, err := os.Open(volume)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeVolume(dest, f); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	return nil
+}
+
+// zipVolumes packs the volumes of an archive into a ZIP at dest, under
+// their file names. Volumes are compressed already, so they are stored.
+func zipVolumes(dest string, volumes []string) (err error) {
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to create archive: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	zw := zip.NewWriter(out)
+	for _, volume := range volumes {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     filepath.Base(volume),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		f, err := os.Open(volume)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	return nil
+}
+
+// removeAll removes files, ignoring errors
+func removeAll(paths []string) {
+	for _, p := range paths {
+		os.Remove(p)
+	}
+}
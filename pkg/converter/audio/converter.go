@@ -3,8 +3,8 @@ package audio
 import (
 	"context"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
@@ -27,6 +27,7 @@ func NewAudioConverter(toolManager *tools.ToolManager, tempDir string) iface.Con
 	}
 
 	// Register supported formats
+	converter.SetCategory("audio", "ffmpeg")
 	converter.AddSupportedConversion("mp3", "wav", "aac", "flac", "ogg", "m4a", "wma")
 	converter.AddSupportedConversion("wav", "mp3", "aac", "flac", "ogg", "m4a", "wma")
 	converter.AddSupportedConversion("aac", "mp3", "wav", "flac", "ogg", "m4a", "wma")
@@ -35,11 +36,14 @@ func NewAudioConverter(toolManager *tools.ToolManager, tempDir string) iface.Con
 	converter.AddSupportedConversion("m4a", "mp3", "wav", "aac", "flac", "ogg", "wma")
 	converter.AddSupportedConversion("wma", "mp3", "wav", "aac", "flac", "ogg", "m4a")
 
+	// Register supported options
+	converter.SetOptionSchema(iface.OptionAudioBitrate, iface.OptionSampleRate)
+
 	return converter
 }
 
 // Convert converts an audio file from one format to another using FFmpeg
-func (c *AudioConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *AudioConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Get the file extension to determine the target format
 	extension := filepath.Ext(outputPath)
 	if len(extension) == 0 {
@@ -80,12 +84,21 @@ func (c *AudioConverter) Convert(ctx context.Context, inputPath, outputPath stri
 		args = append(args, "-c:a", codec)
 	}
 
-	// Add output file
+	// Add bitrate and sample rate if requested
+	if opts.AudioBitrate != "" {
+		args = append(args, "-b:a", opts.AudioBitrate)
+	}
+	if opts.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(opts.SampleRate))
+	}
+
+	// Report progress, then add the output file
+	args = append(args, base.FFmpegProgressArgs...)
 	args = append(args, outputPath)
 
 	// Run FFmpeg
-	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
-	output, err := cmd.CombinedOutput()
+	cmd := tools.CommandContext(ctx, ffmpegPath, args...)
+	output, err := base.RunFFmpeg(ctx, cmd)
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,6 +17,10 @@ type BaseConverter struct {
 	tempDir     string
 	toolManager *tools.ToolManager
 	supportedFormats map[string][]string // map[sourceFormat][]targetFormat
+	optionSchema     iface.OptionSchema
+	registry         *registry.Registry
+	category         string
+	tool             string
 }
 
 // NewBaseConverter creates a new BaseConverter
@@ -23,9 +29,22 @@ func NewBaseConverter(toolManager *tools.ToolManager, tempDir string) *BaseConve
 		tempDir:     tempDir,
 		toolManager: toolManager,
 		supportedFormats: make(map[string][]string),
+		registry:         registry.Default(),
 	}
 }
 
+// SetCategory sets the category and the external tool that subsequent
+// AddSupportedConversion calls record in the format registry
+func (c *BaseConverter) SetCategory(category, tool string) {
+	c.category = category
+	c.tool = tool
+}
+
+// SetTool changes the tool recorded for subsequently added conversions
+func (c *BaseConverter) SetTool(tool string) {
+	c.tool = tool
+}
+
 // SupportsConversion checks if the converter supports the given conversion
 func (c *BaseConverter) SupportsConversion(sourceFormat, targetFormat string) bool {
 	if targets, exists := c.supportedFormats[sourceFormat]; exists {
@@ -38,9 +57,22 @@ func (c *BaseConverter) SupportsConversion(sourceFormat, targetFormat string) bo
 	return false
 }
 
-// AddSupportedConversion adds a supported conversion
+// AddSupportedConversion adds a supported conversion and records it in the format registry
 func (c *BaseConverter) AddSupportedConversion(sourceFormat string, targetFormats ...string) {
 	c.supportedFormats[sourceFormat] = append(c.supportedFormats[sourceFormat], targetFormats...)
+	if c.category != "" {
+		c.registry.Register(c.category, c.tool, sourceFormat, targetFormats...)
+	}
+}
+
+// SetOptionSchema sets the options the converter accepts
+func (c *BaseConverter) SetOptionSchema(names ...string) {
+	c.optionSchema = iface.OptionSchema(names)
+}
+
+// ValidateOptions checks the options against the converter's option schema
+func (c *BaseConverter) ValidateOptions(opts iface.Options) error {
+	return c.optionSchema.Validate(opts)
 }
 
 // CreateTempFile creates a temporary file in the converter's temp directory
@@ -94,6 +126,6 @@ func (c *BaseConverter) GetOutputFilename(inputPath, targetExt string) string {
 }
 
 // Convert is a placeholder that should be implemented by specific converters
-func (c *BaseConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *BaseConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	return fmt.Errorf("convert method not implemented")
 }
@@ -0,0 +1,112 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// FFmpegProgressArgs makes FFmpeg write machine readable progress to stdout.
+// Add them to the arguments of commands run with RunFFmpeg.
+var FFmpegProgressArgs = []string{"-progress", "pipe:1", "-nostats"}
+
+var (
+	ffmpegDurationPattern = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	ffmpegProgressPattern = regexp.MustCompile(`^([a-z0-9_]+)=(\S*)$`)
+)
+
+// RunFFmpeg runs an FFmpeg command, reporting the conversion progress on ctx,
+// and returns FFmpeg's log output without the progress lines
+func RunFFmpeg(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	w := &ffmpegProgressWriter{ctx: ctx, lastPercent: -1}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+	err := cmd.Run()
+	w.flush()
+	return w.output.Bytes(), err
+}
+
+// ffmpegProgressWriter parses the input duration and the -progress key/value
+// lines out of FFmpeg's output
+type ffmpegProgressWriter struct {
+	ctx         context.Context
+	line        []byte
+	output      bytes.Buffer
+	duration    time.Duration
+	lastPercent int
+}
+
+// Write splits the output into lines and handles each complete line
+func (w *ffmpegProgressWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			w.handleLine(w.line)
+			w.line = w.line[:0]
+			continue
+		}
+		w.line = append(w.line, b)
+	}
+	return len(p), nil
+}
+
+// flush handles a trailing line without a newline
+func (w *ffmpegProgressWriter) flush() {
+	if len(w.line) > 0 {
+		w.handleLine(w.line)
+		w.line = w.line[:0]
+	}
+}
+
+func (w *ffmpegProgressWriter) handleLine(line []byte) {
+	if len(line) == 0 {
+		return
+	}
+
+	m := ffmpegProgressPattern.FindSubmatch(line)
+	if m == nil {
+		if w.duration == 0 {
+			w.duration = parseFFmpegDuration(line)
+		}
+		w.output.Write(line)
+		w.output.WriteByte('\n')
+		return
+	}
+
+	// out_time_ms is in microseconds as well, FFmpeg keeps the misleading name for compatibility
+	key := string(m[1])
+	if (key != "out_time_us" && key != "out_time_ms") || w.duration <= 0 {
+		return
+	}
+	us, err := strconv.ParseInt(string(m[2]), 10, 64)
+	if err != nil {
+		return
+	}
+
+	percent := int(float64(time.Duration(us)*time.Microsecond) / float64(w.duration) * 100)
+	if percent > 100 {
+		percent = 100
+	}
+	if percent != w.lastPercent {
+		w.lastPercent = percent
+		iface.ReportProgress(w.ctx, iface.Progress{Percent: float64(percent), Stage: iface.StageConverting})
+	}
+}
+
+// parseFFmpegDuration extracts the input duration from an FFmpeg log line
+func parseFFmpegDuration(line []byte) time.Duration {
+	m := ffmpegDurationPattern.FindSubmatch(line)
+	if m == nil {
+		return 0
+	}
+	hours, _ := strconv.Atoi(string(m[1]))
+	minutes, _ := strconv.Atoi(string(m[2]))
+	seconds, _ := strconv.ParseFloat(string(m[3]), 64)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
@@ -0,0 +1,25 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFFmpegProgressWriter(t *testing.T) {
+	var reported []float64
+	ctx := iface.WithProgress(context.Background(), func(p iface.Progress) {
+		reported = append(reported, p.Percent)
+	})
+
+	w := &ffmpegProgressWriter{ctx: ctx, lastPercent: -1}
+	w.Write([]byte("Input #0, wav, from 'in.wav':\n  Duration: 00:00:10.00, bitrate: 1411 kb/s\n"))
+	w.Write([]byte("out_time_us=2500000\nprogress=continue\nout_time_us=2500000\r"))
+	w.Write([]byte("out_time_ms=5000000\nout_time_us=N/A\nprogress=end"))
+	w.flush()
+
+	assert.Equal(t, []float64{25, 50}, reported)
+	assert.Equal(t, "Input #0, wav, from 'in.wav':\n  Duration: 00:00:10.00, bitrate: 1411 kb/s\n", w.output.String())
+}
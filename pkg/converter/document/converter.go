@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -28,18 +27,31 @@ func NewDocumentConverter(toolManager *tools.ToolManager, tempDir string) iface.
 	}
 
 	// Register supported formats and conversions
-	converter.AddSupportedConversion("doc", "pdf", "docx", "odt", "txt", "rtf")
-	converter.AddSupportedConversion("docx", "pdf", "doc", "odt", "txt", "rtf")
-	converter.AddSupportedConversion("odt", "pdf", "doc", "docx", "txt", "rtf")
+	converter.SetCategory("document", "libreoffice")
+	converter.AddSupportedConversion("doc", "pdf", "docx", "odt", "txt", "rtf", "epub")
+	converter.AddSupportedConversion("docx", "pdf", "doc", "odt", "txt", "rtf", "epub")
+	converter.AddSupportedConversion("odt", "pdf", "doc", "docx", "txt", "rtf", "epub")
 	converter.AddSupportedConversion("pdf", "docx", "doc", "odt", "txt", "rtf")
-	converter.AddSupportedConversion("rtf", "docx", "doc", "odt", "pdf", "txt")
+	converter.AddSupportedConversion("rtf", "docx", "doc", "odt", "pdf", "txt", "epub")
 	converter.AddSupportedConversion("txt", "docx", "doc", "odt", "pdf", "rtf")
 
+	// Spreadsheets and presentations can be exported to PDF, which lets the
+	// planner chain them into other converters (e.g. pptx → pdf → png)
+	converter.AddSupportedConversion("xls", "pdf")
+	converter.AddSupportedConversion("xlsx", "pdf")
+	converter.AddSupportedConversion("ods", "pdf")
+	converter.AddSupportedConversion("ppt", "pdf")
+	converter.AddSupportedConversion("pptx", "pdf")
+	converter.AddSupportedConversion("odp", "pdf")
+
+	// Register supported options
+	converter.SetOptionSchema(iface.OptionPageRange)
+
 	return converter
 }
 
 // Convert converts a document from one format to another using LibreOffice
-func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Extract source and target formats from file extensions
 	sourceFormat := strings.TrimPrefix(filepath.Ext(inputPath), ".")
 	if sourceFormat == "" {
@@ -51,6 +63,11 @@ func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath s
 		return fmt.Errorf("could not determine target format from file extension")
 	}
 
+	// Page selection is only available when exporting to PDF
+	if opts.PageRange != "" && strings.ToLower(targetFormat) != "pdf" {
+		return iface.NewConversionError("unsupported_option", "page_range is only supported for PDF output", nil)
+	}
+
 	// Create output directory if it doesn't exist
 	outputDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -65,9 +82,11 @@ func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath s
 	defer os.RemoveAll(tempDir)
 
 	// Convert the document
-	if err := c.convertWithLibreOffice(inputPath, tempDir, targetFormat); err != nil {
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+	if err := c.convertWithLibreOffice(ctx, inputPath, tempDir, sourceFormat, targetFormat, opts); err != nil {
 		return fmt.Errorf("conversion failed: %w", err)
 	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 90, Stage: iface.StageConverting})
 
 	// Find the converted file
 	files, err := filepath.Glob(filepath.Join(tempDir, "*"))
@@ -79,24 +98,31 @@ func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath s
 	if err := os.Rename(files[0], outputPath); err != nil {
 		return fmt.Errorf("failed to move output file: %w", err)
 	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
 
 	return nil
 }
 
-func (c *DocumentConverter) convertWithLibreOffice(inputPath, outputDir, targetFormat string) error {
+func (c *DocumentConverter) convertWithLibreOffice(ctx context.Context, inputPath, outputDir, sourceFormat, targetFormat string, opts iface.Options) error {
 	// Determine the output format for LibreOffice
 	libreofficeFormat, err := getLibreOfficeFormat(targetFormat)
 	if err != nil {
 		return fmt.Errorf("unsupported target format: %w", err)
 	}
 
+	// Pass the page range to the PDF export filter matching the source document
+	if opts.PageRange != "" {
+		libreofficeFormat = fmt.Sprintf(`pdf:%s:{"PageRange":{"type":"string","value":"%s"}}`, getPDFExportFilter(sourceFormat), opts.PageRange)
+	}
+
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Create and run the LibreOffice command
-	cmd := exec.Command(
+	// Create and run the LibreOffice command; cancelling ctx kills soffice and its helpers
+	cmd := tools.CommandContext(
+		ctx,
 		"libreoffice",
 		"--headless",
 		"--convert-to", libreofficeFormat,
@@ -117,26 +143,41 @@ func (c *DocumentConverter) convertWithLibreOffice(inputPath, outputDir, targetF
 	return nil
 }
 
-// getLibreOfficeFormat returns the LibreOffice format filter for the given file extension
+// getLibreOfficeFormat returns the LibreOffice --convert-to argument for the given file extension
 func getLibreOfficeFormat(ext string) (string, error) {
 	switch strings.ToLower(ext) {
 	case "doc":
-		return "MS Word 97", nil
+		return "doc:MS Word 97", nil
 	case "docx":
-		return "MS Word 2007 XML", nil
+		return "docx:MS Word 2007 XML", nil
 	case "odt":
-		return "writer8", nil
+		return "odt:writer8", nil
 	case "pdf":
-		return "writer_pdf_Export", nil
+		// Let LibreOffice pick the PDF export filter for the document type
+		return "pdf", nil
 	case "rtf":
-		return "Rich Text Format", nil
+		return "rtf:Rich Text Format", nil
 	case "txt":
-		return "Text (encoded):UTF8", nil
+		return "txt:Text (encoded):UTF8", nil
+	case "epub":
+		return "epub:EPUB", nil
 	default:
 		return "", fmt.Errorf("unsupported document format: %s", ext)
 	}
 }
 
+// getPDFExportFilter returns the LibreOffice PDF export filter for the source document type
+func getPDFExportFilter(sourceFormat string) string {
+	switch strings.ToLower(sourceFormat) {
+	case "xls", "xlsx", "ods":
+		return "calc_pdf_Export"
+	case "ppt", "pptx", "odp":
+		return "impress_pdf_Export"
+	default:
+		return "writer_pdf_Export"
+	}
+}
+
 // getOutputDir creates and returns a temporary directory for the conversion
 func (c *DocumentConverter) getOutputDir() (string, error) {
 	tempDir, err := os.MkdirTemp("", "doc_convert_*")
@@ -147,40 +188,6 @@ func (c *DocumentConverter) getOutputDir() (string, error) {
 	return tempDir, nil
 }
 
-// ValidateOptions validates the conversion options
-func (c *DocumentConverter) ValidateOptions(options map[string]interface{}) error {
-	// Check required options
-	if _, ok := options["source_format"]; !ok {
-		return iface.NewConversionError("missing_option", "source_format is required", nil)
-	}
-
-	if _, ok := options["target_format"]; !ok {
-		return iface.NewConversionError("missing_option", "target_format is required", nil)
-	}
-
-	sourceFormat, ok := options["source_format"].(string)
-	if !ok {
-		return iface.NewConversionError("invalid_option", "source_format must be a string", nil)
-	}
-
-	targetFormat, ok := options["target_format"].(string)
-	if !ok {
-		return iface.NewConversionError("invalid_option", "target_format must be a string", nil)
-	}
-
-	if !c.SupportsConversion(sourceFormat, targetFormat) {
-		return iface.NewConversionError("unsupported_conversion", 
-			fmt.Sprintf("conversion from %s to %s is not supported", sourceFormat, targetFormat), nil)
-	}
-
-	// Check if required external tools are installed
-	if _, err := exec.LookPath("libreoffice"); err != nil {
-		return iface.NewConversionError("dependency_error", "LibreOffice is required for document conversion", err)
-	}
-
-	return nil
-}
-
 // Cleanup removes temporary files created during conversion
 func (c *DocumentConverter) Cleanup(files ...string) error {
 	var lastErr error
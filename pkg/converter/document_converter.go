@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -88,7 +89,14 @@ func (c *DocumentConverter) getLibreOfficeFormat(ext string) (string, error) {
 }
 
 // Convert converts a document from one format to another using LibreOffice
-func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *DocumentConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
+	sourceFormat := strings.TrimPrefix(filepath.Ext(inputPath), ".")
+	targetFormat := strings.TrimPrefix(filepath.Ext(outputPath), ".")
+	if !c.SupportsConversion(sourceFormat, targetFormat) {
+		return iface.NewConversionError("unsupported_conversion",
+			fmt.Sprintf("conversion from %s to %s is not supported", sourceFormat, targetFormat), nil)
+	}
+
 	// Implementation of the Convert method
 	// This is a placeholder - the actual implementation would go here
 	return nil
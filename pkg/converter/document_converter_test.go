@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,7 +20,7 @@ type MockDocumentConverter struct {
 }
 
 // Convert is a mock implementation for testing
-func (m *MockDocumentConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (m *MockDocumentConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Check for unsupported source format
 	ext := strings.TrimPrefix(filepath.Ext(inputPath), ".")
 	if ext == "unsupported" {
@@ -131,7 +132,7 @@ func TestDocumentConversions(t *testing.T) {
 			outputFile := filepath.Join(tempDir, fmt.Sprintf("%s_converted.%s", baseName, tc.targetExt))
 
 			// Perform the conversion using our mock
-			err = docConverter.Convert(context.Background(), sourceFile, outputFile)
+			err = docConverter.Convert(context.Background(), sourceFile, outputFile, iface.Options{})
 
 			// Verify the result
 			if tc.expectError {
@@ -185,7 +186,7 @@ func TestUnsupportedFormats(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := docConverter.Convert(context.Background(), tt.sourceFile, "output."+tt.targetExt)
+			err := docConverter.Convert(context.Background(), tt.sourceFile, "output."+tt.targetExt, iface.Options{})
 			assert.Error(t, err, "Expected error for unsupported format")
 		})
 	}
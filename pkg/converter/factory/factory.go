@@ -3,7 +3,6 @@ package factory
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
@@ -12,6 +11,8 @@ import (
 	"github.com/amannvl/freefileconverterz/pkg/converter/document"
 	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
 	"github.com/amannvl/freefileconverterz/pkg/converter/image"
+	"github.com/amannvl/freefileconverterz/pkg/converter/pipeline"
+	"github.com/amannvl/freefileconverterz/pkg/converter/registry"
 	"github.com/amannvl/freefileconverterz/pkg/converter/video"
 )
 
@@ -35,6 +36,8 @@ const (
 type ConverterFactory struct {
 	tempDir     string
 	toolManager *tools.ToolManager
+	registry    *registry.Registry
+	converters  map[ConverterType]iface.Converter
 }
 
 // NewConverterFactory creates a new ConverterFactory
@@ -44,108 +47,129 @@ func NewConverterFactory(tempDir string, toolManager *tools.ToolManager) (*Conve
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
+	// Creating the converters registers their conversions in the registry
+	converters := map[ConverterType]iface.Converter{
+		DocumentConverterType: document.NewDocumentConverter(toolManager, tempDir),
+		ImageConverterType:    image.NewImageConverter(toolManager, tempDir),
+		AudioConverterType:    audio.NewAudioConverter(toolManager, tempDir),
+		VideoConverterType:    video.NewVideoConverter(toolManager, tempDir),
+		ArchiveConverterType:  archive.NewArchiveConverter(toolManager, tempDir),
+	}
+
 	return &ConverterFactory{
 		tempDir:     tempDir,
 		toolManager: toolManager,
+		registry:    registry.Default(),
+		converters:  converters,
 	}, nil
 }
 
-// GetConverter returns the appropriate converter for the given source and target formats
-func (f *ConverterFactory) GetConverter(sourceFormat, targetFormat string) (iface.Converter, error) {
-	// Determine the converter type based on the source format
-	converterType := f.determineConverterType(sourceFormat)
-
-	// Create the appropriate converter
-	switch converterType {
-	case DocumentConverterType:
-		docConv := document.NewDocumentConverter(f.toolManager, f.tempDir)
-		if docConv.SupportsConversion(sourceFormat, targetFormat) {
-			return docConv, nil
-		}
-	case ImageConverterType:
-		imgConv := image.NewImageConverter(f.toolManager, f.tempDir)
-		if imgConv.SupportsConversion(sourceFormat, targetFormat) {
-			return imgConv, nil
-		}
-	case AudioConverterType:
-		audioConv := audio.NewAudioConverter(f.toolManager, f.tempDir)
-		if audioConv.SupportsConversion(sourceFormat, targetFormat) {
-			return audioConv, nil
-		}
-	case VideoConverterType:
-		videoConv := video.NewVideoConverter(f.toolManager, f.tempDir)
-		if videoConv.SupportsConversion(sourceFormat, targetFormat) {
-			return videoConv, nil
-		}
-	case ArchiveConverterType:
-		archiveConv := archive.NewArchiveConverter(f.toolManager, f.tempDir)
-		if archiveConv.SupportsConversion(sourceFormat, targetFormat) {
-			return archiveConv, nil
-		}
+// SetArchiveLimits sets the limits archive entries are checked against before they are written
+func (f *ConverterFactory) SetArchiveLimits(limits archive.Limits) {
+	if c := f.Archives(); c != nil {
+		c.SetLimits(limits)
 	}
+}
 
-	return nil, fmt.Errorf("no converter found for %s to %s conversion", sourceFormat, targetFormat)
+// SetImageBackend sets how image conversions choose between ImageMagick and the native backend
+func (f *ConverterFactory) SetImageBackend(backend image.Backend) error {
+	if c, ok := f.converters[ImageConverterType].(*image.ImageConverter); ok {
+		return c.SetBackend(backend)
+	}
+	return nil
 }
 
-// determineConverterType determines the converter type based on the file extension
-func (f *ConverterFactory) determineConverterType(filename string) ConverterType {
-	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+// Archives returns the archive converter, which also lists and extracts
+// archive entries
+func (f *ConverterFactory) Archives() *archive.ArchiveConverter {
+	c, _ := f.converters[ArchiveConverterType].(*archive.ArchiveConverter)
+	return c
+}
 
-	// Document formats
-	docFormats := map[string]bool{
-		"pdf": true, "doc": true, "docx": true, "odt": true, "rtf": true,
-		"txt": true, "odp": true, "ods": true, "xls": true, "xlsx": true,
-		"ppt": true, "pptx": true, "epub": true, "mobi": true, "azw": true,
-		"fb2": true, "lit": true,
+// GetConverter returns the appropriate converter for the given source and target formats.
+// When no single converter handles the conversion, the cheapest chain of
+// registered conversions is returned as a pipeline. The options are validated
+// against the converter's option schema so invalid options are rejected
+// before the conversion starts.
+func (f *ConverterFactory) GetConverter(sourceFormat, targetFormat string, opts iface.Options) (iface.Converter, error) {
+	// Plan the cheapest path through the registered conversions
+	plan, err := f.registry.Plan(sourceFormat, targetFormat)
+	if err != nil {
+		return nil, fmt.Errorf("no converter found for %s to %s conversion: %w", sourceFormat, targetFormat, err)
 	}
 
-	if docFormats[ext] {
-		return DocumentConverterType
+	steps := make([]pipeline.Step, 0, len(plan))
+	for _, conversion := range plan {
+		conv, ok := f.converters[ConverterType(conversion.Category)]
+		if !ok {
+			return nil, fmt.Errorf("no %s converter available for %s to %s conversion", conversion.Category, conversion.Source, conversion.Target)
+		}
+		steps = append(steps, pipeline.Step{
+			Converter:    conv,
+			SourceFormat: conversion.Source,
+			TargetFormat: conversion.Target,
+		})
 	}
 
-	// Image formats
-	imgFormats := map[string]bool{
-		"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true,
-		"tiff": true, "webp": true, "heic": true, "heif": true,
+	var conv iface.Converter = steps[0].Converter
+	if len(steps) > 1 {
+		conv = pipeline.New(f.tempDir, steps...)
 	}
 
-	if imgFormats[ext] {
-		return ImageConverterType
+	// Validate the options before handing the converter out
+	if err := conv.ValidateOptions(opts); err != nil {
+		return nil, err
 	}
 
-	// Audio formats
-	audioFormats := map[string]bool{
-		"mp3": true, "wav": true, "aac": true, "flac": true, "ogg": true,
-		"m4a": true, "wma": true,
-	}
+	return conv, nil
+}
 
-	if audioFormats[ext] {
-		return AudioConverterType
+// Category returns the converter category a conversion is scheduled under.
+// For multi-hop conversions this is the category of the most expensive step.
+func (f *ConverterFactory) Category(sourceFormat, targetFormat string) (string, error) {
+	plan, err := f.registry.Plan(sourceFormat, targetFormat)
+	if err != nil {
+		return "", fmt.Errorf("no converter found for %s to %s conversion: %w", sourceFormat, targetFormat, err)
 	}
+	return registry.Bottleneck(plan).Category, nil
+}
 
-	// Video formats
-	videoFormats := map[string]bool{
-		"mp4": true, "avi": true, "mov": true, "mkv": true, "wmv": true,
-		"flv": true, "webm": true, "3gp": true, "m4v": true, "mpg": true,
-		"mpeg": true,
+// Fingerprint identifies the steps and tool versions a conversion runs
+// through, so results produced by an older tool are told apart from new ones
+func (f *ConverterFactory) Fingerprint(sourceFormat, targetFormat string) (string, error) {
+	plan, err := f.registry.Plan(sourceFormat, targetFormat)
+	if err != nil {
+		return "", fmt.Errorf("no converter found for %s to %s conversion: %w", sourceFormat, targetFormat, err)
 	}
 
-	if videoFormats[ext] {
-		return VideoConverterType
+	steps := make([]string, 0, len(plan))
+	for _, conversion := range plan {
+		var version string
+		if f.toolManager != nil && conversion.Tool != "" {
+			version = f.toolManager.Version(conversion.Tool)
+		}
+		steps = append(steps, fmt.Sprintf("%s:%s>%s:%s:%s", conversion.Category, conversion.Source, conversion.Target, conversion.Tool, version))
 	}
+	return strings.Join(steps, "|"), nil
+}
 
-	// Archive formats
-	archiveFormats := map[string]bool{
-		"zip": true, "tar": true, "gz": true, "bz2": true, "xz": true,
-		"7z": true, "rar": true, "tgz": true, "tbz2": true, "txz": true,
-	}
+// Registry returns the registry the factory's converters are recorded in
+func (f *ConverterFactory) Registry() *registry.Registry {
+	return f.registry
+}
 
-	if archiveFormats[ext] {
-		return ArchiveConverterType
-	}
+// SupportedFormats returns a map of supported source formats to target formats
+func (f *ConverterFactory) SupportedFormats() map[string][]string {
+	return f.registry.SupportedFormats()
+}
 
-	// Default to document converter for unknown formats
-	return DocumentConverterType
+// Catalog describes every supported format grouped by category, including
+// whether the tool for each conversion is installed right now
+func (f *ConverterFactory) Catalog() map[string]registry.CategoryInfo {
+	if f.toolManager == nil {
+		return f.registry.Catalog(nil)
+	}
+	return f.registry.Catalog(f.toolManager)
 }
 
 // Cleanup removes all temporary files created by the factory
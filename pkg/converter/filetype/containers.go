@@ -0,0 +1,303 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// ISO base media (MP4, QuickTime, 3GP, HEIF) brands
+var (
+	heicBrands = map[string]bool{"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true}
+	heifBrands = map[string]bool{"mif1": true, "msf1": true}
+	avifBrands = map[string]bool{"avif": true, "avis": true}
+	m4aBrands  = map[string]bool{"M4A ": true, "M4B ": true, "M4P ": true}
+)
+
+// quickTimeAtoms are the atoms QuickTime files without ftyp box start with
+var quickTimeAtoms = map[string]bool{"moov": true, "mdat": true, "wide": true, "free": true, "skip": true, "pnot": true}
+
+// isISOBox reports whether the header starts with an ISO base media box
+func isISOBox(header []byte) bool {
+	if len(header) < 12 {
+		return false
+	}
+	box := string(header[4:8])
+	// Other atoms are only trusted with a plausible size, text has no NULs
+	return box == "ftyp" || quickTimeAtoms[box] && header[0] == 0
+}
+
+// detectISO tells the ISO base media formats apart by the brands of their
+// ftyp box
+func detectISO(header []byte) string {
+	if string(header[4:8]) != "ftyp" {
+		return "mov"
+	}
+
+	major := string(header[8:12])
+	end := min(int(binary.BigEndian.Uint32(header[:4])), len(header))
+	compatible := map[string]bool{}
+	for i := 16; i+4 <= end; i += 4 {
+		compatible[string(header[i:i+4])] = true
+	}
+	hasAny := func(brands map[string]bool) bool {
+		for brand := range brands {
+			if compatible[brand] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case heicBrands[major]:
+		return "heic"
+	case avifBrands[major]:
+		return "avif"
+	case heifBrands[major] && hasAny(heicBrands):
+		return "heic"
+	case heifBrands[major] && hasAny(avifBrands):
+		return "avif"
+	case heifBrands[major]:
+		return "heif"
+	case major == "qt  ":
+		return "mov"
+	case strings.HasPrefix(major, "3gp"), strings.HasPrefix(major, "3g2"):
+		return "3gp"
+	case m4aBrands[major]:
+		return "m4a"
+	}
+	return "mp4"
+}
+
+// odfTypes maps the mimetype entry of OpenDocument and EPUB files to formats
+var odfTypes = map[string]string{
+	"application/vnd.oasis.opendocument.text":         "odt",
+	"application/vnd.oasis.opendocument.spreadsheet":  "ods",
+	"application/vnd.oasis.opendocument.presentation": "odp",
+	"application/vnd.oasis.opendocument.graphics":     "odg",
+	"application/epub+zip":                            "epub",
+}
+
+// ooxmlParts maps the part directories of Office Open XML files to formats
+var ooxmlParts = map[string]string{
+	"word/": "docx",
+	"xl/":   "xlsx",
+	"ppt/":  "pptx",
+}
+
+// detectZip tells OpenDocument, EPUB and Office Open XML files from other
+// ZIP archives by their entries
+func detectZip(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "zip"
+	}
+
+	contentTypes := false
+	ooxml := ""
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "mimetype":
+			rc, err := f.Open()
+			if err != nil {
+				continue
+			}
+			data, _ := io.ReadAll(io.LimitReader(rc, 128))
+			rc.Close()
+			if format, ok := odfTypes[strings.TrimSpace(string(data))]; ok {
+				return format
+			}
+		case f.Name == "[Content_Types].xml":
+			contentTypes = true
+		case ooxml == "":
+			for dir, format := range ooxmlParts {
+				if strings.HasPrefix(f.Name, dir) {
+					ooxml = format
+				}
+			}
+		}
+	}
+	if contentTypes && ooxml != "" {
+		return ooxml
+	}
+	return "zip"
+}
+
+// Compound File Binary (OLE2) files, used by Office 97-2003 documents
+var oleMagic = []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+
+// oleStreams maps the top level streams of Office 97-2003 files to formats
+var oleStreams = map[string]string{
+	"WordDocument":        "doc",
+	"Workbook":            "xls",
+	"Book":                "xls",
+	"PowerPoint Document": "ppt",
+}
+
+// CFB sector numbers at and above this are markers, not sectors
+const oleMaxSector = 0xfffffffa
+
+// oleMaxEntries bounds the directory entries read from a CFB file
+const oleMaxEntries = 4096
+
+// detectOLE tells Word, Excel and PowerPoint 97-2003 files apart by the
+// streams at the top of their directory
+func detectOLE(r io.ReaderAt, size int64, header []byte) string {
+	if len(header) < 512 {
+		return ""
+	}
+	shift := binary.LittleEndian.Uint16(header[0x1e:])
+	if shift != 9 && shift != 12 {
+		return ""
+	}
+	sectorSize := int64(1) << shift
+	readSector := func(sector uint32) []byte {
+		buf := make([]byte, sectorSize)
+		offset := (int64(sector) + 1) * sectorSize
+		if offset+sectorSize > size {
+			return nil
+		}
+		if _, err := r.ReadAt(buf, offset); err != nil {
+			return nil
+		}
+		return buf
+	}
+
+	// The allocation table locating the directory sectors; only the part
+	// listed in the header is read, which covers the directory of all but
+	// very large files
+	var fat []uint32
+	for i := 0; i < 109; i++ {
+		sector := binary.LittleEndian.Uint32(header[0x4c+4*i:])
+		if sector >= oleMaxSector {
+			break
+		}
+		data := readSector(sector)
+		for j := 0; j+4 <= len(data); j += 4 {
+			fat = append(fat, binary.LittleEndian.Uint32(data[j:]))
+		}
+	}
+
+	type entry struct {
+		name               string
+		left, right, child uint32
+	}
+	var entries []entry
+	sector := binary.LittleEndian.Uint32(header[0x30:])
+	for sector < oleMaxSector && len(entries) < oleMaxEntries {
+		data := readSector(sector)
+		if data == nil {
+			break
+		}
+		for i := 0; i+128 <= len(data); i += 128 {
+			raw := data[i : i+128]
+			nameLen := min(int(binary.LittleEndian.Uint16(raw[0x40:])), 64)
+			units := make([]uint16, 0, 32)
+			for j := 0; j+2 <= nameLen-2; j += 2 {
+				units = append(units, binary.LittleEndian.Uint16(raw[j:]))
+			}
+			entries = append(entries, entry{
+				name:  string(utf16.Decode(units)),
+				left:  binary.LittleEndian.Uint32(raw[0x44:]),
+				right: binary.LittleEndian.Uint32(raw[0x48:]),
+				child: binary.LittleEndian.Uint32(raw[0x4c:]),
+			})
+		}
+		if int(sector) >= len(fat) {
+			break
+		}
+		sector = fat[sector]
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+
+	// Walk the children of the root entry; embedded documents live in
+	// storages further down and are not considered
+	found := map[string]bool{}
+	visited := map[uint32]bool{}
+	stack := []uint32{entries[0].child}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id >= uint32(len(entries)) || visited[id] {
+			continue
+		}
+		visited[id] = true
+		if format, ok := oleStreams[entries[id].name]; ok {
+			found[format] = true
+		}
+		stack = append(stack, entries[id].left, entries[id].right)
+	}
+	for _, format := range []string{"doc", "xls", "ppt"} {
+		if found[format] {
+			return format
+		}
+	}
+	return ""
+}
+
+// Advanced Systems Format files, used by Windows Media audio and video
+var (
+	asfMagic      = []byte("\x30\x26\xb2\x75\x8e\x66\xcf\x11\xa6\xd9\x00\xaa\x00\x62\xce\x6c")
+	asfVideoMedia = []byte("\xc0\xef\x19\xbc\x4d\x5b\xcf\x11\xa8\xfd\x00\x80\x5f\x5c\x44\x2b")
+)
+
+// asfMaxHeader bounds the bytes of the ASF header object searched for
+// video streams
+const asfMaxHeader = 1 << 20
+
+// detectASF tells Windows Media video from audio by the stream types in
+// the header object
+func detectASF(r io.ReaderAt, header []byte) string {
+	if len(header) < 24 {
+		return ""
+	}
+	headerSize := min(binary.LittleEndian.Uint64(header[16:24]), asfMaxHeader)
+	data := header
+	if headerSize > uint64(len(header)) {
+		data = make([]byte, headerSize)
+		n, _ := r.ReadAt(data, 0)
+		data = data[:n]
+	}
+	if bytes.Contains(data, asfVideoMedia) {
+		return "wmv"
+	}
+	return "wma"
+}
+
+// detectEBML tells WebM from other Matroska files by the DocType element
+func detectEBML(header []byte) string {
+	data := header[:min(len(header), 4096)]
+	i := bytes.Index(data, []byte("\x42\x82"))
+	if i < 0 || i+3 > len(data) {
+		return "mkv"
+	}
+
+	// The element size is a variable length integer
+	first := data[i+2]
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || i+2+length > len(data) {
+		return "mkv"
+	}
+	size := uint64(first & (0xff >> length))
+	for _, b := range data[i+3 : i+2+length] {
+		size = size<<8 | uint64(b)
+	}
+	start := i + 2 + length
+	if uint64(len(data)-start) < size {
+		return "mkv"
+	}
+
+	if string(data[start:start+int(size)]) == "webm" {
+		return "webm"
+	}
+	return "mkv"
+}
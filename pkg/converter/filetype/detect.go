@@ -0,0 +1,265 @@
+package filetype
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"unicode/utf8"
+)
+
+// signature is a byte sequence identifying a format at a fixed offset
+type signature struct {
+	offset int
+	magic  []byte
+	format string
+}
+
+// signatures are matched in order, the first match wins
+var signatures = []signature{
+	{0, []byte("\x89PNG\r\n\x1a\n"), "png"},
+	{0, []byte("\xff\xd8\xff"), "jpg"},
+	{0, []byte("GIF87a"), "gif"},
+	{0, []byte("GIF89a"), "gif"},
+	{0, []byte("II*\x00"), "tiff"},
+	{0, []byte("MM\x00*"), "tiff"},
+	{0, []byte("\x00\x00\x01\x00"), "ico"},
+	{0, []byte("\xff\x0a"), "jxl"},
+	{0, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n"), "jxl"},
+	{0, []byte("{\\rtf"), "rtf"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "7z"},
+	{0, []byte("Rar!\x1a\x07"), "rar"},
+	{0, []byte("\xfd7zXZ\x00"), "xz"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "zst"},
+	{0, []byte("\x04\x22\x4d\x18"), "lz4"},
+	{0, []byte("FLV\x01"), "flv"},
+	{0, []byte("OggS"), "ogg"},
+	{0, []byte("fLaC"), "flac"},
+	{0, []byte("ADIF"), "aac"},
+	{8, []byte("WAVE"), "wav"},
+	{8, []byte("AVI "), "avi"},
+	{8, []byte("WEBP"), "webp"},
+}
+
+// riffFormats are the formats stored in RIFF containers
+var riffFormats = map[string]bool{"wav": true, "avi": true, "webp": true}
+
+// detect identifies the format of r from its header and, for containers,
+// the parts of r the header points to
+func detect(r io.ReaderAt, size int64, header []byte) string {
+	// ISO base media files start with the size of their first box, which
+	// may look like another signature
+	if isISOBox(header) {
+		return detectISO(header)
+	}
+
+	for _, sig := range signatures {
+		if !hasAt(header, sig.offset, sig.magic) {
+			continue
+		}
+		if riffFormats[sig.format] && !bytes.HasPrefix(header, []byte("RIFF")) {
+			continue
+		}
+		if sig.format == "png" && isAPNG(header) {
+			return "apng"
+		}
+		return sig.format
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return detectZip(r, size)
+	case bytes.HasPrefix(header, oleMagic):
+		return detectOLE(r, size, header)
+	case bytes.HasPrefix(header, asfMagic):
+		return detectASF(r, header)
+	case bytes.HasPrefix(header, []byte("\x1a\x45\xdf\xa3")):
+		return detectEBML(header)
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return detectCompressed(r, size, "gz")
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return detectCompressed(r, size, "bz2")
+	case isBMP(header):
+		return "bmp"
+	case isTar(header):
+		return "tar"
+	}
+
+	// PDF files may start with a few bytes of garbage before the marker
+	if bytes.Contains(header[:min(len(header), 1024)], []byte("%PDF-")) {
+		return "pdf"
+	}
+	if format := detectMPEGAudio(r, header); format != "" {
+		return format
+	}
+	return detectText(header)
+}
+
+// hasAt reports whether data contains magic at offset
+func hasAt(data []byte, offset int, magic []byte) bool {
+	return len(data) >= offset+len(magic) && bytes.Equal(data[offset:offset+len(magic)], magic)
+}
+
+// isAPNG looks for the animation control chunk, which precedes the image
+// data of animated PNGs
+func isAPNG(header []byte) bool {
+	for offset := 8; offset+8 <= len(header); {
+		length := int(binary.BigEndian.Uint32(header[offset:]))
+		switch string(header[offset+4 : offset+8]) {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+		if length < 0 || length > len(header) {
+			return false
+		}
+		offset += 12 + length
+	}
+	return false
+}
+
+// isBMP checks the file header and the size of the DIB header following it
+func isBMP(header []byte) bool {
+	if len(header) < 18 || !bytes.HasPrefix(header, []byte("BM")) {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header[14:18]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// isTar checks the magic and the checksum of a tar header. Old tar files
+// have no magic, so the checksum alone decides.
+func isTar(header []byte) bool {
+	if len(header) < 512 {
+		return false
+	}
+	if hasAt(header, 257, []byte("ustar")) {
+		return true
+	}
+
+	field := bytes.TrimRight(bytes.TrimLeft(header[148:156], " "), " \x00")
+	if len(field) == 0 {
+		return false
+	}
+	var stored int64
+	for _, c := range field {
+		if c < '0' || c > '7' {
+			return false
+		}
+		stored = stored*8 + int64(c-'0')
+	}
+
+	// The checksum counts its own field as spaces
+	var sum int64
+	for i, c := range header[:512] {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	return sum == stored && sum != 8*' '
+}
+
+// detectCompressed tells a compressed tar archive from another compressed
+// file by decompressing the first tar header. bzip2 only decompresses whole
+// blocks, so up to a block is read from r.
+func detectCompressed(r io.ReaderAt, size int64, format string) string {
+	var zr io.Reader = io.NewSectionReader(r, 0, size)
+	switch format {
+	case "gz":
+		gr, err := gzip.NewReader(zr)
+		if err != nil {
+			return ""
+		}
+		zr = gr
+	case "bz2":
+		zr = bzip2.NewReader(zr)
+	}
+
+	block := make([]byte, 512)
+	if _, err := io.ReadFull(zr, block); err == nil && isTar(block) {
+		return "tar." + format
+	}
+	return format
+}
+
+// detectMPEGAudio recognizes MP3 and ADTS AAC streams, optionally preceded
+// by an ID3v2 tag
+func detectMPEGAudio(r io.ReaderAt, header []byte) string {
+	frame := header
+	tagged := false
+	if len(header) >= 10 && bytes.HasPrefix(header, []byte("ID3")) {
+		tagged = true
+		// The tag size is a 28 bit synchsafe integer
+		size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+		offset := 10 + size
+		if header[5]&0x10 != 0 {
+			offset += 10 // footer
+		}
+		frame = make([]byte, 4)
+		n, _ := r.ReadAt(frame, offset)
+		frame = frame[:n]
+		if bytes.HasPrefix(frame, []byte("fLaC")) {
+			return "flac"
+		}
+	}
+
+	if len(frame) >= 4 && frame[0] == 0xff && frame[1]&0xe0 == 0xe0 {
+		if frame[1]&0xf6 == 0xf0 {
+			return "aac"
+		}
+		version := frame[1] >> 3 & 0x03
+		layer := frame[1] >> 1 & 0x03
+		bitrate := frame[2] >> 4
+		if version != 1 && layer != 0 && bitrate != 0x0f && frame[2]&0x0c != 0x0c {
+			return "mp3"
+		}
+	}
+	if tagged {
+		return "mp3"
+	}
+	return ""
+}
+
+// detectText recognizes plain text, HTML and SVG. Text is valid UTF-8 or
+// UTF-16 with a byte order mark and contains no control characters other
+// than whitespace.
+func detectText(header []byte) string {
+	if len(header) == 0 {
+		return ""
+	}
+	if bytes.HasPrefix(header, []byte("\xff\xfe")) || bytes.HasPrefix(header, []byte("\xfe\xff")) {
+		return "txt"
+	}
+
+	text := bytes.TrimPrefix(header, []byte("\xef\xbb\xbf"))
+	for rest := text; len(rest) > 0; {
+		r, size := utf8.DecodeRune(rest)
+		switch {
+		case r == utf8.RuneError && size == 1 && !utf8.FullRune(rest):
+			// The header ends inside a multi-byte character
+			rest = nil
+			continue
+		case r == utf8.RuneError && size == 1:
+			return ""
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f':
+			return ""
+		}
+		rest = rest[size:]
+	}
+
+	lower := bytes.ToLower(bytes.TrimSpace(text))
+	switch {
+	case bytes.HasPrefix(lower, []byte("<!doctype html")), bytes.HasPrefix(lower, []byte("<html")):
+		return "html"
+	case bytes.HasPrefix(lower, []byte("<svg")),
+		bytes.HasPrefix(lower, []byte("<?xml")) && bytes.Contains(lower, []byte("<svg")):
+		return "svg"
+	}
+	return "txt"
+}
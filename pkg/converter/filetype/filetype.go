@@ -0,0 +1,152 @@
+// Package filetype identifies file formats from their content. Formats are
+// named like the converter registry names them, so a detected format can be
+// used to select a converter directly.
+package filetype
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// headerSize is the number of leading bytes most signatures are matched in
+const headerSize = 8192
+
+// ErrUnrecognized is returned when neither the content nor the name of a
+// file tell its format
+var ErrUnrecognized = errors.New("file format could not be recognized")
+
+// MismatchError is returned when the content of a file does not match the
+// format its name claims
+type MismatchError struct {
+	// Claimed is the format of the file name
+	Claimed string
+	// Detected is the format of the content, empty if it was not recognized
+	Detected string
+}
+
+func (e *MismatchError) Error() string {
+	if e.Detected == "" {
+		return fmt.Sprintf("file content is not a valid %s file", e.Claimed)
+	}
+	return fmt.Sprintf("file content is %s, not %s", e.Detected, e.Claimed)
+}
+
+// aliases lists the other names a file of a detected format may carry.
+// Containers that are valid files of a more general format may be named
+// after that format, e.g. a DOCX file as ZIP.
+var aliases = map[string][]string{
+	"jpg":     {"jpeg"},
+	"apng":    {"png"},
+	"tiff":    {"tif"},
+	"heic":    {"heif"},
+	"heif":    {"heic"},
+	"mp4":     {"m4a", "m4v"},
+	"m4a":     {"mp4"},
+	"webm":    {"mkv"},
+	"txt":     {"csv", "md", "json", "xml", "log"},
+	"html":    {"htm", "txt"},
+	"svg":     {"xml"},
+	"docx":    {"zip"},
+	"xlsx":    {"zip"},
+	"pptx":    {"zip"},
+	"odt":     {"zip"},
+	"ods":     {"zip"},
+	"odp":     {"zip"},
+	"epub":    {"zip"},
+	"tar.gz":  {"gz"},
+	"tar.bz2": {"bz2"},
+	"xz":      {"tar.xz"},
+	"zst":     {"tar.zst"},
+	"lz4":     {"tar.lz4"},
+}
+
+// doubleExtensions are the formats whose names have two extensions
+var doubleExtensions = []string{"tar.gz", "tar.bz2", "tar.xz", "tar.zst", "tar.lz4"}
+
+// shortExtensions are single extensions standing for a double one
+var shortExtensions = map[string]string{
+	"tgz":  "tar.gz",
+	"tbz":  "tar.bz2",
+	"tbz2": "tar.bz2",
+	"txz":  "tar.xz",
+	"tzst": "tar.zst",
+}
+
+// FromName returns the format a file name claims, or "" if it has no
+// extension
+func FromName(name string) string {
+	lower := strings.ToLower(filepath.Base(name))
+	for _, format := range doubleExtensions {
+		if strings.HasSuffix(lower, "."+format) {
+			return format
+		}
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(lower), ".")
+	if format, ok := shortExtensions[ext]; ok {
+		return format
+	}
+	return ext
+}
+
+// DetectFile returns the format of a file judged by its content, or "" if
+// the content is not recognized
+func DetectFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return Detect(f, info.Size())
+}
+
+// Detect returns the format of the size bytes of r judged by their content,
+// or "" if the content is not recognized
+func Detect(r io.ReaderAt, size int64) (string, error) {
+	header := make([]byte, min(size, headerSize))
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read file header: %w", err)
+	}
+	return detect(r, size, header), nil
+}
+
+// Resolve checks the detected format of a file against the format its name
+// claims and returns the format it should be converted from. A file without
+// extension is converted from the detected format, an alias keeps the
+// claimed one.
+func Resolve(claimed, detected string) (string, error) {
+	claimed = strings.ToLower(strings.TrimPrefix(claimed, "."))
+	switch {
+	case claimed == "" && detected == "":
+		return "", ErrUnrecognized
+	case claimed == "":
+		return detected, nil
+	case claimed == detected:
+		return claimed, nil
+	}
+	for _, alias := range aliases[detected] {
+		if alias == claimed {
+			return claimed, nil
+		}
+	}
+	return "", &MismatchError{Claimed: claimed, Detected: detected}
+}
+
+// Check detects the format of a file and resolves it against the format
+// its name claims
+func Check(path string) (string, error) {
+	detected, err := DetectFile(path)
+	if err != nil {
+		return "", err
+	}
+	return Resolve(FromName(path), detected)
+}
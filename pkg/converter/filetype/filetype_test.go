@@ -0,0 +1,259 @@
+package filetype
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func zipFile(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		require.NoError(t, err)
+		_, err = w.Write([]byte(files[i+1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func tarGz(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 5}))
+	_, err := tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func gz(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func ftyp(major string, compatible ...string) []byte {
+	box := []byte{0, 0, 0, 0}
+	box = append(box, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	return append(box, "\x00\x00\x00\x08free"...)
+}
+
+// cfbEntry is a directory entry of a test compound file
+type cfbEntry struct {
+	name               string
+	left, right, child uint32
+}
+
+// cfb builds a compound file with a single directory sector
+func cfb(entries ...cfbEntry) []byte {
+	const none = 0xffffffff
+	data := make([]byte, 512*3)
+	copy(data, oleMagic)
+	binary.LittleEndian.PutUint16(data[0x1e:], 9)
+	binary.LittleEndian.PutUint32(data[0x2c:], 1)
+	binary.LittleEndian.PutUint32(data[0x30:], 1)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(data[0x4c+4*i:], none)
+	}
+	binary.LittleEndian.PutUint32(data[0x4c:], 0)
+
+	// Sector 0 is the allocation table, sector 1 the directory
+	binary.LittleEndian.PutUint32(data[512:], 0xfffffffd)
+	binary.LittleEndian.PutUint32(data[516:], 0xfffffffe)
+	for i := 2; i < 128; i++ {
+		binary.LittleEndian.PutUint32(data[512+4*i:], none)
+	}
+	for i, entry := range entries {
+		raw := data[1024+128*i : 1024+128*(i+1)]
+		units := utf16.Encode([]rune(entry.name))
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(raw[2*j:], u)
+		}
+		binary.LittleEndian.PutUint16(raw[0x40:], uint16(2*len(units)+2))
+		binary.LittleEndian.PutUint32(raw[0x44:], entry.left)
+		binary.LittleEndian.PutUint32(raw[0x48:], entry.right)
+		binary.LittleEndian.PutUint32(raw[0x4c:], entry.child)
+	}
+	return data
+}
+
+func TestFromName(t *testing.T) {
+	for name, format := range map[string]string{
+		"report.PDF":       "pdf",
+		"photo.jpeg":       "jpeg",
+		"backup.tar.gz":    "tar.gz",
+		"backup.TGZ":       "tar.gz",
+		"logs.tar.bz2":     "tar.bz2",
+		"dir/archive.txz":  "tar.xz",
+		"data.tar.lz4":     "tar.lz4",
+		"data.tzst":        "tar.zst",
+		"no-extension":     "",
+		"archive.gz":       "gz",
+		"/tmp/x/input.mov": "mov",
+	} {
+		assert.Equal(t, format, FromName(name), name)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	const none = 0xffffffff
+	tarball := tarGz(t)
+	mp3Frame := []byte{0xff, 0xfb, 0x90, 0x64, 0, 0, 0, 0}
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), "pdf"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "png"},
+		{"apng", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\x08acTL\x00\x00\x00\x02\x00\x00\x00\x00"), "apng"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "jpg"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "gif"},
+		{"bmp", append([]byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00"), 40, 0, 0, 0), "bmp"},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), "tiff"},
+		{"rtf", []byte("{\\rtf1\\ansi hello}"), "rtf"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "wav"},
+		{"avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), "avi"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "webp"},
+		{"ogg", []byte("OggS\x00\x02"), "ogg"},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "flac"},
+		{"flv", []byte("FLV\x01\x05"), "flv"},
+		{"7z", []byte("7z\xbc\xaf\x27\x1c\x00\x04"), "7z"},
+		{"rar", []byte("Rar!\x1a\x07\x01\x00"), "rar"},
+		{"xz", []byte("\xfd7zXZ\x00\x00\x04"), "xz"},
+		{"mp3 frame", mp3Frame, "mp3"},
+		{"mp3 id3", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02\x00\x00"), mp3Frame...), "mp3"},
+		{"aac", []byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc}, "aac"},
+		{"mp4", ftyp("isom", "isom", "iso2", "avc1", "mp41"), "mp4"},
+		{"mov", ftyp("qt  ", "qt  "), "mov"},
+		{"old quicktime", []byte("\x00\x00\x00\x08wide\x00\x00\x00\x10mdat"), "mov"},
+		{"m4a", ftyp("M4A ", "M4A ", "mp42", "isom"), "m4a"},
+		{"3gp", ftyp("3gp4", "isom", "3gp4"), "3gp"},
+		{"heic", ftyp("heic", "mif1", "heic"), "heic"},
+		{"heic compatible", ftyp("mif1", "mif1", "heic"), "heic"},
+		{"heif", ftyp("mif1", "mif1"), "heif"},
+		{"avif", ftyp("avif", "avif", "mif1", "miaf"), "avif"},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm\x42\x87\x81\x04"), "webm"},
+		{"mkv", []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska\x42\x87\x81\x04"), "mkv"},
+		{"wmv", append(append([]byte(nil), asfMagic...), append(make([]byte, 40), asfVideoMedia...)...), "wmv"},
+		{"wma", append(append([]byte(nil), asfMagic...), make([]byte, 40)...), "wma"},
+		{"docx", zipFile(t, "[Content_Types].xml", "<Types/>", "_rels/.rels", "", "word/document.xml", "<w:document/>"), "docx"},
+		{"xlsx", zipFile(t, "[Content_Types].xml", "<Types/>", "xl/workbook.xml", "<workbook/>"), "xlsx"},
+		{"pptx", zipFile(t, "[Content_Types].xml", "<Types/>", "ppt/presentation.xml", "<p:presentation/>"), "pptx"},
+		{"odt", zipFile(t, "mimetype", "application/vnd.oasis.opendocument.text", "content.xml", ""), "odt"},
+		{"ods", zipFile(t, "mimetype", "application/vnd.oasis.opendocument.spreadsheet", "content.xml", ""), "ods"},
+		{"odp", zipFile(t, "mimetype", "application/vnd.oasis.opendocument.presentation", "content.xml", ""), "odp"},
+		{"epub", zipFile(t, "mimetype", "application/epub+zip", "META-INF/container.xml", ""), "epub"},
+		{"zip", zipFile(t, "word/notes.txt", "not a document"), "zip"},
+		{"doc", cfb(cfbEntry{"Root Entry", none, none, 1}, cfbEntry{"WordDocument", 2, none, none}, cfbEntry{"1Table", none, none, none}), "doc"},
+		{"ppt", cfb(cfbEntry{"Root Entry", none, none, 1}, cfbEntry{"PowerPoint Document", none, none, none}), "ppt"},
+		{"xls with embedded document", cfb(
+			cfbEntry{"Root Entry", none, none, 1},
+			cfbEntry{"Workbook", none, 2, none},
+			cfbEntry{"MBD0001", none, none, 3},
+			cfbEntry{"WordDocument", none, none, none},
+		), "xls"},
+		{"tar.gz", tarball, "tar.gz"},
+		{"gz", gz(t, "just text"), "gz"},
+		{"tar", func() []byte {
+			data, err := gzip.NewReader(bytes.NewReader(tarball))
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(data)
+			require.NoError(t, err)
+			return buf.Bytes()
+		}(), "tar"},
+		{"txt", []byte("name,size\nreport.pdf,1024\n"), "txt"},
+		{"utf-8 txt", []byte("Grüße aus Köln\n"), "txt"},
+		{"html", []byte("<!DOCTYPE html><html><body>hi</body></html>"), "html"},
+		{"svg", []byte("<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "svg"},
+		{"truncated utf-8 txt", []byte("Grüße\n\xe2\x82"), "txt"},
+		{"binary", []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}, ""},
+		{"executable", []byte("MZ\x90\x00\x03\x00"), ""},
+		{"empty", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := Detect(bytes.NewReader(tc.data), int64(len(tc.data)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.format, format)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	for _, tc := range []struct {
+		claimed, detected, format string
+	}{
+		{"pdf", "pdf", "pdf"},
+		{"", "png", "png"},
+		{"jpeg", "jpg", "jpeg"},
+		{"JPG", "jpg", "jpg"},
+		{"m4a", "mp4", "m4a"},
+		{"csv", "txt", "csv"},
+		{"zip", "docx", "zip"},
+		{"heif", "heic", "heif"},
+		{"png", "apng", "png"},
+	} {
+		format, err := Resolve(tc.claimed, tc.detected)
+		require.NoError(t, err)
+		assert.Equal(t, tc.format, format)
+	}
+
+	_, err := Resolve("", "")
+	assert.ErrorIs(t, err, ErrUnrecognized)
+
+	for _, tc := range []struct{ claimed, detected string }{
+		{"jpg", "png"},
+		{"docx", "zip"},
+		{"mp4", "mov"},
+		{"pdf", ""},
+		{"xls", "doc"},
+	} {
+		_, err := Resolve(tc.claimed, tc.detected)
+		var mismatch *MismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, tc.claimed, mismatch.Claimed)
+		assert.Equal(t, tc.detected, mismatch.Detected)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	spoofed := filepath.Join(dir, "invoice.pdf")
+	require.NoError(t, os.WriteFile(spoofed, []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"), 0644))
+	_, err := Check(spoofed)
+	assert.EqualError(t, err, "file content is not a valid pdf file")
+
+	renamed := filepath.Join(dir, "photo.jpg")
+	require.NoError(t, os.WriteFile(renamed, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644))
+	_, err = Check(renamed)
+	assert.EqualError(t, err, "file content is png, not jpg")
+
+	valid := filepath.Join(dir, "backup.tgz")
+	require.NoError(t, os.WriteFile(valid, tarGz(t), 0644))
+	format, err := Check(valid)
+	require.NoError(t, err)
+	assert.Equal(t, "tar.gz", format)
+}
@@ -8,12 +8,16 @@ import (
 
 // Converter defines the interface for all converters
 type Converter interface {
-	// Convert converts the input file to the output file with the target format
-	Convert(ctx context.Context, inputPath, outputPath string) error
+	// Convert converts the input file to the output file with the target format.
+	// Progress is reported through ReportProgress on ctx.
+	Convert(ctx context.Context, inputPath, outputPath string, opts Options) error
 
 	// SupportsConversion checks if the converter supports the given conversion
 	SupportsConversion(sourceFormat, targetFormat string) bool
 
+	// ValidateOptions checks the options against the converter's option schema
+	ValidateOptions(opts Options) error
+
 	// Cleanup removes any temporary files
 	Cleanup(files ...string) error
 }
@@ -0,0 +1,156 @@
+package iface
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Image operation names
+const (
+	OpResize     = "resize"
+	OpCrop       = "crop"
+	OpRotate     = "rotate"
+	OpAutoOrient = "auto_orient"
+	OpStrip      = "strip"
+)
+
+// Ways a resize fits the image into its box
+const (
+	// FitContain scales the image to fit inside the box (the default)
+	FitContain = "contain"
+	// FitCover scales the image to cover the box and crops the overflow
+	FitCover = "cover"
+	// FitFill stretches the image to the box, ignoring its aspect ratio
+	FitFill = "fill"
+)
+
+// gravities are the anchors a crop may be placed at
+var gravities = map[string]bool{
+	"center": true, "north": true, "south": true, "east": true, "west": true,
+	"northeast": true, "northwest": true, "southeast": true, "southwest": true,
+}
+
+var aspectPattern = regexp.MustCompile(`^([1-9][0-9]{0,2}):([1-9][0-9]{0,2})$`)
+
+// maxOperations is the longest list of image operations accepted
+const maxOperations = 16
+
+// ImageOperation is one step of the transformations applied to an image
+// before it is written. Only the fields of its Op are used.
+type ImageOperation struct {
+	// Op is the operation: resize, crop, rotate, auto_orient or strip
+	Op string `json:"op"`
+
+	// Width and Height are the box of a resize or the size of a crop. A
+	// resize may leave one of them 0 to keep the aspect ratio.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Fit is how a resize fits the box: contain, cover or fill
+	Fit string `json:"fit,omitempty"`
+
+	// Aspect crops to the largest area of this ratio, e.g. "16:9", instead
+	// of a fixed size
+	Aspect string `json:"aspect,omitempty"`
+	// Gravity anchors a crop, or the cropped part of a cover resize:
+	// center (the default), north, northeast, east and so on
+	Gravity string `json:"gravity,omitempty"`
+	// X and Y offset a crop of a fixed size from its gravity
+	X int `json:"x,omitempty"`
+	Y int `json:"y,omitempty"`
+
+	// Degrees rotates the image clockwise
+	Degrees int `json:"degrees,omitempty"`
+}
+
+// AspectRatio returns the width and height of the Aspect of a crop
+func (op ImageOperation) AspectRatio() (int, int) {
+	m := aspectPattern.FindStringSubmatch(op.Aspect)
+	if m == nil {
+		return 0, 0
+	}
+	w, _ := strconv.Atoi(m[1])
+	h, _ := strconv.Atoi(m[2])
+	return w, h
+}
+
+// GravityOrDefault returns the gravity of the operation, center if unset
+func (op ImageOperation) GravityOrDefault() string {
+	if op.Gravity == "" {
+		return "center"
+	}
+	return op.Gravity
+}
+
+// FitOrDefault returns how a resize fits its box, contain if unset
+func (op ImageOperation) FitOrDefault() string {
+	if op.Fit == "" {
+		return FitContain
+	}
+	return op.Fit
+}
+
+// validate checks that the operation is known and its fields are in range
+func (op ImageOperation) validate() error {
+	switch op.Op {
+	case OpResize:
+		if op.Width < 0 || op.Width > maxDimension || op.Height < 0 || op.Height > maxDimension {
+			return fmt.Errorf("resize width and height must be between 1 and %d", maxDimension)
+		}
+		if op.Width == 0 && op.Height == 0 {
+			return fmt.Errorf("resize needs a width or a height")
+		}
+		switch op.FitOrDefault() {
+		case FitContain:
+		case FitCover, FitFill:
+			if op.Width == 0 || op.Height == 0 {
+				return fmt.Errorf("resize with fit %q needs a width and a height", op.Fit)
+			}
+		default:
+			return fmt.Errorf("resize fit must be contain, cover or fill")
+		}
+		if op.Gravity != "" && !gravities[op.Gravity] {
+			return fmt.Errorf("gravity %q is not supported", op.Gravity)
+		}
+	case OpCrop:
+		if op.Aspect != "" {
+			if !aspectPattern.MatchString(op.Aspect) {
+				return fmt.Errorf("crop aspect must look like \"16:9\"")
+			}
+			if op.Width != 0 || op.Height != 0 || op.X != 0 || op.Y != 0 {
+				return fmt.Errorf("crop takes either an aspect or a size")
+			}
+		} else {
+			if op.Width < 1 || op.Width > maxDimension || op.Height < 1 || op.Height > maxDimension {
+				return fmt.Errorf("crop width and height must be between 1 and %d", maxDimension)
+			}
+			if op.X < 0 || op.X > maxDimension || op.Y < 0 || op.Y > maxDimension {
+				return fmt.Errorf("crop x and y must be between 0 and %d", maxDimension)
+			}
+		}
+		if op.Gravity != "" && !gravities[op.Gravity] {
+			return fmt.Errorf("gravity %q is not supported", op.Gravity)
+		}
+	case OpRotate:
+		if op.Degrees%90 != 0 || op.Degrees == 0 || op.Degrees < -270 || op.Degrees > 270 {
+			return fmt.Errorf("rotate degrees must be 90, 180 or 270, or their negatives")
+		}
+	case OpAutoOrient, OpStrip:
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	return nil
+}
+
+// validateOperations checks every operation of a list
+func validateOperations(ops []ImageOperation) error {
+	if len(ops) > maxOperations {
+		return invalidOption(OptionOperations, fmt.Sprintf("must have at most %d entries", maxOperations))
+	}
+	for i, op := range ops {
+		if err := op.validate(); err != nil {
+			return invalidOption(OptionOperations, fmt.Sprintf("entry %d is invalid: %v", i+1, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package iface
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Option names used in option schemas and error messages
+const (
+	OptionQuality      = "quality"
+	OptionWidth        = "width"
+	OptionHeight       = "height"
+	OptionAudioBitrate = "audio_bitrate"
+	OptionSampleRate   = "sample_rate"
+	OptionCRF          = "crf"
+	OptionResolution   = "resolution"
+	OptionPageRange    = "page_range"
+	OptionPassword     = "password"
+	OptionCompression  = "compression_level"
+	OptionVolumeSize   = "volume_size"
+	OptionOperations   = "operations"
+	OptionDPI          = "dpi"
+	OptionIconSizes    = "icon_sizes"
+	OptionPaletteSize  = "palette_size"
+	OptionDither       = "dither"
+	OptionDedupeFrames = "dedupe_frames"
+	OptionBackground   = "background"
+)
+
+var (
+	bitratePattern    = regexp.MustCompile(`^[1-9][0-9]{0,3}k$`)
+	resolutionPattern = regexp.MustCompile(`^([1-9][0-9]{0,4})x([1-9][0-9]{0,4})$`)
+	pageRangePattern  = regexp.MustCompile(`^[1-9][0-9]*(-[1-9][0-9]*)?(,[1-9][0-9]*(-[1-9][0-9]*)?)*$`)
+	colorPattern      = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+)
+
+// validSampleRates lists the audio sample rates accepted by the sample_rate option
+var validSampleRates = map[int]bool{
+	8000: true, 11025: true, 16000: true, 22050: true, 32000: true,
+	44100: true, 48000: true, 88200: true, 96000: true,
+}
+
+// maxDimension is the largest width or height accepted for images
+const maxDimension = 16384
+
+// Options holds the per-conversion settings a client may supply.
+// A zero value for any field means the converter default is used.
+type Options struct {
+	// Quality is the JPEG/WebP output quality (1-100)
+	Quality int `json:"quality,omitempty"`
+	// Width and Height bound the output image size in pixels
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Operations transform the image in order before it is written
+	Operations []ImageOperation `json:"operations,omitempty"`
+	// DPI is the resolution vector images and document pages are rasterized at
+	DPI int `json:"dpi,omitempty"`
+	// Background fills the transparent areas of rendered pages, a colour
+	// like "#ffffff" or "#ffffff80"
+	Background string `json:"background,omitempty"`
+	// IconSizes are the square sizes of the images of an ICO file, in pixels
+	IconSizes []int `json:"icon_sizes,omitempty"`
+	// PaletteSize is the number of colours of each GIF frame (2-256)
+	PaletteSize int `json:"palette_size,omitempty"`
+	// Dither is how GIF frames are reduced to their palette:
+	// floyd_steinberg (the default) or none
+	Dither string `json:"dither,omitempty"`
+	// DedupeFrames merges consecutive identical frames of an animation,
+	// adding up their delays
+	DedupeFrames bool `json:"dedupe_frames,omitempty"`
+
+	// AudioBitrate is the target audio bitrate, e.g. "192k"
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+	// SampleRate is the target audio sample rate in Hz
+	SampleRate int `json:"sample_rate,omitempty"`
+
+	// CRF is the video constant rate factor (0-51, lower is better)
+	CRF *int `json:"crf,omitempty"`
+	// Resolution is the target video size, e.g. "1280x720"
+	Resolution string `json:"resolution,omitempty"`
+
+	// PageRange selects document pages, e.g. "1-3,5"
+	PageRange string `json:"page_range,omitempty"`
+	// Password decrypts encrypted archives and encrypts ZIP and 7z outputs
+	Password string `json:"password,omitempty"`
+	// CompressionLevel trades speed for size of new archives, from 1
+	// (fastest) to 9 (smallest)
+	CompressionLevel int `json:"compression_level,omitempty"`
+	// VolumeSize splits new ZIP and 7z archives into volumes of this many bytes
+	VolumeSize int64 `json:"volume_size,omitempty"`
+}
+
+// maxDPI is the highest rasterization resolution accepted
+const maxDPI = 1200
+
+// maxIconSize is the largest image an ICO file holds
+const maxIconSize = 256
+
+// Dithering methods of the dither option
+const (
+	DitherFloydSteinberg = "floyd_steinberg"
+	DitherNone           = "none"
+)
+
+// maxPasswordLength is the longest password accepted, in bytes
+const maxPasswordLength = 256
+
+// minVolumeSize is the smallest archive volume accepted, in bytes
+const minVolumeSize = 64 << 10
+
+// Redacted returns a copy of the options without the password, for storing
+// and reporting them
+func (o Options) Redacted() Options {
+	o.Password = ""
+	return o
+}
+
+// ParseOptions decodes options sent as a JSON object. Unknown options, e.g.
+// misspelled names, are rejected rather than ignored.
+func ParseOptions(data []byte) (Options, error) {
+	var opts Options
+	if err := DecodeStrict(data, &opts); err != nil {
+		var convErr *ConversionError
+		if errors.As(err, &convErr) {
+			return opts, err
+		}
+		return opts, NewConversionError("invalid_option", "options must be a valid JSON object", err)
+	}
+	return opts, nil
+}
+
+// DecodeStrict decodes JSON that holds options, e.g. the items of a batch
+// request, into v. Unknown fields fail with an unsupported_option error.
+func DecodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		// The decoder has no error type for unknown fields
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return NewConversionError("unsupported_option", fmt.Sprintf("option %s is not supported", name), err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Set returns the names of the options that have a non-default value
+func (o Options) Set() []string {
+	var names []string
+	if o.Quality != 0 {
+		names = append(names, OptionQuality)
+	}
+	if o.Width != 0 {
+		names = append(names, OptionWidth)
+	}
+	if o.Height != 0 {
+		names = append(names, OptionHeight)
+	}
+	if len(o.Operations) != 0 {
+		names = append(names, OptionOperations)
+	}
+	if o.DPI != 0 {
+		names = append(names, OptionDPI)
+	}
+	if o.Background != "" {
+		names = append(names, OptionBackground)
+	}
+	if len(o.IconSizes) != 0 {
+		names = append(names, OptionIconSizes)
+	}
+	if o.PaletteSize != 0 {
+		names = append(names, OptionPaletteSize)
+	}
+	if o.Dither != "" {
+		names = append(names, OptionDither)
+	}
+	if o.DedupeFrames {
+		names = append(names, OptionDedupeFrames)
+	}
+	if o.AudioBitrate != "" {
+		names = append(names, OptionAudioBitrate)
+	}
+	if o.SampleRate != 0 {
+		names = append(names, OptionSampleRate)
+	}
+	if o.CRF != nil {
+		names = append(names, OptionCRF)
+	}
+	if o.Resolution != "" {
+		names = append(names, OptionResolution)
+	}
+	if o.PageRange != "" {
+		names = append(names, OptionPageRange)
+	}
+	if o.Password != "" {
+		names = append(names, OptionPassword)
+	}
+	if o.CompressionLevel != 0 {
+		names = append(names, OptionCompression)
+	}
+	if o.VolumeSize != 0 {
+		names = append(names, OptionVolumeSize)
+	}
+	return names
+}
+
+// Validate checks that every option that is set holds a value in range
+func (o Options) Validate() error {
+	if o.Quality != 0 && (o.Quality < 1 || o.Quality > 100) {
+		return invalidOption(OptionQuality, "must be between 1 and 100")
+	}
+	if o.Width < 0 || o.Width > maxDimension {
+		return invalidOption(OptionWidth, fmt.Sprintf("must be between 1 and %d", maxDimension))
+	}
+	if o.Height < 0 || o.Height > maxDimension {
+		return invalidOption(OptionHeight, fmt.Sprintf("must be between 1 and %d", maxDimension))
+	}
+	if err := validateOperations(o.Operations); err != nil {
+		return err
+	}
+	if o.DPI != 0 && (o.DPI < 1 || o.DPI > maxDPI) {
+		return invalidOption(OptionDPI, fmt.Sprintf("must be between 1 and %d", maxDPI))
+	}
+	if o.Background != "" && !colorPattern.MatchString(o.Background) {
+		return invalidOption(OptionBackground, "must be a colour like \"#ffffff\"")
+	}
+	if len(o.IconSizes) > 8 {
+		return invalidOption(OptionIconSizes, "must have at most 8 entries")
+	}
+	for i, size := range o.IconSizes {
+		if size < 1 || size > maxIconSize || slices.Contains(o.IconSizes[:i], size) {
+			return invalidOption(OptionIconSizes, fmt.Sprintf("must be distinct sizes between 1 and %d", maxIconSize))
+		}
+	}
+	if o.PaletteSize != 0 && (o.PaletteSize < 2 || o.PaletteSize > 256) {
+		return invalidOption(OptionPaletteSize, "must be between 2 and 256")
+	}
+	if o.Dither != "" && o.Dither != DitherFloydSteinberg && o.Dither != DitherNone {
+		return invalidOption(OptionDither, fmt.Sprintf("must be %q or %q", DitherFloydSteinberg, DitherNone))
+	}
+	if o.AudioBitrate != "" && !bitratePattern.MatchString(o.AudioBitrate) {
+		return invalidOption(OptionAudioBitrate, "must look like \"192k\"")
+	}
+	if o.SampleRate != 0 && !validSampleRates[o.SampleRate] {
+		return invalidOption(OptionSampleRate, "is not a supported sample rate")
+	}
+	if o.CRF != nil && (*o.CRF < 0 || *o.CRF > 51) {
+		return invalidOption(OptionCRF, "must be between 0 and 51")
+	}
+	if o.Resolution != "" && !resolutionPattern.MatchString(o.Resolution) {
+		return invalidOption(OptionResolution, "must look like \"1280x720\"")
+	}
+	if o.PageRange != "" && !pageRangePattern.MatchString(o.PageRange) {
+		return invalidOption(OptionPageRange, "must look like \"1-3,5\"")
+	}
+	// Passwords are written to archive tools as a line of their input
+	if len(o.Password) > maxPasswordLength || strings.ContainsAny(o.Password, "\x00\r\n") {
+		return invalidOption(OptionPassword, fmt.Sprintf("must be at most %d bytes without NUL or line break characters", maxPasswordLength))
+	}
+	if o.CompressionLevel != 0 && (o.CompressionLevel < 1 || o.CompressionLevel > 9) {
+		return invalidOption(OptionCompression, "must be between 1 and 9")
+	}
+	if o.VolumeSize != 0 && o.VolumeSize < minVolumeSize {
+		return invalidOption(OptionVolumeSize, fmt.Sprintf("must be at least %d bytes", minVolumeSize))
+	}
+	return nil
+}
+
+// OptionSchema lists the options a converter accepts
+type OptionSchema []string
+
+// Validate checks that opts only sets options from the schema and that
+// every value is in range
+func (s OptionSchema) Validate(opts Options) error {
+	allowed := make(map[string]bool, len(s))
+	for _, name := range s {
+		allowed[name] = true
+	}
+	for _, name := range opts.Set() {
+		if !allowed[name] {
+			return NewConversionError(
+				"unsupported_option",
+				fmt.Sprintf("option %q is not supported for this conversion", name),
+				nil,
+			)
+		}
+	}
+	return opts.Validate()
+}
+
+// invalidOption creates the error returned for an out-of-range option
+func invalidOption(name, reason string) *ConversionError {
+	return NewConversionError("invalid_option", fmt.Sprintf("%s %s", name, reason), nil)
+}
@@ -0,0 +1,268 @@
+package iface
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionSchemaValidate(t *testing.T) {
+	crf := 23
+	badCRF := 60
+
+	imageSchema := OptionSchema{OptionQuality, OptionWidth, OptionHeight}
+	videoSchema := OptionSchema{OptionCRF, OptionResolution, OptionAudioBitrate}
+
+	tests := []struct {
+		name     string
+		schema   OptionSchema
+		opts     Options
+		wantCode string
+	}{
+		{
+			name:   "No options",
+			schema: imageSchema,
+			opts:   Options{},
+		},
+		{
+			name:   "Valid image options",
+			schema: imageSchema,
+			opts:   Options{Quality: 85, Width: 800, Height: 600},
+		},
+		{
+			name:     "Quality out of range",
+			schema:   imageSchema,
+			opts:     Options{Quality: 101},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Option not in schema",
+			schema:   imageSchema,
+			opts:     Options{AudioBitrate: "128k"},
+			wantCode: "unsupported_option",
+		},
+		{
+			name:   "Valid video options",
+			schema: videoSchema,
+			opts:   Options{CRF: &crf, Resolution: "1280x720", AudioBitrate: "128k"},
+		},
+		{
+			name:     "CRF out of range",
+			schema:   videoSchema,
+			opts:     Options{CRF: &badCRF},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Malformed resolution",
+			schema:   videoSchema,
+			opts:     Options{Resolution: "1280*720"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid page range",
+			schema: OptionSchema{OptionPageRange},
+			opts:   Options{PageRange: "1-3,5"},
+		},
+		{
+			name:     "Malformed page range",
+			schema:   OptionSchema{OptionPageRange},
+			opts:     Options{PageRange: "1-3;rm"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid password",
+			schema: OptionSchema{OptionPassword},
+			opts:   Options{Password: "s3cret pässword"},
+		},
+		{
+			name:     "Password with NUL",
+			schema:   OptionSchema{OptionPassword},
+			opts:     Options{Password: "a\x00b"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Password with line break",
+			schema:   OptionSchema{OptionPassword},
+			opts:     Options{Password: "a\nb"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Password not in schema",
+			schema:   imageSchema,
+			opts:     Options{Password: "secret"},
+			wantCode: "unsupported_option",
+		},
+		{
+			name:   "Valid archive options",
+			schema: OptionSchema{OptionCompression, OptionVolumeSize},
+			opts:   Options{CompressionLevel: 9, VolumeSize: 100 << 20},
+		},
+		{
+			name:     "Compression level out of range",
+			schema:   OptionSchema{OptionCompression},
+			opts:     Options{CompressionLevel: 10},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Volume size too small",
+			schema:   OptionSchema{OptionVolumeSize},
+			opts:     Options{VolumeSize: 1024},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid image operations",
+			schema: OptionSchema{OptionOperations, OptionQuality},
+			opts: Options{Quality: 80, Operations: []ImageOperation{
+				{Op: OpAutoOrient},
+				{Op: OpCrop, Aspect: "16:9", Gravity: "north"},
+				{Op: OpResize, Width: 1280, Height: 720, Fit: FitCover},
+				{Op: OpRotate, Degrees: -90},
+				{Op: OpStrip},
+			}},
+		},
+		{
+			name:     "Unknown image operation",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: "sharpen"}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Resize without a box",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: OpResize}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Cover resize without a height",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: OpResize, Width: 100, Fit: FitCover}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Crop with aspect and size",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: OpCrop, Aspect: "1:1", Width: 10, Height: 10}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Malformed gravity",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: OpCrop, Width: 10, Height: 10, Gravity: "center;rm"}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Rotation off the right angles",
+			schema:   OptionSchema{OptionOperations},
+			opts:     Options{Operations: []ImageOperation{{Op: OpRotate, Degrees: 45}}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid rasterization options",
+			schema: OptionSchema{OptionDPI, OptionIconSizes},
+			opts:   Options{DPI: 300, IconSizes: []int{16, 32, 256}},
+		},
+		{
+			name:     "DPI out of range",
+			schema:   OptionSchema{OptionDPI},
+			opts:     Options{DPI: 5000},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Icon size too large",
+			schema:   OptionSchema{OptionIconSizes},
+			opts:     Options{IconSizes: []int{16, 512}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Duplicate icon sizes",
+			schema:   OptionSchema{OptionIconSizes},
+			opts:     Options{IconSizes: []int{32, 32}},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid page options",
+			schema: OptionSchema{OptionPageRange, OptionDPI, OptionBackground},
+			opts:   Options{PageRange: "1-3,5", DPI: 150, Background: "#FFFFFF"},
+		},
+		{
+			name:     "Background colour by name",
+			schema:   OptionSchema{OptionBackground},
+			opts:     Options{Background: "white"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:   "Valid animation options",
+			schema: OptionSchema{OptionPaletteSize, OptionDither, OptionDedupeFrames},
+			opts:   Options{PaletteSize: 64, Dither: DitherNone, DedupeFrames: true},
+		},
+		{
+			name:     "Palette too small",
+			schema:   OptionSchema{OptionPaletteSize},
+			opts:     Options{PaletteSize: 1},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Unknown dithering",
+			schema:   OptionSchema{OptionDither},
+			opts:     Options{Dither: "ordered"},
+			wantCode: "invalid_option",
+		},
+		{
+			name:     "Operations not in schema",
+			schema:   videoSchema,
+			opts:     Options{Operations: []ImageOperation{{Op: OpStrip}}},
+			wantCode: "unsupported_option",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Validate(tt.opts)
+			if tt.wantCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var convErr *ConversionError
+			require.True(t, errors.As(err, &convErr), "expected a ConversionError, got %v", err)
+			assert.Equal(t, tt.wantCode, convErr.Code)
+		})
+	}
+}
+
+func TestOptionsRedacted(t *testing.T) {
+	opts := Options{Quality: 80, Password: "secret"}
+	assert.Equal(t, Options{Quality: 80}, opts.Redacted())
+	assert.Equal(t, "secret", opts.Password)
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions([]byte(`{"quality":80,"page_range":"1-2"}`))
+	require.NoError(t, err)
+	assert.Equal(t, Options{Quality: 80, PageRange: "1-2"}, opts)
+
+	tests := map[string]string{
+		`{"qualty":80}`: "unsupported_option",
+		`{"quality":`:   "invalid_option",
+		`[80]`:          "invalid_option",
+	}
+	for raw, code := range tests {
+		_, err := ParseOptions([]byte(raw))
+		var convErr *ConversionError
+		require.True(t, errors.As(err, &convErr), raw)
+		assert.Equal(t, code, convErr.Code, raw)
+	}
+
+	// Options nested in other requests are checked as well
+	var items []struct {
+		Format  string  `json:"format"`
+		Options Options `json:"options"`
+	}
+	err = DecodeStrict([]byte(`[{"format":"png","options":{"widht":10}}]`), &items)
+	var convErr *ConversionError
+	require.True(t, errors.As(err, &convErr))
+	assert.Equal(t, "unsupported_option", convErr.Code)
+	assert.Contains(t, convErr.Message, `"widht"`)
+}
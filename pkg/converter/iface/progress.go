@@ -0,0 +1,48 @@
+package iface
+
+import "context"
+
+// Conversion stages reported by the converters
+const (
+	StageStarting   = "starting"
+	StageConverting = "converting"
+	StageExtracting = "extracting"
+	StagePacking    = "packing"
+	StageFinished   = "finished"
+)
+
+// Progress is a progress update reported by a converter
+type Progress struct {
+	// Percent is the completed share of the conversion, from 0 to 100.
+	// Converters that cannot measure progress report stage changes only.
+	Percent float64 `json:"percent"`
+	Stage   string  `json:"stage"`
+	// Step and Steps locate the current step of a multi-hop conversion
+	Step  int `json:"step,omitempty"`
+	Steps int `json:"steps,omitempty"`
+}
+
+// ProgressFunc receives progress updates. It is called from the converting
+// goroutine and must not block.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a context that delivers the progress reported by
+// Convert to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress reports conversion progress to the ProgressFunc registered
+// on ctx, if any. Converters call it from Convert.
+func ReportProgress(ctx context.Context, p Progress) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		if p.Percent < 0 {
+			p.Percent = 0
+		} else if p.Percent > 100 {
+			p.Percent = 100
+		}
+		fn(p)
+	}
+}
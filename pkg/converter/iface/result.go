@@ -0,0 +1,40 @@
+package iface
+
+import "context"
+
+// Result describes the output of a conversion beyond the file itself
+type Result struct {
+	// Format is the format of the output when it is not the target format,
+	// e.g. zip for several pages of a document converted to images
+	Format string `json:"format,omitempty"`
+	// Pages is the number of pages the output holds
+	Pages int `json:"pages,omitempty"`
+}
+
+// ResultFunc receives the result of a conversion
+type ResultFunc func(Result)
+
+type resultKey struct{}
+
+// WithResult returns a context that delivers the result reported by Convert
+// to fn. Converters package several output files, e.g. the pages of a
+// document, into a ZIP archive only for callers that receive the result and
+// so learn the output format; other callers get the first file. A nil fn
+// hides the receivers of ctx.
+func WithResult(ctx context.Context, fn ResultFunc) context.Context {
+	return context.WithValue(ctx, resultKey{}, fn)
+}
+
+// ReceivesResult reports whether a ResultFunc is registered on ctx
+func ReceivesResult(ctx context.Context) bool {
+	fn, ok := ctx.Value(resultKey{}).(ResultFunc)
+	return ok && fn != nil
+}
+
+// ReportResult reports the result of a conversion to the ResultFunc
+// registered on ctx, if any. Converters call it from Convert.
+func ReportResult(ctx context.Context, r Result) {
+	if fn, ok := ctx.Value(resultKey{}).(ResultFunc); ok && fn != nil {
+		fn(r)
+	}
+}
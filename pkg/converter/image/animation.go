@@ -0,0 +1,478 @@
+package image
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/draw"
+)
+
+// animationFormats are the formats that hold animations
+var animationFormats = map[string]bool{"gif": true, "webp": true, "apng": true}
+
+// frame is one frame of an animation, drawn onto the whole canvas
+type frame struct {
+	image *image.NRGBA
+	delay time.Duration
+}
+
+// animation is a decoded animation. Frames are stored whole, so that every
+// format can write them however it disposes of and blends its frames.
+type animation struct {
+	frames []frame
+	// loops is how often the animation plays, 0 for forever
+	loops int
+}
+
+// keepsAnimation reports whether a conversion keeps the frames of its
+// input. Still WebPs are written by ImageMagick, which encodes them better
+// than img2webp encodes a single frame.
+func keepsAnimation(inputPath, sourceFormat, targetFormat string) bool {
+	if !animationFormats[sourceFormat] {
+		return false
+	}
+	switch targetFormat {
+	case "gif", "apng", "zip":
+		return true
+	case "webp":
+		return sourceFormat == "apng" || isAnimated(inputPath, sourceFormat)
+	}
+	return false
+}
+
+// isAnimated reports whether a GIF or WebP file has more than one frame
+func isAnimated(path, format string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	switch format {
+	case "gif":
+		return gifFrames(data) > 1
+	case "webp":
+		return isAnimatedWebP(data)
+	}
+	return false
+}
+
+// convertAnimation converts an animation frame by frame, applying the
+// options to every frame
+func (c *ImageConverter) convertAnimation(ctx context.Context, inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	log.Info().
+		Str("source", inputPath).
+		Str("target", outputPath).
+		Str("target_format", targetFormat).
+		Int("operations", len(opts.Operations)).
+		Msg("Starting animation conversion")
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+	anim, err := decodeAnimation(inputPath, sourceFormat)
+	if err != nil {
+		log.Error().Err(err).Msg("Animation conversion failed")
+		return err
+	}
+	anim.transform(opts)
+	if opts.DedupeFrames {
+		anim.dedupe()
+	}
+
+	if targetFormat == "webp" {
+		err = c.encodeWebPAnimation(ctx, outputPath, anim, opts)
+	} else {
+		err = writeOutput(outputPath, func(w io.Writer) error {
+			return encodeAnimation(w, anim, targetFormat, opts)
+		})
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Animation conversion failed")
+		return err
+	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
+	return nil
+}
+
+// decodeAnimation reads the frames of an animation
+func decodeAnimation(path, format string) (*animation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	var anim *animation
+	switch format {
+	case "gif":
+		anim, err = decodeGIF(data)
+	case "apng":
+		anim, err = decodeAPNG(data)
+	case "webp":
+		anim, err = decodeWebP(data)
+	default:
+		return nil, iface.NewConversionError("unsupported_format", fmt.Sprintf("cannot read %s animations", format), nil)
+	}
+	if err != nil {
+		var convErr *iface.ConversionError
+		if !errors.As(err, &convErr) {
+			err = iface.NewConversionError("conversion_failed", "failed to read animation", err)
+		}
+		return nil, err
+	}
+	if len(anim.frames) == 0 {
+		return nil, iface.NewConversionError("conversion_failed", "animation has no frames", nil)
+	}
+	return anim, nil
+}
+
+// encodeAnimation writes an animation as GIF, APNG or a ZIP of PNG frames
+func encodeAnimation(w io.Writer, anim *animation, format string, opts iface.Options) error {
+	var err error
+	switch format {
+	case "gif":
+		err = encodeGIF(w, anim, opts)
+	case "apng":
+		err = encodeAPNG(w, anim)
+	case "zip":
+		err = encodeFrames(w, anim)
+	default:
+		return iface.NewConversionError("unsupported_format", fmt.Sprintf("cannot write %s animations", format), nil)
+	}
+	if err != nil {
+		return iface.NewConversionError("conversion_failed", "failed to write animation", err)
+	}
+	return nil
+}
+
+// checkCanvas rejects animations whose frames together are larger than the
+// native backend decodes, before any frame is decoded
+func checkCanvas(width, height, frames int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid canvas of %dx%d pixels", width, height)
+	}
+	if int64(width)*int64(height)*int64(max(frames, 1)) > maxNativePixels {
+		return iface.NewConversionError("image_too_large",
+			fmt.Sprintf("animation of %d frames of %dx%d pixels is too large", frames, width, height), nil)
+	}
+	return nil
+}
+
+// transform applies the options to every frame
+func (a *animation) transform(opts iface.Options) {
+	for i := range a.frames {
+		a.frames[i].image = toNRGBA(transformNative(a.frames[i].image, 1, opts))
+	}
+}
+
+// dedupe merges consecutive identical frames, adding up their delays
+func (a *animation) dedupe() {
+	frames := a.frames[:1]
+	for _, f := range a.frames[1:] {
+		last := &frames[len(frames)-1]
+		if last.image.Rect.Eq(f.image.Rect) && bytes.Equal(last.image.Pix, f.image.Pix) {
+			last.delay += f.delay
+			continue
+		}
+		frames = append(frames, f)
+	}
+	a.frames = frames
+}
+
+// toNRGBA returns an image as NRGBA with its origin at 0,0
+func toNRGBA(img image.Image) *image.NRGBA {
+	if m, ok := img.(*image.NRGBA); ok && m.Rect.Min == (image.Point{}) {
+		return m
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// snapshot copies the canvas of an animation as a frame
+func snapshot(canvas *image.NRGBA, delay time.Duration) frame {
+	img := image.NewNRGBA(canvas.Rect)
+	copy(img.Pix, canvas.Pix)
+	return frame{image: img, delay: delay}
+}
+
+// decodeGIF reads the frames of a GIF, drawing each one onto what the
+// previous frames left on the canvas
+func decodeGIF(data []byte) (*animation, error) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanvas(cfg.Width, cfg.Height, gifFrames(data)); err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	anim := &animation{}
+	switch {
+	case g.LoopCount == -1: // No loop extension
+		anim.loops = 1
+	case g.LoopCount > 0: // Repetitions after the first play
+		anim.loops = g.LoopCount + 1
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, img := range g.Image {
+		var previous *image.NRGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = snapshot(canvas, 0).image
+		}
+
+		draw.Draw(canvas, img.Rect, img, img.Rect.Min, draw.Over)
+		anim.frames = append(anim.frames, snapshot(canvas, time.Duration(g.Delay[i])*10*time.Millisecond))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Rect, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// encodeGIF writes an animation as GIF, reducing every frame to a palette
+// of its own. Each frame replaces the previous one, which is disposed to
+// the transparent background.
+func encodeGIF(w io.Writer, anim *animation, opts iface.Options) error {
+	colors := opts.PaletteSize
+	if colors == 0 {
+		colors = 256
+	}
+	var drawer draw.Drawer = draw.FloydSteinberg
+	if opts.Dither == iface.DitherNone {
+		drawer = draw.Src
+	}
+
+	g := &gif.GIF{}
+	switch {
+	case anim.loops == 1:
+		g.LoopCount = -1
+	case anim.loops > 1:
+		g.LoopCount = anim.loops - 1
+	}
+
+	for _, f := range anim.frames {
+		img := binarizeAlpha(f.image)
+		palette := quantize(img, colors)
+		paletted := image.NewPaletted(img.Rect, palette)
+		drawer.Draw(paletted, img.Rect, img, image.Point{})
+
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, int((f.delay+5*time.Millisecond)/(10*time.Millisecond)))
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// gifFrames counts the images of a GIF without decoding them
+func gifFrames(data []byte) int {
+	if len(data) < 13 {
+		return 0
+	}
+	offset := 13
+	if data[10]&0x80 != 0 { // Global colour table
+		offset += 3 << (data[10]&0x07 + 1)
+	}
+
+	frames := 0
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x21: // Extension
+			offset = skipSubBlocks(data, offset+2)
+		case 0x2C: // Image descriptor
+			frames++
+			if offset+10 > len(data) {
+				return frames
+			}
+			flags := data[offset+9]
+			offset += 10
+			if flags&0x80 != 0 { // Local colour table
+				offset += 3 << (flags&0x07 + 1)
+			}
+			offset = skipSubBlocks(data, offset+1) // After the LZW code size
+		default: // Trailer or garbage
+			return frames
+		}
+	}
+	return frames
+}
+
+// skipSubBlocks returns the offset after the data sub-blocks at offset
+func skipSubBlocks(data []byte, offset int) int {
+	for offset < len(data) {
+		size := int(data[offset])
+		offset += 1 + size
+		if size == 0 {
+			break
+		}
+	}
+	return offset
+}
+
+// binarizeAlpha makes every pixel either opaque or transparent, as GIF has
+// only one transparent colour
+func binarizeAlpha(img *image.NRGBA) *image.NRGBA {
+	dst := image.NewNRGBA(img.Rect)
+	copy(dst.Pix, img.Pix)
+	for i := 3; i < len(dst.Pix); i += 4 {
+		if dst.Pix[i] < 128 {
+			dst.Pix[i-3], dst.Pix[i-2], dst.Pix[i-1], dst.Pix[i] = 0, 0, 0, 0
+		} else {
+			dst.Pix[i] = 255
+		}
+	}
+	return dst
+}
+
+// colorCount is a colour of an image and how many pixels have it
+type colorCount struct {
+	c     [3]uint8
+	count int
+}
+
+// quantize picks a palette of at most n colours for the opaque pixels of an
+// image by median cut, plus a transparent colour if some pixels are
+func quantize(img *image.NRGBA, n int) color.Palette {
+	histogram := make(map[[3]uint8]int)
+	transparent := false
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] == 0 {
+			transparent = true
+			continue
+		}
+		histogram[[3]uint8{img.Pix[i], img.Pix[i+1], img.Pix[i+2]}]++
+	}
+	if transparent {
+		n--
+	}
+
+	colors := make([]colorCount, 0, len(histogram))
+	for c, count := range histogram {
+		colors = append(colors, colorCount{c, count})
+	}
+	// Map iteration is random, sort for reproducible palettes
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+
+	// Split the box with the widest channel range at its median until
+	// there are n boxes
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		widest, channel, widestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := box[0].c[ch], box[0].c[ch]
+				for _, cc := range box[1:] {
+					lo, hi = min(lo, cc.c[ch]), max(hi, cc.c[ch])
+				}
+				if r := int(hi) - int(lo); r > widestRange {
+					widest, channel, widestRange = i, ch, r
+				}
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].c[channel] < box[j].c[channel] })
+		total := 0
+		for _, cc := range box {
+			total += cc.count
+		}
+		split, seen := 1, 0
+		for i, cc := range box[:len(box)-1] {
+			seen += cc.count
+			split = i + 1
+			if seen*2 >= total {
+				break
+			}
+		}
+		boxes[widest] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes)+1)
+	for _, box := range boxes {
+		if len(box) == 0 {
+			continue
+		}
+		var r, g, b, total int
+		for _, cc := range box {
+			r += int(cc.c[0]) * cc.count
+			g += int(cc.c[1]) * cc.count
+			b += int(cc.c[2]) * cc.count
+			total += cc.count
+		}
+		palette = append(palette, color.NRGBA{uint8(r / total), uint8(g / total), uint8(b / total), 255})
+	}
+	if transparent || len(palette) == 0 {
+		palette = append(palette, color.NRGBA{})
+	}
+	return palette
+}
+
+// encodeFrames writes the frames of an animation as numbered PNGs into a
+// ZIP archive. PNGs are compressed already, so they are stored.
+func encodeFrames(w io.Writer, anim *animation) error {
+	zw := zip.NewWriter(w)
+	for i, f := range anim.frames {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("frame-%04d.png", i+1),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := png.Encode(entry, f.image); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeFrames writes the frames of an animation as PNG files into a
+// directory and returns their paths
+func writeFrames(dir string, anim *animation) ([]string, error) {
+	paths := make([]string, len(anim.frames))
+	for i, f := range anim.frames {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("frame-%04d.png", i+1))
+		err := writeOutput(paths[i], func(w io.Writer) error {
+			return png.Encode(w, f.image)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,169 @@
+package image
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeGIF writes an animated GIF of 8×8 frames of solid colours
+func writeGIF(t *testing.T, colors []color.Color, delays []int, loopCount int) string {
+	t.Helper()
+	g := &gif.GIF{LoopCount: loopCount, Delay: delays}
+	for _, c := range colors {
+		img := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{c, color.Black})
+		g.Image = append(g.Image, img)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	path := filepath.Join(t.TempDir(), "input.gif")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, gif.EncodeAll(f, g))
+	require.NoError(t, f.Close())
+	return path
+}
+
+func TestAnimationRoundTrip(t *testing.T) {
+	c := newTestConverter(t)
+	red, green, blue := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	src := writeGIF(t, []color.Color{red, green, blue}, []int{10, 20, 30}, 2)
+
+	// GIF to APNG
+	apng := filepath.Join(t.TempDir(), "output.apng")
+	require.True(t, c.SupportsConversion("gif", "apng"))
+	require.NoError(t, c.Convert(context.Background(), src, apng, iface.Options{}))
+	assert.True(t, isAPNGFile(apng))
+
+	anim, err := decodeAnimation(apng, "apng")
+	require.NoError(t, err)
+	require.Len(t, anim.frames, 3)
+	assert.Equal(t, 3, anim.loops)
+	assert.Equal(t, 200*time.Millisecond, anim.frames[1].delay)
+	assert.Equal(t, color.NRGBA{B: 255, A: 255}, anim.frames[2].image.At(4, 4))
+
+	// APNG named like a still PNG back to GIF
+	png := filepath.Join(t.TempDir(), "input.png")
+	require.NoError(t, os.Rename(apng, png))
+	dest := filepath.Join(t.TempDir(), "output.gif")
+	require.NoError(t, c.Convert(context.Background(), png, dest, iface.Options{}))
+
+	f, err := os.Open(dest)
+	require.NoError(t, err)
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, []int{10, 20, 30}, g.Delay)
+	assert.Equal(t, 2, g.LoopCount)
+}
+
+func TestAnimationFramesAndDedupe(t *testing.T) {
+	c := newTestConverter(t)
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	src := writeGIF(t, []color.Color{red, red, blue}, []int{10, 20, 30}, 0)
+
+	dest := filepath.Join(t.TempDir(), "output.zip")
+	require.True(t, c.SupportsConversion("gif", "zip"))
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{DedupeFrames: true, Width: 4}))
+
+	zr, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer zr.Close()
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "frame-0001.png", zr.File[0].Name)
+	entry, err := zr.File[1].Open()
+	require.NoError(t, err)
+	img, _, err := image.Decode(entry)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 4, 4), img.Bounds())
+
+	// Merged frames add up their delays
+	gifPath := filepath.Join(t.TempDir(), "output.gif")
+	require.NoError(t, c.Convert(context.Background(), src, gifPath, iface.Options{DedupeFrames: true, PaletteSize: 4, Dither: iface.DitherNone}))
+	data, err := os.ReadFile(gifPath)
+	require.NoError(t, err)
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, []int{30, 30}, g.Delay)
+	assert.Equal(t, 0, g.LoopCount)
+	for _, frame := range g.Image {
+		assert.LessOrEqual(t, len(frame.Palette), 4)
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 16), A: 255})
+		}
+	}
+	img.Set(0, 0, color.NRGBA{})
+
+	palette := quantize(img, 16)
+	assert.Len(t, palette, 16)
+	assert.Equal(t, color.NRGBA{}, palette[len(palette)-1])
+
+	// Images with few colours keep them exactly
+	small := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	small.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	small.Set(1, 0, color.NRGBA{B: 255, A: 255})
+	assert.ElementsMatch(t, color.Palette{color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}}, quantize(small, 256))
+}
+
+func TestDecodeWebPAnimation(t *testing.T) {
+	// 1×1 still WebPs, an opaque grey lossy one and a transparent lossless one
+	lossy, err := base64.StdEncoding.DecodeString("UklGRiIAAABXRUJQVlA4IBYAAAAwAQCdASoBAAEADsD+JaQAA3AAAAAA")
+	require.NoError(t, err)
+	lossless, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	require.NoError(t, err)
+
+	frame := func(still []byte, duration int, flags byte) []byte {
+		header := make([]byte, 16)
+		putUint24(header[12:], uint32(duration))
+		header[15] = flags
+		return append(header, still[12:]...)
+	}
+	var body bytes.Buffer
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpAnimationFlag | 0x10
+	writeWebPChunk(&body, "VP8X", vp8x)
+	writeWebPChunk(&body, "ANIM", []byte{0, 0, 0, 0, 3, 0})
+	writeWebPChunk(&body, "ANMF", frame(lossy, 40, 0))
+	writeWebPChunk(&body, "ANMF", frame(lossless, 60, 0))    // Blended over the grey
+	writeWebPChunk(&body, "ANMF", frame(lossless, 80, 0x02)) // Replaces it
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), body.Bytes()...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	require.True(t, isAnimatedWebP(data))
+	anim, err := decodeWebP(data)
+	require.NoError(t, err)
+	assert.Equal(t, 3, anim.loops)
+	require.Len(t, anim.frames, 3)
+	assert.Equal(t, 60*time.Millisecond, anim.frames[1].delay)
+	assert.Equal(t, uint8(255), anim.frames[1].image.NRGBAAt(0, 0).A)
+	assert.Equal(t, uint8(0), anim.frames[2].image.NRGBAAt(0, 0).A)
+}
+
+func TestAnimatedWebPOutputNeedsImg2WebP(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	c := newTestConverter(t)
+	src := writeGIF(t, []color.Color{color.White, color.Black}, []int{10, 10}, 0)
+
+	err := c.Convert(context.Background(), src, filepath.Join(t.TempDir(), "output.webp"), iface.Options{})
+	var convErr *iface.ConversionError
+	require.ErrorAs(t, err, &convErr)
+	assert.Equal(t, "tool_not_found", convErr.Code)
+}
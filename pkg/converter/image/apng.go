@@ -0,0 +1,383 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// APNG dispose and blend operations
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+)
+
+// pngChunk is a chunk of a PNG file
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// isAPNGFile reports whether a PNG file is animated
+func isAPNGFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(f, header); err != nil || string(header) != pngSignature {
+		return false
+	}
+	// The animation control chunk precedes the image data
+	for {
+		var head [8]byte
+		if _, err := io.ReadFull(f, head[:]); err != nil {
+			return false
+		}
+		switch string(head[4:]) {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+		if _, err := f.Seek(int64(binary.BigEndian.Uint32(head[:]))+4, io.SeekCurrent); err != nil {
+			return false
+		}
+	}
+}
+
+// readPNGChunks splits a PNG file into its chunks
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("not a PNG file")
+	}
+	var chunks []pngChunk
+	for offset := len(pngSignature); offset < len(data); {
+		if offset+12 > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		if length < 0 || length > len(data)-offset-12 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		kind := string(data[offset+4 : offset+8])
+		chunks = append(chunks, pngChunk{kind, data[offset+8 : offset+8+length]})
+		offset += 12 + length
+		if kind == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// apngFrame is a frame of an APNG file as stored, a region of the canvas
+type apngFrame struct {
+	rect           image.Rectangle
+	delay          time.Duration
+	dispose, blend byte
+	data           [][]byte
+}
+
+// decodeAPNG reads the frames of an animated PNG. Each frame is decoded as
+// a PNG of its own, made of the header chunks of the file and the image
+// data of the frame, and drawn onto the canvas as its blend and dispose
+// operations say.
+func decodeAPNG(data []byte) (*animation, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, errors.New("missing PNG header")
+	}
+	ihdr := chunks[0].data
+	width, height := int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:]))
+
+	anim := &animation{}
+	var shared []pngChunk // Palette and transparency
+	var frames []*apngFrame
+	var current *apngFrame
+	for _, chunk := range chunks[1:] {
+		switch chunk.kind {
+		case "PLTE", "tRNS":
+			shared = append(shared, chunk)
+		case "acTL":
+			if len(chunk.data) != 8 {
+				return nil, errors.New("invalid animation control chunk")
+			}
+			if err := checkCanvas(width, height, int(binary.BigEndian.Uint32(chunk.data))); err != nil {
+				return nil, err
+			}
+			anim.loops = int(binary.BigEndian.Uint32(chunk.data[4:]))
+		case "fcTL":
+			if len(chunk.data) != 26 {
+				return nil, errors.New("invalid frame control chunk")
+			}
+			d := chunk.data
+			x, y := int(binary.BigEndian.Uint32(d[12:])), int(binary.BigEndian.Uint32(d[16:]))
+			w, h := int(binary.BigEndian.Uint32(d[4:])), int(binary.BigEndian.Uint32(d[8:]))
+			rect := image.Rect(x, y, x+w, y+h)
+			if w <= 0 || h <= 0 || !rect.In(image.Rect(0, 0, width, height)) {
+				return nil, errors.New("frame outside of the canvas")
+			}
+			num, den := int(binary.BigEndian.Uint16(d[20:])), int(binary.BigEndian.Uint16(d[22:]))
+			if den == 0 {
+				den = 100
+			}
+			current = &apngFrame{
+				rect:    rect,
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: d[24],
+				blend:   d[25],
+			}
+			frames = append(frames, current)
+		case "IDAT":
+			// Image data before the first frame control chunk is a default
+			// image that is not part of the animation
+			if current != nil {
+				current.data = append(current.data, chunk.data)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return nil, errors.New("frame data without frame control chunk")
+			}
+			current.data = append(current.data, chunk.data[4:])
+		}
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("no animation frames")
+	}
+	if err := checkCanvas(width, height, len(frames)); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, f := range frames {
+		img, err := decodeAPNGFrame(ihdr, shared, f)
+		if err != nil {
+			return nil, err
+		}
+
+		dispose := f.dispose
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var previous *image.NRGBA
+		if dispose == apngDisposePrevious {
+			previous = snapshot(canvas, 0).image
+		}
+
+		op := draw.Over
+		if f.blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, f.rect, img, img.Bounds().Min, op)
+		anim.frames = append(anim.frames, snapshot(canvas, f.delay))
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, f.rect, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// decodeAPNGFrame decodes the image data of a frame as a PNG of the frame's
+// size
+func decodeAPNGFrame(ihdr []byte, shared []pngChunk, f *apngFrame) (image.Image, error) {
+	header := bytes.Clone(ihdr)
+	binary.BigEndian.PutUint32(header, uint32(f.rect.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(f.rect.Dy()))
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	writePNGChunk(&buf, "IHDR", header)
+	for _, chunk := range shared {
+		writePNGChunk(&buf, chunk.kind, chunk.data)
+	}
+	writePNGChunk(&buf, "IDAT", bytes.Join(f.data, nil))
+	writePNGChunk(&buf, "IEND", nil)
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return img, nil
+}
+
+// encodeAPNG writes an animation as animated PNG. Every frame covers the
+// whole canvas and replaces the previous one.
+func encodeAPNG(w io.Writer, anim *animation) error {
+	b := anim.frames[0].image.Rect
+	opaque := true
+	for _, f := range anim.frames {
+		opaque = opaque && f.image.Opaque()
+	}
+	colorType := byte(6) // RGBA
+	if opaque {
+		colorType = 2 // RGB
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	ihdr[8], ihdr[9] = 8, colorType
+	writePNGChunk(&buf, "IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, uint32(len(anim.frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(anim.loops))
+	writePNGChunk(&buf, "acTL", actl)
+
+	sequence := uint32(0)
+	for i, f := range anim.frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl, sequence)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(min(f.delay.Milliseconds(), 0xFFFF)))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		fctl[24], fctl[25] = apngDisposeNone, apngBlendSource
+		writePNGChunk(&buf, "fcTL", fctl)
+		sequence++
+
+		data, err := compressPNGData(f.image, !opaque)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			writePNGChunk(&buf, "IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, sequence)
+		writePNGChunk(&buf, "fdAT", append(fdat, data...))
+		sequence++
+	}
+	writePNGChunk(&buf, "IEND", nil)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// compressPNGData filters and compresses the pixels of an image as PNG
+// image data, choosing the filter of each row like Go's PNG encoder does
+func compressPNGData(img *image.NRGBA, alpha bool) ([]byte, error) {
+	bpp := 3
+	if alpha {
+		bpp = 4
+	}
+	width := img.Rect.Dx()
+	stride := width * bpp
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	prev := make([]byte, stride)
+	row := make([]byte, stride)
+	filtered := make([]byte, stride+1)
+	best := make([]byte, stride+1)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		pix := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		if alpha {
+			copy(row, pix)
+		} else {
+			for x := 0; x < width; x++ {
+				copy(row[x*3:x*3+3], pix[x*4:x*4+3])
+			}
+		}
+
+		bestSum := -1
+		for filter := byte(0); filter <= 4; filter++ {
+			filtered[0] = filter
+			sum := 0
+			for i := range row {
+				var a, b, c byte
+				if i >= bpp {
+					a, c = row[i-bpp], prev[i-bpp]
+				}
+				b = prev[i]
+				v := row[i]
+				switch filter {
+				case 1:
+					v -= a
+				case 2:
+					v -= b
+				case 3:
+					v -= byte((int(a) + int(b)) / 2)
+				case 4:
+					v -= paeth(a, b, c)
+				}
+				filtered[i+1] = v
+				sum += int(int8(v)) * (1 - 2*int(v>>7))
+			}
+			if bestSum < 0 || sum < bestSum {
+				bestSum = sum
+				copy(best, filtered)
+			}
+		}
+		if _, err := zw.Write(best); err != nil {
+			return nil, err
+		}
+		prev, row = row, prev
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// paeth is the predictor of PNG's Paeth filter
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// writePNGChunk writes a chunk with its length and checksum
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:], uint32(len(data)))
+	copy(head[4:], kind)
+	buf.Write(head[:])
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,126 @@
+package image
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/rs/zerolog/log"
+)
+
+// codec is a pair of tools that decode and encode a format ImageMagick
+// does not reliably support
+type codec struct {
+	decoder string
+	encoder string
+	// inputs are the formats the encoder reads
+	inputs map[string]bool
+	// outputs are the formats the decoder writes
+	outputs map[string]bool
+}
+
+// codecs are the formats converted by their reference tools: AVIF by
+// libavif's avifenc and avifdec, JPEG XL by libjxl's cjxl and djxl
+var codecs = map[string]codec{
+	"avif": {
+		decoder: "avifdec",
+		encoder: "avifenc",
+		inputs:  map[string]bool{"png": true, "jpg": true, "jpeg": true},
+		outputs: map[string]bool{"png": true, "jpg": true, "jpeg": true},
+	},
+	"jxl": {
+		decoder: "djxl",
+		encoder: "cjxl",
+		inputs:  map[string]bool{"png": true, "jpg": true, "jpeg": true, "gif": true},
+		outputs: map[string]bool{"png": true},
+	},
+}
+
+// transforms reports whether the options change the image itself rather
+// than only how it is encoded
+func transforms(opts iface.Options) bool {
+	return len(opts.Operations) > 0 || opts.Width > 0 || opts.Height > 0
+}
+
+// encodeWithCodec writes an AVIF or JPEG XL image. Inputs the encoder does
+// not read, or that are transformed first, go through an intermediate PNG.
+func (c *ImageConverter) encodeWithCodec(ctx context.Context, inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	codec := codecs[targetFormat]
+	src := inputPath
+	if transforms(opts) || !codec.inputs[sourceFormat] {
+		dir, err := c.CreateTempDir("codec-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		src = filepath.Join(dir, "intermediate.png")
+		rasterOpts := opts
+		rasterOpts.Quality = 0
+		if err := c.convertRaster(ctx, inputPath, src, sourceFormat, "png", rasterOpts); err != nil {
+			return err
+		}
+	}
+
+	var args []string
+	if opts.Quality > 0 {
+		switch targetFormat {
+		case "avif":
+			// avifenc takes a quantizer from 0 (lossless) to 63 (worst)
+			q := strconv.Itoa((100 - opts.Quality) * 63 / 100)
+			args = append(args, "--min", q, "--max", q)
+		case "jxl":
+			args = append(args, "-q", strconv.Itoa(opts.Quality))
+		}
+	}
+	return runCodec(ctx, codec.encoder, append(args, src, outputPath)...)
+}
+
+// decodeWithCodec reads an AVIF or JPEG XL image. Targets the decoder does
+// not write, or transformed images, go through an intermediate PNG.
+func (c *ImageConverter) decodeWithCodec(ctx context.Context, inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	codec := codecs[sourceFormat]
+	if !transforms(opts) && codec.outputs[targetFormat] {
+		var args []string
+		if opts.Quality > 0 && sourceFormat == "avif" && targetFormat != "png" {
+			args = append(args, "-q", strconv.Itoa(opts.Quality))
+		}
+		return runCodec(ctx, codec.decoder, append(args, inputPath, outputPath)...)
+	}
+
+	dir, err := c.CreateTempDir("codec-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	decoded := filepath.Join(dir, "decoded.png")
+	if err := runCodec(ctx, codec.decoder, inputPath, decoded); err != nil {
+		return err
+	}
+	return c.convertRaster(ctx, decoded, outputPath, "png", targetFormat, opts)
+}
+
+// runCodec runs an encoder or decoder
+func runCodec(ctx context.Context, tool string, args ...string) error {
+	if _, err := exec.LookPath(tool); err != nil {
+		return iface.NewConversionError("tool_not_found", tool+" not found", err)
+	}
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+	output, err := tools.CommandContext(ctx, tool, args...).CombinedOutput()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("tool", tool).
+			Str("output", string(output)).
+			Msg("Image conversion failed")
+		return iface.NewConversionError("conversion_failed", "failed to convert image", err)
+	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
+	return nil
+}
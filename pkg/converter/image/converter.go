@@ -2,9 +2,10 @@ package image
 
 import (
 	"context"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
 	"github.com/amannvl/freefileconverterz/pkg/converter/base"
@@ -12,10 +13,28 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Image backends
+const (
+	// BackendAuto uses ImageMagick, or the native backend when ImageMagick
+	// is missing or the input is small enough to prefer it
+	BackendAuto = "auto"
+	// BackendImageMagick always uses ImageMagick
+	BackendImageMagick = "imagemagick"
+	// BackendNative uses the native backend for every conversion it handles
+	BackendNative = "native"
+)
+
+// Backend chooses between ImageMagick and the native Go backend
+type Backend struct {
+	Name          string // auto, imagemagick or native; auto if empty
+	NativeMaxSize int64  // With auto, inputs up to this size use the native backend, 0 disables it
+}
+
 // ImageConverter handles image format conversions
 type ImageConverter struct {
 	*base.BaseConverter
 	toolManager *tools.ToolManager
+	backend     Backend
 }
 
 // NewImageConverter creates a new ImageConverter
@@ -25,22 +44,95 @@ func NewImageConverter(toolManager *tools.ToolManager, tempDir string) iface.Con
 		toolManager:   toolManager,
 	}
 
-	// Register supported formats
-	converter.AddSupportedConversion("jpg", "png", "jpeg", "gif", "bmp", "tiff", "webp")
-	converter.AddSupportedConversion("jpeg", "png", "jpg", "gif", "bmp", "tiff", "webp")
-	converter.AddSupportedConversion("png", "jpg", "jpeg", "gif", "bmp", "tiff", "webp")
-	converter.AddSupportedConversion("gif", "png", "jpg", "jpeg", "bmp", "tiff")
-	converter.AddSupportedConversion("bmp", "png", "jpg", "jpeg", "gif", "tiff")
-	converter.AddSupportedConversion("tiff", "png", "jpg", "jpeg", "gif", "bmp")
-	converter.AddSupportedConversion("webp", "png", "jpg", "jpeg")
-	converter.AddSupportedConversion("heic", "jpg", "jpeg", "png")
-	converter.AddSupportedConversion("heif", "jpg", "jpeg", "png")
+	// Register supported formats. Conversions the native backend handles
+	// need no tool, the others need ImageMagick.
+	converter.SetCategory("image", "imagemagick")
+	converter.register("jpg", "png", "jpeg", "gif", "bmp", "tiff", "webp", "pdf")
+	converter.register("jpeg", "png", "jpg", "gif", "bmp", "tiff", "webp", "pdf")
+	converter.register("png", "jpg", "jpeg", "gif", "bmp", "tiff", "webp", "pdf")
+	converter.register("gif", "png", "jpg", "jpeg", "bmp", "tiff")
+	converter.register("bmp", "png", "jpg", "jpeg", "gif", "tiff")
+	converter.register("tiff", "png", "jpg", "jpeg", "gif", "bmp")
+	converter.register("webp", "png", "jpg", "jpeg", "gif", "bmp", "tiff")
+	converter.register("heic", "jpg", "jpeg", "png")
+	converter.register("heif", "jpg", "jpeg", "png")
+
+	// Documents render the pages of the page_range option, several pages
+	// into a ZIP
+	converter.register("pdf", "png", "jpg", "jpeg", "webp")
+
+	// SVGs are rasterized at the dpi option, into a PDF too
+	converter.register("svg", "png", "pdf")
+
+	// Animations keep their frames, delays and loop count. Animated WebPs
+	// are written by img2webp, frames can be extracted into a ZIP of PNGs.
+	converter.SetTool("")
+	converter.AddSupportedConversion("gif", "apng", "zip")
+	converter.AddSupportedConversion("webp", "apng", "zip")
+	converter.AddSupportedConversion("apng", "gif", "apng", "zip")
+	converter.SetTool("img2webp")
+	converter.AddSupportedConversion("gif", "webp")
+	converter.AddSupportedConversion("apng", "webp")
+
+	// Favicons hold a PNG image of every icon size
+	converter.register("png", "ico")
+
+	// AVIF and JPEG XL images are converted by their codecs, other formats
+	// through PNG
+	for format, codec := range codecs {
+		converter.SetTool(codec.encoder)
+		converter.AddSupportedConversion("png", format)
+		converter.AddSupportedConversion("jpg", format)
+		converter.AddSupportedConversion("jpeg", format)
+		converter.SetTool(codec.decoder)
+		converter.AddSupportedConversion(format, "png", "jpg", "jpeg")
+	}
+
+	// Converting to the same format applies the options only, e.g. to resize
+	// or strip the metadata of an image
+	for _, format := range []string{"jpg", "jpeg", "png", "gif", "bmp", "tiff", "webp"} {
+		converter.register(format, format)
+	}
+
+	// Register supported options
+	converter.SetOptionSchema(iface.OptionQuality, iface.OptionWidth, iface.OptionHeight, iface.OptionOperations,
+		iface.OptionDPI, iface.OptionIconSizes, iface.OptionPaletteSize, iface.OptionDither, iface.OptionDedupeFrames,
+		iface.OptionPageRange, iface.OptionBackground)
 
 	return converter
 }
 
-// Convert converts an image from one format to another using ImageMagick
-func (c *ImageConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+// register adds conversions, recording ImageMagick as their tool unless the
+// native backend handles them
+func (c *ImageConverter) register(sourceFormat string, targetFormats ...string) {
+	for _, target := range targetFormats {
+		if supportsNative(sourceFormat, target) {
+			c.SetTool("")
+		} else {
+			c.SetTool("imagemagick")
+		}
+		c.AddSupportedConversion(sourceFormat, target)
+	}
+}
+
+// SetBackend sets how the converter chooses between ImageMagick and the
+// native backend. Unknown backend names are an error.
+func (c *ImageConverter) SetBackend(backend Backend) error {
+	switch backend.Name {
+	case "", BackendAuto, BackendImageMagick, BackendNative:
+	default:
+		return fmt.Errorf("unknown image backend %q", backend.Name)
+	}
+	c.backend = backend
+	return nil
+}
+
+// Convert converts an image from one format to another. Animations are
+// converted frame by frame, AVIF and JPEG XL images are read and written by
+// their codecs, documents page by page, other formats by ImageMagick, or the
+// native backend if it handles the formats and ImageMagick is missing or the
+// backend prefers it.
+func (c *ImageConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Get the file extension to determine the target format
 	extension := filepath.Ext(outputPath)
 	if len(extension) == 0 {
@@ -50,17 +142,49 @@ func (c *ImageConverter) Convert(ctx context.Context, inputPath, outputPath stri
 			nil,
 		)
 	}
-	targetFormat := extension[1:] // Remove the dot
+	targetFormat := strings.ToLower(extension[1:]) // Remove the dot
+	sourceFormat := strings.ToLower(strings.TrimPrefix(filepath.Ext(inputPath), "."))
 
-	// Log the conversion attempt
-	log.Info().
-		Str("source", inputPath).
-		Str("target", outputPath).
-		Str("target_format", targetFormat).
-		Msg("Starting image conversion with ImageMagick")
+	// Animated PNGs are usually named like still ones
+	if sourceFormat == "png" && (animationFormats[targetFormat] || targetFormat == "zip") && isAPNGFile(inputPath) {
+		sourceFormat = "apng"
+	}
+	if keepsAnimation(inputPath, sourceFormat, targetFormat) {
+		return c.convertAnimation(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts)
+	}
 
-	// Get ImageMagick path from tool manager
-	convertPath, err := c.toolManager.GetImageMagickPath()
+	if _, ok := codecs[targetFormat]; ok {
+		return c.encodeWithCodec(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts)
+	}
+	if _, ok := codecs[sourceFormat]; ok {
+		return c.decodeWithCodec(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts)
+	}
+	if pagedFormats[sourceFormat] && targetFormat != sourceFormat {
+		return c.convertPages(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts)
+	}
+	return c.convertRaster(ctx, inputPath, outputPath, sourceFormat, targetFormat, opts)
+}
+
+// convertRaster converts an image with ImageMagick or the native backend
+func (c *ImageConverter) convertRaster(ctx context.Context, inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	convertPath, err := c.imageMagickPath()
+	if supportsNative(sourceFormat, targetFormat) && (err != nil || nativeOnly(targetFormat) || c.prefersNative(inputPath)) {
+		log.Info().
+			Str("source", inputPath).
+			Str("target", outputPath).
+			Str("target_format", targetFormat).
+			Int("operations", len(opts.Operations)).
+			Bool("imagemagick_missing", err != nil).
+			Msg("Starting image conversion with the native backend")
+
+		iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+		if err := convertNative(inputPath, outputPath, sourceFormat, targetFormat, opts); err != nil {
+			log.Error().Err(err).Msg("Image conversion failed")
+			return err
+		}
+		iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
+		return nil
+	}
 	if err != nil {
 		return iface.NewConversionError(
 			"tool_not_found",
@@ -69,12 +193,18 @@ func (c *ImageConverter) Convert(ctx context.Context, inputPath, outputPath stri
 		)
 	}
 
-	// Use ImageMagick for all conversions for consistency and better format support
-	cmd := exec.CommandContext(ctx, convertPath, inputPath, outputPath)
+	// Log the conversion attempt
+	log.Info().
+		Str("source", inputPath).
+		Str("target", outputPath).
+		Str("target_format", targetFormat).
+		Int("operations", len(opts.Operations)).
+		Msg("Starting image conversion with ImageMagick")
 
-	// TODO: Add support for quality and other options
+	cmd := tools.CommandContext(ctx, convertPath, convertArgs(inputPath, outputPath, sourceFormat, opts)...)
 
 	// Run the conversion
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Error().
@@ -88,10 +218,35 @@ func (c *ImageConverter) Convert(ctx context.Context, inputPath, outputPath stri
 			err,
 		)
 	}
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
 
 	return nil
 }
 
+// imageMagickPath returns the path of ImageMagick's convert binary
+func (c *ImageConverter) imageMagickPath() (string, error) {
+	if c.toolManager == nil {
+		return "", fmt.Errorf("no tool manager")
+	}
+	return c.toolManager.GetImageMagickPath()
+}
+
+// prefersNative reports whether the backend picks the native backend for
+// an input even though ImageMagick is installed
+func (c *ImageConverter) prefersNative(inputPath string) bool {
+	switch c.backend.Name {
+	case BackendNative:
+		return true
+	case BackendImageMagick:
+		return false
+	}
+	if c.backend.NativeMaxSize <= 0 {
+		return false
+	}
+	info, err := os.Stat(inputPath)
+	return err == nil && info.Size() <= c.backend.NativeMaxSize
+}
+
 // Cleanup removes temporary files created during conversion
 func (c *ImageConverter) Cleanup(files ...string) error {
 	var lastErr error
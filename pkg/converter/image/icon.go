@@ -0,0 +1,97 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// defaultIconSizes are the sizes of a favicon, those larger than the image
+// are left out
+var defaultIconSizes = []int{16, 32, 48, 64, 128, 256}
+
+// iconSizes returns the sizes of the ICO file made of an image: the
+// requested ones, or the default sizes up to the larger side of the image
+func iconSizes(img image.Image, requested []int) []int {
+	if len(requested) > 0 {
+		return requested
+	}
+	b := img.Bounds()
+	largest := max(b.Dx(), b.Dy())
+	sizes := []int{defaultIconSizes[0]}
+	for _, size := range defaultIconSizes[1:] {
+		if size <= largest {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// encodeIcon writes an ICO file holding the image at each size, fit into a
+// transparent square and stored as PNG, which every browser and Windows
+// since Vista reads
+func encodeIcon(w io.Writer, img image.Image, sizes []int) error {
+	images := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, square(img, size)); err != nil {
+			return err
+		}
+		images[i] = buf.Bytes()
+	}
+
+	// ICONDIR: reserved, type 1 (icon), image count
+	header := []uint16{0, 1, uint16(len(sizes))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	// ICONDIRENTRY per image, the images follow the directory
+	offset := 6 + 16*len(sizes)
+	for i, size := range sizes {
+		entry := struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}{
+			// 0 stands for 256
+			Width:    uint8(size % 256),
+			Height:   uint8(size % 256),
+			Planes:   1,
+			BitCount: 32,
+			Size:     uint32(len(images[i])),
+			Offset:   uint32(offset),
+		}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offset += len(images[i])
+	}
+
+	for _, data := range images {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// square scales an image to fit a transparent square of size pixels,
+// centered
+func square(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = max(size*b.Dy()/b.Dx(), 1)
+	} else {
+		w = max(size*b.Dx()/b.Dy(), 1)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	r := image.Rect(0, 0, w, h).Add(image.Pt((size-w)/2, (size-h)/2))
+	draw.CatmullRom.Scale(dst, r, img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,150 @@
+package image
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// magickGravities maps the gravities of image operations to ImageMagick's,
+// and their share of the free space left of and above a crop
+var magickGravities = map[string]struct {
+	name string
+	x, y float64
+}{
+	"center":    {"Center", 0.5, 0.5},
+	"north":     {"North", 0.5, 0},
+	"south":     {"South", 0.5, 1},
+	"east":      {"East", 1, 0.5},
+	"west":      {"West", 0, 0.5},
+	"northeast": {"NorthEast", 1, 0},
+	"northwest": {"NorthWest", 0, 0},
+	"southeast": {"SouthEast", 1, 1},
+	"southwest": {"SouthWest", 0, 1},
+}
+
+// convertArgs returns the arguments of ImageMagick's convert for a
+// conversion. Of documents and animations only the first page or frame is
+// read, so that a single file is written.
+func convertArgs(inputPath, outputPath, sourceFormat string, opts iface.Options) []string {
+	switch sourceFormat {
+	case "pdf", "gif", "webp":
+		inputPath += "[0]"
+	}
+	return append(readArgs(inputPath, sourceFormat, opts), outputPath)
+}
+
+// pageArgs returns the arguments of ImageMagick's convert writing the pages
+// of a document to one file each, named after pattern with %d replaced by
+// the page index. Without ranges every page is written.
+func pageArgs(inputPath, pattern, sourceFormat string, ranges []pageRange, opts iface.Options) []string {
+	if len(ranges) > 0 {
+		scenes := make([]string, len(ranges))
+		for i, r := range ranges {
+			scenes[i] = strconv.Itoa(r.first - 1)
+			if r.last > r.first {
+				scenes[i] += "-" + strconv.Itoa(r.last-1)
+			}
+		}
+		inputPath += "[" + strings.Join(scenes, ",") + "]"
+	}
+	return append(readArgs(inputPath, sourceFormat, opts), "+adjoin", pattern)
+}
+
+// readArgs returns the arguments of ImageMagick's convert that read an
+// image and apply the options to it. Vector images are rasterized at the
+// requested resolution, which has to be set before they are read, and SVGs
+// keep their transparency unless a background is set.
+func readArgs(input, sourceFormat string, opts iface.Options) []string {
+	var args []string
+	if opts.DPI > 0 && (sourceFormat == "svg" || sourceFormat == "pdf") {
+		args = append(args, "-density", strconv.Itoa(opts.DPI))
+	}
+	if sourceFormat == "svg" {
+		args = append(args, "-background", "none")
+	}
+	args = append(args, input)
+	if opts.Background != "" {
+		args = append(args, "-background", opts.Background, "-alpha", "remove")
+	}
+	return append(args, buildOptionArgs(opts)...)
+}
+
+// buildOptionArgs translates conversion options into ImageMagick arguments.
+// Every argument is built from validated numbers and names, never from the
+// strings a client sent.
+func buildOptionArgs(opts iface.Options) []string {
+	var args []string
+
+	// Operations run in the order they were given
+	for _, op := range opts.Operations {
+		args = append(args, operationArgs(op)...)
+	}
+
+	// Resize to fit within the requested box, keeping the aspect ratio
+	if opts.Width > 0 || opts.Height > 0 {
+		args = append(args, operationArgs(iface.ImageOperation{Op: iface.OpResize, Width: opts.Width, Height: opts.Height})...)
+	}
+
+	if opts.Quality > 0 {
+		args = append(args, "-quality", strconv.Itoa(opts.Quality))
+	}
+
+	return args
+}
+
+// operationArgs returns the ImageMagick arguments of one image operation
+func operationArgs(op iface.ImageOperation) []string {
+	gravity := magickGravities[op.GravityOrDefault()]
+
+	switch op.Op {
+	case iface.OpResize:
+		box := geometry(op.Width, op.Height)
+		switch op.FitOrDefault() {
+		case iface.FitCover:
+			// Fill the box, then cut what sticks out
+			return []string{"-resize", box + "^", "-gravity", gravity.name, "-extent", box, "+gravity", "+repage"}
+		case iface.FitFill:
+			return []string{"-resize", box + "!"}
+		}
+		return []string{"-resize", box}
+	case iface.OpCrop:
+		if w, h := op.AspectRatio(); w > 0 {
+			return aspectCropArgs(w, h, gravity.x, gravity.y)
+		}
+		return []string{"-gravity", gravity.name, "-crop", fmt.Sprintf("%dx%d+%d+%d", op.Width, op.Height, op.X, op.Y), "+gravity", "+repage"}
+	case iface.OpRotate:
+		return []string{"-rotate", strconv.Itoa(op.Degrees)}
+	case iface.OpAutoOrient:
+		return []string{"-auto-orient"}
+	case iface.OpStrip:
+		return []string{"-strip"}
+	}
+	return nil
+}
+
+// aspectCropArgs crops the largest area of the ratio w:h, placed by the
+// shares x and y of the free space. The area depends on the image size at
+// this point of the operations, so it is computed by ImageMagick: the
+// viewport of a no-op distortion cuts it out, which works alike in
+// ImageMagick 6 and 7.
+func aspectCropArgs(w, h int, x, y float64) []string {
+	cw := fmt.Sprintf("min(w,h*%d/%d)", w, h)
+	ch := fmt.Sprintf("min(h,w*%d/%d)", h, w)
+	viewport := fmt.Sprintf("%%[fx:floor(%s)]x%%[fx:floor(%s)]+%%[fx:floor((w-%s)*%g)]+%%[fx:floor((h-%s)*%g)]", cw, ch, cw, x, ch, y)
+	return []string{"-set", "option:distort:viewport", viewport, "-filter", "point", "-distort", "SRT", "0", "+filter", "+repage"}
+}
+
+// geometry returns the ImageMagick geometry of a box, either side of which
+// may be 0 to keep the aspect ratio
+func geometry(width, height int) string {
+	switch {
+	case width > 0 && height > 0:
+		return fmt.Sprintf("%dx%d", width, height)
+	case width > 0:
+		return strconv.Itoa(width)
+	}
+	return fmt.Sprintf("x%d", height)
+}
@@ -0,0 +1,102 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildOptionArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts iface.Options
+		want []string
+	}{
+		{
+			name: "No options",
+			opts: iface.Options{},
+			want: nil,
+		},
+		{
+			name: "Width and quality",
+			opts: iface.Options{Width: 800, Quality: 85},
+			want: []string{"-resize", "800", "-quality", "85"},
+		},
+		{
+			name: "Operations in order before the width",
+			opts: iface.Options{Width: 100, Operations: []iface.ImageOperation{
+				{Op: iface.OpAutoOrient},
+				{Op: iface.OpStrip},
+				{Op: iface.OpRotate, Degrees: 90},
+			}},
+			want: []string{"-auto-orient", "-strip", "-rotate", "90", "-resize", "100"},
+		},
+		{
+			name: "Cover resize",
+			opts: iface.Options{Operations: []iface.ImageOperation{
+				{Op: iface.OpResize, Width: 200, Height: 100, Fit: iface.FitCover, Gravity: "north"},
+			}},
+			want: []string{"-resize", "200x100^", "-gravity", "North", "-extent", "200x100", "+gravity", "+repage"},
+		},
+		{
+			name: "Fill resize",
+			opts: iface.Options{Operations: []iface.ImageOperation{
+				{Op: iface.OpResize, Width: 200, Height: 100, Fit: iface.FitFill},
+			}},
+			want: []string{"-resize", "200x100!"},
+		},
+		{
+			name: "Crop of a fixed size",
+			opts: iface.Options{Operations: []iface.ImageOperation{
+				{Op: iface.OpCrop, Width: 50, Height: 40, X: 5, Y: 10},
+			}},
+			want: []string{"-gravity", "Center", "-crop", "50x40+5+10", "+gravity", "+repage"},
+		},
+		{
+			name: "Crop to an aspect ratio",
+			opts: iface.Options{Operations: []iface.ImageOperation{
+				{Op: iface.OpCrop, Aspect: "16:9", Gravity: "southeast"},
+			}},
+			want: []string{
+				"-set", "option:distort:viewport",
+				"%[fx:floor(min(w,h*16/9))]x%[fx:floor(min(h,w*9/16))]+%[fx:floor((w-min(w,h*16/9))*1)]+%[fx:floor((h-min(h,w*9/16))*1)]",
+				"-filter", "point", "-distort", "SRT", "0", "+filter", "+repage",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildOptionArgs(tt.opts))
+		})
+	}
+}
+
+func TestConvertArgs(t *testing.T) {
+	args := convertArgs("input.svg", "output.png", "svg", iface.Options{DPI: 300, Width: 64})
+	assert.Equal(t, []string{"-density", "300", "-background", "none", "input.svg", "-resize", "64", "output.png"}, args)
+
+	args = convertArgs("input.pdf", "output.jpg", "pdf", iface.Options{})
+	assert.Equal(t, []string{"input.pdf[0]", "output.jpg"}, args)
+
+	// Animations are written as their first frame
+	args = convertArgs("input.gif", "output.png", "gif", iface.Options{})
+	assert.Equal(t, []string{"input.gif[0]", "output.png"}, args)
+
+	// Backgrounds fill transparent areas after reading
+	args = convertArgs("input.svg", "output.png", "svg", iface.Options{Background: "#ffffff"})
+	assert.Equal(t, []string{"-background", "none", "input.svg", "-background", "#ffffff", "-alpha", "remove", "output.png"}, args)
+
+	// The resolution of raster images is left alone
+	args = convertArgs("input.png", "output.jpg", "png", iface.Options{DPI: 300})
+	assert.Equal(t, []string{"input.png", "output.jpg"}, args)
+}
+
+func TestPageArgs(t *testing.T) {
+	args := pageArgs("input.pdf", "page-%d.png", "pdf", parsePageRange("2-3,5"), iface.Options{DPI: 150})
+	assert.Equal(t, []string{"-density", "150", "input.pdf[1-2,4]", "+adjoin", "page-%d.png"}, args)
+
+	args = pageArgs("input.tiff", "page-%d.png", "tiff", nil, iface.Options{})
+	assert.Equal(t, []string{"input.tiff", "+adjoin", "page-%d.png"}, args)
+}
@@ -0,0 +1,426 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // WebP decoder
+)
+
+// nativeSources are the formats the native backend decodes. Animations are
+// decoded to their first frame.
+var nativeSources = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true, "tiff": true, "webp": true,
+}
+
+// nativeTargets are the formats the native backend encodes. Go has no WebP
+// encoder, WebP outputs need ImageMagick.
+var nativeTargets = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true, "tiff": true, "ico": true,
+}
+
+// nativeOnly reports whether images of the format are always written by the
+// native backend. ICO files are built from PNGs of every icon size.
+func nativeOnly(targetFormat string) bool {
+	return targetFormat == "ico"
+}
+
+// maxNativePixels is the largest image the native backend decodes, so that
+// a small file claiming huge dimensions cannot exhaust memory
+const maxNativePixels = 100_000_000
+
+// defaultJPEGQuality is ImageMagick's default, used so both backends give
+// similar files
+const defaultJPEGQuality = 92
+
+// supportsNative reports whether the native backend converts between the
+// formats
+func supportsNative(sourceFormat, targetFormat string) bool {
+	return nativeSources[sourceFormat] && nativeTargets[targetFormat]
+}
+
+// convertNative converts an image with Go's image packages, applying the
+// options like ImageMagick does. The EXIF orientation is dropped with the
+// rest of the metadata, so the image is turned upright first and an
+// auto_orient operation has nothing left to do.
+func convertNative(inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	img, orientation, err := decodeNative(inputPath, sourceFormat)
+	if err != nil {
+		return err
+	}
+	return encodeNative(outputPath, transformNative(orient(img, orientation), 1, opts), targetFormat, opts)
+}
+
+// transformNative applies the operations, the size options and the
+// background to an image. orientation is the EXIF orientation of the input.
+func transformNative(img image.Image, orientation int, opts iface.Options) image.Image {
+	for _, op := range opts.Operations {
+		img = applyOperation(img, op, orientation)
+	}
+	if opts.Width > 0 || opts.Height > 0 {
+		img = applyOperation(img, iface.ImageOperation{Op: iface.OpResize, Width: opts.Width, Height: opts.Height}, orientation)
+	}
+	if opts.Background != "" {
+		img = flatten(img, parseColor(opts.Background))
+	}
+	return img
+}
+
+// decodeNative decodes an image and, for JPEGs, reads its EXIF orientation
+func decodeNative(path, format string) (image.Image, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	return decodeNativeData(data, format)
+}
+
+// decodeNativeData decodes an image read into memory
+func decodeNativeData(data []byte, format string) (image.Image, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, iface.NewConversionError("conversion_failed", "failed to read image", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxNativePixels {
+		return nil, 0, iface.NewConversionError("image_too_large",
+			fmt.Sprintf("image of %dx%d pixels is too large", cfg.Width, cfg.Height), nil)
+	}
+
+	var img image.Image
+	if format == "webp" && isAnimatedWebP(data) {
+		// Go's WebP decoder reads still images only
+		var anim *animation
+		if anim, err = decodeWebP(data); err == nil {
+			img = anim.frames[0].image
+		}
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, 0, iface.NewConversionError("conversion_failed", "failed to read image", err)
+	}
+
+	orientation := 1
+	if format == "jpg" || format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	return img, orientation, nil
+}
+
+// encodeNative writes an image in the target format. Re-encoding drops all
+// metadata, so the native backend always strips it.
+func encodeNative(path string, img image.Image, format string, opts iface.Options) error {
+	return writeOutput(path, func(w io.Writer) error {
+		var err error
+		switch format {
+		case "jpg", "jpeg":
+			quality := opts.Quality
+			if quality == 0 {
+				quality = defaultJPEGQuality
+			}
+			// JPEG has no alpha channel, transparent areas turn white
+			err = jpeg.Encode(w, flatten(img, color.White), &jpeg.Options{Quality: quality})
+		case "png":
+			err = png.Encode(w, img)
+		case "gif":
+			err = gif.Encode(w, img, &gif.Options{NumColors: 256})
+		case "bmp":
+			err = bmp.Encode(w, img)
+		case "tiff":
+			err = tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+		case "ico":
+			err = encodeIcon(w, img, iconSizes(img, opts.IconSizes))
+		default:
+			return iface.NewConversionError("unsupported_format", fmt.Sprintf("cannot write %s images", format), nil)
+		}
+		if err != nil {
+			return iface.NewConversionError("conversion_failed", "failed to write image", err)
+		}
+		return nil
+	})
+}
+
+// writeOutput creates a file and writes it through a buffer, removing it
+// again if writing fails
+func writeOutput(path string, write func(w io.Writer) error) (err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	w := bufio.NewWriter(out)
+	if err := write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// applyOperation applies one image operation. orientation is the EXIF
+// orientation of the input, used by auto_orient.
+func applyOperation(img image.Image, op iface.ImageOperation, orientation int) image.Image {
+	switch op.Op {
+	case iface.OpResize:
+		return resize(img, op)
+	case iface.OpCrop:
+		return crop(img, op)
+	case iface.OpRotate:
+		return rotate(img, op.Degrees)
+	case iface.OpAutoOrient:
+		return orient(img, orientation)
+	}
+	// Metadata is never written, strip has nothing to do
+	return img
+}
+
+// resize scales an image into the box of the operation with Catmull-Rom
+// resampling
+func resize(img image.Image, op iface.ImageOperation) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+
+	switch op.FitOrDefault() {
+	case iface.FitFill:
+		return scale(img, op.Width, op.Height)
+	case iface.FitCover:
+		// Scale to cover the box, then cut what sticks out
+		f := max(float64(op.Width)/float64(w), float64(op.Height)/float64(h))
+		scaled := scale(img, max(round(float64(w)*f), op.Width), max(round(float64(h)*f), op.Height))
+		return cropAt(scaled, op.Width, op.Height, op.GravityOrDefault(), 0, 0)
+	}
+
+	// Fit inside the box, either side of which may be open
+	f := 0.0
+	switch {
+	case op.Width > 0 && op.Height > 0:
+		f = min(float64(op.Width)/float64(w), float64(op.Height)/float64(h))
+	case op.Width > 0:
+		f = float64(op.Width) / float64(w)
+	default:
+		f = float64(op.Height) / float64(h)
+	}
+	return scale(img, max(round(float64(w)*f), 1), max(round(float64(h)*f), 1))
+}
+
+func scale(img image.Image, w, h int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func round(f float64) int {
+	return int(f + 0.5)
+}
+
+// crop cuts the area of the operation, either the largest one of its
+// aspect ratio or one of a fixed size
+func crop(img image.Image, op iface.ImageOperation) image.Image {
+	b := img.Bounds()
+	if aw, ah := op.AspectRatio(); aw > 0 {
+		w := min(b.Dx(), b.Dy()*aw/ah)
+		h := min(b.Dy(), b.Dx()*ah/aw)
+		return cropAt(img, w, h, op.GravityOrDefault(), 0, 0)
+	}
+	return cropAt(img, op.Width, op.Height, op.GravityOrDefault(), op.X, op.Y)
+}
+
+// cropAt cuts an area of w×h placed at the gravity and moved by x and y
+// away from it, like ImageMagick's -gravity and -crop. The area is clipped
+// to the image.
+func cropAt(img image.Image, w, h int, gravity string, x, y int) image.Image {
+	b := img.Bounds()
+	g := magickGravities[gravity]
+
+	// Offsets point inwards from the edge the gravity is at
+	left := int(float64(b.Dx()-w) * g.x)
+	top := int(float64(b.Dy()-h) * g.y)
+	if g.x == 1 {
+		x = -x
+	}
+	if g.y == 1 {
+		y = -y
+	}
+	r := image.Rect(left+x, top+y, left+x+w, top+y+h).Add(b.Min).Intersect(b)
+	if r.Empty() {
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// rotate turns an image clockwise by a multiple of 90 degrees
+func rotate(img image.Image, degrees int) image.Image {
+	switch (degrees%360 + 360) % 360 {
+	case 90:
+		return transform(img, true, false, true)
+	case 180:
+		return transform(img, false, true, true)
+	case 270:
+		return transform(img, true, true, false)
+	}
+	return img
+}
+
+// orient turns an image upright according to its EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2: // Mirrored
+		return transform(img, false, false, true)
+	case 3: // Upside down
+		return transform(img, false, true, true)
+	case 4: // Mirrored upside down
+		return transform(img, false, true, false)
+	case 5: // Mirrored, turned left
+		return transform(img, true, false, false)
+	case 6: // Turned left
+		return transform(img, true, false, true)
+	case 7: // Mirrored, turned right
+		return transform(img, true, true, true)
+	case 8: // Turned right
+		return transform(img, true, true, false)
+	}
+	return img
+}
+
+// transform transposes an image if swap is set and then flips it
+// vertically and horizontally. Every rotation and mirroring by right
+// angles is one of these combinations.
+func transform(img image.Image, swap, flipV, flipH bool) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if swap {
+		w, h = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x, y
+			if flipV {
+				sy = h - 1 - y
+			}
+			if flipH {
+				sx = w - 1 - x
+			}
+			if swap {
+				sx, sy = sy, sx
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// flatten draws an image onto a background of a solid colour
+func flatten(img image.Image, background color.Color) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// parseColor parses a validated colour like "#fff", "#ffffff" or "#ffffff80"
+func parseColor(s string) color.NRGBA {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, 1 (upright) if it
+// has none
+func jpegOrientation(data []byte) int {
+	r := bytes.NewReader(data)
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return 1
+	}
+
+	// Walk the segments up to the image data, looking for the EXIF one
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil || header[0] != 0xFF {
+			return 1
+		}
+		if header[1] == 0xDA { // Start of scan
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(header[2:])) - 2
+		if size < 0 {
+			return 1
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 1
+		}
+		if header[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF data
+func exifOrientation(tiffData []byte) int {
+	if len(tiffData) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiffData[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiffData[4:]))
+	if offset < 8 || offset+2 > len(tiffData) {
+		return 1
+	}
+	count := int(order.Uint16(tiffData[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiffData) {
+			return 1
+		}
+		if order.Uint16(tiffData[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiffData[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
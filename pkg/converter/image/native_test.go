@@ -0,0 +1,199 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestConverter returns a converter without a tool manager, so
+// ImageMagick is missing and the native backend is used
+func newTestConverter(t *testing.T) *ImageConverter {
+	t.Helper()
+	return NewImageConverter(nil, t.TempDir()).(*ImageConverter)
+}
+
+func writePNG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "input.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+	return path
+}
+
+// writeOrientedJPEG writes a JPEG with an EXIF orientation tag
+func writeOrientedJPEG(t *testing.T, w, h int, orientation uint16) string {
+	t.Helper()
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, w, h)), nil))
+
+	// A little-endian TIFF header with one IFD holding the orientation
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	exif = append(append(exif, entry...), 0, 0, 0, 0)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	data := append([]byte{0xFF, 0xD8}, append(segment, exif...)...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	path := filepath.Join(t.TempDir(), "input.jpg")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func decodeSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	require.NoError(t, err)
+	return cfg.Width, cfg.Height
+}
+
+func TestNativeConvertWithOperations(t *testing.T) {
+	c := newTestConverter(t)
+	src := writePNG(t, 200, 100)
+	dest := filepath.Join(t.TempDir(), "output.jpg")
+
+	opts := iface.Options{Quality: 80, Operations: []iface.ImageOperation{
+		{Op: iface.OpCrop, Aspect: "1:1"},
+		{Op: iface.OpResize, Width: 50},
+		{Op: iface.OpStrip},
+	}}
+	require.NoError(t, c.ValidateOptions(opts))
+	require.NoError(t, c.Convert(context.Background(), src, dest, opts))
+
+	w, h := decodeSize(t, dest)
+	assert.Equal(t, 50, w)
+	assert.Equal(t, 50, h)
+}
+
+func TestNativeSameFormat(t *testing.T) {
+	c := newTestConverter(t)
+	src := writePNG(t, 200, 100)
+	dest := filepath.Join(t.TempDir(), "output.png")
+
+	opts := iface.Options{Operations: []iface.ImageOperation{
+		{Op: iface.OpResize, Width: 60, Height: 60, Fit: iface.FitCover, Gravity: "west"},
+	}}
+	require.True(t, c.SupportsConversion("png", "png"))
+	require.NoError(t, c.Convert(context.Background(), src, dest, opts))
+
+	w, h := decodeSize(t, dest)
+	assert.Equal(t, 60, w)
+	assert.Equal(t, 60, h)
+}
+
+func TestNativeAutoOrient(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeOrientedJPEG(t, 40, 20, 6)
+	dest := filepath.Join(t.TempDir(), "output.png")
+
+	opts := iface.Options{Operations: []iface.ImageOperation{{Op: iface.OpAutoOrient}}}
+	require.NoError(t, c.Convert(context.Background(), src, dest, opts))
+
+	w, h := decodeSize(t, dest)
+	assert.Equal(t, 20, w)
+	assert.Equal(t, 40, h)
+
+	// The orientation is not written, so images are always turned upright
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{}))
+	w, h = decodeSize(t, dest)
+	assert.Equal(t, 20, w)
+	assert.Equal(t, 40, h)
+}
+
+func TestSetBackend(t *testing.T) {
+	c := newTestConverter(t)
+	for _, name := range []string{"", BackendAuto, BackendImageMagick, BackendNative} {
+		assert.NoError(t, c.SetBackend(Backend{Name: name}))
+	}
+	assert.Error(t, c.SetBackend(Backend{Name: "nativ"}))
+	assert.Equal(t, BackendNative, c.backend.Name, "an unknown backend is not set")
+}
+
+func TestRotate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	rotated := rotate(img, 90)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), rotated.Bounds())
+	assert.Equal(t, red, rotated.At(0, 0))
+	assert.Equal(t, blue, rotated.At(0, 1))
+
+	rotated = rotate(img, -90)
+	assert.Equal(t, blue, rotated.At(0, 0))
+	assert.Equal(t, red, rotated.At(0, 1))
+}
+
+func TestNativeWebPOutputNeedsImageMagick(t *testing.T) {
+	c := newTestConverter(t)
+	src := writePNG(t, 10, 10)
+	err := c.Convert(context.Background(), src, filepath.Join(t.TempDir(), "output.webp"), iface.Options{})
+
+	var convErr *iface.ConversionError
+	require.True(t, errors.As(err, &convErr), "expected a ConversionError, got %v", err)
+	assert.Equal(t, "tool_not_found", convErr.Code)
+}
+
+func TestNativeIcon(t *testing.T) {
+	c := newTestConverter(t)
+	src := writePNG(t, 100, 50)
+	dest := filepath.Join(t.TempDir(), "output.ico")
+
+	require.True(t, c.SupportsConversion("png", "ico"))
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{}))
+
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Greater(t, len(data), 6)
+	assert.Equal(t, []byte{0, 0, 1, 0}, data[:4])
+
+	// Default sizes up to the larger side of the image
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	require.Equal(t, 4, count)
+	for i, size := range []int{16, 32, 48, 64} {
+		entry := data[6+16*i:]
+		assert.Equal(t, size, int(entry[0]))
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		cfg, err := png.DecodeConfig(bytes.NewReader(data[offset:]))
+		require.NoError(t, err)
+		assert.Equal(t, size, cfg.Width)
+		assert.Equal(t, size, cfg.Height)
+	}
+
+	// Requested sizes, 256 is stored as 0
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{IconSizes: []int{256}}))
+	data, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, 1, int(binary.LittleEndian.Uint16(data[4:])))
+	assert.Equal(t, byte(0), data[6])
+}
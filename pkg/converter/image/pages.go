@@ -0,0 +1,304 @@
+package image
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/internal/tools"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/rs/zerolog/log"
+)
+
+// pagedFormats are the formats of documents with several pages
+var pagedFormats = map[string]bool{"pdf": true, "tiff": true}
+
+// pageRange is an inclusive range of page numbers, counted from 1
+type pageRange struct {
+	first, last int
+}
+
+// page is a rendered page
+type page struct {
+	number int
+	path   string
+}
+
+// parsePageRange parses a validated page_range option like "1-3,5" into
+// sorted ranges that do not overlap. An empty option, for all pages, gives
+// nil.
+func parsePageRange(s string) []pageRange {
+	if s == "" {
+		return nil
+	}
+	var ranges []pageRange
+	for _, part := range strings.Split(s, ",") {
+		first, last, found := strings.Cut(part, "-")
+		r := pageRange{}
+		r.first, _ = strconv.Atoi(first)
+		r.last = r.first
+		if found {
+			r.last, _ = strconv.Atoi(last)
+		}
+		if r.last < r.first {
+			r.first, r.last = r.last, r.first
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].first < ranges[j].first })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.first <= last.last+1 {
+			last.last = max(last.last, r.last)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// pageNumbers returns the numbers of the first n selected pages
+func pageNumbers(ranges []pageRange, n int) []int {
+	numbers := make([]int, 0, n)
+	if len(ranges) == 0 {
+		ranges = []pageRange{{1, n}}
+	}
+	for _, r := range ranges {
+		for p := r.first; p <= r.last && len(numbers) < n; p++ {
+			numbers = append(numbers, p)
+		}
+	}
+	return numbers
+}
+
+// selected reports whether the ranges select a page, all pages if there are
+// no ranges
+func selected(ranges []pageRange, number int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if number >= r.first && number <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+// convertPages renders the pages of a PDF or TIFF selected by the
+// page_range option, every page by default. A single page is written as an
+// image, several pages into a ZIP of images named after their page numbers,
+// e.g. page-0001.png. Callers that do not receive the result always get the
+// first selected page.
+func (c *ImageConverter) convertPages(ctx context.Context, inputPath, outputPath, sourceFormat, targetFormat string, opts iface.Options) error {
+	ranges := parsePageRange(opts.PageRange)
+	if !iface.ReceivesResult(ctx) {
+		first := 1
+		if len(ranges) > 0 {
+			first = ranges[0].first
+		}
+		ranges = []pageRange{{first, first}}
+	}
+	if opts.Background == "" && (targetFormat == "jpg" || targetFormat == "jpeg") {
+		// JPEG has no alpha channel, transparent pages turn white
+		opts.Background = "#ffffff"
+	}
+
+	dir, err := c.CreateTempDir("pages-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	log.Info().
+		Str("source", inputPath).
+		Str("target", outputPath).
+		Str("target_format", targetFormat).
+		Str("page_range", opts.PageRange).
+		Msg("Starting page rendering")
+
+	iface.ReportProgress(ctx, iface.Progress{Percent: 0, Stage: iface.StageConverting})
+	var pages []page
+	convertPath, err := c.imageMagickPath()
+	switch {
+	case sourceFormat == "tiff" && supportsNative(sourceFormat, targetFormat) && (err != nil || c.prefersNative(inputPath)):
+		pages, err = renderTIFFPages(inputPath, dir, targetFormat, ranges, opts)
+	case err != nil:
+		return iface.NewConversionError("tool_not_found", "ImageMagick not found", err)
+	default:
+		pages, err = renderPages(ctx, convertPath, inputPath, dir, sourceFormat, targetFormat, ranges, opts)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Page rendering failed")
+		return err
+	}
+	if len(pages) == 0 {
+		return iface.NewConversionError("page_out_of_range", "page_range selects no page of the document", nil)
+	}
+
+	if len(pages) == 1 {
+		err = copyFile(pages[0].path, outputPath)
+	} else {
+		err = writeOutput(outputPath, func(w io.Writer) error {
+			return zipPages(w, pages, targetFormat)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	result := iface.Result{Pages: len(pages)}
+	if len(pages) > 1 {
+		result.Format = "zip"
+	}
+	iface.ReportResult(ctx, result)
+	iface.ReportProgress(ctx, iface.Progress{Percent: 100, Stage: iface.StageConverting})
+	return nil
+}
+
+// renderPages writes the selected pages with ImageMagick, which numbers the
+// files it writes by their order in the document
+func renderPages(ctx context.Context, convertPath, inputPath, dir, sourceFormat, targetFormat string, ranges []pageRange, opts iface.Options) ([]page, error) {
+	pattern := filepath.Join(dir, "page-%d."+targetFormat)
+	output, err := tools.CommandContext(ctx, convertPath, pageArgs(inputPath, pattern, sourceFormat, ranges, opts)...).CombinedOutput()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("output", string(output)).
+			Msg("Image conversion failed")
+		return nil, iface.NewConversionError("conversion_failed", "failed to render pages", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "page-*."+targetFormat))
+	if err != nil {
+		return nil, err
+	}
+	index := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "page-"), "."+targetFormat))
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool { return index(paths[i]) < index(paths[j]) })
+
+	pages := make([]page, len(paths))
+	for i, number := range pageNumbers(ranges, len(paths)) {
+		pages[i] = page{number: number, path: paths[i]}
+	}
+	return pages, nil
+}
+
+// renderTIFFPages writes the selected pages of a TIFF with the native
+// backend. Go's TIFF decoder reads the first page only, so the header is
+// pointed at the directory of each page in turn.
+func renderTIFFPages(inputPath, dir, targetFormat string, ranges []pageRange, opts iface.Options) ([]page, error) {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	order, offsets := tiffDirectories(data)
+	if order == nil {
+		return nil, iface.NewConversionError("conversion_failed", "failed to read image", nil)
+	}
+
+	var pages []page
+	for i, offset := range offsets {
+		number := i + 1
+		if !selected(ranges, number) {
+			continue
+		}
+		order.PutUint32(data[4:], offset)
+		img, _, err := decodeNativeData(data, "tiff")
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("page-%d.%s", number, targetFormat))
+		if err := encodeNative(path, transformNative(img, 1, opts), targetFormat, opts); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page{number: number, path: path})
+	}
+	return pages, nil
+}
+
+// tiffDirectories returns the byte order of a TIFF and the offsets of its
+// image file directories, one per page
+func tiffDirectories(data []byte) (binary.ByteOrder, []uint32) {
+	if len(data) < 8 {
+		return nil, nil
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, nil
+	}
+
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:]); offset != 0 && !seen[offset]; {
+		if int64(offset)+2 > int64(len(data)) {
+			break
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+
+		next := int64(offset) + 2 + 12*int64(order.Uint16(data[offset:]))
+		if next+4 > int64(len(data)) {
+			break
+		}
+		offset = order.Uint32(data[next:])
+	}
+	return order, offsets
+}
+
+// zipPages writes rendered pages into a ZIP archive. Images are compressed
+// already, so they are stored.
+func zipPages(w io.Writer, pages []page, format string) error {
+	zw := zip.NewWriter(w)
+	for _, p := range pages {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("page-%04d.%s", p.number, format),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyFile copies a rendered page to the output
+func copyFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeOutput(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
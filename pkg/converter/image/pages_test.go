@@ -0,0 +1,117 @@
+package image
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTIFF writes an uncompressed greyscale TIFF with a page of each
+// width, 4 pixels high
+func writeTIFF(t *testing.T, widths ...int) string {
+	t.Helper()
+	const height = 4
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	next := 4 // Where the offset of the next directory goes
+	for _, width := range widths {
+		pixels := len(data)
+		data = append(data, make([]byte, width*height)...)
+
+		binary.LittleEndian.PutUint32(data[next:], uint32(len(data)))
+		entries := [][3]uint32{
+			{256, 3, uint32(width)}, // ImageWidth
+			{257, 3, height},        // ImageLength
+			{258, 3, 8},             // BitsPerSample
+			{259, 3, 1},             // No compression
+			{262, 3, 1},             // Black is zero
+			{273, 4, uint32(pixels)},
+			{277, 3, 1}, // SamplesPerPixel
+			{278, 3, height},
+			{279, 4, uint32(width * height)},
+		}
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(entries)))
+		for _, e := range entries {
+			data = binary.LittleEndian.AppendUint16(data, uint16(e[0]))
+			data = binary.LittleEndian.AppendUint16(data, uint16(e[1]))
+			data = binary.LittleEndian.AppendUint32(data, 1)
+			data = binary.LittleEndian.AppendUint32(data, e[2])
+		}
+		next = len(data)
+		data = append(data, 0, 0, 0, 0)
+	}
+
+	path := filepath.Join(t.TempDir(), "input.tiff")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestParsePageRange(t *testing.T) {
+	assert.Nil(t, parsePageRange(""))
+	assert.Equal(t, []pageRange{{1, 4}, {7, 7}}, parsePageRange("7,3-4,1-2"))
+	assert.Equal(t, []pageRange{{2, 5}}, parsePageRange("5-2"))
+	assert.Equal(t, []int{1, 2, 3}, pageNumbers(nil, 3))
+	assert.Equal(t, []int{2, 3, 5}, pageNumbers(parsePageRange("2-3,5-9"), 3))
+}
+
+func TestNativeTIFFPages(t *testing.T) {
+	c := newTestConverter(t)
+	src := writeTIFF(t, 10, 20, 30)
+	require.True(t, c.SupportsConversion("tiff", "png"))
+
+	convert := func(opts iface.Options) (string, iface.Result, error) {
+		var result iface.Result
+		ctx := iface.WithResult(context.Background(), func(r iface.Result) { result = r })
+		dest := filepath.Join(t.TempDir(), "output.png")
+		err := c.Convert(ctx, src, dest, opts)
+		return dest, result, err
+	}
+
+	// Every page, packaged as ZIP
+	dest, result, err := convert(iface.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, iface.Result{Format: "zip", Pages: 3}, result)
+
+	zr, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer zr.Close()
+	require.Len(t, zr.File, 3)
+	extracted := filepath.Join(t.TempDir(), "page.png")
+	for i, width := range []int{10, 20, 30} {
+		assert.Equal(t, []string{"page-0001.png", "page-0002.png", "page-0003.png"}[i], zr.File[i].Name)
+		r, err := zr.File[i].Open()
+		require.NoError(t, err)
+		require.NoError(t, writeOutput(extracted, func(w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		}))
+		r.Close()
+		w, _ := decodeSize(t, extracted)
+		assert.Equal(t, width, w)
+	}
+
+	// A single page as an image
+	dest, result, err = convert(iface.Options{PageRange: "2", Background: "#ffffff"})
+	require.NoError(t, err)
+	assert.Equal(t, iface.Result{Pages: 1}, result)
+	w, _ := decodeSize(t, dest)
+	assert.Equal(t, 20, w)
+
+	// Callers that do not receive the result get the first selected page
+	dest = filepath.Join(t.TempDir(), "output.png")
+	require.NoError(t, c.Convert(context.Background(), src, dest, iface.Options{PageRange: "3-5"}))
+	w, _ = decodeSize(t, dest)
+	assert.Equal(t, 30, w)
+
+	_, _, err = convert(iface.Options{PageRange: "4-5"})
+	var convErr *iface.ConversionError
+	require.ErrorAs(t, err, &convErr)
+	assert.Equal(t, "page_out_of_range", convErr.Code)
+}
@@ -0,0 +1,219 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// webpAnimationFlag marks animated WebPs in the VP8X chunk
+const webpAnimationFlag = 0x02
+
+// webpChunk is a chunk of a RIFF WebP file
+type webpChunk struct {
+	kind string
+	data []byte
+}
+
+// readWebPChunks splits chunk data of a WebP file into its chunks, which
+// are padded to an even size
+func readWebPChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for offset := 0; offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if length < 0 || length > len(data)-offset-8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunks = append(chunks, webpChunk{string(data[offset : offset+4]), data[offset+8 : offset+8+length]})
+		offset += 8 + length + length&1
+	}
+	return chunks, nil
+}
+
+// webpBody returns the chunks of a WebP file after the RIFF header
+func webpBody(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false
+	}
+	end := min(len(data), 8+int(binary.LittleEndian.Uint32(data[4:])))
+	return data[12:end], true
+}
+
+// isAnimatedWebP reports whether the VP8X chunk of a WebP flags animation
+func isAnimatedWebP(data []byte) bool {
+	body, ok := webpBody(data)
+	return ok && len(body) >= 9 && string(body[:4]) == "VP8X" && body[8]&webpAnimationFlag != 0
+}
+
+// decodeWebP reads the frames of a WebP. Each frame of an animation is
+// decoded as a WebP of its own and drawn onto the canvas as its blending
+// and disposal flags say.
+func decodeWebP(data []byte) (*animation, error) {
+	if !isAnimatedWebP(data) {
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		if err := checkCanvas(b.Dx(), b.Dy(), 1); err != nil {
+			return nil, err
+		}
+		return &animation{frames: []frame{{image: toNRGBA(img)}}}, nil
+	}
+
+	body, _ := webpBody(data)
+	chunks, err := readWebPChunks(body)
+	if err != nil {
+		return nil, err
+	}
+	vp8x := chunks[0].data
+	if len(vp8x) < 10 {
+		return nil, errors.New("invalid VP8X chunk")
+	}
+	width, height := int(uint24(vp8x[4:]))+1, int(uint24(vp8x[7:]))+1
+
+	anim := &animation{}
+	frames := 0
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "ANIM":
+			if len(chunk.data) < 6 {
+				return nil, errors.New("invalid ANIM chunk")
+			}
+			anim.loops = int(binary.LittleEndian.Uint16(chunk.data[4:]))
+		case "ANMF":
+			frames++
+		}
+	}
+	if frames == 0 {
+		return nil, errors.New("no animation frames")
+	}
+	if err := checkCanvas(width, height, frames); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for _, chunk := range chunks {
+		if chunk.kind != "ANMF" {
+			continue
+		}
+		d := chunk.data
+		if len(d) < 16 {
+			return nil, errors.New("invalid ANMF chunk")
+		}
+		x, y := 2*int(uint24(d)), 2*int(uint24(d[3:]))
+		rect := image.Rect(x, y, x+int(uint24(d[6:]))+1, y+int(uint24(d[9:]))+1)
+		if !rect.In(canvas.Rect) {
+			return nil, errors.New("frame outside of the canvas")
+		}
+		delay := time.Duration(uint24(d[12:])) * time.Millisecond
+		flags := d[15]
+
+		img, err := decodeWebPFrame(rect.Dx(), rect.Dy(), d[16:])
+		if err != nil {
+			return nil, err
+		}
+		op := draw.Over
+		if flags&0x02 != 0 { // Do not blend
+			op = draw.Src
+		}
+		draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+		anim.frames = append(anim.frames, snapshot(canvas, delay))
+
+		if flags&0x01 != 0 { // Dispose to the background
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame decodes the image chunks of an animation frame. Frames
+// with an alpha chunk need an extended header to be a valid WebP.
+func decodeWebPFrame(width, height int, data []byte) (image.Image, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	for _, chunk := range chunks {
+		if chunk.kind == "ALPH" {
+			vp8x := make([]byte, 10)
+			vp8x[0] = 0x10 // Alpha
+			putUint24(vp8x[4:], uint32(width-1))
+			putUint24(vp8x[7:], uint32(height-1))
+			writeWebPChunk(&body, "VP8X", vp8x)
+			break
+		}
+	}
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "ALPH", "VP8 ", "VP8L":
+			writeWebPChunk(&body, chunk.kind, chunk.data)
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(4+body.Len()))
+	file.WriteString("WEBP")
+	file.Write(body.Bytes())
+	return webp.Decode(&file)
+}
+
+// encodeWebPAnimation writes an animated WebP with img2webp, lossless unless
+// a quality is set
+func (c *ImageConverter) encodeWebPAnimation(ctx context.Context, outputPath string, anim *animation, opts iface.Options) error {
+	dir, err := c.CreateTempDir("frames-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := writeFrames(dir, anim)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-loop", strconv.Itoa(anim.loops)}
+	if opts.Quality > 0 {
+		args = append(args, "-lossy", "-q", strconv.Itoa(opts.Quality))
+	} else {
+		args = append(args, "-lossless")
+	}
+	for i, path := range paths {
+		args = append(args, "-d", strconv.FormatInt(anim.frames[i].delay.Milliseconds(), 10), path)
+	}
+	return runCodec(ctx, "img2webp", append(args, "-o", outputPath)...)
+}
+
+// writeWebPChunk writes a chunk with its length and padding
+func writeWebPChunk(buf *bytes.Buffer, kind string, data []byte) {
+	buf.WriteString(kind)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)&1 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
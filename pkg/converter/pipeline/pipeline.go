@@ -0,0 +1,136 @@
+// Package pipeline chains converters together through intermediate formats
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/rs/zerolog/log"
+)
+
+// Step is a single conversion in a pipeline
+type Step struct {
+	Converter    iface.Converter
+	SourceFormat string
+	TargetFormat string
+}
+
+// Pipeline runs a chain of conversions, passing each step's output to the
+// next step through a temporary file. The conversion options are applied to
+// the final step only, and only the final step reports its result, so that
+// intermediate steps write a single file of their target format. The
+// password is the exception: it is passed to every step accepting it, so an
+// encrypted input can be read, and intermediate archives are encrypted and
+// decrypted with it.
+type Pipeline struct {
+	steps   []Step
+	tempDir string
+}
+
+// New creates a Pipeline from the given steps. Intermediate files are
+// written below tempDir and removed once the conversion finishes.
+func New(tempDir string, steps ...Step) *Pipeline {
+	return &Pipeline{
+		steps:   steps,
+		tempDir: tempDir,
+	}
+}
+
+// Path returns the formats the conversion passes through, from source to target
+func (p *Pipeline) Path() []string {
+	if len(p.steps) == 0 {
+		return nil
+	}
+	path := []string{p.steps[0].SourceFormat}
+	for _, step := range p.steps {
+		path = append(path, step.TargetFormat)
+	}
+	return path
+}
+
+// Convert runs every step of the pipeline
+func (p *Pipeline) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
+	if len(p.steps) == 0 {
+		return iface.NewConversionError("invalid_pipeline", "pipeline has no steps", nil)
+	}
+
+	workDir, err := os.MkdirTemp(p.tempDir, "pipeline-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	current := inputPath
+	for i, step := range p.steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		last := i == len(p.steps)-1
+		next := outputPath
+		stepOpts := iface.Options{}
+		if opts.Password != "" && step.Converter.ValidateOptions(iface.Options{Password: opts.Password}) == nil {
+			stepOpts.Password = opts.Password
+		}
+		if last {
+			stepOpts = opts
+		} else {
+			next = filepath.Join(workDir, fmt.Sprintf("step%d.%s", i+1, step.TargetFormat))
+		}
+
+		log.Info().
+			Int("step", i+1).
+			Int("steps", len(p.steps)).
+			Str("source_format", step.SourceFormat).
+			Str("target_format", step.TargetFormat).
+			Msg("Running pipeline step")
+
+		// Scale the step's progress to the whole pipeline
+		stepNum, steps := i+1, len(p.steps)
+		stepCtx := iface.WithProgress(ctx, func(progress iface.Progress) {
+			progress.Percent = (float64(stepNum-1) + progress.Percent/100) / float64(steps) * 100
+			progress.Step, progress.Steps = stepNum, steps
+			iface.ReportProgress(ctx, progress)
+		})
+
+		if !last {
+			stepCtx = iface.WithResult(stepCtx, nil)
+		}
+
+		if err := step.Converter.Convert(stepCtx, current, next, stepOpts); err != nil {
+			return fmt.Errorf("step %d (%s to %s) failed: %w", i+1, step.SourceFormat, step.TargetFormat, err)
+		}
+		current = next
+	}
+
+	return nil
+}
+
+// SupportsConversion checks if the pipeline converts between the given formats
+func (p *Pipeline) SupportsConversion(sourceFormat, targetFormat string) bool {
+	path := p.Path()
+	return len(path) > 0 && path[0] == sourceFormat && path[len(path)-1] == targetFormat
+}
+
+// ValidateOptions checks the options against the final step's option schema
+func (p *Pipeline) ValidateOptions(opts iface.Options) error {
+	if len(p.steps) == 0 {
+		return iface.NewConversionError("invalid_pipeline", "pipeline has no steps", nil)
+	}
+	return p.steps[len(p.steps)-1].Converter.ValidateOptions(opts)
+}
+
+// Cleanup removes temporary files
+func (p *Pipeline) Cleanup(files ...string) error {
+	var lastErr error
+	for _, file := range files {
+		if err := os.RemoveAll(file); err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Failed to remove temporary file")
+			lastErr = err
+		}
+	}
+	return lastErr
+}
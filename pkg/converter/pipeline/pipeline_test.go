@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConverter copies its input and records the options of each call
+type recordingConverter struct {
+	passwords bool
+	calls     []iface.Options
+}
+
+func (c *recordingConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
+	c.calls = append(c.calls, opts)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, data, 0644)
+}
+
+func (c *recordingConverter) SupportsConversion(sourceFormat, targetFormat string) bool {
+	return true
+}
+
+func (c *recordingConverter) ValidateOptions(opts iface.Options) error {
+	if opts.Password != "" && !c.passwords {
+		return iface.NewConversionError("unsupported_option", "option \"password\" is not supported for this conversion", nil)
+	}
+	return nil
+}
+
+func (c *recordingConverter) Cleanup(files ...string) error {
+	return nil
+}
+
+func TestPipelinePassword(t *testing.T) {
+	archives := &recordingConverter{passwords: true}
+	images := &recordingConverter{}
+	p := New(t.TempDir(),
+		Step{Converter: archives, SourceFormat: "zip", TargetFormat: "7z"},
+		Step{Converter: images, SourceFormat: "7z", TargetFormat: "tar"},
+		Step{Converter: archives, SourceFormat: "tar", TargetFormat: "zip"},
+	)
+
+	src := filepath.Join(t.TempDir(), "input.zip")
+	require.NoError(t, os.WriteFile(src, []byte("archive"), 0644))
+	opts := iface.Options{Password: "s3cret", CompressionLevel: 9}
+	require.NoError(t, p.Convert(context.Background(), src, filepath.Join(t.TempDir(), "output.zip"), opts))
+
+	// Intermediate steps get the password only, if they accept it
+	require.Len(t, archives.calls, 2)
+	assert.Equal(t, iface.Options{Password: "s3cret"}, archives.calls[0])
+	assert.Equal(t, opts, archives.calls[1])
+	assert.Equal(t, []iface.Options{{}}, images.calls)
+}
@@ -0,0 +1,76 @@
+package registry
+
+// mimeTypes maps format names to their MIME types
+var mimeTypes = map[string]string{
+	// Documents
+	"pdf":  "application/pdf",
+	"doc":  "application/msword",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"rtf":  "application/rtf",
+	"txt":  "text/plain",
+	"html": "text/html",
+	"xls":  "application/vnd.ms-excel",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"csv":  "text/csv",
+	"ppt":  "application/vnd.ms-powerpoint",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odp":  "application/vnd.oasis.opendocument.presentation",
+	"epub": "application/epub+zip",
+
+	// Images
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"webp": "image/webp",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"svg":  "image/svg+xml",
+	"avif": "image/avif",
+	"jxl":  "image/jxl",
+	"ico":  "image/vnd.microsoft.icon",
+	"apng": "image/apng",
+
+	// Audio
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"ogg":  "audio/ogg",
+	"m4a":  "audio/mp4",
+	"wma":  "audio/x-ms-wma",
+
+	// Video
+	"mp4":  "video/mp4",
+	"avi":  "video/x-msvideo",
+	"mov":  "video/quicktime",
+	"mkv":  "video/x-matroska",
+	"wmv":  "video/x-ms-wmv",
+	"flv":  "video/x-flv",
+	"webm": "video/webm",
+	"3gp":  "video/3gpp",
+
+	// Archives
+	"zip":     "application/zip",
+	"tar":     "application/x-tar",
+	"tar.gz":  "application/gzip",
+	"tar.bz2": "application/x-bzip2",
+	"tar.xz":  "application/x-xz",
+	"tar.zst": "application/zstd",
+	"tar.lz4": "application/x-lz4",
+	"zst":     "application/zstd",
+	"7z":      "application/x-7z-compressed",
+	"rar":     "application/vnd.rar",
+}
+
+// MIMEType returns the MIME type of a format, or application/octet-stream if unknown
+func MIMEType(format string) string {
+	if mimeType, ok := mimeTypes[normalize(format)]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
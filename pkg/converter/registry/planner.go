@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// MaxHops is the largest number of conversions Plan chains together
+const MaxHops = 3
+
+// categoryCosts weighs each converter category by how expensive its tool is to run.
+// LibreOffice and FFmpeg video encodes are far slower than ImageMagick or audio transcodes.
+var categoryCosts = map[string]int{
+	"image":    1,
+	"audio":    1,
+	"archive":  2,
+	"video":    3,
+	"document": 4,
+}
+
+// Cost returns the planning cost of a single conversion
+func (c Conversion) Cost() int {
+	if cost, ok := categoryCosts[c.Category]; ok {
+		return cost
+	}
+	return 1
+}
+
+// Plan finds the cheapest chain of registered conversions from source to
+// target using at most MaxHops steps. A directly registered conversion is
+// returned as a single step when it is the cheapest option.
+func (r *Registry) Plan(source, target string) ([]Conversion, error) {
+	source, target = normalize(source), normalize(target)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type state struct {
+		format string
+		hops   int
+	}
+	best := map[state]int{{source, 0}: 0}
+	prev := make(map[state]struct {
+		from state
+		conv Conversion
+	})
+
+	queue := &planQueue{{format: source, cost: 0, hops: 0}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(planItem)
+		current := state{item.format, item.hops}
+		if item.cost > best[current] {
+			continue
+		}
+
+		if item.format == target && item.hops > 0 {
+			// Walk back from the target to recover the chain
+			steps := make([]Conversion, item.hops)
+			for s := current; s.hops > 0; {
+				p := prev[s]
+				steps[s.hops-1] = p.conv
+				s = p.from
+			}
+			return steps, nil
+		}
+
+		if item.hops == MaxHops {
+			continue
+		}
+
+		for _, conv := range sortedConversions(r.conversions[item.format]) {
+			next := state{conv.Target, item.hops + 1}
+			cost := item.cost + conv.Cost()
+			if known, ok := best[next]; ok && known <= cost {
+				continue
+			}
+			best[next] = cost
+			prev[next] = struct {
+				from state
+				conv Conversion
+			}{current, conv}
+			heap.Push(queue, planItem{format: conv.Target, cost: cost, hops: next.hops})
+		}
+	}
+
+	return nil, fmt.Errorf("no conversion path found from %s to %s", source, target)
+}
+
+// Bottleneck returns the most expensive step of a plan. Its category decides
+// which worker pool a multi-hop conversion is scheduled on.
+func Bottleneck(plan []Conversion) Conversion {
+	var slowest Conversion
+	for i, conv := range plan {
+		if i == 0 || conv.Cost() > slowest.Cost() {
+			slowest = conv
+		}
+	}
+	return slowest
+}
+
+// sortedConversions returns the conversions of one source in target order so planning is deterministic
+func sortedConversions(targets map[string]Conversion) []Conversion {
+	set := make(map[string]bool, len(targets))
+	for target := range targets {
+		set[target] = true
+	}
+	convs := make([]Conversion, 0, len(targets))
+	for _, target := range sortedKeys(set) {
+		convs = append(convs, targets[target])
+	}
+	return convs
+}
+
+// planItem is a format reached during planning
+type planItem struct {
+	format string
+	cost   int
+	hops   int
+}
+
+// planQueue is a min-heap of plan items ordered by cost, then hop count
+type planQueue []planItem
+
+func (q planQueue) Len() int { return len(q) }
+
+func (q planQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	return q[i].hops < q[j].hops
+}
+
+func (q planQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *planQueue) Push(x interface{}) { *q = append(*q, x.(planItem)) }
+
+func (q *planQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	r := New()
+	r.Register("video", "ffmpeg", "mp4", "wav", "webm")
+	r.Register("audio", "ffmpeg", "wav", "mp3")
+	r.Register("document", "libreoffice", "pptx", "pdf")
+	r.Register("document", "libreoffice", "docx", "pdf", "epub")
+	r.Register("image", "imagemagick", "pdf", "png")
+
+	formats := func(steps []Conversion) []string {
+		path := []string{steps[0].Source}
+		for _, step := range steps {
+			path = append(path, step.Target)
+		}
+		return path
+	}
+
+	t.Run("direct conversion", func(t *testing.T) {
+		steps, err := r.Plan("docx", "epub")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"docx", "epub"}, formats(steps))
+	})
+
+	t.Run("through an intermediate format", func(t *testing.T) {
+		steps, err := r.Plan("mp4", "mp3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mp4", "wav", "mp3"}, formats(steps))
+
+		steps, err = r.Plan("PPTX", "png")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pptx", "pdf", "png"}, formats(steps))
+		assert.Equal(t, "document", steps[0].Category)
+		assert.Equal(t, "image", steps[1].Category)
+		assert.Equal(t, "document", Bottleneck(steps).Category)
+	})
+
+	t.Run("no path", func(t *testing.T) {
+		_, err := r.Plan("mp3", "pdf")
+		assert.Error(t, err)
+
+		_, err = r.Plan("png", "png")
+		assert.Error(t, err)
+	})
+}
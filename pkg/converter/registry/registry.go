@@ -0,0 +1,206 @@
+// Package registry keeps track of the conversions every converter supports
+package registry
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Conversion describes a single supported source → target conversion
+type Conversion struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Category string `json:"category"`
+	Tool     string `json:"tool"`
+}
+
+// ToolChecker reports whether an external tool is installed
+type ToolChecker interface {
+	IsAvailable(tool string) bool
+}
+
+// TargetInfo describes a conversion target of a format in the catalog
+type TargetInfo struct {
+	Format    string `json:"format"`
+	Tool      string `json:"tool"`
+	Available bool   `json:"available"`
+}
+
+// FormatInfo describes a format in the catalog
+type FormatInfo struct {
+	Name     string       `json:"name"`
+	MIMEType string       `json:"mime_type"`
+	Category string       `json:"category"`
+	Targets  []TargetInfo `json:"targets,omitempty"`
+}
+
+// CategoryInfo groups the formats of one converter category
+type CategoryInfo struct {
+	Input   []string     `json:"input"`
+	Output  []string     `json:"output"`
+	Formats []FormatInfo `json:"formats"`
+}
+
+// Registry holds the conversions registered by the converters
+type Registry struct {
+	mu          sync.RWMutex
+	conversions map[string]map[string]Conversion // map[source]map[target]Conversion
+}
+
+var defaultRegistry = New()
+
+// Default returns the process-wide registry converters register into
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// New creates an empty Registry
+func New() *Registry {
+	return &Registry{
+		conversions: make(map[string]map[string]Conversion),
+	}
+}
+
+// Register records that the tool of the given category converts source into each target.
+// Registering the same conversion again replaces the previous entry.
+func (r *Registry) Register(category, tool, source string, targets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source = normalize(source)
+	if r.conversions[source] == nil {
+		r.conversions[source] = make(map[string]Conversion)
+	}
+	for _, target := range targets {
+		target = normalize(target)
+		r.conversions[source][target] = Conversion{
+			Source:   source,
+			Target:   target,
+			Category: category,
+			Tool:     tool,
+		}
+	}
+}
+
+// Lookup returns the registered conversion from source to target
+func (r *Registry) Lookup(source, target string) (Conversion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conv, ok := r.conversions[normalize(source)][normalize(target)]
+	return conv, ok
+}
+
+// Conversions returns every registered conversion sorted by source and target
+func (r *Registry) Conversions() []Conversion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var all []Conversion
+	for _, targets := range r.conversions {
+		for _, conv := range targets {
+			all = append(all, conv)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Source != all[j].Source {
+			return all[i].Source < all[j].Source
+		}
+		return all[i].Target < all[j].Target
+	})
+	return all
+}
+
+// SupportedFormats returns a map of source formats to their sorted target formats
+func (r *Registry) SupportedFormats() map[string][]string {
+	formats := make(map[string][]string)
+	for _, conv := range r.Conversions() {
+		formats[conv.Source] = append(formats[conv.Source], conv.Target)
+	}
+	return formats
+}
+
+// Catalog describes every registered format grouped by category. Tool
+// availability is checked with the given checker at call time; a nil checker
+// reports every tool as unavailable. Conversions without a tool are built in
+// and always available.
+func (r *Registry) Catalog(checker ToolChecker) map[string]CategoryInfo {
+	available := make(map[string]bool)
+	isAvailable := func(tool string) bool {
+		if ok, checked := available[tool]; checked {
+			return ok
+		}
+		ok := tool == "" || checker != nil && checker.IsAvailable(tool)
+		available[tool] = ok
+		return ok
+	}
+
+	type formatKey struct{ category, name string }
+	formats := make(map[formatKey]*FormatInfo)
+	inputs := make(map[string]map[string]bool)
+	outputs := make(map[string]map[string]bool)
+
+	getFormat := func(category, name string) *FormatInfo {
+		key := formatKey{category, name}
+		if formats[key] == nil {
+			formats[key] = &FormatInfo{
+				Name:     name,
+				MIMEType: MIMEType(name),
+				Category: category,
+			}
+		}
+		return formats[key]
+	}
+
+	for _, conv := range r.Conversions() {
+		if inputs[conv.Category] == nil {
+			inputs[conv.Category] = make(map[string]bool)
+			outputs[conv.Category] = make(map[string]bool)
+		}
+		inputs[conv.Category][conv.Source] = true
+		outputs[conv.Category][conv.Target] = true
+
+		source := getFormat(conv.Category, conv.Source)
+		source.Targets = append(source.Targets, TargetInfo{
+			Format:    conv.Target,
+			Tool:      conv.Tool,
+			Available: isAvailable(conv.Tool),
+		})
+		getFormat(conv.Category, conv.Target)
+	}
+
+	catalog := make(map[string]CategoryInfo)
+	for category := range inputs {
+		info := CategoryInfo{
+			Input:  sortedKeys(inputs[category]),
+			Output: sortedKeys(outputs[category]),
+		}
+		for key, format := range formats {
+			if key.category == category {
+				info.Formats = append(info.Formats, *format)
+			}
+		}
+		sort.Slice(info.Formats, func(i, j int) bool {
+			return info.Formats[i].Name < info.Formats[j].Name
+		})
+		catalog[category] = info
+	}
+
+	return catalog
+}
+
+// normalize lowercases a format and strips any leading dot
+func normalize(format string) string {
+	return strings.ToLower(strings.TrimPrefix(format, "."))
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
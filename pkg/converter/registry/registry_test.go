@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChecker reports the tools in the set as installed
+type fakeChecker map[string]bool
+
+func (f fakeChecker) IsAvailable(tool string) bool {
+	return f[tool]
+}
+
+func TestRegistry(t *testing.T) {
+	r := New()
+	r.Register("image", "imagemagick", "png", "jpg", "webp")
+	r.Register("image", "imagemagick", "jpg", "png")
+	r.Register("video", "ffmpeg", "mp4", "gif", "webm")
+	r.Register("archive", "", "zip", "tar")
+
+	t.Run("Lookup", func(t *testing.T) {
+		conv, ok := r.Lookup(".PNG", "jpg")
+		require.True(t, ok)
+		assert.Equal(t, "image", conv.Category)
+		assert.Equal(t, "imagemagick", conv.Tool)
+
+		_, ok = r.Lookup("png", "mp3")
+		assert.False(t, ok)
+	})
+
+	t.Run("Register is idempotent", func(t *testing.T) {
+		r.Register("image", "imagemagick", "jpg", "png")
+		assert.Equal(t, []string{"png"}, r.SupportedFormats()["jpg"])
+	})
+
+	t.Run("Catalog", func(t *testing.T) {
+		catalog := r.Catalog(fakeChecker{"imagemagick": true})
+
+		image := catalog["image"]
+		assert.Equal(t, []string{"jpg", "png"}, image.Input)
+		assert.Equal(t, []string{"jpg", "png", "webp"}, image.Output)
+
+		require.NotEmpty(t, image.Formats)
+		png := image.Formats[1]
+		assert.Equal(t, "png", png.Name)
+		assert.Equal(t, "image/png", png.MIMEType)
+		assert.Equal(t, []TargetInfo{
+			{Format: "jpg", Tool: "imagemagick", Available: true},
+			{Format: "webp", Tool: "imagemagick", Available: true},
+		}, png.Targets)
+
+		video := catalog["video"]
+		require.Len(t, video.Formats, 3)
+		assert.False(t, video.Formats[1].Targets[0].Available, "ffmpeg is not installed")
+
+		archive := catalog["archive"]
+		require.Len(t, archive.Formats, 2)
+		assert.Equal(t, []TargetInfo{{Format: "tar", Available: true}}, archive.Formats[1].Targets, "built in")
+	})
+}
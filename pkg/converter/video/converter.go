@@ -3,8 +3,8 @@ package video
 import (
 	"context"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/amannvl/freefileconverterz/internal/tools"
@@ -27,6 +27,7 @@ func NewVideoConverter(toolManager *tools.ToolManager, tempDir string) iface.Con
 	}
 
 	// Register supported formats and conversions
+	converter.SetCategory("video", "ffmpeg")
 	converter.AddSupportedConversion("mp4", "avi", "mov", "mkv", "wmv", "flv", "webm", "3gp", "gif")
 	converter.AddSupportedConversion("avi", "mp4", "mov", "mkv", "wmv", "flv", "webm", "3gp")
 	converter.AddSupportedConversion("mov", "mp4", "avi", "mkv", "wmv", "flv", "webm", "3gp")
@@ -36,11 +37,19 @@ func NewVideoConverter(toolManager *tools.ToolManager, tempDir string) iface.Con
 	converter.AddSupportedConversion("webm", "mp4", "avi", "mov", "mkv", "wmv", "flv", "3gp")
 	converter.AddSupportedConversion("3gp", "mp4", "avi", "mov", "mkv", "wmv", "flv", "webm")
 
+	// Extract the audio track as WAV so the audio converter can take over (e.g. mp4 → wav → mp3)
+	for _, source := range []string{"mp4", "avi", "mov", "mkv", "wmv", "flv", "webm", "3gp"} {
+		converter.AddSupportedConversion(source, "wav")
+	}
+
+	// Register supported options
+	converter.SetOptionSchema(iface.OptionCRF, iface.OptionResolution, iface.OptionAudioBitrate)
+
 	return converter
 }
 
 // Convert converts a video file from one format to another
-func (c *VideoConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+func (c *VideoConverter) Convert(ctx context.Context, inputPath, outputPath string, opts iface.Options) error {
 	// Get the file extension to determine the target format
 	extension := filepath.Ext(outputPath)
 	if len(extension) == 0 {
@@ -75,9 +84,11 @@ func (c *VideoConverter) Convert(ctx context.Context, inputPath, outputPath stri
 		"-i", inputPath,
 	}
 
-	// Add video codec for the target format
+	// Add video codec for the target format, or drop the video stream for audio-only output
 	videoCodec := c.getVideoCodecForFormat(targetFormat)
-	if videoCodec != "" {
+	if isAudioFormat(targetFormat) {
+		args = append(args, "-vn")
+	} else if videoCodec != "" {
 		args = append(args, "-c:v", videoCodec)
 	}
 
@@ -87,12 +98,24 @@ func (c *VideoConverter) Convert(ctx context.Context, inputPath, outputPath stri
 		args = append(args, "-c:a", audioCodec)
 	}
 
-	// Add output file
+	// Add quality, size and bitrate if requested
+	if opts.CRF != nil {
+		args = append(args, "-crf", strconv.Itoa(*opts.CRF))
+	}
+	if opts.Resolution != "" {
+		args = append(args, "-vf", "scale="+strings.Replace(opts.Resolution, "x", ":", 1))
+	}
+	if opts.AudioBitrate != "" && audioCodec != "none" {
+		args = append(args, "-b:a", opts.AudioBitrate)
+	}
+
+	// Report progress, then add the output file
+	args = append(args, base.FFmpegProgressArgs...)
 	args = append(args, outputPath)
 
 	// Execute FFmpeg
-	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
-	output, err := cmd.CombinedOutput()
+	cmd := tools.CommandContext(ctx, ffmpegPath, args...)
+	output, err := base.RunFFmpeg(ctx, cmd)
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -152,12 +175,19 @@ func (c *VideoConverter) getAudioCodecForFormat(format string) string {
 	case "gif":
 		// GIF doesn't support audio
 		return "none"
+	case "wav":
+		return "pcm_s16le"
 	default:
 		// Let FFmpeg choose the default codec
 		return "aac"
 	}
 }
 
+// isAudioFormat reports whether the target format only carries audio
+func isAudioFormat(format string) bool {
+	return strings.ToLower(format) == "wav"
+}
+
 // Cleanup removes temporary files created during conversion
 func (c *VideoConverter) Cleanup(files ...string) error {
 	var lastErr error
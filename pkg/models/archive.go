@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/amannvl/freefileconverterz/pkg/converter/archive"
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// ArchiveEntriesResponse lists the entries of a stored archive
+type ArchiveEntriesResponse struct {
+	Key     string          `json:"key"`
+	Format  string          `json:"format"`
+	Entries []archive.Entry `json:"entries"`
+}
+
+// ArchiveExtractRequest picks the entries extracted from a stored archive
+type ArchiveExtractRequest struct {
+	Entries  []string `json:"entries"`            // Entry names, a directory picks everything below it; every entry if empty
+	Format   string   `json:"format,omitempty"`   // Archive format the entries are packed into, stored as individual files if empty
+	Password string   `json:"password,omitempty"` // Decrypts the archive and encrypts a new ZIP or 7z archive
+
+	CompressionLevel int   `json:"compression_level,omitempty"` // 1 (fastest) to 9 (smallest), needs a format
+	VolumeSize       int64 `json:"volume_size,omitempty"`       // Splits a new ZIP or 7z archive into volumes of this many bytes
+}
+
+// Options returns the conversion options the request sets
+func (r ArchiveExtractRequest) Options() iface.Options {
+	return iface.Options{Password: r.Password, CompressionLevel: r.CompressionLevel, VolumeSize: r.VolumeSize}
+}
+
+// ArchiveOutput is a file stored by an archive extraction
+type ArchiveOutput struct {
+	Name        string `json:"name"`
+	Key         string `json:"key"` // Storage key, accepted as "key" by the conversion endpoints
+	Size        int64  `json:"size"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// ArchiveExtractResponse lists the files stored by an archive extraction
+type ArchiveExtractResponse struct {
+	ID      string          `json:"id"`
+	Outputs []ArchiveOutput `json:"outputs"`
+}
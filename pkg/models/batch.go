@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
+)
+
+// Batch groups conversions that were submitted together
+type Batch struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	ConversionIDs []string  `json:"conversion_ids"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BatchItem describes one conversion of a batch request. Items without a key
+// or source URL take the uploaded files in order.
+type BatchItem struct {
+	Key       string        `json:"key,omitempty"`        // Storage key of a stored file to convert instead of an upload
+	SourceURL string        `json:"source_url,omitempty"` // URL of a remote file to convert instead of an upload
+	Format  string        `json:"format"`
+	Options iface.Options `json:"options"`
+}
+
+// BatchRequest represents a batch conversion request
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchProgress aggregates the state of the conversions of a batch
+type BatchProgress struct {
+	Total      int     `json:"total"`
+	Pending    int     `json:"pending"`
+	Processing int     `json:"processing"`
+	Completed  int     `json:"completed"`
+	Failed     int     `json:"failed"`
+	Cancelled  int     `json:"cancelled"`
+	Percent    float64 `json:"percent"`
+}
+
+// Add counts a conversion that has made percent progress
+func (p *BatchProgress) Add(status ConversionStatus, percent float64) {
+	switch status {
+	case StatusPending:
+		p.Pending++
+		percent = 0
+	case StatusProcessing:
+		p.Processing++
+	case StatusCompleted:
+		p.Completed++
+		percent = 100
+	case StatusFailed:
+		p.Failed++
+		percent = 100
+	case StatusCancelled:
+		p.Cancelled++
+		percent = 100
+	}
+	// Keep a running mean over all conversions
+	p.Total++
+	p.Percent += (percent - p.Percent) / float64(p.Total)
+}
+
+// Finished reports whether every conversion of the batch is final
+func (p BatchProgress) Finished() bool {
+	return p.Pending == 0 && p.Processing == 0
+}
+
+// Status derives the batch status. A finished batch is completed when at
+// least one of its conversions succeeded.
+func (p BatchProgress) Status() ConversionStatus {
+	switch {
+	case p.Pending == p.Total:
+		return StatusPending
+	case !p.Finished():
+		return StatusProcessing
+	case p.Completed > 0:
+		return StatusCompleted
+	case p.Failed > 0:
+		return StatusFailed
+	default:
+		return StatusCancelled
+	}
+}
+
+// BatchResponse represents a batch with the state of its conversions
+type BatchResponse struct {
+	Batch
+	Status      ConversionStatus `json:"status"`
+	Progress    BatchProgress    `json:"progress"`
+	Conversions []*Conversion    `json:"conversions"`
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/amannvl/freefileconverterz/pkg/converter/iface"
 )
 
 // ConversionStatus represents the status of a conversion task
@@ -12,28 +14,91 @@ const (
 	StatusProcessing ConversionStatus = "processing"
 	StatusCompleted  ConversionStatus = "completed"
 	StatusFailed     ConversionStatus = "failed"
+	StatusCancelled  ConversionStatus = "cancelled"
 )
 
+// IsFinal reports whether a conversion in this status will not change anymore
+func (s ConversionStatus) IsFinal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// StatusTransition records when a conversion entered a status
+type StatusTransition struct {
+	Status ConversionStatus `json:"status"`
+	At     time.Time        `json:"at"`
+}
+
+// WebhookDelivery records one attempt to deliver a callback
+type WebhookDelivery struct {
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	At         time.Time `json:"at"`
+}
+
 // Conversion represents a file conversion task
 type Conversion struct {
 	ID           string          `json:"id"`
 	UserID       string          `json:"user_id"`
+	BatchID      string          `json:"batch_id,omitempty"`
 	SourceFileID string          `json:"source_file_id"`
 	Status       ConversionStatus `json:"status"`
 	SourceFormat string          `json:"source_format"`
 	TargetFormat string          `json:"target_format"`
-	Options      map[string]interface{} `json:"options"`
+	Options      iface.Options   `json:"options"`
+	Path         []string        `json:"path,omitempty"`
+	OriginalName string          `json:"original_name"`
+	SourceURL    string          `json:"source_url,omitempty"`
+	FileSize     int64           `json:"file_size"`
+	OutputKey    string          `json:"output_key,omitempty"`
+	OutputFormat string          `json:"output_format,omitempty"` // Format of the output when it is not the target format, e.g. zip for several pages
+	Pages        int             `json:"pages,omitempty"`         // Pages of the output, for documents rendered to images
+	Cached       bool            `json:"cached,omitempty"` // The output was reused from an identical conversion
 	Error        string          `json:"error,omitempty"`
+	ErrorCode    string          `json:"error_code,omitempty"` // Code of the converter error a conversion failed with, e.g. archive_path_traversal
 	DownloadURL  string          `json:"download_url,omitempty"`
+	QueuePosition int            `json:"queue_position,omitempty"` // Filled in when the status is read
+	CallbackURL  string          `json:"callback_url,omitempty"`
+	APIKeyID     string          `json:"api_key_id,omitempty"` // Identifies the API key whose secret signs callbacks
+	Transitions  []StatusTransition `json:"transitions,omitempty"`
+	Deliveries   []WebhookDelivery  `json:"webhook_deliveries,omitempty"`
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
+	StartedAt    *time.Time      `json:"started_at,omitempty"`
+	CompletedAt  *time.Time      `json:"completed_at,omitempty"`
+}
+
+// SetStatus moves the conversion to a new status and records the transition
+func (c *Conversion) SetStatus(status ConversionStatus, at time.Time) {
+	c.Status = status
+	c.UpdatedAt = at
+	c.Transitions = append(c.Transitions, StatusTransition{Status: status, At: at})
+
+	switch status {
+	case StatusProcessing:
+		c.StartedAt = &at
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		c.CompletedAt = &at
+	}
+}
+
+// ResultFormat returns the format of the output, the target format unless
+// the converter packaged the output otherwise
+func (c *Conversion) ResultFormat() string {
+	if c.OutputFormat != "" {
+		return c.OutputFormat
+	}
+	return c.TargetFormat
 }
 
 // ConversionRequest represents a conversion request
 type ConversionRequest struct {
 	SourceFileID string                 `json:"source_file_id" validate:"required"`
 	TargetFormat string                 `json:"target_format" validate:"required"`
-	Options      map[string]interface{} `json:"options"`
+	Options      iface.Options          `json:"options"`
 }
 
 // ConversionResponse represents the response for a conversion request